@@ -3,3 +3,10 @@ package api
 import "time"
 
 const defaultContextTimeout = 120 * time.Second
+
+// routingActionTimeout covers draining and stopping containers when a canary or a deployment
+// waiting for promotion is promoted, or a canary is aborted.
+const routingActionTimeout = 15 * time.Minute
+
+// deployQueueTimeout is the longest a deployment waits for earlier deployments of its app.
+const deployQueueTimeout = 30 * time.Minute
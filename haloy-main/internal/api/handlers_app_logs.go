@@ -0,0 +1,256 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	timetypes "github.com/docker/docker/api/types/time"
+	"github.com/docker/docker/client"
+	"github.com/haloydev/haloy/internal/apitypes"
+	"github.com/haloydev/haloy/internal/config"
+	"github.com/haloydev/haloy/internal/docker"
+	"github.com/haloydev/haloy/internal/helpers"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	// defaultAppLogTail is how many lines are shown from the end of each container's log
+	// unless the request asks for more.
+	defaultAppLogTail = "100"
+	// maxAppLogEntries caps the lines returned without following the logs, the newest are kept.
+	maxAppLogEntries = 10000
+)
+
+// appLogSource is a container whose log is streamed, with the name its lines are shown with.
+type appLogSource struct {
+	containerID string
+	replica     string
+}
+
+// handleAppLogs streams what the running containers of an app printed as SSE, merged across
+// replicas. The query parameters are those of docker logs: follow, since, until and tail, plus
+// replica to pick one and stderr=false to leave out stderr. Tail defaults to 100 lines per
+// container, and without follow at most maxAppLogEntries lines are returned.
+func (s *APIServer) handleAppLogs() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		appName := r.PathValue("appName")
+		query := r.URL.Query()
+
+		follow := query.Get("follow") == "true"
+		options := container.LogsOptions{
+			ShowStderr: query.Get("stderr") != "false",
+			Follow:     follow,
+			Since:      query.Get("since"),
+			Until:      query.Get("until"),
+			Tail:       query.Get("tail"),
+		}
+		for name, value := range map[string]string{"since": options.Since, "until": options.Until} {
+			if value == "" {
+				continue
+			}
+			if _, err := timetypes.GetTimestamp(value, time.Now()); err != nil {
+				http.Error(w, fmt.Sprintf("Invalid %s '%s': expected a duration like 10m or a timestamp", name, value), http.StatusBadRequest)
+				return
+			}
+		}
+		if options.Tail == "" {
+			options.Tail = defaultAppLogTail
+		} else if n, err := strconv.Atoi(options.Tail); options.Tail != "all" && (err != nil || n < 0) {
+			http.Error(w, fmt.Sprintf("Invalid tail '%s': expected a number of lines or all", options.Tail), http.StatusBadRequest)
+			return
+		}
+		replica := 0
+		if value := query.Get("replica"); value != "" {
+			var err error
+			if replica, err = strconv.Atoi(value); err != nil || replica < 1 {
+				http.Error(w, fmt.Sprintf("Invalid replica '%s'", value), http.StatusBadRequest)
+				return
+			}
+		}
+
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+
+		cli, err := docker.NewClient(ctx)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer cli.Close()
+
+		containerList, err := docker.GetAppContainers(ctx, cli, false, appName)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if replica != 0 {
+			containerList = slices.DeleteFunc(containerList, func(c container.Summary) bool {
+				return docker.ReplicaID(c) != replica
+			})
+		}
+		if len(containerList) == 0 {
+			http.Error(w, fmt.Sprintf("No running containers found for app %s", appName), http.StatusNotFound)
+			return
+		}
+		sources := appLogSources(containerList)
+
+		if follow {
+			followAppLogs(ctx, w, cli, sources, options)
+			return
+		}
+
+		ctx, cancelTimeout := context.WithTimeout(ctx, defaultContextTimeout)
+		defer cancelTimeout()
+		entries, err := readAppLogs(ctx, cli, sources, options)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for _, entry := range entries {
+			if err := writeSSEMessage(w, entry); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// appLogSources names the containers after their replica, and their deployment if more than
+// one is running, like during a canary.
+func appLogSources(containerList []container.Summary) []appLogSource {
+	deployments := make(map[string]bool)
+	for _, c := range containerList {
+		deployments[c.Labels[config.LabelDeploymentID]] = true
+	}
+
+	sources := make([]appLogSource, 0, len(containerList))
+	for _, c := range containerList {
+		replica := fmt.Sprintf("replica-%d", docker.ReplicaID(c))
+		if deploymentID := c.Labels[config.LabelDeploymentID]; len(deployments) > 1 {
+			replica = fmt.Sprintf("%s/%s", deploymentID[:min(8, len(deploymentID))], replica)
+		}
+		sources = append(sources, appLogSource{containerID: c.ID, replica: replica})
+	}
+	slices.SortFunc(sources, func(a, b appLogSource) int {
+		return strings.Compare(a.replica, b.replica)
+	})
+	return sources
+}
+
+// readAppLogs reads the logs of all sources and merges them in the order they were printed.
+// Only the newest maxAppLogEntries lines are kept, of each source while reading and of them
+// all once merged.
+func readAppLogs(ctx context.Context, cli *client.Client, sources []appLogSource, options container.LogsOptions) ([]apitypes.AppLogEntry, error) {
+	sourceEntries := make([][]apitypes.AppLogEntry, len(sources))
+	g, ctx := errgroup.WithContext(ctx)
+	for i, source := range sources {
+		g.Go(func() error {
+			return docker.StreamContainerLogs(ctx, cli, source.containerID, options, func(line docker.ContainerLogLine) error {
+				sourceEntries[i] = appendNewest(sourceEntries[i], newAppLogEntry(source, line), maxAppLogEntries)
+				return nil
+			})
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	return mergeAppLogs(sourceEntries, maxAppLogEntries), nil
+}
+
+// appendNewest appends entry and drops the oldest entries beyond limit. Entries are only
+// moved once the slice holds twice the limit.
+func appendNewest(entries []apitypes.AppLogEntry, entry apitypes.AppLogEntry, limit int) []apitypes.AppLogEntry {
+	entries = append(entries, entry)
+	if len(entries) >= 2*limit {
+		entries = append(entries[:0], entries[len(entries)-limit:]...)
+	}
+	return entries
+}
+
+// mergeAppLogs merges the entries of the sources by time and keeps the newest limit of them.
+func mergeAppLogs(sourceEntries [][]apitypes.AppLogEntry, limit int) []apitypes.AppLogEntry {
+	var entries []apitypes.AppLogEntry
+	for _, source := range sourceEntries {
+		entries = append(entries, source...)
+	}
+	slices.SortStableFunc(entries, func(a, b apitypes.AppLogEntry) int {
+		return a.Timestamp.Compare(b.Timestamp)
+	})
+	if len(entries) > limit {
+		entries = entries[len(entries)-limit:]
+	}
+	return entries
+}
+
+// followAppLogs sends lines as the containers print them, until they stop or the client leaves.
+func followAppLogs(ctx context.Context, w http.ResponseWriter, cli *client.Client, sources []appLogSource, options container.LogsOptions) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	if _, err := w.Write([]byte(": keepalive\n\n")); err != nil {
+		return
+	}
+	flusher.Flush()
+
+	entries := make(chan apitypes.AppLogEntry, 64)
+	var wg sync.WaitGroup
+	for _, source := range sources {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// A container that stops, or whose log can't be read, just ends its part of the stream.
+			_ = docker.StreamContainerLogs(ctx, cli, source.containerID, options, func(line docker.ContainerLogLine) error {
+				select {
+				case entries <- newAppLogEntry(source, line):
+					return nil
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			})
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(entries)
+	}()
+
+	keepaliveTicker := time.NewTicker(30 * time.Second)
+	defer keepaliveTicker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-keepaliveTicker.C:
+			if _, err := w.Write([]byte(": keepalive\n\n")); err != nil {
+				return
+			}
+			flusher.Flush()
+		case entry, ok := <-entries:
+			if !ok {
+				return
+			}
+			if err := writeSSEMessage(w, entry); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+func newAppLogEntry(source appLogSource, line docker.ContainerLogLine) apitypes.AppLogEntry {
+	return apitypes.AppLogEntry{
+		Timestamp:   line.Timestamp,
+		Replica:     source.replica,
+		ContainerID: helpers.SafeIDPrefix(source.containerID),
+		Stream:      line.Stream,
+		Line:        line.Line,
+	}
+}
@@ -0,0 +1,110 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/haloydev/haloy/internal/apitypes"
+	"github.com/haloydev/haloy/internal/config"
+)
+
+func appContainer(id, deploymentID, name string) container.Summary {
+	return container.Summary{
+		ID:     id,
+		Names:  []string{name},
+		Labels: map[string]string{config.LabelDeploymentID: deploymentID},
+	}
+}
+
+func TestAppLogSources(t *testing.T) {
+	tests := []struct {
+		name       string
+		containers []container.Summary
+		want       []appLogSource
+	}{
+		{
+			name:       "single replica",
+			containers: []container.Summary{appContainer("c1", "20250101120000", "/app-20250101120000")},
+			want:       []appLogSource{{containerID: "c1", replica: "replica-1"}},
+		},
+		{
+			name: "sorted by replica",
+			containers: []container.Summary{
+				appContainer("c2", "20250101120000", "/app-20250101120000-replica-2"),
+				appContainer("c1", "20250101120000", "/app-20250101120000-replica-1"),
+			},
+			want: []appLogSource{{containerID: "c1", replica: "replica-1"}, {containerID: "c2", replica: "replica-2"}},
+		},
+		{
+			name: "several deployments",
+			containers: []container.Summary{
+				appContainer("c2", "20250102120000", "/app-20250102120000"),
+				appContainer("c1", "20250101120000", "/app-20250101120000"),
+			},
+			want: []appLogSource{{containerID: "c1", replica: "20250101/replica-1"}, {containerID: "c2", replica: "20250102/replica-1"}},
+		},
+		{
+			name: "short deployment ID",
+			containers: []container.Summary{
+				appContainer("c2", "abcdefghijk", "/app-abcdefghijk"),
+				appContainer("c1", "abc", "/app-abc"),
+			},
+			want: []appLogSource{{containerID: "c1", replica: "abc/replica-1"}, {containerID: "c2", replica: "abcdefgh/replica-1"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := appLogSources(tt.containers)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("source %d is %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestMergeAppLogs(t *testing.T) {
+	base := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	entry := func(replica string, second int) apitypes.AppLogEntry {
+		return apitypes.AppLogEntry{Timestamp: base.Add(time.Duration(second) * time.Second), Replica: replica}
+	}
+
+	var first, second []apitypes.AppLogEntry
+	for i := range 5 {
+		first = appendNewest(first, entry("replica-1", 2*i), 3)
+		second = appendNewest(second, entry("replica-2", 2*i+1), 3)
+	}
+
+	got := mergeAppLogs([][]apitypes.AppLogEntry{first, second}, 4)
+	want := []apitypes.AppLogEntry{entry("replica-1", 6), entry("replica-2", 7), entry("replica-1", 8), entry("replica-2", 9)}
+	if len(got) != len(want) {
+		t.Fatalf("got %d entries, want %d", len(got), len(want))
+	}
+	for i := range got {
+		if !got[i].Timestamp.Equal(want[i].Timestamp) || got[i].Replica != want[i].Replica {
+			t.Errorf("entry %d is %s at %s, want %s at %s", i, got[i].Replica, got[i].Timestamp, want[i].Replica, want[i].Timestamp)
+		}
+	}
+}
+
+func TestAppendNewest(t *testing.T) {
+	var entries []apitypes.AppLogEntry
+	for i := range 10 {
+		entries = appendNewest(entries, apitypes.AppLogEntry{Line: string(rune('a' + i))}, 3)
+		if len(entries) >= 6 {
+			t.Fatalf("holds %d entries, want fewer than twice the limit", len(entries))
+		}
+	}
+	// The caller trims to the limit when merging, the newest are at the end.
+	if last := entries[len(entries)-1].Line; last != "j" {
+		t.Errorf("newest entry is %q, want j", last)
+	}
+	if len(entries) < 3 {
+		t.Errorf("holds %d entries, want at least the limit", len(entries))
+	}
+}
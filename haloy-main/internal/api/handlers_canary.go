@@ -0,0 +1,152 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/haloydev/haloy/internal/apitypes"
+	"github.com/haloydev/haloy/internal/logging"
+	"github.com/haloydev/haloy/internal/storage"
+)
+
+func (s *APIServer) handleCanaryStatus() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		appName := r.PathValue("appName")
+		if appName == "" {
+			http.Error(w, "App name is required", http.StatusBadRequest)
+			return
+		}
+
+		canary, ok := s.getCanary(w, appName)
+		if !ok {
+			return
+		}
+
+		encodeJSON(w, http.StatusOK, canaryStatusResponse(canary))
+	}
+}
+
+func (s *APIServer) handleCanaryWeight() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		appName := r.PathValue("appName")
+		if appName == "" {
+			http.Error(w, "App name is required", http.StatusBadRequest)
+			return
+		}
+
+		var req apitypes.CanaryWeightRequest
+		if err := decodeJSON(r.Body, &req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if req.Weight < 0 || req.Weight > 100 {
+			http.Error(w, "Weight must be between 0 and 100", http.StatusBadRequest)
+			return
+		}
+
+		if s.routing == nil {
+			http.Error(w, "Canary deployments are not available", http.StatusServiceUnavailable)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), defaultContextTimeout)
+		defer cancel()
+
+		logger := logging.NewLogger(s.logLevel, s.logBroker)
+		canary, err := s.routing.SetCanaryWeight(ctx, logger, appName, req.Weight)
+		if err != nil {
+			if errors.Is(err, storage.ErrCanaryNotFound) {
+				http.Error(w, "No canary in progress for the specified app", http.StatusNotFound)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		encodeJSON(w, http.StatusOK, canaryStatusResponse(canary))
+	}
+}
+
+func (s *APIServer) handleCanaryPromote() http.HandlerFunc {
+	return s.canaryActionHandler("promote", func(ctx context.Context, logger *slog.Logger, appName string) error {
+		return s.routing.PromoteCanary(ctx, logger, appName)
+	})
+}
+
+func (s *APIServer) handleCanaryAbort() http.HandlerFunc {
+	return s.canaryActionHandler("abort", func(ctx context.Context, logger *slog.Logger, appName string) error {
+		return s.routing.AbortCanary(ctx, logger, appName)
+	})
+}
+
+// canaryActionHandler runs promote and abort in the background, since draining and
+// stopping containers can take a while. Progress is reported through the logs.
+func (s *APIServer) canaryActionHandler(action string, run func(ctx context.Context, logger *slog.Logger, appName string) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		appName := r.PathValue("appName")
+		if appName == "" {
+			http.Error(w, "App name is required", http.StatusBadRequest)
+			return
+		}
+
+		if s.routing == nil {
+			http.Error(w, "Canary deployments are not available", http.StatusServiceUnavailable)
+			return
+		}
+
+		if _, ok := s.getCanary(w, appName); !ok {
+			return
+		}
+
+		logger := logging.NewLogger(s.logLevel, s.logBroker)
+
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), routingActionTimeout)
+			defer cancel()
+
+			if err := run(ctx, logger, appName); err != nil {
+				logger.Error("Canary "+action+" failed", "app", appName, "error", err)
+			}
+		}()
+
+		response := apitypes.CanaryActionResponse{
+			Message: "Canary " + action + " started. Use 'haloy logs' to monitor progress.",
+		}
+
+		if err := encodeJSON(w, http.StatusAccepted, response); err != nil {
+			logger.Error("Failed to write response", "error", err)
+		}
+	}
+}
+
+// getCanary loads the canary for an app and writes an error response if that fails.
+func (s *APIServer) getCanary(w http.ResponseWriter, appName string) (storage.Canary, bool) {
+	db, err := storage.New()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return storage.Canary{}, false
+	}
+	defer db.Close()
+
+	canary, err := db.GetCanary(appName)
+	if err != nil {
+		if errors.Is(err, storage.ErrCanaryNotFound) {
+			http.Error(w, "No canary in progress for the specified app", http.StatusNotFound)
+			return canary, false
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return canary, false
+	}
+	return canary, true
+}
+
+func canaryStatusResponse(canary storage.Canary) apitypes.CanaryStatusResponse {
+	return apitypes.CanaryStatusResponse{
+		StableDeploymentID: canary.StableDeploymentID,
+		CanaryDeploymentID: canary.CanaryDeploymentID,
+		Weight:             canary.Weight,
+	}
+}
@@ -2,11 +2,16 @@ package api
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"net"
 	"net/http"
+	"slices"
 
 	"github.com/haloydev/haloy/internal/apitypes"
 	"github.com/haloydev/haloy/internal/deploy"
+	"github.com/haloydev/haloy/internal/deploytypes"
 	"github.com/haloydev/haloy/internal/docker"
 	"github.com/haloydev/haloy/internal/logging"
 )
@@ -31,22 +36,48 @@ func (s *APIServer) handleDeploy() http.HandlerFunc {
 			return
 		}
 
-		deploymentLogger := logging.NewDeploymentLogger(req.DeploymentID, s.logLevel, s.logBroker)
+		if !authorizeTargetConfig(w, r, req.TargetConfig) {
+			return
+		}
 
-		ctx, cancel := context.WithTimeout(context.Background(), defaultContextTimeout)
+		if err := req.Metadata.Validate(); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid deploy metadata: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		ticket, ok := s.enqueueDeployment(w, req.TargetConfig.Name, req.DeploymentID, deploytypes.DeploymentKindDeploy, !req.NoQueue)
+		if !ok {
+			return
+		}
+
+		deploymentLogger := logging.NewDeploymentLogger(req.DeploymentID, s.logLevel, s.logBroker)
+		if err := deploy.RecordQueued(req.DeploymentID, req.TargetConfig.Name, deployedBy(r, req.DeployedBy), req.Metadata, &req.RollbackAppConfig, ""); err != nil {
+			deploymentLogger.Warn("Failed to record deployment", "error", err)
+		}
+		deployCtx, untrack := s.deployQueue.Track(context.Background(), req.DeploymentID)
 
 		go func() {
+			defer untrack()
+			defer ticket.Done()
+
+			if err := waitForDeployLock(deployCtx, ticket, deploymentLogger); err != nil {
+				logDeployError(deployCtx, deploymentLogger, req.DeploymentID, req.TargetConfig.Name, err)
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(deployCtx, defaultContextTimeout)
 			defer cancel()
 
 			cli, err := docker.NewClient(ctx)
 			if err != nil {
+				recordDeployError(ctx, deploymentLogger, req.DeploymentID, err)
 				deploymentLogger.Error("Failed to create Docker client", "error", err)
 				return
 			}
 			defer cli.Close()
 
-			if err := deploy.DeployApp(ctx, cli, req.DeploymentID, req.TargetConfig, req.RollbackAppConfig, deploymentLogger); err != nil {
-				logging.LogDeploymentFailed(deploymentLogger, req.DeploymentID, req.TargetConfig.Name, "Deployment failed", err)
+			if err := deploy.DeployApp(ctx, cli, req.DeploymentID, req.TargetConfig, req.RollbackAppConfig, deploy.DeployOptions{NoPromote: req.NoPromote, Metadata: req.Metadata, Logs: s.logBroker}, deploymentLogger); err != nil {
+				logDeployError(ctx, deploymentLogger, req.DeploymentID, req.TargetConfig.Name, err)
 				return
 			}
 		}()
@@ -55,7 +86,116 @@ func (s *APIServer) handleDeploy() http.HandlerFunc {
 	}
 }
 
-// handleDeploymentLogs handles SSE connections for deployment logs
+// handleDeployCancel cancels a deployment that is waiting for its turn, pulling its image,
+// starting its containers or being health checked. Cleaning up happens in the background.
+func (s *APIServer) handleDeployCancel() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		deploymentID := r.PathValue("deploymentID")
+		if deploymentID == "" {
+			http.Error(w, "Deployment ID is required", http.StatusBadRequest)
+			return
+		}
+
+		if !authorizeDeployment(w, r, deploymentID) {
+			return
+		}
+
+		if !s.deployQueue.Cancel(deploymentID) {
+			http.Error(w, fmt.Sprintf("Deployment %s is not in progress", deploymentID), http.StatusNotFound)
+			return
+		}
+
+		response := apitypes.DeployCancelResponse{
+			DeploymentID: deploymentID,
+			Message:      fmt.Sprintf("Cancelling deployment %s", deploymentID),
+		}
+		encodeJSON(w, http.StatusAccepted, response)
+	}
+}
+
+// logDeployError ends the deployment's log stream with the reason it failed or the note that it was cancelled.
+func logDeployError(ctx context.Context, logger *slog.Logger, deploymentID, appName string, err error) {
+	recordDeployError(ctx, logger, deploymentID, err)
+	if deploy.Cancelled(ctx) {
+		logging.LogDeploymentFailed(logger, deploymentID, appName, "Deployment cancelled", deploy.ErrDeploymentCancelled)
+		return
+	}
+	logging.LogDeploymentFailed(logger, deploymentID, appName, "Deployment failed", err)
+}
+
+// recordDeployError records why a deployment ended early. DeployApp records its own errors,
+// this also covers those that happen before it runs, like giving up waiting for the deploy lock.
+func recordDeployError(ctx context.Context, logger *slog.Logger, deploymentID string, err error) {
+	if deploy.Cancelled(ctx) {
+		deploy.RecordStatus(deploymentID, deploytypes.DeploymentStatusCancelled, deploy.ErrDeploymentCancelled.Error(), logger)
+		return
+	}
+	deploy.RecordStatus(deploymentID, deploytypes.DeploymentStatusFailed, err.Error(), logger)
+}
+
+// deployedBy returns who started a deployment: the subject of the JWT it was made with, the
+// identity the client sent, or its address.
+func deployedBy(r *http.Request, claimed string) string {
+	if subject := principalFromContext(r.Context()).Subject; subject != "" {
+		return subject
+	}
+	if claimed != "" {
+		return claimed
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// handleDeployQueue lists the running and waiting deployments, optionally of a single app.
+// Tokens limited to some apps only see theirs.
+func (s *APIServer) handleDeployQueue() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal := principalFromContext(r.Context())
+		deployments := s.deployQueue.List(r.URL.Query().Get("app"))
+		deployments = slices.DeleteFunc(deployments, func(d deploytypes.QueuedDeployment) bool {
+			return !principal.AllowsApp(d.AppName)
+		})
+		response := apitypes.DeployQueueResponse{
+			Deployments: deployments,
+		}
+		encodeJSON(w, http.StatusOK, response)
+	}
+}
+
+// enqueueDeployment takes a place in the app's deploy queue and writes an error response if that fails.
+func (s *APIServer) enqueueDeployment(w http.ResponseWriter, appName, deploymentID string, kind deploytypes.DeploymentKind, wait bool) (*deploy.Ticket, bool) {
+	ticket, err := s.deployQueue.Enqueue(appName, deploymentID, kind, wait)
+	if err != nil {
+		if errors.Is(err, deploy.ErrDeployInProgress) {
+			http.Error(w, fmt.Sprintf("Deployment of %s rejected: %v", appName, err), http.StatusConflict)
+			return nil, false
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	return ticket, true
+}
+
+// waitForDeployLock waits until the earlier deployments of the ticket's app are done.
+func waitForDeployLock(ctx context.Context, ticket *deploy.Ticket, logger *slog.Logger) error {
+	if position := ticket.Position(); position > 0 {
+		logger.Info(fmt.Sprintf("Waiting for %d earlier deployment(s) of the app to finish", position))
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, deployQueueTimeout)
+	defer cancel()
+	if err := ticket.Wait(ctx); err != nil {
+		return fmt.Errorf("gave up waiting for earlier deployments of the app: %w", err)
+	}
+	return nil
+}
+
+// handleDeploymentLogs handles SSE connections for deployment logs. With ?replay=true the
+// stored log of the deployment is sent first, which lets clients attach to a deployment
+// they didn't start or lost the connection to. Clients reconnecting with Last-Event-ID get
+// the entries they missed. Several clients can follow the same deployment.
 func (s *APIServer) handleDeploymentLogs() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		deploymentID := r.PathValue("deploymentID")
@@ -64,13 +204,36 @@ func (s *APIServer) handleDeploymentLogs() http.HandlerFunc {
 			return
 		}
 
-		// Subscribe to logs for this deployment ID
-		// Don't pass request context - use background context with manual cleanup
-		logChan := s.logBroker.SubscribeDeployment(deploymentID)
+		if !authorizeDeployment(w, r, deploymentID) {
+			return
+		}
+
+		// Subscribe before reading the stored log, so that nothing logged in between is missed.
+		logChan, subscriberID := s.logBroker.SubscribeDeployment(deploymentID)
+		unsubscribe := func() { s.logBroker.UnsubscribeDeployment(deploymentID, subscriberID) }
+
+		var replay []logging.LogEntry
+		resuming := lastEventID(r) > 0
+		if r.URL.Query().Get("replay") == "true" || resuming {
+			var err error
+			replay, err = s.logBroker.ReplayDeployment(deploymentID)
+			if err != nil {
+				unsubscribe()
+				http.Error(w, fmt.Sprintf("Failed to read deployment log: %v", err), http.StatusInternalServerError)
+				return
+			}
+			if len(replay) == 0 && !resuming && !s.deployQueue.InProgress(deploymentID) {
+				unsubscribe()
+				http.Error(w, fmt.Sprintf("No logs found for deployment %s", deploymentID), http.StatusNotFound)
+				return
+			}
+		}
 
 		streamConfig := sseStreamConfig{
-			logChan: logChan,
-			cleanup: func() { s.logBroker.UnsubscribeDeployment(deploymentID) },
+			replay:    replay,
+			logChan:   logChan,
+			cleanup:   unsubscribe,
+			resumable: true,
 			shouldTerminate: func(logEntry logging.LogEntry) bool {
 				return logEntry.IsDeploymentComplete || logEntry.IsDeploymentFailed
 			},
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/haloydev/haloy/internal/apitoken"
+	"github.com/haloydev/haloy/internal/apitypes"
+	"github.com/haloydev/haloy/internal/config"
+)
+
+func TestDeployWithAppScopedTokenRejectsHostAccess(t *testing.T) {
+	principal := apitoken.Principal{Name: "ci", Scopes: []apitoken.Scope{apitoken.ScopeDeploy, apitoken.ScopeRollback}, Apps: []string{"web-*"}}
+	targetConfig := func(volumes []string, network string) config.TargetConfig {
+		return config.TargetConfig{
+			Name:    "web-shop",
+			Server:  "haloy.dev",
+			Image:   &config.Image{Repository: "nginx", Tag: "latest"},
+			Volumes: volumes,
+			Network: network,
+		}
+	}
+
+	tests := []struct {
+		name         string
+		targetConfig config.TargetConfig
+		wantMessage  string
+	}{
+		{name: "Docker socket", targetConfig: targetConfig([]string{"data:/data", "/var/run/docker.sock:/var/run/docker.sock"}, ""), wantMessage: "mounts the host path '/var/run/docker.sock'"},
+		{name: "host root", targetConfig: targetConfig([]string{"/:/host"}, ""), wantMessage: "mounts the host path '/'"},
+		{name: "host network", targetConfig: targetConfig(nil, "host"), wantMessage: "uses the host network"},
+		{name: "network of another container", targetConfig: targetConfig(nil, "container:haloyd"), wantMessage: "shares the network of 'haloyd'"},
+	}
+	s := &APIServer{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := []struct {
+				handler http.HandlerFunc
+				body    any
+			}{
+				{handler: s.handleDeploy(), body: apitypes.DeployRequest{DeploymentID: "01JDEPLOY", TargetConfig: tt.targetConfig}},
+				{handler: s.handleRollback(), body: apitypes.RollbackRequest{TargetDeploymentID: "01JOLD", NewDeploymentID: "01JDEPLOY", NewTargetConfig: tt.targetConfig}},
+			}
+			for _, request := range requests {
+				body, err := json.Marshal(request.body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				r := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+				r = r.WithContext(context.WithValue(r.Context(), principalKey{}, principal))
+				w := httptest.NewRecorder()
+				request.handler(w, r)
+
+				if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), tt.wantMessage) {
+					t.Errorf("got %d %q, want 403 mentioning %q", w.Code, w.Body.String(), tt.wantMessage)
+				}
+			}
+		})
+	}
+}
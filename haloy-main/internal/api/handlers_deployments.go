@@ -0,0 +1,72 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/haloydev/haloy/internal/apitypes"
+	"github.com/haloydev/haloy/internal/deploytypes"
+	"github.com/haloydev/haloy/internal/storage"
+)
+
+const defaultDeploymentsLimit = 20
+
+// handleAppDeployments lists an app's deployments with their status and timeline, newest first.
+func (s *APIServer) handleAppDeployments() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		appName := r.PathValue("appName")
+		if appName == "" {
+			http.Error(w, "App name is required", http.StatusBadRequest)
+			return
+		}
+
+		query := storage.DeploymentHistoryQuery{Limit: defaultDeploymentsLimit}
+		if value := r.URL.Query().Get("limit"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 1 || parsed > storage.MaxDeploymentsPerApp {
+				http.Error(w, "limit must be a number between 1 and "+strconv.Itoa(storage.MaxDeploymentsPerApp), http.StatusBadRequest)
+				return
+			}
+			query.Limit = parsed
+		}
+		if value := r.URL.Query().Get("since"); value != "" {
+			since, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				http.Error(w, "since must be an RFC 3339 timestamp", http.StatusBadRequest)
+				return
+			}
+			query.Since = since
+		}
+		if value := r.URL.Query().Get("status"); value != "" {
+			status := deploytypes.DeploymentStatus(value)
+			if !status.Valid() {
+				http.Error(w, "unknown status "+value, http.StatusBadRequest)
+				return
+			}
+			query.Status = status
+		}
+
+		db, err := storage.New()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer db.Close()
+
+		deployments, err := db.GetDeploymentHistory(appName, query)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		response := apitypes.AppDeploymentsResponse{
+			Deployments: make([]deploytypes.DeploymentRecord, 0, len(deployments)),
+		}
+		for _, deployment := range deployments {
+			response.Deployments = append(response.Deployments, deployment.Record())
+		}
+
+		encodeJSON(w, http.StatusOK, response)
+	}
+}
@@ -2,6 +2,8 @@ package api
 
 import (
 	"net/http"
+
+	"github.com/haloydev/haloy/internal/logging"
 )
 
 func (s *APIServer) handleLogs() http.HandlerFunc {
@@ -12,6 +14,12 @@ func (s *APIServer) handleLogs() http.HandlerFunc {
 			logChan: logChan,
 			cleanup: func() { s.logBroker.UnsubscribeGeneral(subscriberID) },
 		}
+		// Tokens limited to some apps only see the logs of those apps.
+		if principal := principalFromContext(r.Context()); !principal.AllApps() {
+			streamConfig.include = func(logEntry logging.LogEntry) bool {
+				return logEntry.AppName != "" && principal.AllowsApp(logEntry.AppName)
+			}
+		}
 
 		streamSSELogs(w, r, streamConfig)
 	}
@@ -0,0 +1,228 @@
+package api
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+
+	"github.com/haloydev/haloy/internal/apitypes"
+	"github.com/haloydev/haloy/internal/logging"
+	"github.com/haloydev/haloy/internal/storage"
+)
+
+// maxReportedMismatches limits the status mismatches listed in a mirror report.
+const maxReportedMismatches = 10
+
+// handleMirrorStart starts copying requests for an app to its deployment waiting for promotion.
+func (s *APIServer) handleMirrorStart() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		appName := r.PathValue("appName")
+		if appName == "" {
+			http.Error(w, "App name is required", http.StatusBadRequest)
+			return
+		}
+
+		var req apitypes.MirrorStartRequest
+		if err := decodeJSON(r.Body, &req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if req.DeploymentID == "" {
+			http.Error(w, "Deployment ID is required", http.StatusBadRequest)
+			return
+		}
+
+		if s.routing == nil {
+			http.Error(w, "Traffic mirroring is not available", http.StatusServiceUnavailable)
+			return
+		}
+
+		db, err := storage.New()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer db.Close()
+
+		preview, err := db.GetPreview(appName)
+		if err != nil {
+			if errors.Is(err, storage.ErrPreviewNotFound) {
+				http.Error(w, "No deployment waiting for promotion for the specified app", http.StatusNotFound)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if preview.PreviewDeploymentID != req.DeploymentID {
+			http.Error(w, "Deployment "+req.DeploymentID+" is not waiting for promotion, "+preview.PreviewDeploymentID+" is", http.StatusConflict)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), defaultContextTimeout)
+		defer cancel()
+
+		logger := logging.NewDeploymentLogger(req.DeploymentID, s.logLevel, s.logBroker)
+		mirror, err := s.routing.StartMirror(ctx, logger, appName, req.DeploymentID, req.AllMethods)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		encodeJSON(w, http.StatusOK, apitypes.MirrorStatusResponse{
+			LiveDeploymentID:      mirror.LiveDeploymentID,
+			CandidateDeploymentID: mirror.CandidateDeploymentID,
+			AllMethods:            mirror.AllMethods,
+		})
+	}
+}
+
+func (s *APIServer) handleMirrorStop() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		appName := r.PathValue("appName")
+		if appName == "" {
+			http.Error(w, "App name is required", http.StatusBadRequest)
+			return
+		}
+
+		if s.routing == nil {
+			http.Error(w, "Traffic mirroring is not available", http.StatusServiceUnavailable)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), defaultContextTimeout)
+		defer cancel()
+
+		logger := logging.NewLogger(s.logLevel, s.logBroker)
+		if err := s.routing.StopMirror(ctx, logger, appName); err != nil {
+			if errors.Is(err, storage.ErrMirrorNotFound) {
+				http.Error(w, "No traffic mirror in progress for the specified app", http.StatusNotFound)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		encodeJSON(w, http.StatusOK, apitypes.MirrorActionResponse{
+			Message: "Stopped mirroring requests for " + appName,
+		})
+	}
+}
+
+// handleMirrorReport reports on the mirror in progress, or on the most recently mirrored
+// candidate if the mirror was stopped or its candidate promoted.
+func (s *APIServer) handleMirrorReport() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		appName := r.PathValue("appName")
+		if appName == "" {
+			http.Error(w, "App name is required", http.StatusBadRequest)
+			return
+		}
+
+		db, err := storage.New()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer db.Close()
+
+		active := true
+		candidateDeploymentID := ""
+		mirror, err := db.GetMirror(appName)
+		switch {
+		case err == nil:
+			candidateDeploymentID = mirror.CandidateDeploymentID
+		case errors.Is(err, storage.ErrMirrorNotFound):
+			active = false
+			candidateDeploymentID, err = db.LatestMirrorCandidate(appName)
+			if err != nil {
+				if errors.Is(err, storage.ErrMirrorNotFound) {
+					http.Error(w, "No mirrored requests for the specified app", http.StatusNotFound)
+					return
+				}
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		results, err := db.ListMirrorResults(appName, candidateDeploymentID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		report := mirrorReport(results)
+		report.CandidateDeploymentID = candidateDeploymentID
+		report.Active = active
+		encodeJSON(w, http.StatusOK, report)
+	}
+}
+
+func mirrorReport(results []storage.MirrorResult) apitypes.MirrorReportResponse {
+	report := apitypes.MirrorReportResponse{Requests: len(results)}
+
+	type mismatchKey struct {
+		method, path             string
+		liveStatus, mirrorStatus int
+	}
+	mismatches := make(map[mismatchKey]int)
+	liveLatencies := make([]int64, 0, len(results))
+	candidateLatencies := make([]int64, 0, len(results))
+
+	for _, result := range results {
+		liveLatencies = append(liveLatencies, result.LiveLatencyMs)
+		switch {
+		case result.MirrorStatus == 0:
+			report.MirrorErrors++
+			continue
+		case result.MirrorStatus == result.LiveStatus:
+			report.StatusMatches++
+		default:
+			report.StatusMismatches++
+			mismatches[mismatchKey{result.Method, result.Path, result.LiveStatus, result.MirrorStatus}]++
+		}
+		candidateLatencies = append(candidateLatencies, result.MirrorLatencyMs)
+	}
+
+	report.LiveLatency = latencySummary(liveLatencies)
+	report.CandidateLatency = latencySummary(candidateLatencies)
+
+	for key, count := range mismatches {
+		report.Mismatches = append(report.Mismatches, apitypes.MirrorMismatch{
+			Method:       key.method,
+			Path:         key.path,
+			LiveStatus:   key.liveStatus,
+			MirrorStatus: key.mirrorStatus,
+			Count:        count,
+		})
+	}
+	slices.SortFunc(report.Mismatches, func(a, b apitypes.MirrorMismatch) int {
+		return cmp.Or(cmp.Compare(b.Count, a.Count), cmp.Compare(a.Path, b.Path), cmp.Compare(a.Method, b.Method), cmp.Compare(a.MirrorStatus, b.MirrorStatus))
+	})
+	if len(report.Mismatches) > maxReportedMismatches {
+		report.Mismatches = report.Mismatches[:maxReportedMismatches]
+	}
+	return report
+}
+
+func latencySummary(latencies []int64) apitypes.MirrorLatency {
+	if len(latencies) == 0 {
+		return apitypes.MirrorLatency{}
+	}
+	slices.Sort(latencies)
+	percentile := func(p int) int64 {
+		return latencies[(len(latencies)-1)*p/100]
+	}
+	return apitypes.MirrorLatency{
+		P50Ms: percentile(50),
+		P95Ms: percentile(95),
+		P99Ms: percentile(99),
+		MaxMs: latencies[len(latencies)-1],
+	}
+}
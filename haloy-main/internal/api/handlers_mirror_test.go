@@ -0,0 +1,80 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/haloydev/haloy/internal/apitypes"
+	"github.com/haloydev/haloy/internal/storage"
+)
+
+func TestLatencySummary(t *testing.T) {
+	tests := []struct {
+		name      string
+		latencies []int64
+		want      apitypes.MirrorLatency
+	}{
+		{name: "empty", latencies: nil, want: apitypes.MirrorLatency{}},
+		{name: "single", latencies: []int64{7}, want: apitypes.MirrorLatency{P50Ms: 7, P95Ms: 7, P99Ms: 7, MaxMs: 7}},
+		{name: "unsorted", latencies: []int64{30, 10, 20}, want: apitypes.MirrorLatency{P50Ms: 20, P95Ms: 20, P99Ms: 20, MaxMs: 30}},
+	}
+	hundred := make([]int64, 100)
+	for i := range hundred {
+		hundred[i] = int64(100 - i) // 100 down to 1
+	}
+	tests = append(tests, struct {
+		name      string
+		latencies []int64
+		want      apitypes.MirrorLatency
+	}{name: "hundred", latencies: hundred, want: apitypes.MirrorLatency{P50Ms: 50, P95Ms: 95, P99Ms: 99, MaxMs: 100}})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := latencySummary(tt.latencies); got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMirrorReport(t *testing.T) {
+	results := []storage.MirrorResult{
+		{Method: "GET", Path: "/", LiveStatus: 200, MirrorStatus: 200, LiveLatencyMs: 10, MirrorLatencyMs: 12},
+		{Method: "GET", Path: "/about", LiveStatus: 200, MirrorStatus: 500, LiveLatencyMs: 20, MirrorLatencyMs: 40},
+		{Method: "GET", Path: "/about", LiveStatus: 200, MirrorStatus: 500, LiveLatencyMs: 30, MirrorLatencyMs: 50},
+		{Method: "GET", Path: "/api", LiveStatus: 200, MirrorStatus: 404, LiveLatencyMs: 5, MirrorLatencyMs: 6},
+		{Method: "GET", Path: "/slow", LiveStatus: 200, LiveLatencyMs: 15, MirrorLatencyMs: 30000, Error: "timeout"},
+	}
+
+	report := mirrorReport(results)
+	if report.Requests != 5 || report.StatusMatches != 1 || report.StatusMismatches != 3 || report.MirrorErrors != 1 {
+		t.Errorf("got counts requests=%d matches=%d mismatches=%d errors=%d, want 5, 1, 3, 1",
+			report.Requests, report.StatusMatches, report.StatusMismatches, report.MirrorErrors)
+	}
+	// Failed copies count for the live latency only.
+	if report.LiveLatency.MaxMs != 30 || report.CandidateLatency.MaxMs != 50 {
+		t.Errorf("got max latencies live=%d candidate=%d, want 30 and 50", report.LiveLatency.MaxMs, report.CandidateLatency.MaxMs)
+	}
+
+	want := []apitypes.MirrorMismatch{
+		{Method: "GET", Path: "/about", LiveStatus: 200, MirrorStatus: 500, Count: 2},
+		{Method: "GET", Path: "/api", LiveStatus: 200, MirrorStatus: 404, Count: 1},
+	}
+	if len(report.Mismatches) != len(want) {
+		t.Fatalf("got mismatches %+v, want %+v", report.Mismatches, want)
+	}
+	for i := range want {
+		if report.Mismatches[i] != want[i] {
+			t.Errorf("mismatch %d: got %+v, want %+v", i, report.Mismatches[i], want[i])
+		}
+	}
+}
+
+func TestMirrorReportLimitsMismatches(t *testing.T) {
+	var results []storage.MirrorResult
+	for i := range maxReportedMismatches + 5 {
+		results = append(results, storage.MirrorResult{Method: "GET", Path: "/" + string(rune('a'+i)), LiveStatus: 200, MirrorStatus: 500})
+	}
+	if report := mirrorReport(results); len(report.Mismatches) != maxReportedMismatches {
+		t.Errorf("got %d mismatches, want %d", len(report.Mismatches), maxReportedMismatches)
+	}
+}
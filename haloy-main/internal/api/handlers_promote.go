@@ -0,0 +1,80 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/haloydev/haloy/internal/apitypes"
+	"github.com/haloydev/haloy/internal/logging"
+	"github.com/haloydev/haloy/internal/storage"
+)
+
+// handlePromote moves an app's domains to a deployment started with --no-promote.
+// Like canary promotion it runs in the background and reports progress through the logs.
+func (s *APIServer) handlePromote() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		appName := r.PathValue("appName")
+		if appName == "" {
+			http.Error(w, "App name is required", http.StatusBadRequest)
+			return
+		}
+
+		var req apitypes.PromoteRequest
+		if err := decodeJSON(r.Body, &req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if req.DeploymentID == "" {
+			http.Error(w, "Deployment ID is required", http.StatusBadRequest)
+			return
+		}
+
+		if s.routing == nil {
+			http.Error(w, "Promotion is not available", http.StatusServiceUnavailable)
+			return
+		}
+
+		db, err := storage.New()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer db.Close()
+
+		preview, err := db.GetPreview(appName)
+		if err != nil {
+			if errors.Is(err, storage.ErrPreviewNotFound) {
+				http.Error(w, "No deployment waiting for promotion for the specified app", http.StatusNotFound)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if preview.PreviewDeploymentID != req.DeploymentID {
+			http.Error(w, "Deployment "+req.DeploymentID+" is not waiting for promotion, "+preview.PreviewDeploymentID+" is", http.StatusConflict)
+			return
+		}
+
+		logger := logging.NewDeploymentLogger(req.DeploymentID, s.logLevel, s.logBroker)
+
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), routingActionTimeout)
+			defer cancel()
+
+			if err := s.routing.PromotePreview(ctx, logger, appName, req.DeploymentID); err != nil {
+				logger.Error("Promotion failed", "app", appName, "deploymentID", req.DeploymentID, "error", err)
+			}
+		}()
+
+		response := apitypes.PromoteResponse{
+			Message: "Promotion of " + req.DeploymentID + " started. Use 'haloy logs' to monitor progress.",
+		}
+
+		if err := encodeJSON(w, http.StatusAccepted, response); err != nil {
+			logger.Error("Failed to write response", "error", err)
+		}
+	}
+}
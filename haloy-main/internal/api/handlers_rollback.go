@@ -6,7 +6,9 @@ import (
 	"net/http"
 
 	"github.com/haloydev/haloy/internal/apitypes"
+	"github.com/haloydev/haloy/internal/config"
 	"github.com/haloydev/haloy/internal/deploy"
+	"github.com/haloydev/haloy/internal/deploytypes"
 	"github.com/haloydev/haloy/internal/docker"
 	"github.com/haloydev/haloy/internal/logging"
 )
@@ -35,21 +37,52 @@ func (s *APIServer) handleRollback() http.HandlerFunc {
 			return
 		}
 
+		if !authorizeTargetConfig(w, r, appConfig) {
+			return
+		}
+
+		ticket, ok := s.enqueueDeployment(w, appConfig.Name, req.NewDeploymentID, deploytypes.DeploymentKindRollback, true)
+		if !ok {
+			return
+		}
+
 		deploymentLogger := logging.NewDeploymentLogger(req.NewDeploymentID, s.logLevel, s.logBroker)
+		if err := deploy.RecordQueued(req.NewDeploymentID, appConfig.Name, deployedBy(r, req.DeployedBy), config.DeployMetadata{}, nil, ""); err != nil {
+			deploymentLogger.Warn("Failed to record deployment", "error", err)
+		}
+		deployCtx, untrack := s.deployQueue.Track(context.Background(), req.NewDeploymentID)
 
 		go func() {
-			ctx := context.Background()
-			ctx, cancel := context.WithTimeout(ctx, defaultContextTimeout)
+			defer untrack()
+			defer ticket.Done()
+
+			if err := waitForDeployLock(deployCtx, ticket, deploymentLogger); err != nil {
+				recordDeployError(deployCtx, deploymentLogger, req.NewDeploymentID, err)
+				if deploy.Cancelled(deployCtx) {
+					logging.LogDeploymentFailed(deploymentLogger, req.NewDeploymentID, appConfig.Name, "Rollback cancelled", err)
+					return
+				}
+				deploymentLogger.Error("Deployment failed", "app", appConfig.Name, "error", err)
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(deployCtx, defaultContextTimeout)
 			defer cancel()
 
 			cli, err := docker.NewClient(ctx)
 			if err != nil {
+				recordDeployError(ctx, deploymentLogger, req.NewDeploymentID, err)
 				deploymentLogger.Error("Failed to create Docker client", "error", err)
 				return
 			}
 			defer cli.Close()
 
-			if err := deploy.RollbackApp(ctx, cli, appConfig, req.TargetDeploymentID, req.NewDeploymentID, deploymentLogger); err != nil {
+			if err := deploy.RollbackApp(ctx, cli, appConfig, req.TargetDeploymentID, req.NewDeploymentID, s.logBroker, deploymentLogger); err != nil {
+				recordDeployError(ctx, deploymentLogger, req.NewDeploymentID, err)
+				if deploy.Cancelled(ctx) {
+					logging.LogDeploymentFailed(deploymentLogger, req.NewDeploymentID, appConfig.Name, "Rollback cancelled", err)
+					return
+				}
 				deploymentLogger.Error("Deployment failed", "app", appConfig.Name, "error", err)
 				return
 			}
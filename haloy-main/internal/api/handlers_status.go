@@ -3,7 +3,9 @@ package api
 import (
 	"context"
 	"fmt"
+	"maps"
 	"net/http"
+	"slices"
 	"strings"
 
 	"github.com/docker/docker/api/types/container"
@@ -11,6 +13,7 @@ import (
 	"github.com/haloydev/haloy/internal/config"
 	"github.com/haloydev/haloy/internal/docker"
 	"github.com/haloydev/haloy/internal/helpers"
+	"github.com/haloydev/haloy/internal/storage"
 )
 
 func (s *APIServer) handleAppStatus() http.HandlerFunc {
@@ -49,6 +52,23 @@ func (s *APIServer) handleAppStatus() http.HandlerFunc {
 			return
 		}
 
+		db, err := storage.New()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer db.Close()
+
+		sleepingApps, err := db.ListSleepingApps()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if sleeping, ok := sleepingApps[appName]; ok && sleeping.DeploymentID == response.DeploymentID {
+			// The containers were stopped after the app was idle, the next request starts them again.
+			response.State = "sleeping"
+		}
+
 		encodeJSON(w, http.StatusOK, response)
 	}
 }
@@ -63,6 +83,8 @@ func getResponse(containers []container.Summary) (apitypes.AppStatusResponse, er
 		containerIDs []string
 		states       []string
 		domains      []config.Domain
+		routable     bool
+		metadata     config.DeployMetadata
 	}
 
 	deploymentMap := make(map[string]*deploymentData)
@@ -80,6 +102,7 @@ func getResponse(containers []container.Summary) (apitypes.AppStatusResponse, er
 				containerIDs: []string{},
 				states:       []string{},
 				domains:      []config.Domain{},
+				metadata:     labels.Metadata,
 			}
 		}
 
@@ -87,6 +110,9 @@ func getResponse(containers []container.Summary) (apitypes.AppStatusResponse, er
 		deploymentMap[labels.DeploymentID].containerIDs = append(deploymentMap[labels.DeploymentID].containerIDs, c.ID)
 		deploymentMap[labels.DeploymentID].states = append(deploymentMap[labels.DeploymentID].states, strings.ToLower(c.State))
 		deploymentMap[labels.DeploymentID].domains = append(deploymentMap[labels.DeploymentID].domains, labels.Domains...)
+		if labels.RoutingSecretHash != "" {
+			deploymentMap[labels.DeploymentID].routable = true
+		}
 
 		// Track latest deployment
 		if labels.DeploymentID > latestDeploymentID {
@@ -104,11 +130,23 @@ func getResponse(containers []container.Summary) (apitypes.AppStatusResponse, er
 	// Determine overall state from all containers in latest deployment
 	overallState := determineOverallState(latestDeployment.states)
 
+	// Deployment routing follows the config of the latest deployment and covers every running deployment.
+	var reachableDeploymentIDs []string
+	if latestDeployment.routable {
+		for _, id := range slices.Sorted(maps.Keys(deploymentMap)) {
+			if slices.Contains(deploymentMap[id].states, "running") {
+				reachableDeploymentIDs = append(reachableDeploymentIDs, id)
+			}
+		}
+	}
+
 	return apitypes.AppStatusResponse{
-		State:        overallState,
-		DeploymentID: latestDeploymentID,
-		ContainerIDs: latestDeployment.containerIDs,
-		Domains:      latestDeployment.domains,
+		State:                  overallState,
+		DeploymentID:           latestDeploymentID,
+		ContainerIDs:           latestDeployment.containerIDs,
+		Domains:                latestDeployment.domains,
+		ReachableDeploymentIDs: reachableDeploymentIDs,
+		Metadata:               latestDeployment.metadata,
 	}, nil
 }
 
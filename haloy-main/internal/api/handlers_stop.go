@@ -7,6 +7,7 @@ import (
 	"github.com/haloydev/haloy/internal/apitypes"
 	"github.com/haloydev/haloy/internal/docker"
 	"github.com/haloydev/haloy/internal/logging"
+	"github.com/haloydev/haloy/internal/storage"
 )
 
 func (s *APIServer) handleStopApp() http.HandlerFunc {
@@ -30,6 +31,18 @@ func (s *APIServer) handleStopApp() http.HandlerFunc {
 			}
 			defer cli.Close()
 
+			// A stopped app must not be woken up again by the next request.
+			db, err := storage.New()
+			if err != nil {
+				logger.Error("Failed to open database for stop operation", "app", appName, "error", err)
+				return
+			}
+			defer db.Close()
+			if err := db.DeleteSleepingApp(appName); err != nil {
+				logger.Error("Failed to clear sleeping state", "app", appName, "error", err)
+				return
+			}
+
 			logger.Info("Stopping containers", "app", appName)
 			stoppedIDs, err := docker.StopContainers(ctx, cli, logger, appName, "")
 			if err != nil {
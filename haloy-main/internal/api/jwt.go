@@ -0,0 +1,242 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+	"github.com/haloydev/haloy/internal/apitoken"
+	"github.com/haloydev/haloy/internal/config"
+)
+
+const (
+	// jwksMaxAge is how long signing keys are cached before they are fetched again.
+	jwksMaxAge = 1 * time.Hour
+	// jwksMinRefresh limits how often tokens signed with an unknown key make haloyd fetch the
+	// keys, in case the issuer rotated them.
+	jwksMinRefresh   = 1 * time.Minute
+	jwksFetchTimeout = 10 * time.Second
+	jwksMaxSize      = 1 << 20
+	// jwtLeeway allows for clock skew between haloyd and the issuer.
+	jwtLeeway = 1 * time.Minute
+)
+
+var jwtSignatureAlgorithms = []jose.SignatureAlgorithm{
+	jose.RS256, jose.RS384, jose.RS512,
+	jose.PS256, jose.PS384, jose.PS512,
+	jose.ES256, jose.ES384, jose.ES512,
+	jose.EdDSA,
+}
+
+// JWTVerifier accepts JWTs signed by the configured issuers, and maps their claims to
+// what the token may do.
+type JWTVerifier struct {
+	issuers map[string]*jwtIssuer
+}
+
+type jwtIssuer struct {
+	config config.JWTIssuerConfig
+	keys   *jwksCache
+}
+
+// NewJWTVerifier returns a verifier for the issuers. Signing keys are loaded when the first
+// token of an issuer is verified.
+func NewJWTVerifier(issuers []config.JWTIssuerConfig) (*JWTVerifier, error) {
+	v := &JWTVerifier{issuers: make(map[string]*jwtIssuer, len(issuers))}
+	for _, ic := range issuers {
+		if err := ic.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid JWT issuer '%s': %w", ic.DisplayName(), err)
+		}
+		load := func(ctx context.Context) (jose.JSONWebKeySet, error) { return fetchJWKS(ctx, ic.JWKSURL) }
+		if ic.JWKSFile != "" {
+			load = func(context.Context) (jose.JSONWebKeySet, error) { return readJWKS(ic.JWKSFile) }
+		}
+		v.issuers[ic.Issuer] = &jwtIssuer{config: ic, keys: &jwksCache{load: load}}
+	}
+	return v, nil
+}
+
+// looksLikeJWT tells JWTs apart from opaque tokens without parsing them.
+func looksLikeJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+// Verify checks the token's signature, issuer, audience and lifetime, and returns what the
+// first rule matching its claims allows.
+func (v *JWTVerifier) Verify(ctx context.Context, token string) (apitoken.Principal, error) {
+	parsed, err := jwt.ParseSigned(token, jwtSignatureAlgorithms)
+	if err != nil {
+		return apitoken.Principal{}, fmt.Errorf("invalid JWT: %w", err)
+	}
+
+	var unverified jwt.Claims
+	if err := parsed.UnsafeClaimsWithoutVerification(&unverified); err != nil {
+		return apitoken.Principal{}, fmt.Errorf("invalid JWT claims: %w", err)
+	}
+	issuer, ok := v.issuers[unverified.Issuer]
+	if !ok {
+		return apitoken.Principal{}, fmt.Errorf("JWT issuer '%s' is not trusted", unverified.Issuer)
+	}
+
+	key, err := issuer.keys.key(ctx, parsed.Headers[0].KeyID)
+	if err != nil {
+		return apitoken.Principal{}, fmt.Errorf("failed to get signing key of '%s': %w", issuer.config.DisplayName(), err)
+	}
+
+	var registered jwt.Claims
+	var claims map[string]any
+	if err := parsed.Claims(key, &registered, &claims); err != nil {
+		return apitoken.Principal{}, fmt.Errorf("invalid JWT signature: %w", err)
+	}
+	// Only short-lived tokens are accepted, so they must say when they expire.
+	if registered.Expiry == nil {
+		return apitoken.Principal{}, errors.New("JWT has no expiry")
+	}
+	expected := jwt.Expected{
+		Issuer:      issuer.config.Issuer,
+		AnyAudience: jwt.Audience{issuer.config.Audience},
+		Time:        time.Now(),
+	}
+	if err := registered.ValidateWithLeeway(expected, jwtLeeway); err != nil {
+		return apitoken.Principal{}, fmt.Errorf("invalid JWT: %w", err)
+	}
+
+	for _, rule := range issuer.config.Rules {
+		if !matchClaims(rule.Claims, claims) {
+			continue
+		}
+		// Scopes were validated with the issuer config.
+		scopes, _ := apitoken.ParseScopes(rule.Scopes)
+		return apitoken.Principal{
+			Name:    fmt.Sprintf("%s:%s", issuer.config.DisplayName(), registered.Subject),
+			Subject: registered.Subject,
+			Scopes:  scopes,
+			Apps:    rule.Apps,
+		}, nil
+	}
+	return apitoken.Principal{}, fmt.Errorf("JWT for '%s' matches no rule of '%s'", registered.Subject, issuer.config.DisplayName())
+}
+
+// matchClaims reports whether every claim the rule names is present and matches its pattern.
+func matchClaims(patterns map[string]string, claims map[string]any) bool {
+	for name, pattern := range patterns {
+		value, ok := claims[name]
+		if !ok {
+			return false
+		}
+		var s string
+		switch value := value.(type) {
+		case string:
+			s = value
+		case bool, float64:
+			s = fmt.Sprint(value)
+		default:
+			return false
+		}
+		if ok, err := path.Match(pattern, s); err != nil || !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// jwksCache holds the signing keys of an issuer.
+type jwksCache struct {
+	mu        sync.Mutex
+	load      func(ctx context.Context) (jose.JSONWebKeySet, error)
+	keys      jose.JSONWebKeySet
+	fetchedAt time.Time
+}
+
+// key returns the key with the id, loading the keys again when they are old or, at most once
+// per jwksMinRefresh, when the key is unknown. Tokens without a key id can only be used with
+// issuers that have a single key.
+func (c *jwksCache) key(ctx context.Context, keyID string) (*jose.JSONWebKey, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	find := func() *jose.JSONWebKey {
+		if keyID == "" {
+			if len(c.keys.Keys) == 1 {
+				return &c.keys.Keys[0]
+			}
+			return nil
+		}
+		if keys := c.keys.Key(keyID); len(keys) > 0 {
+			return &keys[0]
+		}
+		return nil
+	}
+
+	key := find()
+	age := time.Since(c.fetchedAt)
+	if age > jwksMaxAge || (key == nil && age > jwksMinRefresh) {
+		keys, err := c.load(ctx)
+		if err != nil {
+			if key != nil {
+				// Keep using the cached key if the issuer is briefly unreachable.
+				return key, nil
+			}
+			return nil, err
+		}
+		c.keys = keys
+		c.fetchedAt = time.Now()
+		key = find()
+	}
+
+	if key == nil {
+		return nil, fmt.Errorf("no key with id '%s'", keyID)
+	}
+	return key, nil
+}
+
+func readJWKS(file string) (jose.JSONWebKeySet, error) {
+	var keys jose.JSONWebKeySet
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return keys, fmt.Errorf("failed to read JWKS file: %w", err)
+	}
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return keys, fmt.Errorf("failed to parse JWKS file %s: %w", file, err)
+	}
+	return keys, nil
+}
+
+func fetchJWKS(ctx context.Context, url string) (jose.JSONWebKeySet, error) {
+	var keys jose.JSONWebKeySet
+
+	ctx, cancel := context.WithTimeout(ctx, jwksFetchTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return keys, fmt.Errorf("failed to create JWKS request: %w", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return keys, fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return keys, fmt.Errorf("failed to fetch JWKS from %s: %s", url, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, jwksMaxSize))
+	if err != nil {
+		return keys, fmt.Errorf("failed to read JWKS: %w", err)
+	}
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return keys, fmt.Errorf("failed to parse JWKS from %s: %w", url, err)
+	}
+	return keys, nil
+}
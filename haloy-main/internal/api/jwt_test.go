@@ -0,0 +1,139 @@
+package api
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+	"github.com/haloydev/haloy/internal/apitoken"
+	"github.com/haloydev/haloy/internal/config"
+)
+
+const testIssuer = "https://ci.example.com"
+
+// newTestIssuer writes a JWKS file with a new key and returns a signer for it.
+func newTestIssuer(t *testing.T) (jose.Signer, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: key},
+		(&jose.SignerOptions{}).WithType("JWT").WithHeader("kid", "test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwks := jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{Key: &key.PublicKey, KeyID: "test", Algorithm: string(jose.ES256), Use: "sig"}}}
+	data, err := json.Marshal(jwks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(file, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return signer, file
+}
+
+func signTestJWT(t *testing.T, signer jose.Signer, claims jwt.Claims, extra map[string]any) string {
+	t.Helper()
+	token, err := jwt.Signed(signer).Claims(claims).Claims(extra).Serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestJWTVerifier_Verify(t *testing.T) {
+	signer, jwksFile := newTestIssuer(t)
+	otherSigner, _ := newTestIssuer(t)
+
+	verifier, err := NewJWTVerifier([]config.JWTIssuerConfig{{
+		Name:     "ci",
+		Issuer:   testIssuer,
+		Audience: "haloy",
+		JWKSFile: jwksFile,
+		Rules: []config.JWTRule{
+			{Claims: map[string]string{"repository": "acme/web", "ref": "refs/heads/main"}, Scopes: []string{"deploy", "read"}, Apps: []string{"web-*"}},
+			{Claims: map[string]string{"repository": "acme/*"}, Scopes: []string{"read"}},
+		},
+	}})
+	if err != nil {
+		t.Fatalf("NewJWTVerifier() error = %v", err)
+	}
+
+	now := time.Now()
+	valid := jwt.Claims{
+		Issuer:   testIssuer,
+		Subject:  "repo:acme/web:ref:refs/heads/main",
+		Audience: jwt.Audience{"haloy"},
+		IssuedAt: jwt.NewNumericDate(now),
+		Expiry:   jwt.NewNumericDate(now.Add(5 * time.Minute)),
+	}
+	mainBranch := map[string]any{"repository": "acme/web", "ref": "refs/heads/main"}
+
+	principal, err := verifier.Verify(context.Background(), signTestJWT(t, signer, valid, mainBranch))
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if principal.Subject != valid.Subject || principal.Name != "ci:"+valid.Subject {
+		t.Errorf("Verify() principal = %+v", principal)
+	}
+	if !principal.HasScope(apitoken.ScopeDeploy) || !principal.AllowsApp("web-prod") || principal.AllowsApp("api") {
+		t.Errorf("expected first rule to apply, got %+v", principal)
+	}
+
+	principal, err = verifier.Verify(context.Background(),
+		signTestJWT(t, signer, valid, map[string]any{"repository": "acme/web", "ref": "refs/heads/feature"}))
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if principal.HasScope(apitoken.ScopeDeploy) || !principal.HasScope(apitoken.ScopeRead) {
+		t.Errorf("expected second rule to apply, got %+v", principal)
+	}
+
+	expired := valid
+	expired.Expiry = jwt.NewNumericDate(now.Add(-10 * time.Minute))
+	noExpiry := valid
+	noExpiry.Expiry = nil
+	otherAudience := valid
+	otherAudience.Audience = jwt.Audience{"something-else"}
+	otherIssuer := valid
+	otherIssuer.Issuer = "https://evil.example.com"
+
+	rejected := map[string]string{
+		"expired":        signTestJWT(t, signer, expired, mainBranch),
+		"no expiry":      signTestJWT(t, signer, noExpiry, mainBranch),
+		"other audience": signTestJWT(t, signer, otherAudience, mainBranch),
+		"other issuer":   signTestJWT(t, signer, otherIssuer, mainBranch),
+		"wrong key":      signTestJWT(t, otherSigner, valid, mainBranch),
+		"no rule":        signTestJWT(t, signer, valid, map[string]any{"repository": "evil/web"}),
+		"missing claim":  signTestJWT(t, signer, valid, nil),
+	}
+	for name, token := range rejected {
+		if _, err := verifier.Verify(context.Background(), token); err == nil {
+			t.Errorf("%s: expected Verify() to fail", name)
+		}
+	}
+}
+
+func TestNewJWTVerifier_RequiresClaims(t *testing.T) {
+	_, err := NewJWTVerifier([]config.JWTIssuerConfig{{
+		Issuer:   testIssuer,
+		Audience: "haloy",
+		JWKSFile: "jwks.json",
+		Rules:    []config.JWTRule{{Scopes: []string{"admin"}}},
+	}})
+	if err == nil {
+		t.Error("expected error for a rule that matches every token of the issuer")
+	}
+}
@@ -1,13 +1,53 @@
 package api
 
 import (
+	"context"
 	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net"
 	"net/http"
 	"strings"
+	"time"
+
+	"github.com/haloydev/haloy/internal/apitoken"
+	"github.com/haloydev/haloy/internal/config"
+	"github.com/haloydev/haloy/internal/storage"
 )
 
+// legacyTokenName is the name audited for requests made with HALOY_API_TOKEN, which has the admin scope.
+const legacyTokenName = "HALOY_API_TOKEN"
+
+// previousLegacyTokenName is audited for requests made with the token HALOY_API_TOKEN replaced,
+// while it is still valid after a rotation.
+const previousLegacyTokenName = "HALOY_API_TOKEN_PREVIOUS"
+
+// unixSocketName is the name audited for requests made over the API's Unix socket.
+const unixSocketName = "unix-socket"
+
+type principalKey struct{}
+
+// unixSocketKey marks requests that came in over the Unix socket.
+type unixSocketKey struct{}
+
+// auditKey holds the *auditRecord of a request that changes something.
+type auditKey struct{}
+
+// auditRecord is what the audit log records about a request besides its route and token.
+// Handlers whose app isn't part of the path fill it in.
+type auditRecord struct {
+	appName string
+}
+
 func (s *APIServer) bearerTokenAuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if viaUnixSocket(r.Context()) {
+			principal := apitoken.Principal{Name: unixSocketName, Scopes: []apitoken.Scope{apitoken.ScopeAdmin}}
+			ctx := context.WithValue(r.Context(), principalKey{}, principal)
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+
 		authHeader := r.Header.Get("Authorization")
 		if authHeader == "" {
 			http.Error(w, "Authorization header required", http.StatusUnauthorized)
@@ -25,8 +65,81 @@ func (s *APIServer) bearerTokenAuthMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
-		if subtle.ConstantTimeCompare([]byte(token), []byte(s.apiToken)) != 1 {
-			http.Error(w, "Invalid token", http.StatusUnauthorized)
+		principal, err := s.authenticate(r.Context(), token)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), principalKey{}, principal)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// authenticate finds who a token belongs to: HALOY_API_TOKEN, the token it replaced during
+// the grace period, a JWT of a trusted issuer, or a named token that is neither revoked nor expired.
+func (s *APIServer) authenticate(ctx context.Context, token string) (apitoken.Principal, error) {
+	apiTokens := s.apiTokens.Load()
+	if apiTokens.Current != "" && subtle.ConstantTimeCompare([]byte(token), []byte(apiTokens.Current)) == 1 {
+		return apitoken.Principal{Name: legacyTokenName, Scopes: []apitoken.Scope{apitoken.ScopeAdmin}}, nil
+	}
+	if apiTokens.PreviousValid(time.Now()) && subtle.ConstantTimeCompare([]byte(token), []byte(apiTokens.Previous)) == 1 {
+		return apitoken.Principal{Name: previousLegacyTokenName, Scopes: []apitoken.Scope{apitoken.ScopeAdmin}}, nil
+	}
+	if s.jwtVerifier != nil && looksLikeJWT(token) {
+		return s.jwtVerifier.Verify(ctx, token)
+	}
+
+	db, err := storage.New()
+	if err != nil {
+		return apitoken.Principal{}, errors.New("Failed to check token")
+	}
+	defer db.Close()
+
+	stored, err := db.GetAPITokenByHash(apitoken.Hash(token))
+	if err != nil {
+		return apitoken.Principal{}, errors.New("Invalid token")
+	}
+	if stored.Expired(time.Now()) {
+		return apitoken.Principal{}, errors.New("Token expired")
+	}
+	// Failing to record the last use shouldn't fail the request.
+	_ = db.TouchAPIToken(stored.ID)
+
+	return stored.Principal(), nil
+}
+
+func viaUnixSocket(ctx context.Context) bool {
+	local, _ := ctx.Value(unixSocketKey{}).(bool)
+	return local
+}
+
+func principalFromContext(ctx context.Context) apitoken.Principal {
+	principal, _ := ctx.Value(principalKey{}).(apitoken.Principal)
+	return principal
+}
+
+// requireScope only lets requests through whose token has the scope and, for routes with an
+// app in the path, may act on that app. Requests that change something are audited.
+func (s *APIServer) requireScope(scope apitoken.Scope, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal := principalFromContext(r.Context())
+		appName := r.PathValue("appName")
+
+		if r.Method != http.MethodGet {
+			record := &auditRecord{appName: appName}
+			recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+			defer func() { saveAuditEvent(r, principal, record, recorder.status) }()
+			w = recorder
+			r = r.WithContext(context.WithValue(r.Context(), auditKey{}, record))
+		}
+
+		if !principal.HasScope(scope) {
+			http.Error(w, fmt.Sprintf("Token '%s' doesn't have the %s scope", principal.Name, scope), http.StatusForbidden)
+			return
+		}
+		if appName != "" && !principal.AllowsApp(appName) {
+			http.Error(w, fmt.Sprintf("Token '%s' isn't allowed to access app '%s'", principal.Name, appName), http.StatusForbidden)
 			return
 		}
 
@@ -34,6 +147,103 @@ func (s *APIServer) bearerTokenAuthMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// authorizeApp checks that the request's token may act on an app that isn't part of the
+// route's path, and notes the app in the audit log. It responds with 403 Forbidden if not.
+func authorizeApp(w http.ResponseWriter, r *http.Request, appName string) bool {
+	if record, ok := r.Context().Value(auditKey{}).(*auditRecord); ok {
+		record.appName = appName
+	}
+	principal := principalFromContext(r.Context())
+	if !principal.AllowsApp(appName) {
+		http.Error(w, fmt.Sprintf("Token '%s' isn't allowed to access app '%s'", principal.Name, appName), http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// authorizeTargetConfig is authorizeApp for the app config of a deployment. Tokens limited to some
+// apps may only deploy containers that stay within their app, since access to the host reaches
+// every other app too.
+func authorizeTargetConfig(w http.ResponseWriter, r *http.Request, targetConfig config.TargetConfig) bool {
+	if !authorizeApp(w, r, targetConfig.Name) {
+		return false
+	}
+	principal := principalFromContext(r.Context())
+	if principal.AllApps() {
+		return true
+	}
+	if access := targetConfig.HostAccess(); access != "" {
+		http.Error(w, fmt.Sprintf("Token '%s' is limited to some apps and can't deploy an app that %s", principal.Name, access), http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// authorizeDeployment is authorizeApp for the app of a deployment.
+func authorizeDeployment(w http.ResponseWriter, r *http.Request, deploymentID string) bool {
+	appName := ""
+	if db, err := storage.New(); err == nil {
+		if deployment, err := db.GetDeployment(deploymentID); err == nil {
+			appName = deployment.AppName
+		}
+		db.Close()
+	}
+	if appName == "" {
+		// Unknown deployments can only be looked at by tokens for all apps.
+		if principal := principalFromContext(r.Context()); !principal.AllApps() {
+			http.Error(w, fmt.Sprintf("Token '%s' isn't allowed to access deployment %s", principal.Name, deploymentID), http.StatusForbidden)
+			return false
+		}
+		return true
+	}
+	return authorizeApp(w, r, appName)
+}
+
+func saveAuditEvent(r *http.Request, principal apitoken.Principal, record *auditRecord, status int) {
+	db, err := storage.New()
+	if err != nil {
+		return
+	}
+	defer db.Close()
+
+	remoteAddr := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		remoteAddr = host
+	}
+	_ = db.SaveAuditEvent(storage.AuditEvent{
+		TokenName:  principal.Name,
+		Action:     r.Pattern,
+		AppName:    record.appName,
+		StatusCode: status,
+		RemoteAddr: remoteAddr,
+	})
+}
+
+// statusRecorder remembers the status code a handler responded with.
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (sr *statusRecorder) WriteHeader(status int) {
+	if !sr.wroteHeader {
+		sr.status = status
+		sr.wroteHeader = true
+	}
+	sr.ResponseWriter.WriteHeader(status)
+}
+
+func (sr *statusRecorder) Flush() {
+	if flusher, ok := sr.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (sr *statusRecorder) Unwrap() http.ResponseWriter {
+	return sr.ResponseWriter
+}
+
 // standardHeadersMiddleware applies headers for regular HTTP endpoints
 func (s *APIServer) headersMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
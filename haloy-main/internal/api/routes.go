@@ -1,19 +1,47 @@
 package api
 
+import (
+	"net/http"
+
+	"github.com/haloydev/haloy/internal/apitoken"
+)
+
 func (s *APIServer) setupRoutes() {
 	headers := chain(s.headersMiddleware, s.rateLimiter.Middleware)
 	headersWithAuth := chain(s.headersMiddleware, s.rateLimiter.Middleware, s.bearerTokenAuthMiddleware)
 	streamHeadersWithAuth := chain(s.streamHeadersMiddleware, s.rateLimiter.Middleware, s.bearerTokenAuthMiddleware)
 
+	// Authenticated routes require a token with the given scope.
+	withAuth := func(scope apitoken.Scope, h http.Handler) http.Handler {
+		return headersWithAuth(s.requireScope(scope, h))
+	}
+	streamWithAuth := func(scope apitoken.Scope, h http.Handler) http.Handler {
+		return streamHeadersWithAuth(s.requireScope(scope, h))
+	}
+
 	s.router.Handle("GET /health", headers(s.handleHealth()))
-	s.router.Handle("POST /v1/deploy", headersWithAuth(s.handleDeploy()))
-	s.router.Handle("GET /v1/deploy/{deploymentID}/logs", streamHeadersWithAuth(s.handleDeploymentLogs()))
-	s.router.Handle("POST /v1/images/upload", headersWithAuth(s.handleImageUpload()))
-	s.router.Handle("GET /v1/logs", streamHeadersWithAuth(s.handleLogs()))
-	s.router.Handle("GET /v1/rollback/{appName}", headersWithAuth(s.handleRollbackTargets()))
-	s.router.Handle("POST /v1/rollback", headersWithAuth(s.handleRollback()))
-	s.router.Handle("GET /v1/status/{appName}", headersWithAuth(s.handleAppStatus()))
-	s.router.Handle("POST /v1/stop/{appName}", headersWithAuth(s.handleStopApp()))
-	s.router.Handle("POST /v1/exec/{appName}", headersWithAuth(s.handleExec()))
-	s.router.Handle("GET /v1/version", headersWithAuth(s.handleVersion()))
+	s.router.Handle("POST /v1/deploy", withAuth(apitoken.ScopeDeploy, s.handleDeploy()))
+	s.router.Handle("GET /v1/deploy/{deploymentID}/logs", streamWithAuth(apitoken.ScopeRead, s.handleDeploymentLogs()))
+	s.router.Handle("POST /v1/deploy/{deploymentID}/cancel", withAuth(apitoken.ScopeDeploy, s.handleDeployCancel()))
+	s.router.Handle("GET /v1/deployments/queue", withAuth(apitoken.ScopeRead, s.handleDeployQueue()))
+	s.router.Handle("GET /v1/canary/{appName}", withAuth(apitoken.ScopeRead, s.handleCanaryStatus()))
+	s.router.Handle("POST /v1/canary/{appName}/weight", withAuth(apitoken.ScopeDeploy, s.handleCanaryWeight()))
+	s.router.Handle("POST /v1/canary/{appName}/promote", withAuth(apitoken.ScopeDeploy, s.handleCanaryPromote()))
+	s.router.Handle("POST /v1/canary/{appName}/abort", withAuth(apitoken.ScopeDeploy, s.handleCanaryAbort()))
+	s.router.Handle("POST /v1/promote/{appName}", withAuth(apitoken.ScopeDeploy, s.handlePromote()))
+	s.router.Handle("POST /v1/mirror/{appName}", withAuth(apitoken.ScopeDeploy, s.handleMirrorStart()))
+	s.router.Handle("POST /v1/mirror/{appName}/stop", withAuth(apitoken.ScopeDeploy, s.handleMirrorStop()))
+	s.router.Handle("GET /v1/mirror/{appName}/report", withAuth(apitoken.ScopeRead, s.handleMirrorReport()))
+	// An uploaded image can carry any tag, including those of other apps' images, so only
+	// tokens that may act on every app can upload.
+	s.router.Handle("POST /v1/images/upload", withAuth(apitoken.ScopeAdmin, s.handleImageUpload()))
+	s.router.Handle("GET /v1/logs", streamWithAuth(apitoken.ScopeRead, s.handleLogs()))
+	s.router.Handle("GET /v1/rollback/{appName}", withAuth(apitoken.ScopeRead, s.handleRollbackTargets()))
+	s.router.Handle("POST /v1/rollback", withAuth(apitoken.ScopeRollback, s.handleRollback()))
+	s.router.Handle("GET /v1/apps/{appName}/deployments", withAuth(apitoken.ScopeRead, s.handleAppDeployments()))
+	s.router.Handle("GET /v1/apps/{appName}/logs", streamWithAuth(apitoken.ScopeRead, s.handleAppLogs()))
+	s.router.Handle("GET /v1/status/{appName}", withAuth(apitoken.ScopeRead, s.handleAppStatus()))
+	s.router.Handle("POST /v1/stop/{appName}", withAuth(apitoken.ScopeStop, s.handleStopApp()))
+	s.router.Handle("POST /v1/exec/{appName}", withAuth(apitoken.ScopeExec, s.handleExec()))
+	s.router.Handle("GET /v1/version", withAuth(apitoken.ScopeRead, s.handleVersion()))
 }
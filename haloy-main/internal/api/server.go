@@ -1,11 +1,20 @@
 package api
 
 import (
+	"context"
+	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
+	"os"
+	"path/filepath"
+	"sync/atomic"
 	"time"
 
+	"github.com/haloydev/haloy/internal/config"
+	"github.com/haloydev/haloy/internal/deploy"
 	"github.com/haloydev/haloy/internal/logging"
+	"github.com/haloydev/haloy/internal/storage"
 	"golang.org/x/time/rate"
 )
 
@@ -13,22 +22,57 @@ type APIServer struct {
 	router      *http.ServeMux
 	logBroker   logging.StreamPublisher
 	logLevel    slog.Level
-	apiToken    string
+	apiTokens   atomic.Pointer[config.APITokens]
+	jwtVerifier *JWTVerifier
 	rateLimiter *RateLimiter
+	routing     RoutingController
+	deployQueue *deploy.Queue
 }
 
-func NewServer(apiToken string, logBroker logging.StreamPublisher, logLevel slog.Level) *APIServer {
+// RoutingController changes the routing of canary deployments and deployments waiting for
+// promotion, and mirrors traffic to the latter. It is implemented by haloyd, which owns the
+// HAProxy configuration.
+type RoutingController interface {
+	SetCanaryWeight(ctx context.Context, logger *slog.Logger, appName string, weight int) (storage.Canary, error)
+	PromoteCanary(ctx context.Context, logger *slog.Logger, appName string) error
+	AbortCanary(ctx context.Context, logger *slog.Logger, appName string) error
+	PromotePreview(ctx context.Context, logger *slog.Logger, appName, deploymentID string) error
+	StartMirror(ctx context.Context, logger *slog.Logger, appName, deploymentID string, allMethods bool) (storage.Mirror, error)
+	StopMirror(ctx context.Context, logger *slog.Logger, appName string) error
+}
+
+// NewServer creates the API server. Deployments and rollbacks it starts take their turn in
+// deployQueue, which haloyd shares with automatic rollbacks.
+func NewServer(apiTokens config.APITokens, logBroker logging.StreamPublisher, logLevel slog.Level, deployQueue *deploy.Queue) *APIServer {
 	s := &APIServer{
 		router:      http.NewServeMux(),
 		logBroker:   logBroker,
 		logLevel:    logLevel,
-		apiToken:    apiToken,
 		rateLimiter: NewRateLimiter(rate.Limit(5), 10), // 5 req/sec, burst of 10
+		deployQueue: deployQueue,
 	}
+	s.apiTokens.Store(&apiTokens)
 	s.setupRoutes()
 	return s
 }
 
+// SetAPITokens replaces the HALOY_API_TOKEN tokens. Requests that were authenticated already,
+// like open log streams, are not affected.
+func (s *APIServer) SetAPITokens(apiTokens config.APITokens) {
+	s.apiTokens.Store(&apiTokens)
+}
+
+// SetJWTVerifier makes the server accept JWTs of the verifier's issuers. It must be called
+// before the server starts listening.
+func (s *APIServer) SetJWTVerifier(v *JWTVerifier) {
+	s.jwtVerifier = v
+}
+
+// SetRoutingController must be called before the server starts listening.
+func (s *APIServer) SetRoutingController(c RoutingController) {
+	s.routing = c
+}
+
 func (s *APIServer) ListenAndServe(addr string) error {
 	srv := &http.Server{
 		Addr:              addr,
@@ -38,3 +82,55 @@ func (s *APIServer) ListenAndServe(addr string) error {
 	}
 	return srv.ListenAndServe()
 }
+
+// ListenAndServeUnix serves the API on a Unix socket. Who may connect is decided by the
+// socket's file permissions, so requests over it don't need a token and have the admin scope.
+func (s *APIServer) ListenAndServeUnix(path string) error {
+	listener, err := listenUnix(path)
+	if err != nil {
+		return err
+	}
+
+	srv := &http.Server{
+		Handler:           s.router,
+		ReadHeaderTimeout: 5 * time.Second,
+		IdleTimeout:       60 * time.Second,
+		ConnContext: func(ctx context.Context, c net.Conn) context.Context {
+			return context.WithValue(ctx, unixSocketKey{}, true)
+		},
+	}
+	return srv.Serve(listener)
+}
+
+// listenUnix listens on a Unix socket that only the user haloyd runs as, and its group, may
+// connect to. The socket is created in a directory only haloyd's user can enter and moved into
+// place once its permissions are set, so nobody else can connect before they are.
+func listenUnix(path string) (net.Listener, error) {
+	// A socket left behind by a haloyd that didn't shut down cleanly is replaced.
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSocket == 0 {
+		return nil, fmt.Errorf("%s exists and is not a socket", path)
+	}
+
+	dir, err := os.MkdirTemp(filepath.Dir(path), ".haloyd-sock-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create socket directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	tmpPath := filepath.Join(dir, filepath.Base(path))
+	listener, err := net.Listen("unix", tmpPath)
+	if err != nil {
+		return nil, err
+	}
+	// The socket file is unlinked by rename, not by closing the listener.
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+	if err := os.Chmod(tmpPath, 0o660); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to set socket permissions: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to move socket into place: %w", err)
+	}
+	return listener, nil
+}
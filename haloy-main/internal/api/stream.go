@@ -4,15 +4,22 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/haloydev/haloy/internal/logging"
 )
 
 type sseStreamConfig struct {
+	replay          []logging.LogEntry // Sent before the entries from logChan
 	logChan         <-chan logging.LogEntry
 	cleanup         func()
 	shouldTerminate func(logging.LogEntry) bool
+	include         func(logging.LogEntry) bool // Entries it returns false for aren't sent, nil sends all
+	// resumable sends the Seq of entries as SSE event IDs. A client reconnecting with the
+	// Last-Event-ID header gets the entries after it, which must be in replay if they aren't
+	// buffered anymore.
+	resumable bool
 }
 
 // streamSSELogs handles the common SSE streaming logic
@@ -31,6 +38,30 @@ func streamSSELogs(w http.ResponseWriter, r *http.Request, config sseStreamConfi
 	}
 	flusher.Flush()
 
+	// Entries up to lastSeq were sent already, to this client before it reconnected or from
+	// replay. The broker buffers recent entries, so the channel usually starts with some of them.
+	var lastSeq uint64
+	if config.resumable {
+		lastSeq = lastEventID(r)
+	}
+	for _, logEntry := range config.replay {
+		if lastSeq > 0 && logEntry.Seq <= lastSeq {
+			continue
+		}
+		if config.include != nil && !config.include(logEntry) {
+			continue
+		}
+		if err := writeSSELogEntry(w, logEntry, config.resumable); err != nil {
+			return
+		}
+		if config.shouldTerminate != nil && config.shouldTerminate(logEntry) {
+			flusher.Flush()
+			return
+		}
+		lastSeq = max(lastSeq, logEntry.Seq)
+	}
+	flusher.Flush()
+
 	ctx := r.Context()
 	keepaliveTicker := time.NewTicker(30 * time.Second)
 	defer keepaliveTicker.Stop()
@@ -50,11 +81,18 @@ func streamSSELogs(w http.ResponseWriter, r *http.Request, config sseStreamConfi
 			if !ok {
 				return
 			}
+			if lastSeq > 0 && logEntry.Seq <= lastSeq {
+				continue
+			}
+			if config.include != nil && !config.include(logEntry) {
+				continue
+			}
 
-			if err := writeSSEMessage(w, logEntry); err != nil {
+			if err := writeSSELogEntry(w, logEntry, config.resumable); err != nil {
 				return
 			}
 			flusher.Flush()
+			lastSeq = max(lastSeq, logEntry.Seq)
 
 			// Check if we should terminate the stream
 			if config.shouldTerminate != nil && config.shouldTerminate(logEntry) {
@@ -64,8 +102,28 @@ func streamSSELogs(w http.ResponseWriter, r *http.Request, config sseStreamConfi
 	}
 }
 
+// lastEventID returns the ID of the last event a reconnecting client got, 0 if it has none.
+func lastEventID(r *http.Request) uint64 {
+	id, err := strconv.ParseUint(r.Header.Get("Last-Event-ID"), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return id
+}
+
+// writeSSELogEntry writes a log entry as Server-Sent Event, with its Seq as the event ID if
+// withID is set.
+func writeSSELogEntry(w http.ResponseWriter, entry logging.LogEntry, withID bool) error {
+	if withID && entry.Seq != 0 {
+		if _, err := fmt.Fprintf(w, "id: %d\n", entry.Seq); err != nil {
+			return fmt.Errorf("failed to write SSE id: %w", err)
+		}
+	}
+	return writeSSEMessage(w, entry)
+}
+
 // writeSSEMessage writes a log entry as Server-Sent Event
-func writeSSEMessage(w http.ResponseWriter, entry logging.LogEntry) error {
+func writeSSEMessage(w http.ResponseWriter, entry any) error {
 	data, err := json.Marshal(entry)
 	if err != nil {
 		return fmt.Errorf("failed to marshal log entry: %w", err)
@@ -10,23 +10,31 @@ import (
 	"fmt"
 	"io"
 	"mime/multipart"
+	"net"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
 	"time"
 
+	"github.com/haloydev/haloy/internal/config"
 	"github.com/haloydev/haloy/internal/constants"
 	"github.com/haloydev/haloy/internal/helpers"
+	"github.com/haloydev/haloy/internal/sshrunner"
 )
 
-var ErrNotFound = errors.New("resource not found")
+var (
+	ErrNotFound = errors.New("resource not found")
+	ErrConflict = errors.New("conflict")
+)
 
 // APIClient handles communication with the haloy API
 type APIClient struct {
-	client   *http.Client
-	baseURL  string
-	apiToken string
+	client    *http.Client
+	transport *http.Transport
+	baseURL   string
+	server    string // Where the server is reached, for errors
+	apiToken  string
 }
 
 func New(url, token string) (*APIClient, error) {
@@ -39,18 +47,95 @@ func NewWithTimeout(url, token string, timeout time.Duration) (*APIClient, error
 		return nil, fmt.Errorf("failed to normalize url: %w", err)
 	}
 	serverUrl := helpers.BuildServerURL(normalizedUrl)
+	server := serverUrl
+
+	serverConfig, _, err := config.ServerConfigFor(normalizedUrl)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load client config: %w", err)
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if helpers.IsSSHServerURL(normalizedUrl) {
+		dial, err := sshDialer(normalizedUrl, serverConfig)
+		if err != nil {
+			return nil, err
+		}
+		transport.Proxy = nil
+		transport.DialContext = dial
+		server = normalizedUrl
+	} else {
+		tlsConfig, err := clientTLSConfig(normalizedUrl, serverConfig)
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig = tlsConfig
+	}
 
 	cli := &APIClient{
 		client: &http.Client{
-			Timeout: timeout,
+			Timeout:   timeout,
+			Transport: transport,
 		},
-		baseURL:  serverUrl,
-		apiToken: token,
+		transport: transport,
+		baseURL:   serverUrl,
+		server:    server,
+		apiToken:  token,
 	}
 
 	return cli, nil
 }
 
+// clientTLSConfig returns the TLS config presenting the client certificate configured for the
+// server, or nil if it has none.
+func clientTLSConfig(normalizedURL string, serverConfig config.ServerConfig) (*tls.Config, error) {
+	if serverConfig.ClientCert == "" {
+		return nil, nil
+	}
+	cert, err := tls.LoadX509KeyPair(serverConfig.ClientCert, serverConfig.ClientKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load client certificate for %s: %w", normalizedURL, err)
+	}
+	return &tls.Config{Certificates: []tls.Certificate{cert}}, nil
+}
+
+// sshDialer returns a dial function that tunnels every connection over SSH to the API socket
+// on the server, through 'haloyadm api connect'. Access to the socket is decided by the SSH
+// user's permissions on the server, so no API token is needed.
+func sshDialer(normalizedURL string, serverConfig config.ServerConfig) (func(ctx context.Context, network, addr string) (net.Conn, error), error) {
+	user, host, port, err := helpers.ParseSSHServerURL(normalizedURL)
+	if err != nil {
+		return nil, err
+	}
+	sshConfig := sshrunner.Config{
+		User:     user,
+		Host:     host,
+		Port:     port,
+		Identity: serverConfig.SSHIdentity,
+	}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return sshrunner.DialCommand(ctx, sshConfig, "haloyadm api connect")
+	}, nil
+}
+
+// NewUnix creates a client for the API socket of haloyd running on this machine. Requests
+// over it don't need an API token.
+func NewUnix(socketPath string) *APIClient {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, "unix", socketPath)
+	}
+	return &APIClient{
+		client: &http.Client{
+			Timeout:   30 * time.Second,
+			Transport: transport,
+		},
+		transport: transport,
+		baseURL:   "http://haloyd",
+		server:    socketPath,
+	}
+}
+
 func (c *APIClient) setAuthHeader(req *http.Request) {
 	if c.apiToken != "" {
 		req.Header.Set("Authorization", "Bearer "+c.apiToken)
@@ -79,7 +164,7 @@ func (c *APIClient) HealthCheck(ctx context.Context) error {
 
 func (c *APIClient) Get(ctx context.Context, path string, v any) error {
 	if err := c.HealthCheck(ctx); err != nil {
-		return fmt.Errorf("server not available at %s: %w", c.baseURL, err)
+		return fmt.Errorf("server not available at %s: %w", c.server, err)
 	}
 
 	url := fmt.Sprintf("%s/v1/%s", c.baseURL, path)
@@ -116,7 +201,7 @@ func (c *APIClient) Get(ctx context.Context, path string, v any) error {
 
 func (c *APIClient) Post(ctx context.Context, path string, request, response any) error {
 	if err := c.HealthCheck(ctx); err != nil {
-		return fmt.Errorf("server not available at %s: %w", c.baseURL, err)
+		return fmt.Errorf("server not available at %s: %w", c.server, err)
 	}
 
 	var jsonData []byte
@@ -161,6 +246,12 @@ func (c *APIClient) Post(ctx context.Context, path string, request, response any
 		if resp.StatusCode == http.StatusUnauthorized {
 			return fmt.Errorf("authentication failed - check your %s", constants.EnvVarAPIToken)
 		}
+		if resp.StatusCode == http.StatusNotFound {
+			return fmt.Errorf("%w: %s", ErrNotFound, errorMessage)
+		}
+		if resp.StatusCode == http.StatusConflict {
+			return fmt.Errorf("%w: %s", ErrConflict, errorMessage)
+		}
 		return fmt.Errorf("POST request failed with status %d: %s", resp.StatusCode, errorMessage)
 	}
 
@@ -176,7 +267,7 @@ func (c *APIClient) Post(ctx context.Context, path string, request, response any
 // PostFile uploads a file using multipart form data
 func (c *APIClient) PostFile(ctx context.Context, path, fieldName, filePath string) error {
 	if err := c.HealthCheck(ctx); err != nil {
-		return fmt.Errorf("server not available at %s: %w", c.baseURL, err)
+		return fmt.Errorf("server not available at %s: %w", c.server, err)
 	}
 
 	file, err := os.Open(filePath)
@@ -239,12 +330,11 @@ func (c *APIClient) PostFile(ctx context.Context, path, fieldName, filePath stri
 // Generic streaming method that handles any SSE endpoint
 func (c *APIClient) Stream(ctx context.Context, path string, handler func(data string) bool) error {
 	// Create transport that forces HTTP/1.1 to avoid HTTP/2 stream cancellation
-	streamingTransport := &http.Transport{
-		ForceAttemptHTTP2: false, // Force HTTP/1.1
-		TLSNextProto:      make(map[string]func(authority string, c *tls.Conn) http.RoundTripper),
-		IdleConnTimeout:   0,     // No idle timeout
-		DisableKeepAlives: false, // Keep connections alive
-	}
+	streamingTransport := c.transport.Clone()
+	streamingTransport.ForceAttemptHTTP2 = false // Force HTTP/1.1
+	streamingTransport.TLSNextProto = make(map[string]func(authority string, c *tls.Conn) http.RoundTripper)
+	streamingTransport.IdleConnTimeout = 0       // No idle timeout
+	streamingTransport.DisableKeepAlives = false // Keep connections alive
 	streamingClient := &http.Client{Timeout: 0, Transport: streamingTransport}
 
 	url := fmt.Sprintf("%s/v1/%s", c.baseURL, path)
@@ -268,10 +358,18 @@ func (c *APIClient) Stream(ctx context.Context, path string, handler func(data s
 		if resp.StatusCode == http.StatusUnauthorized {
 			return fmt.Errorf("authentication failed for stream - check your %s", constants.EnvVarAPIToken)
 		}
+		if resp.StatusCode == http.StatusNotFound {
+			return fmt.Errorf("%w: stream returned status %d", ErrNotFound, resp.StatusCode)
+		}
+		if message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024)); len(bytes.TrimSpace(message)) > 0 {
+			return fmt.Errorf("stream returned status %d: %s", resp.StatusCode, bytes.TrimSpace(message))
+		}
 		return fmt.Errorf("stream returned status %d", resp.StatusCode)
 	}
 
 	scanner := bufio.NewScanner(resp.Body)
+	// App log lines can be up to a megabyte, and are a bit longer as JSON.
+	scanner.Buffer(make([]byte, 0, 64*1024), 2*1024*1024)
 	for scanner.Scan() {
 		select {
 		case <-ctx.Done():
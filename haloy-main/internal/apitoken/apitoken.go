@@ -0,0 +1,127 @@
+// Package apitoken holds the scopes of named API tokens and checks what a token may do.
+package apitoken
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+type Scope string
+
+const (
+	ScopeRead     Scope = "read"     // Status, history, logs and other listings
+	ScopeDeploy   Scope = "deploy"   // Deploy, cancel, promote and change canaries and mirrors
+	ScopeRollback Scope = "rollback" // Roll back to an earlier deployment
+	ScopeExec     Scope = "exec"     // Run commands in app containers
+	ScopeStop     Scope = "stop"     // Stop apps
+	ScopeAdmin    Scope = "admin"    // Everything, on every app, including uploading images
+)
+
+// Scopes lists every scope a token can have.
+var Scopes = []Scope{ScopeRead, ScopeDeploy, ScopeRollback, ScopeExec, ScopeStop, ScopeAdmin}
+
+// tokenPrefix starts every generated token, so they are easy to recognize in config files
+// and secret scanners.
+const tokenPrefix = "haloy_"
+
+var nameRegex = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]{0,62}$`)
+
+// Principal is who made an API request: the name of their token and what it allows.
+type Principal struct {
+	Name string
+	// Subject is the "sub" claim of JWTs, recorded as who started deployments made with them.
+	Subject string
+	Scopes  []Scope
+	// Apps are glob patterns of the app names the token may act on. Empty for all apps.
+	Apps []string
+}
+
+// HasScope reports whether the token has the scope. Admin tokens have every scope.
+func (p Principal) HasScope(scope Scope) bool {
+	return slices.Contains(p.Scopes, ScopeAdmin) || slices.Contains(p.Scopes, scope)
+}
+
+// AllApps reports whether the token may act on every app.
+func (p Principal) AllApps() bool {
+	return len(p.Apps) == 0 || slices.Contains(p.Scopes, ScopeAdmin)
+}
+
+// AllowsApp reports whether the token may act on the app.
+func (p Principal) AllowsApp(appName string) bool {
+	if p.AllApps() {
+		return true
+	}
+	for _, pattern := range p.Apps {
+		if ok, err := path.Match(pattern, appName); err == nil && ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Generate returns a new random token.
+func Generate() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	return tokenPrefix + hex.EncodeToString(b), nil
+}
+
+// Hash returns the hash stored for a token. Tokens are random, so a fast hash is enough.
+func Hash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func ValidateName(name string) error {
+	if !nameRegex.MatchString(name) {
+		return fmt.Errorf("token name '%s' must start with a letter or digit and contain only letters, digits, '.', '_' and '-'", name)
+	}
+	return nil
+}
+
+// ParseScopes parses scope names, like those given on the command line.
+func ParseScopes(values []string) ([]Scope, error) {
+	if len(values) == 0 {
+		return nil, fmt.Errorf("at least one scope is required")
+	}
+	scopes := make([]Scope, 0, len(values))
+	for _, value := range values {
+		scope := Scope(strings.TrimSpace(value))
+		if !slices.Contains(Scopes, scope) {
+			return nil, fmt.Errorf("unknown scope '%s', must be one of %s", value, JoinScopes(Scopes))
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes, nil
+}
+
+// ValidateAppPatterns checks that app name patterns are valid globs.
+func ValidateAppPatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if pattern == "" {
+			return fmt.Errorf("app pattern can't be empty")
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid app pattern '%s': %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+func JoinScopes(scopes []Scope) string {
+	names := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		names = append(names, string(scope))
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,81 @@
+package apitoken
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPrincipal_HasScope(t *testing.T) {
+	deployer := Principal{Name: "ci", Scopes: []Scope{ScopeRead, ScopeDeploy}}
+	if !deployer.HasScope(ScopeDeploy) || !deployer.HasScope(ScopeRead) {
+		t.Error("expected deployer to have its own scopes")
+	}
+	if deployer.HasScope(ScopeExec) {
+		t.Error("expected deployer not to have exec scope")
+	}
+
+	admin := Principal{Name: "ops", Scopes: []Scope{ScopeAdmin}}
+	for _, scope := range Scopes {
+		if !admin.HasScope(scope) {
+			t.Errorf("expected admin to have %s scope", scope)
+		}
+	}
+}
+
+func TestPrincipal_AllowsApp(t *testing.T) {
+	tests := []struct {
+		name      string
+		principal Principal
+		app       string
+		want      bool
+	}{
+		{name: "no patterns", principal: Principal{Scopes: []Scope{ScopeRead}}, app: "web", want: true},
+		{name: "exact", principal: Principal{Scopes: []Scope{ScopeRead}, Apps: []string{"web"}}, app: "web", want: true},
+		{name: "glob", principal: Principal{Scopes: []Scope{ScopeRead}, Apps: []string{"web-*"}}, app: "web-staging", want: true},
+		{name: "glob miss", principal: Principal{Scopes: []Scope{ScopeRead}, Apps: []string{"web-*"}}, app: "api", want: false},
+		{name: "second pattern", principal: Principal{Scopes: []Scope{ScopeRead}, Apps: []string{"web-*", "api"}}, app: "api", want: true},
+		{name: "admin ignores patterns", principal: Principal{Scopes: []Scope{ScopeAdmin}, Apps: []string{"web"}}, app: "api", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.principal.AllowsApp(tt.app); got != tt.want {
+				t.Errorf("AllowsApp(%q) = %v, want %v", tt.app, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseScopes(t *testing.T) {
+	scopes, err := ParseScopes([]string{"read", "deploy", "read"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(scopes) != 2 || scopes[0] != ScopeRead || scopes[1] != ScopeDeploy {
+		t.Errorf("ParseScopes() = %v, want [read deploy]", scopes)
+	}
+
+	if _, err := ParseScopes(nil); err == nil {
+		t.Error("expected error for no scopes")
+	}
+	if _, err := ParseScopes([]string{"write"}); err == nil {
+		t.Error("expected error for unknown scope")
+	}
+}
+
+func TestGenerateAndHash(t *testing.T) {
+	token, err := Generate()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(token, tokenPrefix) {
+		t.Errorf("token %q should start with %q", token, tokenPrefix)
+	}
+	other, _ := Generate()
+	if token == other {
+		t.Error("expected generated tokens to differ")
+	}
+	if Hash(token) != Hash(token) || Hash(token) == Hash(other) {
+		t.Error("expected hash to be deterministic and distinct per token")
+	}
+}
@@ -1,6 +1,8 @@
 package apitypes
 
 import (
+	"time"
+
 	"github.com/haloydev/haloy/internal/config"
 	"github.com/haloydev/haloy/internal/deploytypes"
 )
@@ -16,29 +18,122 @@ type DeployRequest struct {
 	TargetConfig config.TargetConfig `json:"targetConfig"`
 	// AppConfig without resolved secrets and with target extracted. Saved on server for rollbacks
 	RollbackAppConfig config.AppConfig `json:"rollbackAppConfig"`
+	// NoPromote keeps the app's domains on the live deployment until 'haloy promote' is run.
+	NoPromote bool `json:"noPromote,omitempty"`
+	// NoQueue rejects the deployment with 409 Conflict instead of waiting when the app is already being deployed.
+	NoQueue bool `json:"noQueue,omitempty"`
+	// DeployedBy identifies who started the deployment, like user@host. Stored with the deployment.
+	DeployedBy string `json:"deployedBy,omitempty"`
+	// Metadata holds the git commit of the config directory, the deploy message and labels.
+	Metadata config.DeployMetadata `json:"metadata"`
 }
 
 type RollbackRequest struct {
 	TargetDeploymentID string              `json:"targetDeploymentID"`
 	NewDeploymentID    string              `json:"newDeploymentID"`
 	NewTargetConfig    config.TargetConfig `json:"newTargetConfig"`
+	DeployedBy         string              `json:"deployedBy,omitempty"`
 }
 
 type RollbackTargetsResponse struct {
 	Targets []deploytypes.RollbackTarget `json:"targets"`
 }
 
+type DeployQueueResponse struct {
+	Deployments []deploytypes.QueuedDeployment `json:"deployments"`
+}
+
+type AppDeploymentsResponse struct {
+	Deployments []deploytypes.DeploymentRecord `json:"deployments"`
+}
+
+type DeployCancelResponse struct {
+	DeploymentID string `json:"deploymentId"`
+	Message      string `json:"message"`
+}
+
 type AppStatusResponse struct {
 	State        string          `json:"state"`
 	DeploymentID string          `json:"deploymentId"`
 	ContainerIDs []string        `json:"containerIds"`
 	Domains      []config.Domain `json:"domains"`
+	// ReachableDeploymentIDs lists the running deployments that requests with the deployment
+	// routing secret can pick. Empty when deployment routing is disabled.
+	ReachableDeploymentIDs []string `json:"reachableDeploymentIds,omitempty"`
+	// Metadata of the latest deployment, read from its container labels.
+	Metadata config.DeployMetadata `json:"metadata"`
 }
 
 type StopAppResponse struct {
 	Message string `json:"message,omitempty"`
 }
 
+type CanaryStatusResponse struct {
+	StableDeploymentID string `json:"stableDeploymentId"`
+	CanaryDeploymentID string `json:"canaryDeploymentId"`
+	Weight             int    `json:"weight"` // Percentage of traffic sent to the canary
+}
+
+type CanaryWeightRequest struct {
+	Weight int `json:"weight"`
+}
+
+type CanaryActionResponse struct {
+	Message string `json:"message,omitempty"`
+}
+
+type PromoteRequest struct {
+	DeploymentID string `json:"deploymentId"`
+}
+
+type PromoteResponse struct {
+	Message string `json:"message,omitempty"`
+}
+
+type MirrorStartRequest struct {
+	DeploymentID string `json:"deploymentId"`
+	AllMethods   bool   `json:"allMethods,omitempty"` // Also mirror requests that may change state, like POST
+}
+
+type MirrorStatusResponse struct {
+	LiveDeploymentID      string `json:"liveDeploymentId"`
+	CandidateDeploymentID string `json:"candidateDeploymentId"`
+	AllMethods            bool   `json:"allMethods"`
+}
+
+type MirrorActionResponse struct {
+	Message string `json:"message,omitempty"`
+}
+
+// MirrorReportResponse compares the live responses with the candidate's responses to the
+// mirrored requests. Latencies of failed copies are left out.
+type MirrorReportResponse struct {
+	CandidateDeploymentID string           `json:"candidateDeploymentId"`
+	Active                bool             `json:"active"` // Whether requests are still being mirrored
+	Requests              int              `json:"requests"`
+	StatusMatches         int              `json:"statusMatches"`
+	StatusMismatches      int              `json:"statusMismatches"`
+	MirrorErrors          int              `json:"mirrorErrors"` // Copies that got no response
+	LiveLatency           MirrorLatency    `json:"liveLatency"`
+	CandidateLatency      MirrorLatency    `json:"candidateLatency"`
+	Mismatches            []MirrorMismatch `json:"mismatches,omitempty"` // Most frequent first
+}
+
+type MirrorLatency struct {
+	P50Ms int64 `json:"p50Ms"`
+	P95Ms int64 `json:"p95Ms"`
+	P99Ms int64 `json:"p99Ms"`
+	MaxMs int64 `json:"maxMs"`
+}
+
+type MirrorMismatch struct {
+	Method       string `json:"method"`
+	Path         string `json:"path"`
+	LiveStatus   int    `json:"liveStatus"`
+	MirrorStatus int    `json:"mirrorStatus"`
+	Count        int    `json:"count"`
+}
+
 type ImageUploadResponse struct {
 	Success bool   `json:"success"`
 	Message string `json:"message"`
@@ -66,3 +161,12 @@ type ExecResult struct {
 type ExecResponse struct {
 	Results []ExecResult `json:"results"`
 }
+
+// AppLogEntry is a line printed by one of an app's containers.
+type AppLogEntry struct {
+	Timestamp   time.Time `json:"timestamp"`
+	Replica     string    `json:"replica"` // Like replica-2, after the deployment ID when several deployments are running
+	ContainerID string    `json:"containerId"`
+	Stream      string    `json:"stream"` // stdout or stderr
+	Line        string    `json:"line"`
+}
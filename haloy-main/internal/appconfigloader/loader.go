@@ -190,6 +190,18 @@ func MergeToTarget(appConfig config.AppConfig, targetConfig config.TargetConfig,
 		tc.ACMEEmail = appConfig.ACMEEmail
 	}
 
+	if tc.PreviewDomain == "" {
+		tc.PreviewDomain = appConfig.PreviewDomain
+	}
+
+	if tc.AutoRollback == nil {
+		tc.AutoRollback = appConfig.AutoRollback
+	}
+
+	if tc.DeploymentRouting == nil {
+		tc.DeploymentRouting = appConfig.DeploymentRouting
+	}
+
 	// Merge Env arrays if the target has an explicit Env block, otherwise inherit (which is handled by copier)
 	// Only merge if both base and target have elements. If target.Env is nil (copied from targetConfig, which is nil),
 	// it will inherit the base config value. If target.Env is non-nil (meaning it was set explicitly in the target block,
@@ -230,6 +242,22 @@ func MergeToTarget(appConfig config.AppConfig, targetConfig config.TargetConfig,
 		tc.PostDeploy = appConfig.PostDeploy
 	}
 
+	if tc.StopSignal == "" {
+		tc.StopSignal = appConfig.StopSignal
+	}
+
+	if tc.StopTimeout == "" {
+		tc.StopTimeout = appConfig.StopTimeout
+	}
+
+	if tc.DrainTimeout == "" {
+		tc.DrainTimeout = appConfig.DrainTimeout
+	}
+
+	if tc.IdleTimeout == "" {
+		tc.IdleTimeout = appConfig.IdleTimeout
+	}
+
 	normalizeTargetConfig(&tc)
 
 	return tc, nil
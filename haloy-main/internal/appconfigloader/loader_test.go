@@ -365,6 +365,64 @@ func TestMergeToTarget(t *testing.T) {
 	}
 }
 
+func TestMergeToTarget_StopAndDrainSettings(t *testing.T) {
+	appConfig := config.AppConfig{
+		TargetConfig: config.TargetConfig{
+			Name:         "myapp",
+			Server:       "default.haloy.dev",
+			StopSignal:   "SIGQUIT",
+			StopTimeout:  "30s",
+			DrainTimeout: "1m",
+			IdleTimeout:  "1h",
+		},
+	}
+
+	result, err := MergeToTarget(appConfig, config.TargetConfig{DrainTimeout: "2m"}, "prod", "yaml")
+	if err != nil {
+		t.Fatalf("MergeToTarget() unexpected error = %v", err)
+	}
+
+	if result.StopSignal != "SIGQUIT" {
+		t.Errorf("MergeToTarget() StopSignal = %s, expected SIGQUIT", result.StopSignal)
+	}
+	if result.StopTimeout != "30s" {
+		t.Errorf("MergeToTarget() StopTimeout = %s, expected 30s", result.StopTimeout)
+	}
+	if result.DrainTimeout != "2m" {
+		t.Errorf("MergeToTarget() DrainTimeout = %s, expected 2m", result.DrainTimeout)
+	}
+	if result.IdleTimeout != "1h" {
+		t.Errorf("MergeToTarget() IdleTimeout = %s, expected 1h", result.IdleTimeout)
+	}
+}
+
+func TestMergeToTarget_AutoRollback(t *testing.T) {
+	appConfig := config.AppConfig{
+		TargetConfig: config.TargetConfig{
+			Name:         "myapp",
+			Server:       "default.haloy.dev",
+			AutoRollback: &config.AutoRollback{Window: "5m"},
+		},
+	}
+
+	result, err := MergeToTarget(appConfig, config.TargetConfig{}, "prod", "yaml")
+	if err != nil {
+		t.Fatalf("MergeToTarget() unexpected error = %v", err)
+	}
+	if result.AutoRollback == nil || result.AutoRollback.Window != "5m" {
+		t.Errorf("MergeToTarget() AutoRollback = %+v, expected window 5m from base config", result.AutoRollback)
+	}
+
+	override := config.TargetConfig{AutoRollback: &config.AutoRollback{Window: "1m"}}
+	result, err = MergeToTarget(appConfig, override, "staging", "yaml")
+	if err != nil {
+		t.Fatalf("MergeToTarget() unexpected error = %v", err)
+	}
+	if result.AutoRollback == nil || result.AutoRollback.Window != "1m" {
+		t.Errorf("MergeToTarget() AutoRollback = %+v, expected window 1m from target", result.AutoRollback)
+	}
+}
+
 func TestMergeImage(t *testing.T) {
 	baseImage := &config.Image{
 		Repository: "nginx",
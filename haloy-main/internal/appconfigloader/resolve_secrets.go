@@ -50,6 +50,10 @@ func gatherValueSources(appConfig *config.AppConfig) []*config.ValueSource {
 		sources = append(sources, &appConfig.Env[i].ValueSource)
 	}
 
+	if appConfig.DeploymentRouting != nil && appConfig.DeploymentRouting.Enabled {
+		sources = append(sources, &appConfig.DeploymentRouting.Secret)
+	}
+
 	if appConfig.Image != nil {
 		sources = append(sources, gatherImageValueSources(appConfig.Image)...)
 	}
@@ -93,6 +97,10 @@ func gatherTargetValueSources(tc *config.TargetConfig) []*config.ValueSource {
 		sources = append(sources, &tc.Env[i].ValueSource)
 	}
 
+	if tc.DeploymentRouting != nil && tc.DeploymentRouting.Enabled {
+		sources = append(sources, &tc.DeploymentRouting.Secret)
+	}
+
 	if tc.Image != nil {
 		sources = append(sources, gatherImageValueSources(tc.Image)...)
 	}
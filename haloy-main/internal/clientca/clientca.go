@@ -0,0 +1,199 @@
+// Package clientca manages the CA haloyd issues API client certificates from, which HAProxy
+// verifies when the API requires client certificates.
+package clientca
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/haloydev/haloy/internal/config"
+	"github.com/haloydev/haloy/internal/constants"
+	"github.com/haloydev/haloy/internal/helpers"
+)
+
+const caValidity = 10 * 365 * 24 * time.Hour
+
+type CA struct {
+	cert    *x509.Certificate
+	certPEM []byte
+	key     crypto.Signer
+}
+
+// Dir returns the directory the CA is stored in.
+func Dir() (string, error) {
+	dataDir, err := config.DataDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to determine data directory: %w", err)
+	}
+	return filepath.Join(dataDir, constants.ClientCADir), nil
+}
+
+// LoadOrCreate loads the CA from dir, creating it first if it doesn't exist. It reports
+// whether the CA was created.
+func LoadOrCreate(dir string) (*CA, bool, error) {
+	certPath := filepath.Join(dir, constants.ClientCACertFileName)
+	keyPath := filepath.Join(dir, constants.ClientCAKeyFileName)
+
+	if _, err := os.Stat(certPath); errors.Is(err, os.ErrNotExist) {
+		ca, err := create(dir, certPath, keyPath)
+		return ca, err == nil, err
+	}
+
+	certPEM, err := os.ReadFile(certPath)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read client CA certificate: %w", err)
+	}
+	keyPEM, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read client CA key: %w", err)
+	}
+
+	certBlock, _ := pem.Decode(certPEM)
+	if certBlock == nil {
+		return nil, false, fmt.Errorf("invalid client CA certificate in %s", certPath)
+	}
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to parse client CA certificate: %w", err)
+	}
+	keyBlock, _ := pem.Decode(keyPEM)
+	if keyBlock == nil {
+		return nil, false, fmt.Errorf("invalid client CA key in %s", keyPath)
+	}
+	key, err := x509.ParseECPrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to parse client CA key: %w", err)
+	}
+
+	return &CA{cert: cert, certPEM: certPEM, key: key}, false, nil
+}
+
+func create(dir, certPath, keyPath string) (*CA, error) {
+	if err := os.MkdirAll(dir, constants.ModeDirPrivate); err != nil {
+		return nil, fmt.Errorf("failed to create client CA directory: %w", err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate client CA key: %w", err)
+	}
+	serial, err := serialNumber()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "haloy API client CA", Organization: []string{"haloy"}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(caValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create client CA certificate: %w", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse client CA certificate: %w", err)
+	}
+
+	keyPEM, err := encodeKey(key)
+	if err != nil {
+		return nil, err
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+
+	if err := os.WriteFile(keyPath, keyPEM, constants.ModeFileSecret); err != nil {
+		return nil, fmt.Errorf("failed to write client CA key: %w", err)
+	}
+	if err := os.WriteFile(certPath, certPEM, constants.ModeFileDefault); err != nil {
+		return nil, fmt.Errorf("failed to write client CA certificate: %w", err)
+	}
+
+	return &CA{cert: cert, certPEM: certPEM, key: key}, nil
+}
+
+// CertPEM returns the CA certificate, which HAProxy verifies client certificates with.
+func (ca *CA) CertPEM() []byte {
+	return ca.certPEM
+}
+
+// Issue returns a new client certificate and its key for name, valid for validity.
+func (ca *CA) Issue(name string, validity time.Duration) (certPEM, keyPEM []byte, expiresAt time.Time, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, time.Time{}, fmt.Errorf("failed to generate key: %w", err)
+	}
+	serial, err := serialNumber()
+	if err != nil {
+		return nil, nil, time.Time{}, err
+	}
+
+	now := time.Now()
+	expiresAt = now.Add(validity)
+	// The CA can't sign certificates that outlive it.
+	if expiresAt.After(ca.cert.NotAfter) {
+		expiresAt = ca.cert.NotAfter
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name, Organization: []string{"haloy"}},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     expiresAt,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		return nil, nil, time.Time{}, fmt.Errorf("failed to create certificate: %w", err)
+	}
+
+	keyPEM, err = encodeKey(key)
+	if err != nil {
+		return nil, nil, time.Time{}, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), keyPEM, expiresAt, nil
+}
+
+// InstallForHAProxy copies the CA certificate into HAProxy's config directory.
+func (ca *CA) InstallForHAProxy(haproxyConfigDir string) error {
+	if err := helpers.EnsureDir(haproxyConfigDir); err != nil {
+		return fmt.Errorf("failed to create HAProxy config directory: %w", err)
+	}
+	path := filepath.Join(haproxyConfigDir, constants.HAProxyClientCAFileName)
+	if err := os.WriteFile(path, ca.certPEM, constants.ModeFileDefault); err != nil {
+		return fmt.Errorf("failed to write client CA certificate for HAProxy: %w", err)
+	}
+	return nil
+}
+
+func encodeKey(key *ecdsa.PrivateKey) ([]byte, error) {
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode key: %w", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), nil
+}
+
+func serialNumber() (*big.Int, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate serial number: %w", err)
+	}
+	return serial, nil
+}
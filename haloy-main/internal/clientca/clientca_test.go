@@ -0,0 +1,142 @@
+package clientca
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/haloydev/haloy/internal/constants"
+)
+
+func parseCert(t *testing.T, certPEM []byte) *x509.Certificate {
+	t.Helper()
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		t.Fatal("no PEM block in certificate")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestLoadOrCreate(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "client-ca")
+
+	ca, created, err := LoadOrCreate(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !created {
+		t.Error("expected the CA to be created")
+	}
+	if cert := parseCert(t, ca.CertPEM()); !cert.IsCA || cert.Subject.CommonName != "haloy API client CA" {
+		t.Errorf("unexpected CA certificate: IsCA=%v subject=%s", cert.IsCA, cert.Subject)
+	}
+	info, err := os.Stat(filepath.Join(dir, constants.ClientCAKeyFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != constants.ModeFileSecret {
+		t.Errorf("CA key has mode %v, want %v", info.Mode().Perm(), constants.ModeFileSecret)
+	}
+
+	loaded, created, err := LoadOrCreate(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created {
+		t.Error("expected the existing CA to be loaded")
+	}
+	if string(loaded.CertPEM()) != string(ca.CertPEM()) {
+		t.Error("loaded CA certificate differs from the created one")
+	}
+}
+
+func TestLoadOrCreateInvalid(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, constants.ClientCACertFileName), []byte("not a certificate"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := LoadOrCreate(dir); err == nil {
+		t.Error("expected an error for an invalid CA certificate")
+	}
+}
+
+func TestIssue(t *testing.T) {
+	ca, _, err := LoadOrCreate(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certPEM, keyPEM, expiresAt, err := ca.Issue("ci", 24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := parseCert(t, certPEM)
+	if cert.Subject.CommonName != "ci" {
+		t.Errorf("got common name %q, want ci", cert.Subject.CommonName)
+	}
+	if !cert.NotAfter.Equal(expiresAt.Truncate(time.Second)) {
+		t.Errorf("certificate expires %v, reported %v", cert.NotAfter, expiresAt)
+	}
+	if block, _ := pem.Decode(keyPEM); block == nil || block.Type != "EC PRIVATE KEY" {
+		t.Error("expected an EC private key")
+	}
+
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(ca.CertPEM())
+	if _, err := cert.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}); err != nil {
+		t.Errorf("issued certificate doesn't verify against the CA: %v", err)
+	}
+	if _, err := cert.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}}); err == nil {
+		t.Error("issued certificate shouldn't be usable by servers")
+	}
+
+	other, _, err := LoadOrCreate(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherRoots := x509.NewCertPool()
+	otherRoots.AppendCertsFromPEM(other.CertPEM())
+	if _, err := cert.Verify(x509.VerifyOptions{Roots: otherRoots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}); err == nil {
+		t.Error("issued certificate verifies against another CA")
+	}
+}
+
+func TestIssueCappedByCA(t *testing.T) {
+	ca, _, err := LoadOrCreate(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM, _, expiresAt, err := ca.Issue("long", 2*caValidity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caCert := parseCert(t, ca.CertPEM())
+	if !expiresAt.Equal(caCert.NotAfter) || !parseCert(t, certPEM).NotAfter.Equal(caCert.NotAfter) {
+		t.Errorf("certificate expires %v, want the CA's expiry %v", expiresAt, caCert.NotAfter)
+	}
+}
+
+func TestInstallForHAProxy(t *testing.T) {
+	ca, _, err := LoadOrCreate(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	haproxyDir := filepath.Join(t.TempDir(), "haproxy-config")
+	if err := ca.InstallForHAProxy(haproxyDir); err != nil {
+		t.Fatal(err)
+	}
+	installed, err := os.ReadFile(filepath.Join(haproxyDir, constants.HAProxyClientCAFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(installed) != string(ca.CertPEM()) {
+		t.Error("installed certificate differs from the CA certificate")
+	}
+}
@@ -0,0 +1,66 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/haloydev/haloy/internal/constants"
+	"github.com/joho/godotenv"
+)
+
+// APITokens are the HALOY_API_TOKEN tokens haloyd accepts. After the token is rotated, the
+// previous one stays valid until PreviousExpiresAt so clients can switch over.
+type APITokens struct {
+	Current           string
+	Previous          string
+	PreviousExpiresAt time.Time
+}
+
+// PreviousValid reports whether the previous token is still accepted at now.
+func (t APITokens) PreviousValid(now time.Time) bool {
+	return t.Previous != "" && now.Before(t.PreviousExpiresAt)
+}
+
+// APITokensFromEnv reads the tokens from environment variables looked up with getenv.
+func APITokensFromEnv(getenv func(string) string) (APITokens, error) {
+	tokens := APITokens{
+		Current:  getenv(constants.EnvVarAPIToken),
+		Previous: getenv(constants.EnvVarAPITokenPrevious),
+	}
+	if tokens.Current == "" {
+		return tokens, fmt.Errorf("%s not set", constants.EnvVarAPIToken)
+	}
+	if tokens.Previous == "" {
+		return tokens, nil
+	}
+
+	expires := getenv(constants.EnvVarAPITokenPreviousExpires)
+	expiresAt, err := time.Parse(time.RFC3339, expires)
+	if err != nil {
+		return tokens, fmt.Errorf("invalid %s '%s': %w", constants.EnvVarAPITokenPreviousExpires, expires, err)
+	}
+	tokens.PreviousExpiresAt = expiresAt
+	return tokens, nil
+}
+
+// ReadAPITokens reads the tokens from the .env file in the config directory, which haloyadm
+// rewrites when rotating the token, so haloyd picks up new tokens without restarting. It falls
+// back to the process environment when there is no .env file.
+func ReadAPITokens() (APITokens, error) {
+	configDir, err := ConfigDir()
+	if err != nil {
+		return APITokens{}, fmt.Errorf("failed to determine config directory: %w", err)
+	}
+	envFile := filepath.Join(configDir, constants.ConfigEnvFileName)
+	env, err := godotenv.Read(envFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return APITokensFromEnv(os.Getenv)
+	}
+	if err != nil {
+		return APITokens{}, fmt.Errorf("failed to read %s: %w", envFile, err)
+	}
+	return APITokensFromEnv(func(key string) string { return env[key] })
+}
@@ -0,0 +1,42 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/haloydev/haloy/internal/constants"
+)
+
+func TestAPITokensFromEnv(t *testing.T) {
+	expires := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	env := map[string]string{
+		constants.EnvVarAPIToken:                "new",
+		constants.EnvVarAPITokenPrevious:        "old",
+		constants.EnvVarAPITokenPreviousExpires: expires.Format(time.RFC3339),
+	}
+	getenv := func(key string) string { return env[key] }
+
+	tokens, err := APITokensFromEnv(getenv)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if tokens.Current != "new" || tokens.Previous != "old" || !tokens.PreviousExpiresAt.Equal(expires) {
+		t.Errorf("APITokensFromEnv() = %+v", tokens)
+	}
+	if !tokens.PreviousValid(expires.Add(-time.Second)) {
+		t.Error("expected previous token to be valid before it expires")
+	}
+	if tokens.PreviousValid(expires) {
+		t.Error("expected previous token to be invalid once it expires")
+	}
+
+	env[constants.EnvVarAPITokenPreviousExpires] = "tomorrow"
+	if _, err := APITokensFromEnv(getenv); err == nil {
+		t.Error("expected error for invalid expiry")
+	}
+
+	delete(env, constants.EnvVarAPIToken)
+	if _, err := APITokensFromEnv(getenv); err == nil {
+		t.Error("expected error when the token is not set")
+	}
+}
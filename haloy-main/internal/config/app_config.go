@@ -42,6 +42,29 @@ type TargetConfig struct {
 	PreDeploy          []string           `json:"preDeploy,omitempty" yaml:"pre_deploy,omitempty" toml:"pre_deploy,omitempty"`
 	PostDeploy         []string           `json:"postDeploy,omitempty" yaml:"post_deploy,omitempty" toml:"post_deploy,omitempty"`
 
+	// StopSignal and StopTimeout control how Docker stops the app's containers.
+	// DrainTimeout is the maximum time to wait for open connections to old instances
+	// to finish before they are stopped. Durations use Go syntax, e.g. "30s" or "2m".
+	StopSignal   string `json:"stopSignal,omitempty" yaml:"stop_signal,omitempty" toml:"stop_signal,omitempty"`
+	StopTimeout  string `json:"stopTimeout,omitempty" yaml:"stop_timeout,omitempty" toml:"stop_timeout,omitempty"`
+	DrainTimeout string `json:"drainTimeout,omitempty" yaml:"drain_timeout,omitempty" toml:"drain_timeout,omitempty"`
+
+	// PreviewDomain serves deployments started with 'haloy deploy --no-promote' until they are promoted.
+	// Defaults to <deploymentID>.<canonical domain>.
+	PreviewDomain string `json:"previewDomain,omitempty" yaml:"preview_domain,omitempty" toml:"preview_domain,omitempty"`
+
+	// IdleTimeout stops the app's containers when HAProxy has seen no requests for it in this long.
+	// The next request wakes the app up again, e.g. "30m".
+	IdleTimeout string `json:"idleTimeout,omitempty" yaml:"idle_timeout,omitempty" toml:"idle_timeout,omitempty"`
+
+	// AutoRollback makes haloyd watch a deployment after it takes over the app's traffic and
+	// roll back to the previous deployment if it becomes unhealthy.
+	AutoRollback *AutoRollback `json:"autoRollback,omitempty" yaml:"auto_rollback,omitempty" toml:"auto_rollback,omitempty"`
+
+	// DeploymentRouting lets requests that carry the secret pick one of the app's running deployments,
+	// e.g. a canary or a deployment waiting for promotion, instead of the one serving the app.
+	DeploymentRouting *DeploymentRouting `json:"deploymentRouting,omitempty" yaml:"deployment_routing,omitempty" toml:"deployment_routing,omitempty"`
+
 	// Non config fields. Not read from the config file and populated on load.
 	TargetName string `json:"-" yaml:"-" toml:"-"`
 	Format     string `json:"-" yaml:"-" toml:"-"`
@@ -52,8 +75,55 @@ type DeploymentStrategy string
 const (
 	DeploymentStrategyRolling DeploymentStrategy = "rolling" // Default: blue-green
 	DeploymentStrategyReplace DeploymentStrategy = "replace" // Stop old, start new
+	DeploymentStrategyCanary  DeploymentStrategy = "canary"  // Run new next to old with a share of the traffic
 )
 
+type AutoRollback struct {
+	// Window is how long the deployment is observed after the switch, e.g. "5m".
+	Window string `json:"window" yaml:"window" toml:"window"`
+	// MaxFailedHealthChecks is the number of consecutive failed health checks that trigger a rollback.
+	MaxFailedHealthChecks *int `json:"maxFailedHealthChecks,omitempty" yaml:"max_failed_health_checks,omitempty" toml:"max_failed_health_checks,omitempty"`
+	// MaxRestarts is the number of container restarts or exits tolerated during the window.
+	MaxRestarts *int `json:"maxRestarts,omitempty" yaml:"max_restarts,omitempty" toml:"max_restarts,omitempty"`
+}
+
+func (ar *AutoRollback) Validate(format string) error {
+	if ar.Window == "" {
+		return fmt.Errorf("%s is required", GetFieldNameForFormat(AutoRollback{}, "Window", format))
+	}
+	if err := validateDuration(ar.Window, MaxAutoRollbackWindow); err != nil {
+		return fmt.Errorf("%s is invalid: %w", GetFieldNameForFormat(AutoRollback{}, "Window", format), err)
+	}
+	if ar.MaxFailedHealthChecks != nil && *ar.MaxFailedHealthChecks < 1 {
+		return fmt.Errorf("%s must be at least 1", GetFieldNameForFormat(AutoRollback{}, "MaxFailedHealthChecks", format))
+	}
+	if ar.MaxRestarts != nil && *ar.MaxRestarts < 0 {
+		return fmt.Errorf("%s cannot be negative", GetFieldNameForFormat(AutoRollback{}, "MaxRestarts", format))
+	}
+	return nil
+}
+
+// MinDeploymentRoutingSecretLength keeps the routing secret from being guessed.
+const MinDeploymentRoutingSecretLength = 16
+
+type DeploymentRouting struct {
+	Enabled bool        `json:"enabled" yaml:"enabled" toml:"enabled"`
+	Secret  ValueSource `json:"secret" yaml:"secret" toml:"secret"`
+}
+
+func (dr *DeploymentRouting) Validate(format string) error {
+	if !dr.Enabled {
+		return nil
+	}
+	if err := dr.Secret.Validate(); err != nil {
+		return fmt.Errorf("%s: %w", GetFieldNameForFormat(DeploymentRouting{}, "Secret", format), err)
+	}
+	if dr.Secret.From == nil && len(dr.Secret.Value) < MinDeploymentRoutingSecretLength {
+		return fmt.Errorf("%s must be at least %d characters", GetFieldNameForFormat(DeploymentRouting{}, "Secret", format), MinDeploymentRoutingSecretLength)
+	}
+	return nil
+}
+
 type Domain struct {
 	Canonical string   `yaml:"domain" json:"domain" toml:"domain"`
 	Aliases   []string `yaml:"aliases,omitempty" json:"aliases,omitempty" toml:"aliases,omitempty"`
@@ -98,6 +98,11 @@ func TestTargetConfig_Validate_Comprehensive(t *testing.T) {
 				Volumes:         []string{"/host:/container"},
 				PreDeploy:       []string{"echo pre"},
 				PostDeploy:      []string{"echo post"},
+				StopSignal:      "SIGQUIT",
+				StopTimeout:     "45s",
+				DrainTimeout:    "1m",
+				IdleTimeout:     "30m",
+				AutoRollback:    &AutoRollback{Window: "5m", MaxRestarts: helpers.IntPtr(2)},
 				Env: []EnvVar{
 					{
 						Name:        "ENV_VAR",
@@ -234,6 +239,171 @@ func TestTargetConfig_Validate_Comprehensive(t *testing.T) {
 			expectError: true,
 			errMsg:      "replicas must be at least 1",
 		},
+		{
+			name: "invalid stop signal",
+			target: TargetConfig{
+				Name:   "haloy-test-app",
+				Server: "haloy.dev",
+				Image: &Image{
+					Repository: "nginx",
+					Tag:        "latest",
+				},
+				StopSignal: "sig term",
+			},
+			format:      "yaml",
+			expectError: true,
+			errMsg:      "stop_signal is invalid",
+		},
+		{
+			name: "invalid stop timeout",
+			target: TargetConfig{
+				Name:   "haloy-test-app",
+				Server: "haloy.dev",
+				Image: &Image{
+					Repository: "nginx",
+					Tag:        "latest",
+				},
+				StopTimeout: "30",
+			},
+			format:      "json",
+			expectError: true,
+			errMsg:      "stopTimeout is invalid",
+		},
+		{
+			name: "drain timeout exceeds maximum",
+			target: TargetConfig{
+				Name:   "haloy-test-app",
+				Server: "haloy.dev",
+				Image: &Image{
+					Repository: "nginx",
+					Tag:        "latest",
+				},
+				DrainTimeout: "1h",
+			},
+			format:      "yaml",
+			expectError: true,
+			errMsg:      "exceeds the maximum",
+		},
+		{
+			name: "idle timeout below minimum",
+			target: TargetConfig{
+				Name:   "haloy-test-app",
+				Server: "haloy.dev",
+				Image: &Image{
+					Repository: "nginx",
+					Tag:        "latest",
+				},
+				IdleTimeout: "10s",
+			},
+			format:      "yaml",
+			expectError: true,
+			errMsg:      "idle_timeout must be at least 1m0s",
+		},
+		{
+			name: "invalid preview domain",
+			target: TargetConfig{
+				Name:   "haloy-test-app",
+				Server: "haloy.dev",
+				Image: &Image{
+					Repository: "nginx",
+					Tag:        "latest",
+				},
+				PreviewDomain: "not a domain",
+			},
+			format:      "yaml",
+			expectError: true,
+			errMsg:      "preview_domain is invalid",
+		},
+		{
+			name: "auto rollback without window",
+			target: TargetConfig{
+				Name:   "haloy-test-app",
+				Server: "haloy.dev",
+				Image: &Image{
+					Repository: "nginx",
+					Tag:        "latest",
+				},
+				AutoRollback: &AutoRollback{},
+			},
+			format:      "yaml",
+			expectError: true,
+			errMsg:      "auto_rollback: window is required",
+		},
+		{
+			name: "auto rollback with invalid health check threshold",
+			target: TargetConfig{
+				Name:   "haloy-test-app",
+				Server: "haloy.dev",
+				Image: &Image{
+					Repository: "nginx",
+					Tag:        "latest",
+				},
+				AutoRollback: &AutoRollback{Window: "5m", MaxFailedHealthChecks: helpers.IntPtr(0)},
+			},
+			format:      "json",
+			expectError: true,
+			errMsg:      "maxFailedHealthChecks must be at least 1",
+		},
+		{
+			name: "auto rollback without image history",
+			target: TargetConfig{
+				Name:   "haloy-test-app",
+				Server: "haloy.dev",
+				Image: &Image{
+					Repository: "nginx",
+					Tag:        "latest",
+					History:    &ImageHistory{Strategy: HistoryStrategyNone},
+				},
+				AutoRollback: &AutoRollback{Window: "5m"},
+			},
+			format:      "yaml",
+			expectError: true,
+			errMsg:      "requires image history",
+		},
+		{
+			name: "deployment routing with short secret",
+			target: TargetConfig{
+				Name:   "haloy-test-app",
+				Server: "haloy.dev",
+				Image: &Image{
+					Repository: "nginx",
+					Tag:        "latest",
+				},
+				DeploymentRouting: &DeploymentRouting{Enabled: true, Secret: ValueSource{Value: "short"}},
+			},
+			format:      "yaml",
+			expectError: true,
+			errMsg:      "secret must be at least 16 characters",
+		},
+		{
+			name: "deployment routing without secret",
+			target: TargetConfig{
+				Name:   "haloy-test-app",
+				Server: "haloy.dev",
+				Image: &Image{
+					Repository: "nginx",
+					Tag:        "latest",
+				},
+				DeploymentRouting: &DeploymentRouting{Enabled: true},
+			},
+			format:      "yaml",
+			expectError: true,
+			errMsg:      "deployment_routing: secret",
+		},
+		{
+			name: "deployment routing with secret from env",
+			target: TargetConfig{
+				Name:   "haloy-test-app",
+				Server: "haloy.dev",
+				Image: &Image{
+					Repository: "nginx",
+					Tag:        "latest",
+				},
+				DeploymentRouting: &DeploymentRouting{Enabled: true, Secret: ValueSource{From: &SourceReference{Env: "ROUTING_SECRET"}}},
+			},
+			format:      "yaml",
+			expectError: false,
+		},
 	}
 
 	for _, tt := range tests {
@@ -254,6 +424,30 @@ func TestTargetConfig_Validate_Comprehensive(t *testing.T) {
 	}
 }
 
+func TestTargetConfig_HostAccess(t *testing.T) {
+	tests := []struct {
+		name    string
+		volumes []string
+		network string
+		want    string
+	}{
+		{name: "nothing", want: ""},
+		{name: "named volume", volumes: []string{"data:/data:ro"}, network: "bridge", want: ""},
+		{name: "bind mount", volumes: []string{"data:/data", "/srv/web:/srv"}, want: "mounts the host path '/srv/web'"},
+		{name: "relative bind mount", volumes: []string{"./data:/data"}, want: "mounts the host path './data'"},
+		{name: "host network", network: "host", want: "uses the host network"},
+		{name: "network of another container", network: "container:db", want: "shares the network of 'db'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tc := TargetConfig{Volumes: tt.volumes, Network: tt.network}
+			if got := tc.HostAccess(); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestDomain_Validate(t *testing.T) {
 	tests := []struct {
 		name    string
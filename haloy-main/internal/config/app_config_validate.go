@@ -7,6 +7,7 @@ import (
 	"regexp"
 	"slices"
 	"strings"
+	"time"
 
 	"github.com/haloydev/haloy/internal/helpers"
 )
@@ -35,9 +36,9 @@ func (tc *TargetConfig) Validate(format string) error {
 	}
 
 	if tc.DeploymentStrategy != "" {
-		validStrategies := []DeploymentStrategy{DeploymentStrategyRolling, DeploymentStrategyReplace}
+		validStrategies := []DeploymentStrategy{DeploymentStrategyRolling, DeploymentStrategyReplace, DeploymentStrategyCanary}
 		if !slices.Contains(validStrategies, tc.DeploymentStrategy) {
-			return fmt.Errorf("deployment_strategy must be 'rolling' or 'replace', got '%s'", tc.DeploymentStrategy)
+			return fmt.Errorf("deployment_strategy must be 'rolling', 'replace' or 'canary', got '%s'", tc.DeploymentStrategy)
 		}
 	}
 
@@ -49,6 +50,12 @@ func (tc *TargetConfig) Validate(format string) error {
 		}
 	}
 
+	if tc.PreviewDomain != "" {
+		if err := helpers.IsValidDomain(tc.PreviewDomain); err != nil {
+			return fmt.Errorf("%s is invalid: %w", GetFieldNameForFormat(TargetConfig{}, "PreviewDomain", format), err)
+		}
+	}
+
 	if tc.ACMEEmail != "" && !helpers.IsValidEmail(tc.ACMEEmail) {
 		return fmt.Errorf("%s is invalid '%s'; must be a valid email address", GetFieldNameForFormat(TargetConfig{}, "ACMEEmail", format), tc.ACMEEmail)
 	}
@@ -99,9 +106,102 @@ func (tc *TargetConfig) Validate(format string) error {
 		}
 	}
 
+	if tc.StopSignal != "" && !isValidStopSignal(tc.StopSignal) {
+		return fmt.Errorf("%s is invalid '%s'; must be a signal name like 'SIGTERM' or a signal number", GetFieldNameForFormat(TargetConfig{}, "StopSignal", format), tc.StopSignal)
+	}
+
+	if tc.StopTimeout != "" {
+		if err := validateDuration(tc.StopTimeout, MaxStopTimeout); err != nil {
+			return fmt.Errorf("%s is invalid: %w", GetFieldNameForFormat(TargetConfig{}, "StopTimeout", format), err)
+		}
+	}
+
+	if tc.DrainTimeout != "" {
+		if err := validateDuration(tc.DrainTimeout, MaxDrainTimeout); err != nil {
+			return fmt.Errorf("%s is invalid: %w", GetFieldNameForFormat(TargetConfig{}, "DrainTimeout", format), err)
+		}
+	}
+
+	if tc.IdleTimeout != "" {
+		if err := validateDuration(tc.IdleTimeout, MaxIdleTimeout); err != nil {
+			return fmt.Errorf("%s is invalid: %w", GetFieldNameForFormat(TargetConfig{}, "IdleTimeout", format), err)
+		}
+		if d, _ := time.ParseDuration(tc.IdleTimeout); d < MinIdleTimeout {
+			return fmt.Errorf("%s must be at least %s", GetFieldNameForFormat(TargetConfig{}, "IdleTimeout", format), MinIdleTimeout)
+		}
+	}
+
+	if tc.AutoRollback != nil {
+		if err := tc.AutoRollback.Validate(format); err != nil {
+			return fmt.Errorf("%s: %w", GetFieldNameForFormat(TargetConfig{}, "AutoRollback", format), err)
+		}
+		if tc.Image != nil && tc.Image.History != nil && tc.Image.History.Strategy == HistoryStrategyNone {
+			return fmt.Errorf("%s requires image history, it can't be used with the 'none' history strategy", GetFieldNameForFormat(TargetConfig{}, "AutoRollback", format))
+		}
+	}
+
+	if tc.DeploymentRouting != nil {
+		if err := tc.DeploymentRouting.Validate(format); err != nil {
+			return fmt.Errorf("%s: %w", GetFieldNameForFormat(TargetConfig{}, "DeploymentRouting", format), err)
+		}
+	}
+
+	return nil
+}
+
+// HostAccess describes how the app's containers reach beyond their own app, through bind mounts
+// of host paths or by sharing the host's or another container's network. It is empty if they don't.
+func (tc *TargetConfig) HostAccess() string {
+	for _, volume := range tc.Volumes {
+		hostPath := strings.TrimSpace(strings.Split(volume, ":")[0])
+		if strings.Contains(hostPath, "/") || strings.HasPrefix(hostPath, ".") {
+			return fmt.Sprintf("mounts the host path '%s'", hostPath)
+		}
+	}
+	switch {
+	case tc.Network == "host":
+		return "uses the host network"
+	case strings.HasPrefix(tc.Network, "container:"):
+		return fmt.Sprintf("shares the network of '%s'", strings.TrimPrefix(tc.Network, "container:"))
+	}
+	return ""
+}
+
+const (
+	// Upper bounds keep stopping and draining within the time haloyd allows for a single update.
+	MaxStopTimeout  = 2 * time.Minute
+	MaxDrainTimeout = 10 * time.Minute
+
+	MaxAutoRollbackWindow = time.Hour
+
+	// Idle apps are detected from HAProxy session counters that haloyd reads every 30 seconds,
+	// shorter timeouts would stop apps between two requests.
+	MinIdleTimeout = time.Minute
+	MaxIdleTimeout = 30 * 24 * time.Hour
+)
+
+func validateDuration(value string, max time.Duration) error {
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return fmt.Errorf("'%s' is not a valid duration (e.g. '30s', '2m')", value)
+	}
+	if d < 0 {
+		return fmt.Errorf("'%s' cannot be negative", value)
+	}
+	if d > max {
+		return fmt.Errorf("'%s' exceeds the maximum of %s", value, max)
+	}
 	return nil
 }
 
+func isValidStopSignal(signal string) bool {
+	matched, err := regexp.MatchString(`^(SIG[A-Z0-9+-]+|[A-Z][A-Z0-9+-]*|[0-9]+)$`, signal)
+	if err != nil {
+		return false
+	}
+	return matched
+}
+
 func isValidAppName(name string) bool {
 	// Only allow alphanumeric, hyphens, and underscores
 	// Must start with alphanumeric character
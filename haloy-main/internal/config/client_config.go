@@ -20,9 +20,22 @@ type ClientConfig struct {
 
 type ServerConfig struct {
 	TokenEnv string `json:"token_env" yaml:"token_env" toml:"token_env"`
+	// ClientCert and ClientKey are presented to servers that require client certificates.
+	ClientCert string `json:"client_cert,omitempty" yaml:"client_cert,omitempty" toml:"client_cert,omitempty"`
+	ClientKey  string `json:"client_key,omitempty" yaml:"client_key,omitempty" toml:"client_key,omitempty"`
+	// SSHIdentity is the private key used to reach ssh:// servers, instead of ssh's default.
+	SSHIdentity string `json:"ssh_identity,omitempty" yaml:"ssh_identity,omitempty" toml:"ssh_identity,omitempty"`
 }
 
 func (cc *ClientConfig) AddServer(url, tokenEnv string, force bool) error {
+	return cc.AddServerConfig(url, ServerConfig{TokenEnv: tokenEnv}, force)
+}
+
+func (cc *ClientConfig) AddServerConfig(url string, serverConfig ServerConfig, force bool) error {
+	if (serverConfig.ClientCert == "") != (serverConfig.ClientKey == "") {
+		return fmt.Errorf("client certificate and key must be set together")
+	}
+
 	normalizedURL, err := helpers.NormalizeServerURL(url)
 	if err != nil {
 		return err
@@ -38,7 +51,7 @@ func (cc *ClientConfig) AddServer(url, tokenEnv string, force bool) error {
 		}
 	}
 
-	cc.Servers[normalizedURL] = ServerConfig{TokenEnv: tokenEnv}
+	cc.Servers[normalizedURL] = serverConfig
 	return nil
 }
 
@@ -64,6 +77,25 @@ func (cc *ClientConfig) ListServers() []string {
 	return urls
 }
 
+// ServerConfigFor returns the configuration of the server at url from the client config in
+// the config directory. It returns false if the server isn't configured.
+func ServerConfigFor(url string) (ServerConfig, bool, error) {
+	configDir, err := ConfigDir()
+	if err != nil {
+		return ServerConfig{}, false, err
+	}
+	clientConfig, err := LoadClientConfig(filepath.Join(configDir, constants.ClientConfigFileName))
+	if err != nil || clientConfig == nil {
+		return ServerConfig{}, false, err
+	}
+	normalizedURL, err := helpers.NormalizeServerURL(url)
+	if err != nil {
+		return ServerConfig{}, false, err
+	}
+	serverConfig, ok := clientConfig.Servers[normalizedURL]
+	return serverConfig, ok, nil
+}
+
 func LoadClientConfig(path string) (*ClientConfig, error) {
 	if _, err := os.Stat(path); os.IsNotExist(err) {
 		return nil, nil
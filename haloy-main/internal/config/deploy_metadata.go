@@ -0,0 +1,104 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	maxDeployMessageLength = 500
+	maxDeployLabels        = 20
+	maxDeployLabelValue    = 200
+)
+
+var (
+	gitCommitRegex      = regexp.MustCompile(`^[0-9a-f]{7,64}$`)
+	deployLabelKeyRegex = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]{0,62}$`)
+)
+
+// DeployMetadata describes where a deployment came from. It is stored with the deployment
+// and set as labels on its containers.
+type DeployMetadata struct {
+	GitCommit string            `json:"gitCommit,omitempty"`
+	GitBranch string            `json:"gitBranch,omitempty"`
+	GitDirty  bool              `json:"gitDirty,omitempty"` // The working tree had uncommitted changes
+	Message   string            `json:"message,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+}
+
+func (m DeployMetadata) Validate() error {
+	if m.GitCommit != "" && !gitCommitRegex.MatchString(m.GitCommit) {
+		return fmt.Errorf("git commit '%s' is not a hex encoded commit hash", m.GitCommit)
+	}
+	if strings.ContainsAny(m.GitBranch, "\n\r") {
+		return fmt.Errorf("git branch must be a single line")
+	}
+	if len(m.Message) > maxDeployMessageLength {
+		return fmt.Errorf("message must be at most %d characters", maxDeployMessageLength)
+	}
+	if len(m.Labels) > maxDeployLabels {
+		return fmt.Errorf("at most %d labels are allowed", maxDeployLabels)
+	}
+	for key, value := range m.Labels {
+		if !deployLabelKeyRegex.MatchString(key) {
+			return fmt.Errorf("label key '%s' must start with a letter or digit and contain only letters, digits, '.', '_' and '-'", key)
+		}
+		if len(value) > maxDeployLabelValue {
+			return fmt.Errorf("label '%s' must be at most %d characters", key, maxDeployLabelValue)
+		}
+	}
+	return nil
+}
+
+// ParseDeployLabels parses labels given as key=value.
+func ParseDeployLabels(values []string) (map[string]string, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+	labels := make(map[string]string, len(values))
+	for _, value := range values {
+		key, v, ok := strings.Cut(value, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid label '%s', must be key=value", value)
+		}
+		labels[key] = v
+	}
+	return labels, nil
+}
+
+func (m DeployMetadata) toLabels(labels map[string]string) {
+	if m.GitCommit != "" {
+		labels[LabelGitSHA] = m.GitCommit
+	}
+	if m.GitBranch != "" {
+		labels[LabelGitBranch] = m.GitBranch
+	}
+	if m.GitDirty {
+		labels[LabelGitDirty] = "true"
+	}
+	if m.Message != "" {
+		labels[LabelDeployMessage] = m.Message
+	}
+	for key, value := range m.Labels {
+		labels[LabelDeployLabelPrefix+key] = value
+	}
+}
+
+func parseDeployMetadataLabels(labels map[string]string) DeployMetadata {
+	m := DeployMetadata{
+		GitCommit: labels[LabelGitSHA],
+		GitBranch: labels[LabelGitBranch],
+		GitDirty:  labels[LabelGitDirty] == "true",
+		Message:   labels[LabelDeployMessage],
+	}
+	for key, value := range labels {
+		if name, ok := strings.CutPrefix(key, LabelDeployLabelPrefix); ok {
+			if m.Labels == nil {
+				m.Labels = make(map[string]string)
+			}
+			m.Labels[name] = value
+		}
+	}
+	return m
+}
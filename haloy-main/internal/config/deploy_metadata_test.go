@@ -0,0 +1,108 @@
+package config
+
+import (
+	"maps"
+	"strings"
+	"testing"
+)
+
+func TestParseDeployLabels(t *testing.T) {
+	labels, err := ParseDeployLabels([]string{"ticket=OPS-12", "note=a=b", "empty="})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := map[string]string{"ticket": "OPS-12", "note": "a=b", "empty": ""}
+	if !maps.Equal(labels, expected) {
+		t.Errorf("ParseDeployLabels() = %v, want %v", labels, expected)
+	}
+
+	for _, value := range []string{"ticket", "=value"} {
+		if _, err := ParseDeployLabels([]string{value}); err == nil {
+			t.Errorf("ParseDeployLabels(%q) expected error", value)
+		}
+	}
+}
+
+func TestDeployMetadata_Validate(t *testing.T) {
+	tests := []struct {
+		name     string
+		metadata DeployMetadata
+		wantErr  bool
+	}{
+		{
+			name:     "empty",
+			metadata: DeployMetadata{},
+		},
+		{
+			name: "valid",
+			metadata: DeployMetadata{
+				GitCommit: "4f1c2ab9e0d3c5a7b8f6e1d2c3b4a5968778695a",
+				GitBranch: "feature/login",
+				GitDirty:  true,
+				Message:   "Fix login redirect",
+				Labels:    map[string]string{"ticket": "OPS-12"},
+			},
+		},
+		{
+			name:     "commit is not hex",
+			metadata: DeployMetadata{GitCommit: "not-a-commit"},
+			wantErr:  true,
+		},
+		{
+			name:     "multi line branch",
+			metadata: DeployMetadata{GitBranch: "main\nevil"},
+			wantErr:  true,
+		},
+		{
+			name:     "message too long",
+			metadata: DeployMetadata{Message: strings.Repeat("a", maxDeployMessageLength+1)},
+			wantErr:  true,
+		},
+		{
+			name:     "invalid label key",
+			metadata: DeployMetadata{Labels: map[string]string{"bad key": "value"}},
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.metadata.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestContainerLabels_DeployMetadataRoundTrip(t *testing.T) {
+	cl := ContainerLabels{
+		AppName:         "app",
+		DeploymentID:    "01k7wq6x3vz4c5m6n7p8q9r0st",
+		HealthCheckPath: "/",
+		Port:            "8080",
+		Role:            AppLabelRole,
+		Metadata: DeployMetadata{
+			GitCommit: "4f1c2ab",
+			GitBranch: "main",
+			GitDirty:  true,
+			Message:   "Fix login redirect",
+			Labels:    map[string]string{"ticket": "OPS-12"},
+		},
+	}
+
+	labels := cl.ToLabels()
+	if labels[LabelGitSHA] != "4f1c2ab" || labels[LabelDeployLabelPrefix+"ticket"] != "OPS-12" {
+		t.Fatalf("ToLabels() missing metadata labels: %v", labels)
+	}
+
+	parsed, err := ParseContainerLabels(labels)
+	if err != nil {
+		t.Fatalf("ParseContainerLabels() error: %v", err)
+	}
+	if parsed.Metadata.GitCommit != cl.Metadata.GitCommit || parsed.Metadata.GitBranch != cl.Metadata.GitBranch ||
+		parsed.Metadata.GitDirty != cl.Metadata.GitDirty || parsed.Metadata.Message != cl.Metadata.Message ||
+		!maps.Equal(parsed.Metadata.Labels, cl.Metadata.Labels) {
+		t.Errorf("ParseContainerLabels() metadata = %+v, want %+v", parsed.Metadata, cl.Metadata)
+	}
+}
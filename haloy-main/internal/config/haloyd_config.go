@@ -14,12 +14,23 @@ import (
 )
 
 type HaloydConfig struct {
-	API struct {
-		Domain string `json:"domain" yaml:"domain" toml:"domain"`
-	} `json:"api" yaml:"api" toml:"api"`
+	API          APIConfig `json:"api" yaml:"api" toml:"api"`
 	Certificates struct {
 		AcmeEmail string `json:"acmeEmail" yaml:"acme_email" toml:"acme_email"`
 	} `json:"certificates" yaml:"certificates" toml:"certificates"`
+	Logging LoggingConfig `json:"logging,omitempty" yaml:"logging,omitempty" toml:"logging,omitempty"`
+}
+
+type APIConfig struct {
+	Domain string `json:"domain" yaml:"domain" toml:"domain"`
+	// JWTIssuers are trusted to sign short-lived tokens for the API.
+	JWTIssuers []JWTIssuerConfig `json:"jwtIssuers,omitempty" yaml:"jwt_issuers,omitempty" toml:"jwt_issuers,omitempty"`
+	// RequireClientCert makes HAProxy only pass requests to the API that present a client
+	// certificate issued with 'haloyadm client-cert create', on top of the API token.
+	RequireClientCert bool `json:"requireClientCert,omitempty" yaml:"require_client_cert,omitempty" toml:"require_client_cert,omitempty"`
+	// DisableTCP stops haloyd from listening on the API port, leaving only the Unix socket in
+	// the data dir. Remote clients then reach the API over SSH.
+	DisableTCP bool `json:"disableTCP,omitempty" yaml:"disable_tcp,omitempty" toml:"disable_tcp,omitempty"`
 }
 
 // Normalize sets default values for HaloydConfig
@@ -43,6 +54,36 @@ func (mc *HaloydConfig) Validate() error {
 		return fmt.Errorf("acmeEmail is required when domain is specified")
 	}
 
+	if mc.API.RequireClientCert && mc.API.Domain == "" {
+		return fmt.Errorf("requireClientCert needs the API domain to be set")
+	}
+
+	if mc.API.DisableTCP && mc.API.Domain != "" {
+		return fmt.Errorf("disableTCP can't be used with an API domain, HAProxy reaches the API over TCP")
+	}
+
+	issuers := make(map[string]bool, len(mc.API.JWTIssuers))
+	for _, issuer := range mc.API.JWTIssuers {
+		if err := issuer.Validate(); err != nil {
+			return fmt.Errorf("invalid JWT issuer '%s': %w", issuer.DisplayName(), err)
+		}
+		if issuers[issuer.Issuer] {
+			return fmt.Errorf("JWT issuer '%s' is configured more than once", issuer.Issuer)
+		}
+		issuers[issuer.Issuer] = true
+	}
+
+	sinks := make(map[string]bool, len(mc.Logging.Sinks))
+	for _, sink := range mc.Logging.Sinks {
+		if err := sink.Validate(); err != nil {
+			return fmt.Errorf("invalid log sink '%s': %w", sink.DisplayName(), err)
+		}
+		if sinks[sink.DisplayName()] {
+			return fmt.Errorf("log sink '%s' is configured more than once, give each a name", sink.DisplayName())
+		}
+		sinks[sink.DisplayName()] = true
+	}
+
 	return nil
 }
 
@@ -23,9 +23,7 @@ func TestHaloydConfig_Validate(t *testing.T) {
 		{
 			name: "valid config with domain and email",
 			config: HaloydConfig{
-				API: struct {
-					Domain string `json:"domain" yaml:"domain" toml:"domain"`
-				}{Domain: "api.example.com"},
+				API: APIConfig{Domain: "api.example.com"},
 				Certificates: struct {
 					AcmeEmail string `json:"acmeEmail" yaml:"acme_email" toml:"acme_email"`
 				}{AcmeEmail: "admin@example.com"},
@@ -44,9 +42,7 @@ func TestHaloydConfig_Validate(t *testing.T) {
 		{
 			name: "invalid domain format",
 			config: HaloydConfig{
-				API: struct {
-					Domain string `json:"domain" yaml:"domain" toml:"domain"`
-				}{Domain: "invalid domain"},
+				API: APIConfig{Domain: "invalid domain"},
 				Certificates: struct {
 					AcmeEmail string `json:"acmeEmail" yaml:"acme_email" toml:"acme_email"`
 				}{AcmeEmail: "admin@example.com"},
@@ -57,9 +53,7 @@ func TestHaloydConfig_Validate(t *testing.T) {
 		{
 			name: "invalid email format",
 			config: HaloydConfig{
-				API: struct {
-					Domain string `json:"domain" yaml:"domain" toml:"domain"`
-				}{Domain: "api.example.com"},
+				API: APIConfig{Domain: "api.example.com"},
 				Certificates: struct {
 					AcmeEmail string `json:"acmeEmail" yaml:"acme_email" toml:"acme_email"`
 				}{AcmeEmail: "not-an-email"},
@@ -70,13 +64,58 @@ func TestHaloydConfig_Validate(t *testing.T) {
 		{
 			name: "domain without email",
 			config: HaloydConfig{
-				API: struct {
-					Domain string `json:"domain" yaml:"domain" toml:"domain"`
-				}{Domain: "api.example.com"},
+				API: APIConfig{Domain: "api.example.com"},
 			},
 			wantErr: true,
 			errMsg:  "acmeEmail is required when domain is specified",
 		},
+		{
+			name: "valid log sinks",
+			config: HaloydConfig{
+				Logging: LoggingConfig{Sinks: []LogSinkConfig{
+					{Type: LogSinkSyslog, URL: "udp://logs.example.com:514"},
+					{Type: LogSinkLoki, URL: "http://loki:3100/loki/api/v1/push", Headers: map[string]string{"X-Scope-OrgID": "acme"}, AppLogs: true, Apps: []string{"web-*"}},
+					{Type: LogSinkOTLP, URL: "https://otel.example.com/v1/logs"},
+					{Type: LogSinkFile, Path: "logs/haloy.jsonl", AppLogs: true},
+				}},
+			},
+			wantErr: false,
+		},
+		{
+			name: "syslog sink without port",
+			config: HaloydConfig{
+				Logging: LoggingConfig{Sinks: []LogSinkConfig{{Type: LogSinkSyslog, URL: "udp://logs.example.com"}}},
+			},
+			wantErr: true,
+			errMsg:  "url must be udp://host:port or tcp://host:port",
+		},
+		{
+			name: "unknown log sink type",
+			config: HaloydConfig{
+				Logging: LoggingConfig{Sinks: []LogSinkConfig{{Type: "kafka", URL: "http://kafka"}}},
+			},
+			wantErr: true,
+			errMsg:  "unknown type 'kafka'",
+		},
+		{
+			name: "duplicate log sink names",
+			config: HaloydConfig{
+				Logging: LoggingConfig{Sinks: []LogSinkConfig{
+					{Type: LogSinkFile, Path: "a.jsonl"},
+					{Type: LogSinkFile, Path: "b.jsonl"},
+				}},
+			},
+			wantErr: true,
+			errMsg:  "log sink 'file' is configured more than once",
+		},
+		{
+			name: "log sink apps without app logs",
+			config: HaloydConfig{
+				Logging: LoggingConfig{Sinks: []LogSinkConfig{{Type: LogSinkFile, Path: "a.jsonl", Apps: []string{"web"}}}},
+			},
+			wantErr: true,
+			errMsg:  "apps only selects app logs",
+		},
 	}
 
 	for _, tt := range tests {
@@ -109,9 +148,7 @@ func TestHaloydConfig_Normalize(t *testing.T) {
 		{
 			name: "config with values",
 			config: HaloydConfig{
-				API: struct {
-					Domain string `json:"domain" yaml:"domain" toml:"domain"`
-				}{Domain: "api.example.com"},
+				API: APIConfig{Domain: "api.example.com"},
 				Certificates: struct {
 					AcmeEmail string `json:"acmeEmail" yaml:"acme_email" toml:"acme_email"`
 				}{AcmeEmail: "admin@example.com"},
@@ -150,9 +187,7 @@ certificates:
 `,
 			extension: ".yaml",
 			expected: &HaloydConfig{
-				API: struct {
-					Domain string `json:"domain" yaml:"domain" toml:"domain"`
-				}{Domain: "api.example.com"},
+				API: APIConfig{Domain: "api.example.com"},
 				Certificates: struct {
 					AcmeEmail string `json:"acmeEmail" yaml:"acme_email" toml:"acme_email"`
 				}{AcmeEmail: "admin@example.com"},
@@ -170,9 +205,7 @@ certificates:
 }`,
 			extension: ".json",
 			expected: &HaloydConfig{
-				API: struct {
-					Domain string `json:"domain" yaml:"domain" toml:"domain"`
-				}{Domain: "api.example.com"},
+				API: APIConfig{Domain: "api.example.com"},
 				Certificates: struct {
 					AcmeEmail string `json:"acmeEmail" yaml:"acme_email" toml:"acme_email"`
 				}{AcmeEmail: "admin@example.com"},
@@ -194,9 +227,7 @@ certificates:
 `,
 			extension: ".yaml",
 			expected: &HaloydConfig{
-				API: struct {
-					Domain string `json:"domain" yaml:"domain" toml:"domain"`
-				}{Domain: ""},
+				API: APIConfig{Domain: ""},
 				Certificates: struct {
 					AcmeEmail string `json:"acmeEmail" yaml:"acme_email" toml:"acme_email"`
 				}{AcmeEmail: ""},
@@ -274,9 +305,7 @@ func TestSaveHaloydConfig(t *testing.T) {
 		{
 			name: "save yaml config",
 			config: HaloydConfig{
-				API: struct {
-					Domain string `json:"domain" yaml:"domain" toml:"domain"`
-				}{Domain: "api.example.com"},
+				API: APIConfig{Domain: "api.example.com"},
 				Certificates: struct {
 					AcmeEmail string `json:"acmeEmail" yaml:"acme_email" toml:"acme_email"`
 				}{AcmeEmail: "admin@example.com"},
@@ -286,9 +315,7 @@ func TestSaveHaloydConfig(t *testing.T) {
 		{
 			name: "save json config",
 			config: HaloydConfig{
-				API: struct {
-					Domain string `json:"domain" yaml:"domain" toml:"domain"`
-				}{Domain: "api.example.com"},
+				API: APIConfig{Domain: "api.example.com"},
 				Certificates: struct {
 					AcmeEmail string `json:"acmeEmail" yaml:"acme_email" toml:"acme_email"`
 				}{AcmeEmail: "admin@example.com"},
@@ -303,9 +330,7 @@ func TestSaveHaloydConfig(t *testing.T) {
 		{
 			name: "save config with only domain",
 			config: HaloydConfig{
-				API: struct {
-					Domain string `json:"domain" yaml:"domain" toml:"domain"`
-				}{Domain: "api.example.com"},
+				API: APIConfig{Domain: "api.example.com"},
 			},
 			extension: ".yaml",
 		},
@@ -0,0 +1,87 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/haloydev/haloy/internal/apitoken"
+)
+
+// JWTIssuerConfig lets haloyd accept short-lived JWTs signed by an issuer instead of static
+// tokens, like the OIDC tokens CI systems hand out to jobs.
+type JWTIssuerConfig struct {
+	// Name identifies the issuer in the audit log and errors. Defaults to Issuer.
+	Name string `json:"name,omitempty" yaml:"name,omitempty" toml:"name,omitempty"`
+	// Issuer must match the token's "iss" claim exactly.
+	Issuer string `json:"issuer" yaml:"issuer" toml:"issuer"`
+	// Audience must be one of the token's "aud" claims.
+	Audience string `json:"audience" yaml:"audience" toml:"audience"`
+	// The issuer's signing keys are read from either JWKSURL or JWKSFile, the latter
+	// is handy for testing with locally signed tokens.
+	JWKSURL  string `json:"jwksUrl,omitempty" yaml:"jwks_url,omitempty" toml:"jwks_url,omitempty"`
+	JWKSFile string `json:"jwksFile,omitempty" yaml:"jwks_file,omitempty" toml:"jwks_file,omitempty"`
+	// Rules map claims to what a token may do. The first rule whose claims all match applies,
+	// tokens matching none are rejected.
+	Rules []JWTRule `json:"rules" yaml:"rules" toml:"rules"`
+}
+
+// JWTRule grants scopes on apps to tokens whose claims match.
+type JWTRule struct {
+	// Claims map claim names to glob patterns their values must match, like
+	// repository: acme/web and ref: refs/heads/main.
+	Claims map[string]string `json:"claims" yaml:"claims" toml:"claims"`
+	Scopes []string          `json:"scopes" yaml:"scopes" toml:"scopes"`
+	// Apps are glob patterns of the app names the token may act on. Empty for all apps.
+	Apps []string `json:"apps,omitempty" yaml:"apps,omitempty" toml:"apps,omitempty"`
+}
+
+func (ic JWTIssuerConfig) DisplayName() string {
+	if ic.Name != "" {
+		return ic.Name
+	}
+	return ic.Issuer
+}
+
+func (ic JWTIssuerConfig) Validate() error {
+	if ic.Issuer == "" {
+		return fmt.Errorf("issuer is required")
+	}
+	// Without an audience, tokens the issuer made for other services would be accepted.
+	if ic.Audience == "" {
+		return fmt.Errorf("audience is required")
+	}
+	if (ic.JWKSURL == "") == (ic.JWKSFile == "") {
+		return fmt.Errorf("exactly one of jwksUrl and jwksFile is required")
+	}
+	if ic.JWKSURL != "" {
+		u, err := url.Parse(ic.JWKSURL)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return fmt.Errorf("invalid jwksUrl '%s'", ic.JWKSURL)
+		}
+	}
+	if len(ic.Rules) == 0 {
+		return fmt.Errorf("at least one rule is required")
+	}
+	for i, rule := range ic.Rules {
+		if err := rule.Validate(); err != nil {
+			return fmt.Errorf("rule %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+func (r JWTRule) Validate() error {
+	// Issuers like CI systems sign tokens for everyone using them, so a rule must pin down whose.
+	if len(r.Claims) == 0 {
+		return fmt.Errorf("at least one claim to match is required")
+	}
+	for name, pattern := range r.Claims {
+		if err := apitoken.ValidateAppPatterns([]string{pattern}); err != nil {
+			return fmt.Errorf("claim '%s': %w", name, err)
+		}
+	}
+	if _, err := apitoken.ParseScopes(r.Scopes); err != nil {
+		return err
+	}
+	return apitoken.ValidateAppPatterns(r.Apps)
+}
@@ -2,7 +2,9 @@ package config
 
 import (
 	"fmt"
+	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/haloydev/haloy/internal/constants"
@@ -14,7 +16,26 @@ const (
 	LabelDeploymentID    = "dev.haloy.deployment-id"
 	LabelHealthCheckPath = "dev.haloy.health-check-path" // optional default to "/"
 	LabelACMEEmail       = "dev.haloy.acme.email"
-	LabelPort            = "dev.haloy.port" // optional
+	LabelPort            = "dev.haloy.port"           // optional
+	LabelDrainTimeout    = "dev.haloy.drain-timeout"  // optional default to constants.DefaultDrainTimeout
+	LabelPreviewDomain   = "dev.haloy.preview-domain" // optional
+	LabelIdleTimeout     = "dev.haloy.idle-timeout"   // optional, the app never sleeps without it
+
+	// Auto rollback settings, only set when auto_rollback is configured.
+	LabelAutoRollbackWindow                = "dev.haloy.auto-rollback.window"
+	LabelAutoRollbackMaxFailedHealthChecks = "dev.haloy.auto-rollback.max-failed-health-checks"
+	LabelAutoRollbackMaxRestarts           = "dev.haloy.auto-rollback.max-restarts"
+
+	// SHA-256 of the secret that allows requests to pick a deployment, only set when deployment routing is enabled.
+	LabelDeploymentRoutingSecretHash = "dev.haloy.deployment-routing.secret-sha256"
+
+	// Deploy metadata, only set when known.
+	LabelGitSHA        = "dev.haloy.git-sha"
+	LabelGitBranch     = "dev.haloy.git-branch"
+	LabelGitDirty      = "dev.haloy.git-dirty"
+	LabelDeployMessage = "dev.haloy.deploy-message"
+	// Prefix of the labels given with 'haloy deploy --label key=value'.
+	LabelDeployLabelPrefix = "dev.haloy.label."
 
 	// Format strings for indexed canonical domains and aliases.
 	// Use fmt.Sprintf(LabelDomainCanonical, index) to get "dev.haloy.domain.<index>"
@@ -31,23 +52,35 @@ const (
 	AppLabelRole     = "app"
 )
 
+var sha256HexRegex = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
 type ContainerLabels struct {
-	AppName         string
-	DeploymentID    string
-	HealthCheckPath string
-	ACMEEmail       string
-	Port            Port
-	Domains         []Domain
-	Role            string
+	AppName           string
+	DeploymentID      string
+	HealthCheckPath   string
+	ACMEEmail         string
+	Port              Port
+	DrainTimeout      string
+	PreviewDomain     string
+	IdleTimeout       string
+	AutoRollback      *AutoRollback
+	RoutingSecretHash string // hex encoded SHA-256 of the deployment routing secret
+	Metadata          DeployMetadata
+	Domains           []Domain
+	Role              string
 }
 
 // Parse from docker labels to ContainerLabels struct.
 func ParseContainerLabels(labels map[string]string) (*ContainerLabels, error) {
 	cl := &ContainerLabels{
-		AppName:      labels[LabelAppName],
-		DeploymentID: labels[LabelDeploymentID],
-		ACMEEmail:    labels[LabelACMEEmail],
-		Role:         labels[LabelRole],
+		AppName:           labels[LabelAppName],
+		DeploymentID:      labels[LabelDeploymentID],
+		ACMEEmail:         labels[LabelACMEEmail],
+		PreviewDomain:     labels[LabelPreviewDomain],
+		IdleTimeout:       labels[LabelIdleTimeout],
+		RoutingSecretHash: labels[LabelDeploymentRoutingSecretHash],
+		Role:              labels[LabelRole],
+		Metadata:          parseDeployMetadataLabels(labels),
 	}
 
 	if v, ok := labels[LabelPort]; ok {
@@ -63,6 +96,20 @@ func ParseContainerLabels(labels map[string]string) (*ContainerLabels, error) {
 		cl.HealthCheckPath = constants.DefaultHealthCheckPath
 	}
 
+	if v, ok := labels[LabelDrainTimeout]; ok && v != "" {
+		cl.DrainTimeout = v
+	} else {
+		cl.DrainTimeout = constants.DefaultDrainTimeout
+	}
+
+	if v, ok := labels[LabelAutoRollbackWindow]; ok && v != "" {
+		autoRollback, err := parseAutoRollbackLabels(v, labels)
+		if err != nil {
+			return nil, err
+		}
+		cl.AutoRollback = autoRollback
+	}
+
 	// Parse domains
 	domainMap := make(map[int]*Domain)
 
@@ -109,6 +156,25 @@ func ParseContainerLabels(labels map[string]string) (*ContainerLabels, error) {
 	return cl, nil
 }
 
+func parseAutoRollbackLabels(window string, labels map[string]string) (*AutoRollback, error) {
+	autoRollback := &AutoRollback{Window: window}
+	if v, ok := labels[LabelAutoRollbackMaxFailedHealthChecks]; ok {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s label '%s': %w", LabelAutoRollbackMaxFailedHealthChecks, v, err)
+		}
+		autoRollback.MaxFailedHealthChecks = &n
+	}
+	if v, ok := labels[LabelAutoRollbackMaxRestarts]; ok {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s label '%s': %w", LabelAutoRollbackMaxRestarts, v, err)
+		}
+		autoRollback.MaxRestarts = &n
+	}
+	return autoRollback, nil
+}
+
 // getOrCreateDomain returns an existing *config.Domain from domainMap or creates a new one.
 func getOrCreateDomain(domainMap map[int]*Domain, idx int) *Domain {
 	if domain, exists := domainMap[idx]; exists {
@@ -129,6 +195,34 @@ func (cl *ContainerLabels) ToLabels() map[string]string {
 		LabelRole:            cl.Role,
 	}
 
+	if cl.DrainTimeout != "" {
+		labels[LabelDrainTimeout] = cl.DrainTimeout
+	}
+
+	if cl.PreviewDomain != "" {
+		labels[LabelPreviewDomain] = cl.PreviewDomain
+	}
+
+	if cl.IdleTimeout != "" {
+		labels[LabelIdleTimeout] = cl.IdleTimeout
+	}
+
+	if cl.AutoRollback != nil {
+		labels[LabelAutoRollbackWindow] = cl.AutoRollback.Window
+		if cl.AutoRollback.MaxFailedHealthChecks != nil {
+			labels[LabelAutoRollbackMaxFailedHealthChecks] = strconv.Itoa(*cl.AutoRollback.MaxFailedHealthChecks)
+		}
+		if cl.AutoRollback.MaxRestarts != nil {
+			labels[LabelAutoRollbackMaxRestarts] = strconv.Itoa(*cl.AutoRollback.MaxRestarts)
+		}
+	}
+
+	if cl.RoutingSecretHash != "" {
+		labels[LabelDeploymentRoutingSecretHash] = cl.RoutingSecretHash
+	}
+
+	cl.Metadata.toLabels(labels)
+
 	// Iterate through the domains slice.
 	for i, domain := range cl.Domains {
 		// Set canonical domain.
@@ -166,6 +260,16 @@ func (cl *ContainerLabels) Validate() error {
 		return fmt.Errorf("ACME email is not valid")
 	}
 
+	if cl.PreviewDomain != "" {
+		if err := helpers.IsValidDomain(cl.PreviewDomain); err != nil {
+			return fmt.Errorf("preview domain validation failed: %w", err)
+		}
+	}
+
+	if cl.RoutingSecretHash != "" && !sha256HexRegex.MatchString(cl.RoutingSecretHash) {
+		return fmt.Errorf("deployment routing secret hash must be a hex encoded SHA-256")
+	}
+
 	if cl.Port == "" {
 		return fmt.Errorf("port is required")
 	}
@@ -0,0 +1,96 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+
+	"github.com/haloydev/haloy/internal/apitoken"
+)
+
+type LogSinkType string
+
+const (
+	LogSinkSyslog LogSinkType = "syslog"
+	LogSinkLoki   LogSinkType = "loki"
+	LogSinkOTLP   LogSinkType = "otlp"
+	LogSinkFile   LogSinkType = "file"
+)
+
+// LoggingConfig is where haloyd ships logs to, on top of what 'haloy logs' streams.
+type LoggingConfig struct {
+	Sinks []LogSinkConfig `json:"sinks,omitempty" yaml:"sinks,omitempty" toml:"sinks,omitempty"`
+}
+
+// LogSinkConfig is an external system haloyd's logs are shipped to.
+type LogSinkConfig struct {
+	// Name identifies the sink in haloyd's logs. Defaults to Type.
+	Name string      `json:"name,omitempty" yaml:"name,omitempty" toml:"name,omitempty"`
+	Type LogSinkType `json:"type" yaml:"type" toml:"type"`
+	// URL is where to send logs: udp://host:514 or tcp://host:601 for syslog, the push
+	// endpoint for Loki, like http://loki:3100/loki/api/v1/push, and the logs endpoint for
+	// OTLP, like http://collector:4318/v1/logs.
+	URL string `json:"url,omitempty" yaml:"url,omitempty" toml:"url,omitempty"`
+	// Path is the file the file sink appends JSON lines to. Relative paths are in the data dir,
+	// which is the only place haloyd can write to outside its container.
+	Path string `json:"path,omitempty" yaml:"path,omitempty" toml:"path,omitempty"`
+	// Headers are sent with Loki and OTLP requests, like Authorization or X-Scope-OrgID.
+	Headers map[string]string `json:"headers,omitempty" yaml:"headers,omitempty" toml:"headers,omitempty"`
+	// Labels are added to everything shipped, as Loki labels, OTLP resource attributes,
+	// syslog structured data or JSON fields.
+	Labels map[string]string `json:"labels,omitempty" yaml:"labels,omitempty" toml:"labels,omitempty"`
+	// AppLogs also ships what app containers print, labelled with the app, deployment and replica.
+	AppLogs bool `json:"appLogs,omitempty" yaml:"app_logs,omitempty" toml:"app_logs,omitempty"`
+	// Apps are glob patterns of the apps whose output is shipped with AppLogs. Empty for all apps.
+	Apps []string `json:"apps,omitempty" yaml:"apps,omitempty" toml:"apps,omitempty"`
+}
+
+func (sc LogSinkConfig) DisplayName() string {
+	if sc.Name != "" {
+		return sc.Name
+	}
+	return string(sc.Type)
+}
+
+func (sc LogSinkConfig) Validate() error {
+	switch sc.Type {
+	case LogSinkSyslog:
+		u, err := url.Parse(sc.URL)
+		if err != nil || (u.Scheme != "udp" && u.Scheme != "tcp") || u.Port() == "" || u.Hostname() == "" {
+			return fmt.Errorf("url must be udp://host:port or tcp://host:port, got '%s'", sc.URL)
+		}
+		if _, _, err := net.SplitHostPort(u.Host); err != nil {
+			return fmt.Errorf("invalid url '%s': %w", sc.URL, err)
+		}
+	case LogSinkLoki, LogSinkOTLP:
+		u, err := url.Parse(sc.URL)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return fmt.Errorf("url must be an http or https URL, got '%s'", sc.URL)
+		}
+	case LogSinkFile:
+		if sc.Path == "" {
+			return fmt.Errorf("path is required")
+		}
+	case "":
+		return fmt.Errorf("type is required")
+	default:
+		return fmt.Errorf("unknown type '%s', must be one of %s, %s, %s or %s", sc.Type, LogSinkSyslog, LogSinkLoki, LogSinkOTLP, LogSinkFile)
+	}
+
+	if sc.Type != LogSinkFile && sc.Path != "" {
+		return fmt.Errorf("path is only used by file sinks")
+	}
+	if sc.Type == LogSinkFile && sc.URL != "" {
+		return fmt.Errorf("url isn't used by file sinks, set path instead")
+	}
+	if len(sc.Headers) > 0 && sc.Type != LogSinkLoki && sc.Type != LogSinkOTLP {
+		return fmt.Errorf("headers are only sent by loki and otlp sinks")
+	}
+	if len(sc.Apps) > 0 && !sc.AppLogs {
+		return fmt.Errorf("apps only selects app logs, set appLogs to ship them")
+	}
+	if err := apitoken.ValidateAppPatterns(sc.Apps); err != nil {
+		return err
+	}
+	return nil
+}
@@ -63,6 +63,16 @@ func ConfigDir() (string, error) {
 	return expandedPath, nil
 }
 
+// APISocketPath returns the Unix socket haloyd serves the API on. The data dir is mounted at
+// the same path in the haloyd container, so it is the same on the host.
+func APISocketPath() (string, error) {
+	dataDir, err := DataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dataDir, constants.APISocketFileName), nil
+}
+
 func IsSystemMode() bool {
 	// Check explicit override first
 	if systemInstall := os.Getenv(constants.EnvVarSystemInstall); systemInstall != "" {
@@ -12,17 +12,43 @@ const (
 	DefaultHealthCheckPath   = "/"
 	DefaultContainerPort     = "8080"
 	DefaultReplicas          = 1
+	DefaultDrainTimeout      = "30s"
+	DefaultCanaryWeight      = 5 // percentage of traffic sent to a new canary deployment
+
+	// Auto rollback thresholds used when auto_rollback only sets a window.
+	DefaultAutoRollbackMaxFailedHealthChecks = 3
+	DefaultAutoRollbackMaxRestarts           = 3
 
 	CertificatesHTTPProviderPort = "8080"
 	APIServerPort                = "9999"
+	WakerPort                    = "9998" // haloyd holds requests for sleeping apps here while starting them
+	MirrorPort                   = "9997" // haloyd proxies requests for apps with a traffic mirror here
+
+	// HAProxy tells the waker and the mirror proxy which app a request is for with these headers.
+	WakeAppHeader   = "X-Haloy-Wake-App"
+	MirrorAppHeader = "X-Haloy-Mirror-App"
+	// Apps on the Docker network can reach the waker and the mirror proxy too, HAProxy proves a
+	// request came through it with a secret in these headers.
+	WakeSecretHeader   = "X-Haloy-Wake-Secret"
+	MirrorSecretHeader = "X-Haloy-Mirror-Secret"
+	// Copies of requests sent to a mirror candidate carry this header, so apps can skip side effects.
+	MirroredRequestHeader = "X-Haloy-Mirrored"
+
+	// Requests that carry the deployment routing secret can pick a deployment with this header or cookie.
+	DeploymentRoutingHeader       = "X-Haloy-Deployment"
+	DeploymentRoutingSecretHeader = "X-Haloy-Deployment-Secret"
+	DeploymentRoutingCookie       = "haloy_deployment"
+	DeploymentRoutingSecretCookie = "haloy_deployment_secret"
 
 	// Environment variables
-	EnvVarAPIToken      = "HALOY_API_TOKEN"
-	EnvVarReplicaID     = "HALOY_REPLICA_ID" // available in all containers.
-	EnvVarDataDir       = "HALOY_DATA_DIR"   // used to override default data directory.
-	EnvVarConfigDir     = "HALOY_CONFIG_DIR" // used to override default config directory for haloy.
-	EnvVarDebug         = "HALOY_DEBUG"
-	EnvVarSystemInstall = "HALOY_SYSTEM_INSTALL" // used to disable system wide install
+	EnvVarAPIToken                = "HALOY_API_TOKEN"
+	EnvVarAPITokenPrevious        = "HALOY_API_TOKEN_PREVIOUS"         // set when rotating the token, valid until the expiry below.
+	EnvVarAPITokenPreviousExpires = "HALOY_API_TOKEN_PREVIOUS_EXPIRES" // RFC3339 time the previous token stops working.
+	EnvVarReplicaID               = "HALOY_REPLICA_ID"                 // available in all containers.
+	EnvVarDataDir                 = "HALOY_DATA_DIR"                   // used to override default data directory.
+	EnvVarConfigDir               = "HALOY_CONFIG_DIR"                 // used to override default config directory for haloy.
+	EnvVarDebug                   = "HALOY_DEBUG"
+	EnvVarSystemInstall           = "HALOY_SYSTEM_INSTALL" // used to disable system wide install
 
 	// Directories
 	SystemDataDir   = "/var/lib/haloy"
@@ -31,16 +57,26 @@ const (
 	UserConfigDir   = "~/.config/haloy"
 
 	// Subdirectories
-	DBDir            = "db"
-	HAProxyConfigDir = "haproxy-config"
-	CertStorageDir   = "cert-storage"
+	DBDir             = "db"
+	DBBackupDir       = "backups" // Inside DBDir, copies of the database taken before migrating
+	HAProxyConfigDir  = "haproxy-config"
+	CertStorageDir    = "cert-storage"
+	HAProxyRuntimeDir = "haproxy-runtime"
+	DeploymentLogsDir = "deployment-logs"
+	ClientCADir       = "client-ca" // CA haloyd issues API client certificates from
 
 	// File names
-	HaloydConfigFileName  = "haloyd.yaml"
-	ClientConfigFileName  = "client.yaml"
-	ConfigEnvFileName     = ".env"
-	HAProxyConfigFileName = "haproxy.cfg"
-	DBFileName            = "haloy.db"
+	HaloydConfigFileName      = "haloyd.yaml"
+	ClientConfigFileName      = "client.yaml"
+	ConfigEnvFileName         = ".env"
+	HAProxyConfigFileName     = "haproxy.cfg"
+	DBFileName                = "haloy.db"
+	HAProxyMasterSocket       = "master.sock"
+	ClientCACertFileName      = "ca.crt"
+	ClientCAKeyFileName       = "ca.key"
+	HAProxyClientCAFileName   = "client-ca.crt"    // Copy of the client CA certificate in HAProxyConfigDir
+	HAProxyAPICrtListFileName = "api-crt-list.txt" // In HAProxyConfigDir, asks for client certificates on the API domain
+	APISocketFileName         = "haloyd.sock"      // Unix socket in the data dir haloyd serves the API on
 )
 
 // File and directory permissions
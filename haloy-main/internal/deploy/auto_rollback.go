@@ -0,0 +1,136 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/docker/docker/client"
+	"github.com/haloydev/haloy/internal/config"
+	"github.com/haloydev/haloy/internal/deploytypes"
+	"github.com/haloydev/haloy/internal/docker"
+	"github.com/haloydev/haloy/internal/helpers"
+	"github.com/haloydev/haloy/internal/logging"
+	"github.com/haloydev/haloy/internal/storage"
+)
+
+// AutoRollback rolls an app back after deploymentID became unhealthy during its observation window.
+// It redeploys the newest earlier deployment that was not rolled back itself as rollbackDeploymentID
+// and records the reason. Secrets can't be resolved on the server, so env vars that reference a
+// source reuse the values from the failing deployment's containers.
+func AutoRollback(ctx context.Context, cli *client.Client, appName, deploymentID, rollbackDeploymentID, reason string, logs logging.StreamPublisher, logger *slog.Logger) error {
+	db, err := storage.New()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	rolledBack, err := db.ListAutoRollbacks(appName)
+	if err != nil {
+		return err
+	}
+	for _, rollback := range rolledBack {
+		if rollback.RollbackDeploymentID == deploymentID {
+			return fmt.Errorf("deployment %s is itself an automatic rollback of %s, not rolling back again", deploymentID, rollback.DeploymentID)
+		}
+	}
+
+	targets, err := GetRollbackTargets(ctx, cli, appName)
+	if err != nil {
+		return err
+	}
+
+	// Targets are sorted newest first.
+	var target *deploytypes.RollbackTarget
+	for i := range targets {
+		if targets[i].DeploymentID < deploymentID && !targets[i].AutoRolledBack {
+			target = &targets[i]
+			break
+		}
+	}
+	if target == nil || target.RawAppConfig == nil {
+		return fmt.Errorf("no earlier deployment of %s to roll back to", appName)
+	}
+
+	targetConfig := target.RawAppConfig.TargetConfig
+	targetConfig.APIToken = nil
+	targetConfig.Env, err = envFromDeployment(ctx, cli, appName, deploymentID, targetConfig.Env)
+	if err != nil {
+		return err
+	}
+	// The routing secret can't be recovered from the running containers either.
+	if dr := targetConfig.DeploymentRouting; dr != nil && dr.Enabled && dr.Secret.From != nil {
+		logger.Warn("Deployment routing secret can't be resolved on the server, disabling deployment routing for the rollback")
+		targetConfig.DeploymentRouting = nil
+	}
+	if err := targetConfig.Validate(targetConfig.Format); err != nil {
+		return fmt.Errorf("config of deployment %s is not valid: %w", target.DeploymentID, err)
+	}
+
+	rollback := storage.AutoRollback{
+		DeploymentID:         deploymentID,
+		AppName:              appName,
+		RolledBackTo:         target.DeploymentID,
+		RollbackDeploymentID: rollbackDeploymentID,
+		Reason:               reason,
+	}
+	if err := db.SaveAutoRollback(rollback); err != nil {
+		return err
+	}
+
+	logger.Info(fmt.Sprintf("Automatically rolling back %s to %s: %s", appName, target.DeploymentID, reason),
+		"app", appName, "rolledBackFrom", deploymentID, "rolledBackTo", target.DeploymentID)
+
+	return RollbackApp(ctx, cli, targetConfig, target.DeploymentID, rollbackDeploymentID, logs, logger)
+}
+
+// envFromDeployment resolves env vars that reference a source with the values the containers
+// of a deployment were started with.
+func envFromDeployment(ctx context.Context, cli *client.Client, appName, deploymentID string, envVars []config.EnvVar) ([]config.EnvVar, error) {
+	needsResolving := false
+	for _, envVar := range envVars {
+		if envVar.From != nil {
+			needsResolving = true
+			break
+		}
+	}
+	if !needsResolving {
+		return envVars, nil
+	}
+
+	containers, err := docker.GetAppContainers(ctx, cli, true, appName)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]string)
+	for _, c := range containers {
+		if c.Labels[config.LabelDeploymentID] != deploymentID {
+			continue
+		}
+		info, err := cli.ContainerInspect(ctx, c.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to inspect container %s: %w", helpers.SafeIDPrefix(c.ID), err)
+		}
+		for _, kv := range info.Config.Env {
+			if name, value, ok := strings.Cut(kv, "="); ok {
+				values[name] = value
+			}
+		}
+		break
+	}
+
+	resolved := make([]config.EnvVar, 0, len(envVars))
+	for _, envVar := range envVars {
+		if envVar.From != nil {
+			value, ok := values[envVar.Name]
+			if !ok {
+				return nil, fmt.Errorf("unable to resolve env var '%s' on the server", envVar.Name)
+			}
+			envVar = config.EnvVar{Name: envVar.Name, ValueSource: config.ValueSource{Value: value}}
+		}
+		resolved = append(resolved, envVar)
+	}
+	return resolved, nil
+}
@@ -0,0 +1,114 @@
+package deploy
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"github.com/haloydev/haloy/internal/config"
+)
+
+// fakeDocker serves the container list and inspect endpoints of the Docker API, with env
+// holding the environment of each container by ID.
+func fakeDocker(t *testing.T, deploymentIDs map[string]string, env map[string][]string) (*client.Client, *atomic.Int32) {
+	t.Helper()
+	calls := &atomic.Int32{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		path := strings.TrimPrefix(r.URL.Path, "/v1.45")
+		switch {
+		case path == "/containers/json":
+			var list []container.Summary
+			for _, id := range slices.Sorted(maps.Keys(deploymentIDs)) {
+				list = append(list, container.Summary{ID: id, Labels: map[string]string{config.LabelDeploymentID: deploymentIDs[id]}})
+			}
+			json.NewEncoder(w).Encode(list)
+		case strings.HasPrefix(path, "/containers/") && strings.HasSuffix(path, "/json"):
+			id := strings.TrimSuffix(strings.TrimPrefix(path, "/containers/"), "/json")
+			json.NewEncoder(w).Encode(container.InspectResponse{
+				ContainerJSONBase: &container.ContainerJSONBase{ID: id, State: &container.State{}},
+				Config:            &container.Config{Env: env[id]},
+			})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	cli, err := client.NewClientWithOpts(client.WithHost("tcp://"+strings.TrimPrefix(server.URL, "http://")), client.WithVersion("1.45"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cli.Close() })
+	return cli, calls
+}
+
+func TestEnvFromDeployment(t *testing.T) {
+	cli, calls := fakeDocker(t,
+		map[string]string{"failing": "02", "older": "01"},
+		map[string][]string{
+			"failing": {"PATH=/usr/bin", "API_KEY=from-failing", "DSN=postgres://db?a=b"},
+			"older":   {"API_KEY=from-older"},
+		})
+	secret := &config.SourceReference{Secret: "api"}
+
+	tests := []struct {
+		name    string
+		envVars []config.EnvVar
+		want    []config.EnvVar
+		wantErr bool
+	}{
+		{
+			name: "values resolved from the deployment's containers",
+			envVars: []config.EnvVar{
+				{Name: "MODE", ValueSource: config.ValueSource{Value: "production"}},
+				{Name: "API_KEY", ValueSource: config.ValueSource{From: secret}},
+				{Name: "DSN", ValueSource: config.ValueSource{From: secret}},
+			},
+			want: []config.EnvVar{
+				{Name: "MODE", ValueSource: config.ValueSource{Value: "production"}},
+				{Name: "API_KEY", ValueSource: config.ValueSource{Value: "from-failing"}},
+				{Name: "DSN", ValueSource: config.ValueSource{Value: "postgres://db?a=b"}},
+			},
+		},
+		{
+			name:    "missing value",
+			envVars: []config.EnvVar{{Name: "TOKEN", ValueSource: config.ValueSource{From: secret}}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := envFromDeployment(context.Background(), cli, "web", "02", tt.envVars)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("got %+v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.EqualFunc(got, tt.want, func(a, b config.EnvVar) bool {
+				return a.Name == b.Name && a.Value == b.Value && a.From == nil && b.From == nil
+			}) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	// Literal values don't need Docker.
+	calls.Store(0)
+	literal := []config.EnvVar{{Name: "MODE", ValueSource: config.ValueSource{Value: "production"}}}
+	if got, err := envFromDeployment(context.Background(), cli, "web", "02", literal); err != nil || len(got) != 1 || calls.Load() != 0 {
+		t.Errorf("got %+v, %v after %d Docker calls, want the literal values unchanged without calls", got, err, calls.Load())
+	}
+}
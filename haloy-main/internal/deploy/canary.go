@@ -0,0 +1,102 @@
+package deploy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/docker/docker/client"
+	"github.com/haloydev/haloy/internal/config"
+	"github.com/haloydev/haloy/internal/constants"
+	"github.com/haloydev/haloy/internal/docker"
+	"github.com/haloydev/haloy/internal/storage"
+)
+
+// startCanary records a canary for the app before its containers start, so haloyd sends only a
+// share of the traffic to them. It returns false when there is no running deployment to run the
+// canary next to, in which case the app is deployed as usual.
+func startCanary(ctx context.Context, cli *client.Client, appName, deploymentID string, logger *slog.Logger) (bool, error) {
+	running, stableDeploymentID, err := runningDeployments(ctx, cli, appName, deploymentID)
+	if err != nil {
+		return false, err
+	}
+
+	if stableDeploymentID == "" {
+		logger.Info("No running deployment found, deploying without canary")
+		return false, nil
+	}
+
+	db, err := storage.New()
+	if err != nil {
+		return false, err
+	}
+	defer db.Close()
+
+	if preview, err := db.GetPreview(appName); err == nil && running[preview.PreviewDeploymentID] {
+		return false, fmt.Errorf("deployment %s is waiting for promotion, promote it or deploy without canary first", preview.PreviewDeploymentID)
+	}
+
+	existing, err := db.GetCanary(appName)
+	if err == nil && running[existing.StableDeploymentID] && running[existing.CanaryDeploymentID] {
+		return false, fmt.Errorf("canary %s is already in progress for %s, promote or abort it first", existing.CanaryDeploymentID, appName)
+	} else if err != nil && !errors.Is(err, storage.ErrCanaryNotFound) {
+		return false, err
+	}
+
+	canary := storage.Canary{
+		AppName:            appName,
+		StableDeploymentID: stableDeploymentID,
+		CanaryDeploymentID: deploymentID,
+		Weight:             constants.DefaultCanaryWeight,
+	}
+	if err := db.SaveCanary(canary); err != nil {
+		return false, err
+	}
+
+	logger.Info(fmt.Sprintf("Starting canary next to %s with %d%% of traffic", stableDeploymentID, canary.Weight),
+		"stableDeploymentID", stableDeploymentID, "weight", canary.Weight)
+	return true, nil
+}
+
+// endCanary removes any canary state for the app. A regular deployment replaces both the
+// stable and the canary deployment, so the canary split no longer applies.
+func endCanary(appName string, logger *slog.Logger) error {
+	db, err := storage.New()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	canary, err := db.GetCanary(appName)
+	if errors.Is(err, storage.ErrCanaryNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	logger.Info(fmt.Sprintf("Ending canary %s", canary.CanaryDeploymentID))
+	return db.DeleteCanary(appName)
+}
+
+// runningDeployments returns the IDs of the app's running deployments and the latest of them,
+// ignoring the deployment being started.
+func runningDeployments(ctx context.Context, cli *client.Client, appName, ignoreDeploymentID string) (running map[string]bool, latestDeploymentID string, err error) {
+	containers, err := docker.GetAppContainers(ctx, cli, false, appName)
+	if err != nil {
+		return nil, "", err
+	}
+
+	running = make(map[string]bool)
+	for _, c := range containers {
+		id := c.Labels[config.LabelDeploymentID]
+		if id == ignoreDeploymentID {
+			continue
+		}
+		running[id] = true
+		if id > latestDeploymentID {
+			latestDeploymentID = id
+		}
+	}
+	return running, latestDeploymentID, nil
+}
@@ -0,0 +1,65 @@
+package deploy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/client"
+	"github.com/haloydev/haloy/internal/deploytypes"
+	"github.com/haloydev/haloy/internal/docker"
+	"github.com/haloydev/haloy/internal/storage"
+)
+
+const cancelCleanupTimeout = 2 * time.Minute
+
+// CleanupCancelledDeployment removes what a cancelled deployment created before it went live:
+// its containers, its image tag and any canary or preview state pointing at it. The deployment's
+// status is set to cancelled. It runs with its own context since the deployment's is done.
+func CleanupCancelledDeployment(cli *client.Client, appName, deploymentID string, logger *slog.Logger) error {
+	ctx, cancel := context.WithTimeout(context.Background(), cancelCleanupTimeout)
+	defer cancel()
+
+	removed, err := docker.RemoveDeploymentContainers(ctx, cli, logger, appName, deploymentID)
+	if err != nil {
+		return fmt.Errorf("failed to remove containers: %w", err)
+	}
+	if len(removed) > 0 {
+		logger.Info(fmt.Sprintf("Removed %d container(s) of the cancelled deployment", len(removed)))
+	}
+
+	tag := fmt.Sprintf("%s:%s", appName, deploymentID)
+	if _, err := cli.ImageRemove(ctx, tag, image.RemoveOptions{PruneChildren: false}); err != nil && !client.IsErrNotFound(err) {
+		logger.Warn("Failed to remove image tag of the cancelled deployment", "tag", tag, "error", err)
+	}
+
+	db, err := storage.New()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if canary, err := db.GetCanary(appName); err == nil && canary.CanaryDeploymentID == deploymentID {
+		if err := db.DeleteCanary(appName); err != nil {
+			return err
+		}
+	} else if err != nil && !errors.Is(err, storage.ErrCanaryNotFound) {
+		return err
+	}
+
+	if preview, err := db.GetPreview(appName); err == nil && preview.PreviewDeploymentID == deploymentID {
+		if err := db.DeleteMirror(appName); err != nil {
+			return err
+		}
+		if err := db.DeletePreview(appName); err != nil {
+			return err
+		}
+	} else if err != nil && !errors.Is(err, storage.ErrPreviewNotFound) {
+		return err
+	}
+
+	return db.SetDeploymentStatus(deploymentID, deploytypes.DeploymentStatusCancelled, ErrDeploymentCancelled.Error())
+}
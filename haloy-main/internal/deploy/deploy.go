@@ -7,16 +7,55 @@ import (
 	"fmt"
 	"log/slog"
 	"strings"
+	"time"
 
 	"github.com/docker/docker/client"
 	"github.com/haloydev/haloy/internal/config"
+	"github.com/haloydev/haloy/internal/deploytypes"
 	"github.com/haloydev/haloy/internal/docker"
+	"github.com/haloydev/haloy/internal/logging"
 	"github.com/haloydev/haloy/internal/storage"
 )
 
-func DeployApp(ctx context.Context, cli *client.Client, deploymentID string, targetConfig config.TargetConfig, rawAppConfig config.AppConfig, logger *slog.Logger) error {
+// DeployOptions holds per-deployment settings that are not part of the app config.
+type DeployOptions struct {
+	// NoPromote starts the deployment on its preview hostname and leaves the app's domains
+	// on the live deployment until it is promoted.
+	NoPromote bool
+	// Metadata is set as labels on the deployment's containers.
+	Metadata config.DeployMetadata
+	// Logs removes the stored logs of the deployments pruned from the app's history. Without
+	// it they are left for haloyd's periodic cleanup.
+	Logs logging.StreamPublisher
+}
+
+// DeployApp pulls the image and starts the deployment's containers. If the deployment is
+// cancelled before that finishes, whatever it created is removed and ErrDeploymentCancelled
+// is returned.
+func DeployApp(ctx context.Context, cli *client.Client, deploymentID string, targetConfig config.TargetConfig, rawAppConfig config.AppConfig, opts DeployOptions, logger *slog.Logger) error {
+	RecordStatus(deploymentID, deploytypes.DeploymentStatusDeploying, "", logger)
+
+	err := deployApp(ctx, cli, deploymentID, targetConfig, rawAppConfig, opts, logger)
+	if err != nil && Cancelled(ctx) {
+		logger.Warn("Deployment cancelled, cleaning up", "error", err)
+		if cleanupErr := CleanupCancelledDeployment(cli, targetConfig.Name, deploymentID, logger); cleanupErr != nil {
+			logger.Warn("Failed to clean up cancelled deployment", "error", cleanupErr)
+		}
+		return ErrDeploymentCancelled
+	} else if err != nil {
+		RecordStatus(deploymentID, deploytypes.DeploymentStatusFailed, err.Error(), logger)
+	}
+	return err
+}
+
+func deployApp(ctx context.Context, cli *client.Client, deploymentID string, targetConfig config.TargetConfig, rawAppConfig config.AppConfig, opts DeployOptions, logger *slog.Logger) error {
 	imageRef := targetConfig.Image.ImageRef()
 
+	if opts.NoPromote && targetConfig.DeploymentStrategy != config.DeploymentStrategyRolling {
+		return fmt.Errorf("deployments that wait for promotion require the rolling strategy, got '%s'", targetConfig.DeploymentStrategy)
+	}
+
+	pullStart := time.Now()
 	err := docker.EnsureImageUpToDate(ctx, cli, logger, *targetConfig.Image)
 	if err != nil {
 		return err
@@ -26,6 +65,35 @@ func DeployApp(ctx context.Context, cli *client.Client, deploymentID string, tar
 	if err != nil {
 		return fmt.Errorf("failed to tag image: %w", err)
 	}
+	RecordPhase(deploymentID, deploytypes.DeploymentPhasePull, time.Since(pullStart), logger)
+	if digest, err := docker.ImageDigest(ctx, cli, newImageRef); err != nil {
+		logger.Warn("Failed to resolve image digest", "image", newImageRef, "error", err)
+	} else {
+		recordImageDigest(deploymentID, digest, logger)
+	}
+
+	isCanary := false
+	switch {
+	case opts.NoPromote:
+		if err := startPreview(ctx, cli, targetConfig.Name, deploymentID, logger); err != nil {
+			return fmt.Errorf("failed to start preview: %w", err)
+		}
+	case targetConfig.DeploymentStrategy == config.DeploymentStrategyCanary:
+		isCanary, err = startCanary(ctx, cli, targetConfig.Name, deploymentID, logger)
+		if err != nil {
+			return fmt.Errorf("failed to start canary: %w", err)
+		}
+		if err := endPreview(targetConfig.Name, logger); err != nil {
+			return fmt.Errorf("failed to end preview: %w", err)
+		}
+	default:
+		if err := endCanary(targetConfig.Name, logger); err != nil {
+			return fmt.Errorf("failed to end canary: %w", err)
+		}
+		if err := endPreview(targetConfig.Name, logger); err != nil {
+			return fmt.Errorf("failed to end preview: %w", err)
+		}
+	}
 
 	if targetConfig.DeploymentStrategy == config.DeploymentStrategyReplace {
 		_, err := docker.StopContainers(ctx, cli, logger, targetConfig.Name, "")
@@ -34,8 +102,19 @@ func DeployApp(ctx context.Context, cli *client.Client, deploymentID string, tar
 		}
 	}
 
-	runResult, err := docker.RunContainer(ctx, cli, deploymentID, newImageRef, targetConfig)
+	runStart := time.Now()
+	runResult, err := docker.RunContainer(ctx, cli, deploymentID, newImageRef, targetConfig, opts.Metadata)
 	if err != nil {
+		if isCanary {
+			if endErr := endCanary(targetConfig.Name, logger); endErr != nil {
+				logger.Warn("Failed to remove canary state", "error", endErr)
+			}
+		}
+		if opts.NoPromote {
+			if endErr := endPreview(targetConfig.Name, logger); endErr != nil {
+				logger.Warn("Failed to remove preview state", "error", endErr)
+			}
+		}
 		if errors.Is(err, context.DeadlineExceeded) {
 			return fmt.Errorf("container startup timed out: %w", err)
 		} else if errors.Is(err, context.Canceled) {
@@ -49,18 +128,20 @@ func DeployApp(ctx context.Context, cli *client.Client, deploymentID string, tar
 	}
 	if len(runResult) == 0 {
 		return fmt.Errorf("no containers started, check logs for details")
-	} else if len(runResult) == 1 {
+	}
+	RecordPhase(deploymentID, deploytypes.DeploymentPhaseStart, time.Since(runStart), logger)
+	if len(runResult) == 1 {
 		logger.Info("Container started successfully", "containerID", runResult[0].ID, "deploymentID", deploymentID)
 	} else {
 		logger.Info(fmt.Sprintf("Containers started successfully (%d replicas)", len(runResult)), "count", len(runResult), "deploymentID", deploymentID)
 	}
 	// We'll make sure to save the raw app config (without resolved secrets to history)
-	handleImageHistory(ctx, cli, rawAppConfig, deploymentID, newImageRef, logger)
+	handleImageHistory(ctx, cli, rawAppConfig, deploymentID, newImageRef, opts.Logs, logger)
 
 	return nil
 }
 
-func handleImageHistory(ctx context.Context, cli *client.Client, rawAppConfig config.AppConfig, deploymentID, newImageRef string, logger *slog.Logger) {
+func handleImageHistory(ctx context.Context, cli *client.Client, rawAppConfig config.AppConfig, deploymentID, newImageRef string, logs logging.StreamPublisher, logger *slog.Logger) {
 	image := rawAppConfig.Image
 
 	if image == nil {
@@ -76,13 +157,21 @@ func handleImageHistory(ctx context.Context, cli *client.Client, rawAppConfig co
 	switch strategy {
 	case config.HistoryStrategyNone:
 		logger.Debug("History disabled, skipping cleanup and history storage")
+		// The deployment's status is still recorded, keep those records from piling up.
+		prunedIDs, err := pruneDeployments(rawAppConfig.Name, 0)
+		if err != nil {
+			logger.Warn("Failed to prune old deployments", "error", err)
+		}
+		removeDeploymentLogs(logs, prunedIDs, logger)
 
 	case config.HistoryStrategyLocal:
-		if err := writeAppConfigHistory(rawAppConfig, deploymentID, newImageRef); err != nil {
+		prunedIDs, err := writeAppConfigHistory(rawAppConfig, deploymentID, newImageRef)
+		if err != nil {
 			logger.Warn("Failed to write app config history", "error", err)
 		} else {
 			logger.Debug("App configuration saved to history")
 		}
+		removeDeploymentLogs(logs, prunedIDs, logger)
 
 		// Keep N images locally for fast rollback
 		if err := docker.RemoveImages(ctx, cli, logger, rawAppConfig.Name, deploymentID, *rawAppConfig.Image.History.Count); err != nil {
@@ -93,11 +182,13 @@ func handleImageHistory(ctx context.Context, cli *client.Client, rawAppConfig co
 
 	case config.HistoryStrategyRegistry:
 		// Save deployment history for rollback metadata
-		if err := writeAppConfigHistory(rawAppConfig, deploymentID, newImageRef); err != nil {
+		prunedIDs, err := writeAppConfigHistory(rawAppConfig, deploymentID, newImageRef)
+		if err != nil {
 			logger.Warn("Failed to write app config history", "error", err)
 		} else {
 			logger.Debug("App configuration saved to history")
 		}
+		removeDeploymentLogs(logs, prunedIDs, logger)
 
 		// Remove all old images - registry is source of truth
 		// Keep only the current deployment's image (count = 1)
@@ -125,25 +216,49 @@ func tagImage(ctx context.Context, cli *client.Client, srcRef, appName, deployme
 	return dstRef, nil
 }
 
-// writeAppConfigHistory writes the given appConfig to the db. It will save the newImageRef as a json repsentation of the Image struct to use for rollbacks
-func writeAppConfigHistory(rawAppConfig config.AppConfig, deploymentID, newImageRef string) error {
+func pruneDeployments(appName string, deploymentsToKeep int) ([]string, error) {
+	db, err := storage.New()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	return db.PruneOldDeployments(appName, deploymentsToKeep)
+}
+
+// removeDeploymentLogs deletes the stored logs of pruned deployments. Logs that can't be
+// removed are left for haloyd's periodic cleanup, the deployments are pruned either way.
+func removeDeploymentLogs(logs logging.StreamPublisher, deploymentIDs []string, logger *slog.Logger) {
+	if logs == nil {
+		return
+	}
+	for _, id := range deploymentIDs {
+		if err := logs.RemoveDeployment(id); err != nil {
+			logger.Debug("Failed to remove deployment log", "deploymentID", id, "error", err)
+		}
+	}
+}
+
+// writeAppConfigHistory writes the given appConfig to the db. It will save the newImageRef as a json repsentation of the Image struct to use for rollbacks.
+// It returns the IDs of the deployments pruned from the history.
+func writeAppConfigHistory(rawAppConfig config.AppConfig, deploymentID, newImageRef string) ([]string, error) {
 	if rawAppConfig.Image.History == nil {
-		return fmt.Errorf("image.history must be set")
+		return nil, fmt.Errorf("image.history must be set")
 	}
 
 	if rawAppConfig.Image.History.Strategy != config.HistoryStrategyNone && rawAppConfig.Image.History.Count == nil {
-		return fmt.Errorf("image.history.count is required for %s strategy", rawAppConfig.Image.History.Strategy)
+		return nil, fmt.Errorf("image.history.count is required for %s strategy", rawAppConfig.Image.History.Strategy)
 	}
 
 	db, err := storage.New()
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer db.Close()
 
 	rawAppConfigJSON, err := json.Marshal(rawAppConfig)
 	if err != nil {
-		return fmt.Errorf("failed to convert target config to JSON: %w", err)
+		return nil, fmt.Errorf("failed to convert target config to JSON: %w", err)
 	}
 
 	deployedImage := rawAppConfig.Image
@@ -154,7 +269,7 @@ func writeAppConfigHistory(rawAppConfig config.AppConfig, deploymentID, newImage
 
 	deployedImageJSON, err := json.Marshal(deployedImage)
 	if err != nil {
-		return fmt.Errorf("failed to convert deployed image to JSON: %w", err)
+		return nil, fmt.Errorf("failed to convert deployed image to JSON: %w", err)
 	}
 
 	deployment := storage.Deployment{
@@ -165,12 +280,13 @@ func writeAppConfigHistory(rawAppConfig config.AppConfig, deploymentID, newImage
 	}
 
 	if err := db.SaveDeployment(deployment); err != nil {
-		return fmt.Errorf("failed to save deployment to database: %w", err)
+		return nil, fmt.Errorf("failed to save deployment to database: %w", err)
 	}
 
-	if err := db.PruneOldDeployments(rawAppConfig.Name, *rawAppConfig.Image.History.Count); err != nil {
-		return fmt.Errorf("failed to prune old deployments: %w", err)
+	prunedIDs, err := db.PruneOldDeployments(rawAppConfig.Name, *rawAppConfig.Image.History.Count)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prune old deployments: %w", err)
 	}
 
-	return nil
+	return prunedIDs, nil
 }
@@ -0,0 +1,103 @@
+package deploy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/docker/docker/client"
+	"github.com/haloydev/haloy/internal/docker"
+	"github.com/haloydev/haloy/internal/storage"
+)
+
+// startPreview records the deployment as waiting for promotion before its containers start,
+// so haloyd serves it on the preview hostname and keeps the app's domains on the live deployment.
+// A previous preview that was never promoted is stopped and replaced.
+func startPreview(ctx context.Context, cli *client.Client, appName, deploymentID string, logger *slog.Logger) error {
+	db, err := storage.New()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	running, _, err := runningDeployments(ctx, cli, appName, deploymentID)
+	if err != nil {
+		return err
+	}
+
+	if canary, err := db.GetCanary(appName); err == nil && running[canary.CanaryDeploymentID] {
+		return fmt.Errorf("canary %s is in progress, promote or abort it first", canary.CanaryDeploymentID)
+	}
+
+	liveDeploymentID := ""
+	existing, err := db.GetPreview(appName)
+	switch {
+	case err == nil:
+		liveDeploymentID = existing.LiveDeploymentID
+		if running[existing.PreviewDeploymentID] {
+			logger.Info(fmt.Sprintf("Replacing deployment %s that was waiting for promotion", existing.PreviewDeploymentID))
+			if _, err := docker.StopDeploymentContainers(ctx, cli, logger, appName, existing.PreviewDeploymentID); err != nil {
+				return fmt.Errorf("failed to stop previous preview: %w", err)
+			}
+			if _, err := docker.RemoveDeploymentContainers(ctx, cli, logger, appName, existing.PreviewDeploymentID); err != nil {
+				return fmt.Errorf("failed to remove previous preview: %w", err)
+			}
+			delete(running, existing.PreviewDeploymentID)
+			if err := db.DeleteMirror(appName); err != nil {
+				return err
+			}
+		}
+	case !errors.Is(err, storage.ErrPreviewNotFound):
+		return err
+	}
+
+	if !running[liveDeploymentID] {
+		liveDeploymentID = ""
+		for id := range running {
+			if id > liveDeploymentID {
+				liveDeploymentID = id
+			}
+		}
+	}
+
+	if liveDeploymentID == "" {
+		return fmt.Errorf("no running deployment of %s found, deploy it once before using --no-promote", appName)
+	}
+
+	preview := storage.Preview{
+		AppName:             appName,
+		LiveDeploymentID:    liveDeploymentID,
+		PreviewDeploymentID: deploymentID,
+	}
+	if err := db.SavePreview(preview); err != nil {
+		return err
+	}
+
+	logger.Info(fmt.Sprintf("Deployment will not be promoted, %s keeps serving the app", liveDeploymentID),
+		"liveDeploymentID", liveDeploymentID)
+	return nil
+}
+
+// endPreview removes the app's preview state. A regular deployment replaces both the live
+// deployment and any deployment that was waiting for promotion.
+func endPreview(appName string, logger *slog.Logger) error {
+	db, err := storage.New()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	preview, err := db.GetPreview(appName)
+	if errors.Is(err, storage.ErrPreviewNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	logger.Info(fmt.Sprintf("Deployment %s will no longer wait for promotion", preview.PreviewDeploymentID))
+	if err := db.DeleteMirror(appName); err != nil {
+		return err
+	}
+	return db.DeletePreview(appName)
+}
@@ -0,0 +1,191 @@
+package deploy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/haloydev/haloy/internal/deploytypes"
+)
+
+// ErrDeployInProgress is returned when an app is already being deployed and the caller
+// asked not to wait for it.
+var ErrDeployInProgress = errors.New("another deployment of the app is in progress")
+
+// ErrDeploymentCancelled is the cause of the context of a deployment cancelled through Queue.Cancel.
+var ErrDeploymentCancelled = errors.New("deployment cancelled")
+
+// Queue serializes deployments per app. Deployments of different apps run in parallel,
+// deployments of the same app run one at a time in the order they were queued.
+// It also keeps the cancel funcs of the deployments haloyd is working on.
+type Queue struct {
+	mutex   sync.Mutex
+	apps    map[string][]*Ticket // Head of each slice holds the app's lock
+	running map[string]*trackedDeployment
+}
+
+type trackedDeployment struct {
+	cancel context.CancelCauseFunc
+}
+
+func NewQueue() *Queue {
+	return &Queue{
+		apps:    make(map[string][]*Ticket),
+		running: make(map[string]*trackedDeployment),
+	}
+}
+
+// Track returns a copy of ctx that is cancelled with ErrDeploymentCancelled when the deployment
+// is cancelled, and a func that stops tracking the deployment and releases the context.
+func (q *Queue) Track(ctx context.Context, deploymentID string) (context.Context, func()) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	tracked := &trackedDeployment{cancel: cancel}
+
+	q.mutex.Lock()
+	q.running[deploymentID] = tracked
+	q.mutex.Unlock()
+
+	return ctx, func() {
+		q.mutex.Lock()
+		if q.running[deploymentID] == tracked {
+			delete(q.running, deploymentID)
+		}
+		q.mutex.Unlock()
+		cancel(nil)
+	}
+}
+
+// Cancel cancels a tracked deployment, whether it is still waiting for its turn or already
+// running. It returns false if no deployment with the ID is tracked.
+func (q *Queue) Cancel(deploymentID string) bool {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	tracked, ok := q.running[deploymentID]
+	if !ok {
+		return false
+	}
+	tracked.cancel(ErrDeploymentCancelled)
+	return true
+}
+
+// InProgress reports whether a deployment is queued or running.
+func (q *Queue) InProgress(deploymentID string) bool {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	_, ok := q.running[deploymentID]
+	return ok
+}
+
+// Cancelled reports whether ctx, or the context it was derived from, was cancelled through Queue.Cancel.
+func Cancelled(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), ErrDeploymentCancelled)
+}
+
+// Ticket is a place in an app's queue. It must be released with Done once the deployment
+// finished or gave up waiting.
+type Ticket struct {
+	queue *Queue
+	entry deploytypes.QueuedDeployment
+	ready chan struct{} // Closed once the ticket holds the lock
+	once  sync.Once
+}
+
+// Enqueue adds a deployment to its app's queue. With wait set to false it fails with
+// ErrDeployInProgress instead of queueing behind another deployment.
+func (q *Queue) Enqueue(appName, deploymentID string, kind deploytypes.DeploymentKind, wait bool) (*Ticket, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	tickets := q.apps[appName]
+	if len(tickets) > 0 && !wait {
+		return nil, fmt.Errorf("%w: %s is running", ErrDeployInProgress, tickets[0].entry.DeploymentID)
+	}
+
+	ticket := &Ticket{
+		queue: q,
+		entry: deploytypes.QueuedDeployment{
+			AppName:      appName,
+			DeploymentID: deploymentID,
+			Kind:         kind,
+			QueuedAt:     time.Now().UTC(),
+		},
+		ready: make(chan struct{}),
+	}
+	q.apps[appName] = append(tickets, ticket)
+	if len(tickets) == 0 {
+		ticket.start()
+	}
+	return ticket, nil
+}
+
+// List returns the running and waiting deployments, optionally only those of one app.
+// Apps are sorted by name and each app's deployments are in queue order.
+func (q *Queue) List(appName string) []deploytypes.QueuedDeployment {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	var deployments []deploytypes.QueuedDeployment
+	for _, name := range slices.Sorted(maps.Keys(q.apps)) {
+		if appName != "" && name != appName {
+			continue
+		}
+		for i, ticket := range q.apps[name] {
+			entry := ticket.entry
+			entry.Position = i
+			deployments = append(deployments, entry)
+		}
+	}
+	return deployments
+}
+
+// Position returns the number of deployments ahead of the ticket.
+func (t *Ticket) Position() int {
+	t.queue.mutex.Lock()
+	defer t.queue.mutex.Unlock()
+
+	return slices.Index(t.queue.apps[t.entry.AppName], t)
+}
+
+// Wait blocks until the ticket holds its app's lock or the context is done.
+func (t *Ticket) Wait(ctx context.Context) error {
+	select {
+	case <-t.ready:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Done releases the lock, or leaves the queue if the ticket was still waiting, and lets
+// the next deployment of the app start. Calling it more than once has no effect.
+func (t *Ticket) Done() {
+	t.once.Do(func() {
+		q := t.queue
+		q.mutex.Lock()
+		defer q.mutex.Unlock()
+
+		tickets := slices.DeleteFunc(q.apps[t.entry.AppName], func(other *Ticket) bool { return other == t })
+		if len(tickets) == 0 {
+			delete(q.apps, t.entry.AppName)
+			return
+		}
+		q.apps[t.entry.AppName] = tickets
+		tickets[0].start()
+	})
+}
+
+// start hands the lock to the ticket. The queue mutex must be held.
+func (t *Ticket) start() {
+	if t.entry.StartedAt != nil {
+		return
+	}
+	now := time.Now().UTC()
+	t.entry.StartedAt = &now
+	close(t.ready)
+}
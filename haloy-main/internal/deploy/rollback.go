@@ -11,13 +11,20 @@ import (
 	"github.com/haloydev/haloy/internal/config"
 	"github.com/haloydev/haloy/internal/deploytypes"
 	"github.com/haloydev/haloy/internal/docker"
+	"github.com/haloydev/haloy/internal/logging"
 	"github.com/haloydev/haloy/internal/storage"
 )
 
 // RollbackApp is basically a wrapper around DeployApp that allows rolling back to a previous deployment.
-func RollbackApp(ctx context.Context, cli *client.Client, targetConfig config.TargetConfig, targetDeploymentID, newDeploymentID string, logger *slog.Logger) error {
+// logs is passed on to DeployApp in DeployOptions.Logs.
+func RollbackApp(ctx context.Context, cli *client.Client, targetConfig config.TargetConfig, targetDeploymentID, newDeploymentID string, logs logging.StreamPublisher, logger *slog.Logger) error {
 	appName := targetConfig.Name
 
+	// Rollbacks take over the app right away instead of starting as a canary.
+	if targetConfig.DeploymentStrategy == config.DeploymentStrategyCanary {
+		targetConfig.DeploymentStrategy = config.DeploymentStrategyRolling
+	}
+
 	targets, err := GetRollbackTargets(ctx, cli, appName)
 	if err != nil {
 		return err
@@ -27,12 +34,19 @@ func RollbackApp(ctx context.Context, cli *client.Client, targetConfig config.Ta
 		return fmt.Errorf("there are no images to rollback to for %s", appName)
 	}
 
+	for _, target := range targets {
+		if target.IsRunning && target.DeploymentID != targetDeploymentID {
+			recordRolledBackFrom(newDeploymentID, target.DeploymentID, logger)
+		}
+	}
+
 	for _, target := range targets {
 		if target.DeploymentID == targetDeploymentID {
 			if target.RawAppConfig == nil {
 				return fmt.Errorf("no raw app config stored for app %s: %w", appName, err)
 			}
-			if err := DeployApp(ctx, cli, newDeploymentID, targetConfig, *target.RawAppConfig, logger); err != nil {
+			recordRollbackMetadata(newDeploymentID, target.Metadata, logger)
+			if err := DeployApp(ctx, cli, newDeploymentID, targetConfig, *target.RawAppConfig, DeployOptions{Metadata: target.Metadata, Logs: logs}, logger); err != nil {
 				return fmt.Errorf("failed to deploy app %s: %w", appName, err)
 			}
 
@@ -56,11 +70,16 @@ func GetRollbackTargets(ctx context.Context, cli *client.Client, appName string)
 	}
 	defer db.Close()
 
-	deployments, err := db.GetDeploymentHistory(appName, 50)
+	deployments, err := db.GetDeploymentHistory(appName, storage.DeploymentHistoryQuery{Limit: 50, WentLive: true})
 	if err != nil {
 		return targets, fmt.Errorf("failed to get deployment history: %w", err)
 	}
 
+	autoRollbacks, err := db.ListAutoRollbacks(appName)
+	if err != nil {
+		return targets, err
+	}
+
 	runningDeploymentID, _ := getRunningDeploymentID(ctx, cli, appName)
 
 	for _, deployment := range deployments {
@@ -106,7 +125,9 @@ func GetRollbackTargets(ctx context.Context, cli *client.Client, appName string)
 			ImageRef:     imageRef,
 			IsRunning:    deployment.ID == runningDeploymentID,
 			RawAppConfig: &rawAppConfig,
+			Metadata:     deployment.Metadata(),
 		}
+		_, target.AutoRolledBack = autoRollbacks[deployment.ID]
 
 		targets = append(targets, target)
 	}
@@ -0,0 +1,151 @@
+package deploy
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/haloydev/haloy/internal/config"
+	"github.com/haloydev/haloy/internal/deploytypes"
+	"github.com/haloydev/haloy/internal/storage"
+)
+
+// RecordQueued stores a deployment that was accepted and waits for its turn. Rollbacks don't
+// know their app config until they start, their config is stored once they went out.
+// rolledBackFrom is the deployment a rollback replaces, if known.
+func RecordQueued(deploymentID, appName, deployedBy string, metadata config.DeployMetadata, rawAppConfig *config.AppConfig, rolledBackFrom string) error {
+	db, err := storage.New()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	rawAppConfigJSON, deployedImageJSON := json.RawMessage("{}"), json.RawMessage("{}")
+	if rawAppConfig != nil {
+		if rawAppConfigJSON, err = json.Marshal(rawAppConfig); err != nil {
+			return fmt.Errorf("failed to convert app config to JSON: %w", err)
+		}
+		if deployedImageJSON, err = json.Marshal(rawAppConfig.Image); err != nil {
+			return fmt.Errorf("failed to convert image to JSON: %w", err)
+		}
+	}
+
+	deployment := storage.Deployment{
+		ID:            deploymentID,
+		AppName:       appName,
+		RawAppConfig:  rawAppConfigJSON,
+		DeployedImage: deployedImageJSON,
+		DeployedBy:    deployedBy,
+	}
+	if err := deployment.SetMetadata(metadata); err != nil {
+		return err
+	}
+	// The deployment being replaced may have been pruned already.
+	if rolledBackFrom != "" {
+		if _, err := db.GetDeployment(rolledBackFrom); err == nil {
+			deployment.RolledBackFrom = &rolledBackFrom
+		}
+	}
+	return db.CreateDeployment(deployment)
+}
+
+// RecordStatus moves a deployment to a new status. The deployment goes on if that fails,
+// so errors are only logged.
+func RecordStatus(deploymentID string, status deploytypes.DeploymentStatus, failureReason string, logger *slog.Logger) {
+	db, err := storage.New()
+	if err != nil {
+		logger.Warn("Failed to record deployment status", "status", status, "error", err)
+		return
+	}
+	defer db.Close()
+
+	if err := db.SetDeploymentStatus(deploymentID, status, failureReason); err != nil {
+		logger.Warn("Failed to record deployment status", "status", status, "error", err)
+	}
+}
+
+// RecordLive records a deployment as succeeded once production traffic was switched to it,
+// along with how long the switch took. Canaries and deployments waiting for promotion are
+// recorded when they are promoted. A rollback marks the deployment it replaced as rolled back.
+func RecordLive(deploymentID string, routeSwitch time.Duration, logger *slog.Logger) {
+	db, err := storage.New()
+	if err != nil {
+		logger.Warn("Failed to record deployment status", "error", err)
+		return
+	}
+	defer db.Close()
+
+	if err := db.SetDeploymentPhase(deploymentID, deploytypes.DeploymentPhaseRouteSwitch, routeSwitch); err != nil {
+		logger.Warn("Failed to record deployment phase", "error", err)
+	}
+	if err := db.SetDeploymentStatus(deploymentID, deploytypes.DeploymentStatusSucceeded, ""); err != nil {
+		logger.Warn("Failed to record deployment status", "error", err)
+		return
+	}
+
+	deployment, err := db.GetDeployment(deploymentID)
+	if err != nil || deployment.RolledBackFrom == nil {
+		return
+	}
+	if err := db.SetDeploymentStatus(*deployment.RolledBackFrom, deploytypes.DeploymentStatusRolledBack, ""); err != nil {
+		logger.Warn("Failed to record rolled back deployment", "error", err)
+	}
+}
+
+// RecordPhase records how long a phase of a deployment took.
+func RecordPhase(deploymentID string, phase deploytypes.DeploymentPhase, duration time.Duration, logger *slog.Logger) {
+	db, err := storage.New()
+	if err != nil {
+		logger.Warn("Failed to record deployment phase", "phase", phase, "error", err)
+		return
+	}
+	defer db.Close()
+
+	if err := db.SetDeploymentPhase(deploymentID, phase, duration); err != nil {
+		logger.Warn("Failed to record deployment phase", "phase", phase, "error", err)
+	}
+}
+
+// recordImageDigest records the digest of the image a deployment runs.
+func recordImageDigest(deploymentID, digest string, logger *slog.Logger) {
+	db, err := storage.New()
+	if err != nil {
+		logger.Warn("Failed to record image digest", "error", err)
+		return
+	}
+	defer db.Close()
+
+	if err := db.SetDeploymentImageDigest(deploymentID, digest); err != nil {
+		logger.Warn("Failed to record image digest", "error", err)
+	}
+}
+
+// recordRollbackMetadata gives a rollback the metadata of the deployment it redeploys, so its
+// git commit is the one that goes live.
+func recordRollbackMetadata(deploymentID string, metadata config.DeployMetadata, logger *slog.Logger) {
+	db, err := storage.New()
+	if err != nil {
+		logger.Warn("Failed to record deployment metadata", "error", err)
+		return
+	}
+	defer db.Close()
+
+	if err := db.SetDeploymentMetadata(deploymentID, metadata); err != nil {
+		logger.Warn("Failed to record deployment metadata", "error", err)
+	}
+}
+
+// recordRolledBackFrom records the live deployment a rollback replaces.
+func recordRolledBackFrom(deploymentID, rolledBackFrom string, logger *slog.Logger) {
+	db, err := storage.New()
+	if err != nil {
+		logger.Warn("Failed to record rolled back deployment", "error", err)
+		return
+	}
+	defer db.Close()
+
+	if err := db.SetDeploymentRolledBackFrom(deploymentID, rolledBackFrom); err != nil {
+		logger.Warn("Failed to record rolled back deployment", "error", err)
+	}
+}
@@ -1,11 +1,115 @@
 package deploytypes
 
-import "github.com/haloydev/haloy/internal/config"
+import (
+	"slices"
+	"time"
+
+	"github.com/haloydev/haloy/internal/config"
+)
 
 type RollbackTarget struct {
 	DeploymentID string
 	ImageID      string
 	ImageRef     string
 	IsRunning    bool // The image is live
-	RawAppConfig *config.AppConfig
+	// AutoRolledBack is set when haloyd rolled the deployment back because it became unhealthy.
+	AutoRolledBack bool
+	RawAppConfig   *config.AppConfig
+	Metadata       config.DeployMetadata
+}
+
+// DeploymentKind tells what started a deployment.
+type DeploymentKind string
+
+const (
+	DeploymentKindDeploy       DeploymentKind = "deploy"
+	DeploymentKindRollback     DeploymentKind = "rollback"
+	DeploymentKindAutoRollback DeploymentKind = "auto-rollback"
+)
+
+// QueuedDeployment is a deployment holding or waiting for its app's deploy lock.
+type QueuedDeployment struct {
+	AppName      string         `json:"appName"`
+	DeploymentID string         `json:"deploymentId"`
+	Kind         DeploymentKind `json:"kind"`
+	Position     int            `json:"position"` // 0 for the running deployment, 1 for the next one and so on
+	QueuedAt     time.Time      `json:"queuedAt"`
+	StartedAt    *time.Time     `json:"startedAt,omitempty"` // Set once the deployment holds the lock
+}
+
+// DeploymentStatus is where a deployment is in its lifecycle.
+type DeploymentStatus string
+
+const (
+	DeploymentStatusQueued     DeploymentStatus = "queued"
+	DeploymentStatusDeploying  DeploymentStatus = "deploying"
+	DeploymentStatusSucceeded  DeploymentStatus = "succeeded"
+	DeploymentStatusFailed     DeploymentStatus = "failed"
+	DeploymentStatusCancelled  DeploymentStatus = "cancelled"
+	DeploymentStatusRolledBack DeploymentStatus = "rolled_back" // Went live and was replaced by a rollback
+)
+
+// DeploymentStatuses lists every status a deployment can have.
+var DeploymentStatuses = []DeploymentStatus{
+	DeploymentStatusQueued,
+	DeploymentStatusDeploying,
+	DeploymentStatusSucceeded,
+	DeploymentStatusFailed,
+	DeploymentStatusCancelled,
+	DeploymentStatusRolledBack,
+}
+
+// Valid reports whether s is a known status.
+func (s DeploymentStatus) Valid() bool {
+	return slices.Contains(DeploymentStatuses, s)
+}
+
+// WentLive reports whether a deployment with the status served traffic at some point.
+func (s DeploymentStatus) WentLive() bool {
+	return s == DeploymentStatusSucceeded || s == DeploymentStatusRolledBack
+}
+
+// DeploymentPhase is a step of a deployment whose duration is recorded.
+type DeploymentPhase string
+
+const (
+	DeploymentPhasePull        DeploymentPhase = "pull"
+	DeploymentPhaseStart       DeploymentPhase = "start"
+	DeploymentPhaseHealth      DeploymentPhase = "health"
+	DeploymentPhaseRouteSwitch DeploymentPhase = "route_switch"
+)
+
+// DeploymentPhases holds how long each phase of a deployment took. Phases a deployment didn't
+// reach are nil.
+type DeploymentPhases struct {
+	Pull        *time.Duration `json:"pull,omitempty"`
+	Start       *time.Duration `json:"start,omitempty"`
+	Health      *time.Duration `json:"health,omitempty"`
+	RouteSwitch *time.Duration `json:"routeSwitch,omitempty"`
+}
+
+// DeploymentRecord is the stored timeline of a deployment.
+type DeploymentRecord struct {
+	DeploymentID   string           `json:"deploymentId"`
+	AppName        string           `json:"appName"`
+	Status         DeploymentStatus `json:"status"`
+	ImageRef       string           `json:"imageRef,omitempty"`
+	ImageDigest    string           `json:"imageDigest,omitempty"`
+	StartedAt      *time.Time       `json:"startedAt,omitempty"`
+	FinishedAt     *time.Time       `json:"finishedAt,omitempty"`
+	FailureReason  string           `json:"failureReason,omitempty"`
+	DeployedBy     string           `json:"deployedBy,omitempty"`
+	RolledBackFrom string           `json:"rolledBackFrom,omitempty"`
+	Phases         DeploymentPhases `json:"phases"`
+	// Git commit, message and labels the deployment was started with.
+	config.DeployMetadata
+}
+
+// Duration returns how long the deployment took from being accepted until it finished, or
+// zero if it hasn't finished or its start wasn't recorded.
+func (r DeploymentRecord) Duration() time.Duration {
+	if r.StartedAt == nil || r.FinishedAt == nil {
+		return 0
+	}
+	return r.FinishedAt.Sub(*r.StartedAt)
 }
@@ -3,6 +3,8 @@ package docker
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"log/slog"
@@ -24,23 +26,48 @@ type ContainerRunResult struct {
 	ReplicaID    int
 }
 
-func RunContainer(ctx context.Context, cli *client.Client, deploymentID, imageRef string, targetConfig config.TargetConfig) ([]ContainerRunResult, error) {
+func RunContainer(ctx context.Context, cli *client.Client, deploymentID, imageRef string, targetConfig config.TargetConfig, metadata config.DeployMetadata) ([]ContainerRunResult, error) {
 	result := make([]ContainerRunResult, 0, *targetConfig.Replicas)
 
 	if err := checkImagePlatformCompatibility(ctx, cli, imageRef); err != nil {
 		return result, err
 	}
+	routingSecretHash := ""
+	if dr := targetConfig.DeploymentRouting; dr != nil && dr.Enabled {
+		if dr.Secret.Value == "" {
+			return result, fmt.Errorf("deployment routing secret is not resolved")
+		}
+		sum := sha256.Sum256([]byte(dr.Secret.Value))
+		routingSecretHash = hex.EncodeToString(sum[:])
+	}
+
 	cl := config.ContainerLabels{
-		AppName:         targetConfig.Name,
-		DeploymentID:    deploymentID,
-		ACMEEmail:       targetConfig.ACMEEmail,
-		Port:            targetConfig.Port,
-		HealthCheckPath: targetConfig.HealthCheckPath,
-		Domains:         targetConfig.Domains,
-		Role:            config.AppLabelRole,
+		AppName:           targetConfig.Name,
+		DeploymentID:      deploymentID,
+		ACMEEmail:         targetConfig.ACMEEmail,
+		Port:              targetConfig.Port,
+		HealthCheckPath:   targetConfig.HealthCheckPath,
+		DrainTimeout:      targetConfig.DrainTimeout,
+		PreviewDomain:     targetConfig.PreviewDomain,
+		IdleTimeout:       targetConfig.IdleTimeout,
+		AutoRollback:      targetConfig.AutoRollback,
+		RoutingSecretHash: routingSecretHash,
+		Metadata:          metadata,
+		Domains:           targetConfig.Domains,
+		Role:              config.AppLabelRole,
 	}
 	labels := cl.ToLabels()
 
+	var stopTimeout *int
+	if targetConfig.StopTimeout != "" {
+		d, err := time.ParseDuration(targetConfig.StopTimeout)
+		if err != nil {
+			return result, fmt.Errorf("invalid stop timeout '%s': %w", targetConfig.StopTimeout, err)
+		}
+		seconds := int(d.Round(time.Second).Seconds())
+		stopTimeout = &seconds
+	}
+
 	var envVars []string
 
 	for _, envVar := range targetConfig.Env {
@@ -60,9 +87,11 @@ func RunContainer(ctx context.Context, cli *client.Client, deploymentID, imageRe
 	for i := range make([]struct{}, *targetConfig.Replicas) {
 		envVars := append(envVars, fmt.Sprintf("%s=%d", constants.EnvVarReplicaID, i+1))
 		containerConfig := &container.Config{
-			Image:  imageRef,
-			Labels: labels,
-			Env:    envVars,
+			Image:       imageRef,
+			Labels:      labels,
+			Env:         envVars,
+			StopSignal:  targetConfig.StopSignal,
+			StopTimeout: stopTimeout,
 		}
 		containerName := fmt.Sprintf("%s-haloy-%s", targetConfig.Name, deploymentID)
 		if *targetConfig.Replicas > 1 {
@@ -99,6 +128,19 @@ func RunContainer(ctx context.Context, cli *client.Client, deploymentID, imageRe
 }
 
 func StopContainers(ctx context.Context, cli *client.Client, logger *slog.Logger, appName, ignoreDeploymentID string) (stoppedIDs []string, err error) {
+	return stopContainersMatching(ctx, cli, logger, appName, func(deploymentID string) bool {
+		return deploymentID != ignoreDeploymentID
+	})
+}
+
+// StopDeploymentContainers stops the containers belonging to a single deployment of an app.
+func StopDeploymentContainers(ctx context.Context, cli *client.Client, logger *slog.Logger, appName, deploymentID string) (stoppedIDs []string, err error) {
+	return stopContainersMatching(ctx, cli, logger, appName, func(id string) bool {
+		return id == deploymentID
+	})
+}
+
+func stopContainersMatching(ctx context.Context, cli *client.Client, logger *slog.Logger, appName string, match func(deploymentID string) bool) (stoppedIDs []string, err error) {
 	containerList, err := GetAppContainers(ctx, cli, true, appName)
 	if err != nil {
 		return stoppedIDs, err
@@ -106,8 +148,7 @@ func StopContainers(ctx context.Context, cli *client.Client, logger *slog.Logger
 
 	var containersToStop []container.Summary
 	for _, containerInfo := range containerList {
-		deploymentID := containerInfo.Labels[config.LabelDeploymentID]
-		if deploymentID != ignoreDeploymentID {
+		if match(containerInfo.Labels[config.LabelDeploymentID]) {
 			containersToStop = append(containersToStop, containerInfo)
 		}
 	}
@@ -186,9 +227,17 @@ func stopContainersConcurrent(ctx context.Context, cli *client.Client, logger *s
 	return stoppedIDs, err
 }
 
+// defaultStopTimeout is used for containers that were created without a stop timeout.
+const defaultStopTimeout = 20
+
 func stopSingleContainer(ctx context.Context, cli *client.Client, logger *slog.Logger, containerID string) error {
-	timeout := 20
-	stopOptions := container.StopOptions{Timeout: &timeout}
+	// Leaving Timeout and Signal unset lets Docker use the stop signal and timeout
+	// stored on the container, which come from the app's stop_signal and stop_timeout.
+	stopOptions := container.StopOptions{}
+	if info, err := cli.ContainerInspect(ctx, containerID); err != nil || info.Config == nil || info.Config.StopTimeout == nil {
+		timeout := defaultStopTimeout
+		stopOptions.Timeout = &timeout
+	}
 
 	err := cli.ContainerStop(ctx, containerID, stopOptions)
 	if err == nil {
@@ -212,14 +261,26 @@ type RemoveContainersResult struct {
 
 // RemoveContainers attempts to remove old containers for a given app and ignoring a specific deployment.
 func RemoveContainers(ctx context.Context, cli *client.Client, logger *slog.Logger, appName, ignoreDeploymentID string) (removedIDs []string, err error) {
+	return removeContainersMatching(ctx, cli, logger, appName, func(deploymentID string) bool {
+		return deploymentID != ignoreDeploymentID
+	})
+}
+
+// RemoveDeploymentContainers removes the containers belonging to a single deployment of an app.
+func RemoveDeploymentContainers(ctx context.Context, cli *client.Client, logger *slog.Logger, appName, deploymentID string) (removedIDs []string, err error) {
+	return removeContainersMatching(ctx, cli, logger, appName, func(id string) bool {
+		return id == deploymentID
+	})
+}
+
+func removeContainersMatching(ctx context.Context, cli *client.Client, logger *slog.Logger, appName string, match func(deploymentID string) bool) (removedIDs []string, err error) {
 	containerList, err := GetAppContainers(ctx, cli, true, appName)
 	if err != nil {
 		return removedIDs, err
 	}
 
 	for _, containerInfo := range containerList {
-		deploymentID := containerInfo.Labels[config.LabelDeploymentID]
-		if deploymentID == ignoreDeploymentID {
+		if !match(containerInfo.Labels[config.LabelDeploymentID]) {
 			continue
 		}
 
@@ -109,6 +109,21 @@ func EnsureImageUpToDate(ctx context.Context, cli *client.Client, logger *slog.L
 	return nil
 }
 
+// ImageDigest returns the registry digest of a local image, or its image ID for images that
+// never came from a registry.
+func ImageDigest(ctx context.Context, cli *client.Client, imageRef string) (string, error) {
+	inspect, err := cli.ImageInspect(ctx, imageRef)
+	if err != nil {
+		return "", fmt.Errorf("failed to inspect image %s: %w", imageRef, err)
+	}
+	for _, rd := range inspect.RepoDigests {
+		if _, digest, ok := strings.Cut(rd, "@"); ok {
+			return digest, nil
+		}
+	}
+	return inspect.ID, nil
+}
+
 // PruneImages removes dangling (unused) Docker images and returns the amount of space reclaimed.
 func PruneImages(ctx context.Context, cli *client.Client, logger *slog.Logger) (uint64, error) {
 	report, err := cli.ImagesPrune(ctx, filters.Args{})
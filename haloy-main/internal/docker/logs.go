@@ -0,0 +1,118 @@
+package docker
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/haloydev/haloy/internal/helpers"
+)
+
+// maxLogLineSize is the longest log line passed on whole. Docker splits longer lines itself,
+// at 16KB, so this only matters for logging drivers that don't.
+const maxLogLineSize = 1024 * 1024
+
+var replicaSuffixRegex = regexp.MustCompile(`-replica-(\d+)$`)
+
+// ContainerLogLine is a line an app container printed.
+type ContainerLogLine struct {
+	Timestamp time.Time
+	Stream    string // stdout or stderr
+	Line      string
+}
+
+// ReplicaID returns the replica number of an app container, from the name it was started with.
+func ReplicaID(c container.Summary) int {
+	for _, name := range c.Names {
+		if m := replicaSuffixRegex.FindStringSubmatch(name); m != nil {
+			if id, err := strconv.Atoi(m[1]); err == nil {
+				return id
+			}
+		}
+	}
+	// Deployments with a single replica don't number it.
+	return 1
+}
+
+// StreamContainerLogs calls fn with each line in the container's log, split into stdout and
+// stderr, until the log ends or, when following it, the container stops.
+func StreamContainerLogs(ctx context.Context, cli *client.Client, containerID string, options container.LogsOptions, fn func(ContainerLogLine) error) error {
+	options.ShowStdout = true
+	options.Timestamps = true
+	logs, err := cli.ContainerLogs(ctx, containerID, options)
+	if err != nil {
+		return fmt.Errorf("failed to get logs of container %s: %w", helpers.SafeIDPrefix(containerID), err)
+	}
+	defer logs.Close()
+
+	stdoutReader, stdoutWriter := io.Pipe()
+	stderrReader, stderrWriter := io.Pipe()
+
+	// Both streams call fn, which doesn't need to be safe for concurrent use.
+	var fnMu sync.Mutex
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i, stream := range []struct {
+		name   string
+		reader *io.PipeReader
+	}{{"stdout", stdoutReader}, {"stderr", stderrReader}} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = scanLogLines(stream.reader, stream.name, func(line ContainerLogLine) error {
+				fnMu.Lock()
+				defer fnMu.Unlock()
+				return fn(line)
+			})
+			// Stop StdCopy if fn failed, and don't block it if lines are left.
+			stream.reader.CloseWithError(errs[i])
+		}()
+	}
+
+	_, err = stdcopy.StdCopy(stdoutWriter, stderrWriter, logs)
+	stdoutWriter.CloseWithError(err)
+	stderrWriter.CloseWithError(err)
+	wg.Wait()
+
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	// What stopped reading a stream is more telling than StdCopy failing to write to it.
+	for _, scanErr := range errs {
+		if scanErr != nil {
+			return fmt.Errorf("failed to read container logs: %w", scanErr)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read container logs: %w", err)
+	}
+	return nil
+}
+
+func scanLogLines(r io.Reader, stream string, fn func(ContainerLogLine) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLogLineSize)
+	for scanner.Scan() {
+		line := ContainerLogLine{Stream: stream, Line: scanner.Text()}
+		// Lines start with the time Docker received them, as requested with Timestamps.
+		if timestamp, rest, ok := strings.Cut(line.Line, " "); ok {
+			if t, err := time.Parse(time.RFC3339Nano, timestamp); err == nil {
+				line.Timestamp = t
+				line.Line = rest
+			}
+		}
+		if err := fn(line); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,104 @@
+package docker
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+func TestReplicaID(t *testing.T) {
+	tests := []struct {
+		name  string
+		names []string
+		want  int
+	}{
+		{name: "numbered", names: []string{"/myapp-20250101120000-replica-3"}, want: 3},
+		{name: "single replica", names: []string{"/myapp-20250101120000"}, want: 1},
+		{name: "no names", names: nil, want: 1},
+		{name: "suffix not at the end", names: []string{"/myapp-replica-2-old"}, want: 1},
+		{name: "second name", names: []string{"/link", "/myapp-replica-12"}, want: 12},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ReplicaID(container.Summary{Names: tt.names}); got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScanLogLines(t *testing.T) {
+	timestamp := time.Date(2025, 1, 2, 3, 4, 5, 123456789, time.UTC)
+	tests := []struct {
+		name  string
+		input string
+		want  []ContainerLogLine
+	}{
+		{
+			name:  "timestamped",
+			input: "2025-01-02T03:04:05.123456789Z hello world\n",
+			want:  []ContainerLogLine{{Timestamp: timestamp, Stream: "stderr", Line: "hello world"}},
+		},
+		{
+			name:  "without timestamp",
+			input: "hello world\n",
+			want:  []ContainerLogLine{{Stream: "stderr", Line: "hello world"}},
+		},
+		{
+			name:  "empty line after timestamp",
+			input: "2025-01-02T03:04:05.123456789Z \n",
+			want:  []ContainerLogLine{{Timestamp: timestamp, Stream: "stderr", Line: ""}},
+		},
+		{
+			name:  "last line without newline",
+			input: "first\nsecond",
+			want:  []ContainerLogLine{{Stream: "stderr", Line: "first"}, {Stream: "stderr", Line: "second"}},
+		},
+		{
+			name:  "empty",
+			input: "",
+			want:  nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []ContainerLogLine
+			err := scanLogLines(strings.NewReader(tt.input), "stderr", func(line ContainerLogLine) error {
+				got = append(got, line)
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.EqualFunc(got, tt.want, func(a, b ContainerLogLine) bool {
+				return a.Timestamp.Equal(b.Timestamp) && a.Stream == b.Stream && a.Line == b.Line
+			}) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScanLogLinesStopsOnError(t *testing.T) {
+	errStop := errors.New("stop")
+	calls := 0
+	err := scanLogLines(strings.NewReader("one\ntwo\nthree\n"), "stdout", func(ContainerLogLine) error {
+		calls++
+		return errStop
+	})
+	if !errors.Is(err, errStop) || calls != 1 {
+		t.Errorf("got %v after %d calls, want the callback's error after 1", err, calls)
+	}
+}
+
+func TestScanLogLinesTooLong(t *testing.T) {
+	input := strings.Repeat("x", maxLogLineSize+1) + "\n"
+	err := scanLogLines(strings.NewReader(input), "stdout", func(ContainerLogLine) error { return nil })
+	if err == nil {
+		t.Error("expected an error for a line longer than maxLogLineSize")
+	}
+}
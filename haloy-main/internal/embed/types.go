@@ -5,6 +5,7 @@ type HAProxyTemplateData struct {
 	HTTPFrontend            string
 	HTTPSFrontend           string
 	HTTPSFrontendUseBackend string
+	HTTPSBindOptions        string
 	Backends                string
 }
 
@@ -0,0 +1,146 @@
+package haloy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/haloydev/haloy/internal/apiclient"
+	"github.com/haloydev/haloy/internal/apitypes"
+	"github.com/haloydev/haloy/internal/config"
+	"github.com/haloydev/haloy/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+func CanaryCmd(configPath *string, flags *appCmdFlags) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "canary",
+		Short: "Manage canary deployments",
+		Long: `Manage canary deployments started with deployment_strategy: canary.
+
+A canary deployment runs next to the current deployment and receives a share of the traffic
+until it is promoted or aborted.`,
+	}
+
+	cmd.PersistentFlags().StringVarP(&flags.configPath, "config", "c", "", "Path to config file or directory (default: .)")
+	cmd.PersistentFlags().StringSliceVarP(&flags.targets, "targets", "t", nil, "Run on specific targets (comma-separated)")
+	cmd.PersistentFlags().BoolVarP(&flags.all, "all", "a", false, "Run on all targets")
+
+	cmd.AddCommand(CanaryStatusCmd(configPath, flags))
+	cmd.AddCommand(CanarySetWeightCmd(configPath, flags))
+	cmd.AddCommand(CanaryPromoteCmd(configPath, flags))
+	cmd.AddCommand(CanaryAbortCmd(configPath, flags))
+
+	return cmd
+}
+
+func CanaryStatusCmd(configPath *string, flags *appCmdFlags) *cobra.Command {
+	return &cobra.Command{
+		Use:   "status",
+		Short: "Show the canary in progress",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return runForTargets(cmd.Context(), *configPath, flags, func(ctx context.Context, target config.TargetConfig, prefix string) error {
+				api, err := newTargetAPIClient(&target, prefix)
+				if err != nil {
+					return err
+				}
+
+				var response apitypes.CanaryStatusResponse
+				if err := api.Get(ctx, fmt.Sprintf("canary/%s", target.Name), &response); err != nil {
+					return canaryError(err, target.Name, "failed to get canary status", prefix)
+				}
+
+				ui.Section(fmt.Sprintf("Canary for %s", target.Name), canaryStatusLines(response))
+				return nil
+			})
+		},
+	}
+}
+
+func CanarySetWeightCmd(configPath *string, flags *appCmdFlags) *cobra.Command {
+	return &cobra.Command{
+		Use:   "set-weight <percent>",
+		Short: "Set the percentage of traffic sent to the canary",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			weight, err := strconv.Atoi(strings.TrimSuffix(args[0], "%"))
+			if err != nil || weight < 0 || weight > 100 {
+				return fmt.Errorf("invalid weight '%s': must be a number between 0 and 100", args[0])
+			}
+
+			return runForTargets(cmd.Context(), *configPath, flags, func(ctx context.Context, target config.TargetConfig, prefix string) error {
+				api, err := newTargetAPIClient(&target, prefix)
+				if err != nil {
+					return err
+				}
+
+				request := apitypes.CanaryWeightRequest{Weight: weight}
+				var response apitypes.CanaryStatusResponse
+				if err := api.Post(ctx, fmt.Sprintf("canary/%s/weight", target.Name), request, &response); err != nil {
+					return canaryError(err, target.Name, "failed to set canary weight", prefix)
+				}
+
+				pui := &ui.PrefixedUI{Prefix: prefix}
+				pui.Success("Canary %s for %s now receives %d%% of traffic", response.CanaryDeploymentID, target.Name, response.Weight)
+				return nil
+			})
+		},
+	}
+}
+
+func CanaryPromoteCmd(configPath *string, flags *appCmdFlags) *cobra.Command {
+	return &cobra.Command{
+		Use:   "promote",
+		Short: "Send all traffic to the canary and retire the current deployment",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return runCanaryAction(cmd.Context(), *configPath, flags, "promote")
+		},
+	}
+}
+
+func CanaryAbortCmd(configPath *string, flags *appCmdFlags) *cobra.Command {
+	return &cobra.Command{
+		Use:   "abort",
+		Short: "Stop sending traffic to the canary and remove it",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return runCanaryAction(cmd.Context(), *configPath, flags, "abort")
+		},
+	}
+}
+
+func runCanaryAction(ctx context.Context, configPath string, flags *appCmdFlags, action string) error {
+	return runForTargets(ctx, configPath, flags, func(ctx context.Context, target config.TargetConfig, prefix string) error {
+		api, err := newTargetAPIClient(&target, prefix)
+		if err != nil {
+			return err
+		}
+
+		var response apitypes.CanaryActionResponse
+		if err := api.Post(ctx, fmt.Sprintf("canary/%s/%s", target.Name, action), nil, &response); err != nil {
+			return canaryError(err, target.Name, fmt.Sprintf("failed to %s canary", action), prefix)
+		}
+
+		pui := &ui.PrefixedUI{Prefix: prefix}
+		pui.Success("%s", response.Message)
+		return nil
+	})
+}
+
+func canaryError(err error, appName, message, prefix string) error {
+	if errors.Is(err, apiclient.ErrNotFound) {
+		return &PrefixedError{Err: fmt.Errorf("no canary in progress for '%s'", appName), Prefix: prefix}
+	}
+	return &PrefixedError{Err: fmt.Errorf("%s: %w", message, err), Prefix: prefix}
+}
+
+func canaryStatusLines(response apitypes.CanaryStatusResponse) []string {
+	return []string{
+		fmt.Sprintf("Stable deployment: %s (%d%%)", response.StableDeploymentID, 100-response.Weight),
+		fmt.Sprintf("Canary deployment: %s (%d%%)", response.CanaryDeploymentID, response.Weight),
+	}
+}
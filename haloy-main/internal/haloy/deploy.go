@@ -3,8 +3,10 @@ package haloy
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"os/user"
 	"path/filepath"
 
 	"github.com/haloydev/haloy/internal/apiclient"
@@ -13,6 +15,7 @@ import (
 	"github.com/haloydev/haloy/internal/cmdexec"
 	"github.com/haloydev/haloy/internal/config"
 	"github.com/haloydev/haloy/internal/docker"
+	"github.com/haloydev/haloy/internal/helpers"
 	"github.com/haloydev/haloy/internal/logging"
 	"github.com/haloydev/haloy/internal/ui"
 	"github.com/spf13/cobra"
@@ -21,15 +24,29 @@ import (
 
 func DeployAppCmd(configPath *string, flags *appCmdFlags) *cobra.Command {
 	var noLogsFlag bool
+	var noPromoteFlag bool
+	var noQueueFlag bool
+	var detachFlag bool
+	var messageFlag string
+	var labelFlags []string
 
 	cmd := &cobra.Command{
 		Use:   "deploy",
 		Short: "Deploy an application",
-		Long:  "Deploy an application using a haloy configuration file.",
-		Args:  cobra.NoArgs,
+		Long: `Deploy an application using a haloy configuration file.
+
+The git commit and branch of the config directory, and whether it has uncommitted changes,
+are stored with the deployment along with the message and labels given. They are set as
+labels on the app's containers and shown by 'haloy status' and 'haloy history'.`,
+		Args: cobra.NoArgs,
 		RunE: func(cmd *cobra.Command, _ []string) error {
 			ctx := cmd.Context()
 
+			metadata, err := deployMetadata(ctx, *configPath, messageFlag, labelFlags)
+			if err != nil {
+				return fmt.Errorf("invalid deploy metadata: %w", err)
+			}
+
 			rawAppConfig, format, err := appconfigloader.Load(ctx, *configPath, flags.targets, flags.all)
 			if err != nil {
 				return fmt.Errorf("unable to load config: %w", err)
@@ -99,7 +116,7 @@ func DeployAppCmd(configPath *string, flags *appCmdFlags) *cobra.Command {
 			deploymentIDs := make(map[string]string)
 			for _, target := range resolvedTargets {
 				if _, exists := deploymentIDs[target.Name]; !exists {
-					deploymentIDs[target.Name] = createDeploymentID()
+					deploymentIDs[target.Name] = helpers.NewDeploymentID()
 				}
 			}
 
@@ -140,7 +157,11 @@ func DeployAppCmd(configPath *string, flags *appCmdFlags) *cobra.Command {
 							*configPath,
 							deploymentID,
 							prefix,
+							metadata,
 							noLogsFlag,
+							noPromoteFlag,
+							noQueueFlag,
+							detachFlag,
 						); err != nil {
 							return err
 						}
@@ -169,6 +190,89 @@ func DeployAppCmd(configPath *string, flags *appCmdFlags) *cobra.Command {
 	cmd.Flags().StringSliceVarP(&flags.targets, "targets", "t", nil, "Deploy to a specific targets (comma-separated)")
 	cmd.Flags().BoolVarP(&flags.all, "all", "a", false, "Deploy to all targets")
 	cmd.Flags().BoolVar(&noLogsFlag, "no-logs", false, "Don't stream haloyd deployment logs")
+	cmd.Flags().BoolVar(&detachFlag, "detach", false, "Return once the deployment started and print its ID, use 'haloy deploy attach' to follow it")
+	cmd.Flags().BoolVar(&noQueueFlag, "no-queue", false, "Fail instead of waiting when the app is already being deployed")
+	cmd.Flags().BoolVar(&noPromoteFlag, "no-promote", false, "Serve the deployment on its preview hostname and keep traffic on the current deployment until 'haloy promote'")
+	cmd.Flags().StringVarP(&messageFlag, "message", "m", "", "Message describing the deployment, shown in 'haloy history'")
+	cmd.Flags().StringArrayVar(&labelFlags, "label", nil, "Label to store with the deployment as key=value (can be repeated)")
+
+	cmd.AddCommand(DeployAttachCmd(configPath, flags))
+	cmd.AddCommand(DeployCancelCmd(configPath, flags))
+
+	return cmd
+}
+
+func DeployAttachCmd(configPath *string, flags *appCmdFlags) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "attach <deployment-id>",
+		Short: "Follow the logs of a deployment",
+		Long: `Follow the logs of a deployment, for example one started with 'haloy deploy --detach'
+or one whose log stream was interrupted. The logs written so far are printed first, then
+new logs are followed until the deployment completes or fails.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			deploymentID := args[0]
+
+			return runForTargets(cmd.Context(), *configPath, flags, func(ctx context.Context, target config.TargetConfig, prefix string) error {
+				api, err := newTargetAPIClient(&target, prefix)
+				if err != nil {
+					return err
+				}
+
+				if err := streamDeploymentLogs(ctx, api, deploymentID, prefix, true); err != nil {
+					if errors.Is(err, apiclient.ErrNotFound) {
+						return &PrefixedError{Err: fmt.Errorf("no logs found for deployment %s", deploymentID), Prefix: prefix}
+					}
+					return &PrefixedError{Err: fmt.Errorf("failed to follow deployment logs: %w", err), Prefix: prefix}
+				}
+				return nil
+			})
+		},
+	}
+
+	cmd.Flags().StringVarP(&flags.configPath, "config", "c", "", "Path to config file or directory (default: .)")
+	cmd.Flags().StringSliceVarP(&flags.targets, "targets", "t", nil, "Attach on specific targets (comma-separated)")
+	cmd.Flags().BoolVarP(&flags.all, "all", "a", false, "Attach on all targets")
+
+	return cmd
+}
+
+func DeployCancelCmd(configPath *string, flags *appCmdFlags) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "cancel <deployment-id>",
+		Short: "Cancel a deployment that is in progress",
+		Long: `Cancel a deployment that is queued, pulling its image, starting its containers or
+being health checked. The containers and image tag it created are removed and the
+deployment is recorded as cancelled. Deployments that are already live can't be cancelled,
+use 'haloy rollback' instead.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			deploymentID := args[0]
+
+			return runForTargets(cmd.Context(), *configPath, flags, func(ctx context.Context, target config.TargetConfig, prefix string) error {
+				api, err := newTargetAPIClient(&target, prefix)
+				if err != nil {
+					return err
+				}
+
+				var response apitypes.DeployCancelResponse
+				if err := api.Post(ctx, fmt.Sprintf("deploy/%s/cancel", deploymentID), nil, &response); err != nil {
+					if errors.Is(err, apiclient.ErrNotFound) {
+						return &PrefixedError{Err: fmt.Errorf("deployment %s is not in progress", deploymentID), Prefix: prefix}
+					}
+					return &PrefixedError{Err: fmt.Errorf("failed to cancel deployment: %w", err), Prefix: prefix}
+				}
+
+				pui := &ui.PrefixedUI{Prefix: prefix}
+				pui.Success("%s", response.Message)
+				return nil
+			})
+		},
+	}
+
+	cmd.Flags().StringVarP(&flags.configPath, "config", "c", "", "Path to config file or directory (default: .)")
+	cmd.Flags().StringSliceVarP(&flags.targets, "targets", "t", nil, "Cancel on specific targets (comma-separated)")
+	cmd.Flags().BoolVarP(&flags.all, "all", "a", false, "Cancel on all targets")
 
 	return cmd
 }
@@ -178,7 +282,8 @@ func deployTarget(
 	targetConfig config.TargetConfig,
 	rollbackAppConfig config.AppConfig,
 	configPath, deploymentID, prefix string,
-	noLogs bool,
+	metadata config.DeployMetadata,
+	noLogs, noPromote, noQueue, detach bool,
 ) error {
 	format := targetConfig.Format
 	server := targetConfig.Server
@@ -210,32 +315,26 @@ func deployTarget(
 		TargetConfig:      targetConfig,
 		RollbackAppConfig: rollbackAppConfig,
 		DeploymentID:      deploymentID,
+		NoPromote:         noPromote,
+		NoQueue:           noQueue,
+		DeployedBy:        deployedBy(),
+		Metadata:          metadata,
 	}
 
 	pui.Info("Deployment started for %s", targetConfig.Name)
 
 	err = api.Post(ctx, "deploy", request, nil)
 	if err != nil {
+		if errors.Is(err, apiclient.ErrConflict) {
+			return &PrefixedError{Err: fmt.Errorf("%s is already being deployed, run 'haloy queue' to see what is pending", targetConfig.Name), Prefix: prefix}
+		}
 		return &PrefixedError{Err: err, Prefix: prefix}
 	}
 
-	if !noLogs {
-		streamPath := fmt.Sprintf("deploy/%s/logs", deploymentID)
-
-		streamHandler := func(data string) bool {
-			var logEntry logging.LogEntry
-			if err := json.Unmarshal([]byte(data), &logEntry); err != nil {
-				pui.Warn("failed to unmarshal json: %v", err)
-				return false // we don't stop on these errors.
-			}
-
-			ui.DisplayLogEntry(logEntry, prefix)
-
-			// If deployment is complete we'll return true to signal stream should stop
-			return logEntry.IsDeploymentComplete
-		}
-
-		api.Stream(ctx, streamPath, streamHandler)
+	if detach {
+		pui.Info("Deployment %s continues on the server, run 'haloy deploy attach %s' to follow it", deploymentID, deploymentID)
+	} else if !noLogs {
+		streamDeploymentLogs(ctx, api, deploymentID, prefix, false)
 	}
 
 	if len(postDeploy) > 0 {
@@ -248,6 +347,43 @@ func deployTarget(
 	return nil
 }
 
+// streamDeploymentLogs prints the logs of a deployment until it completes or fails. With replay
+// set the logs written before connecting are printed first.
+func streamDeploymentLogs(ctx context.Context, api *apiclient.APIClient, deploymentID, prefix string, replay bool) error {
+	pui := &ui.PrefixedUI{Prefix: prefix}
+	streamPath := fmt.Sprintf("deploy/%s/logs", deploymentID)
+	if replay {
+		streamPath += "?replay=true"
+	}
+
+	streamHandler := func(data string) bool {
+		var logEntry logging.LogEntry
+		if err := json.Unmarshal([]byte(data), &logEntry); err != nil {
+			pui.Warn("failed to unmarshal json: %v", err)
+			return false // we don't stop on these errors.
+		}
+
+		ui.DisplayLogEntry(logEntry, prefix)
+
+		// If deployment is complete we'll return true to signal stream should stop
+		return logEntry.IsDeploymentComplete
+	}
+
+	return api.Stream(ctx, streamPath, streamHandler)
+}
+
+// deployedBy identifies who runs haloy as user@host, it is stored with the deployments they start.
+func deployedBy() string {
+	name := "unknown"
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		name = u.Username
+	}
+	if host, err := os.Hostname(); err == nil && host != "" {
+		name += "@" + host
+	}
+	return name
+}
+
 func getHooksWorkDir(configPath string) string {
 	workDir := "."
 	if configPath != "." {
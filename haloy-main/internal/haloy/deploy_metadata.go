@@ -0,0 +1,89 @@
+package haloy
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/haloydev/haloy/internal/cmdexec"
+	"github.com/haloydev/haloy/internal/config"
+)
+
+// deployMetadata collects the metadata sent with a deployment: the git commit of the config
+// directory, if it is in a git repository, and the message and labels given as flags.
+func deployMetadata(ctx context.Context, configPath, message string, labelFlags []string) (config.DeployMetadata, error) {
+	labels, err := config.ParseDeployLabels(labelFlags)
+	if err != nil {
+		return config.DeployMetadata{}, err
+	}
+
+	metadata := config.DeployMetadata{
+		Message: message,
+		Labels:  labels,
+	}
+
+	dir := getHooksWorkDir(configPath)
+	if commit, err := cmdexec.RunCLICommand(ctx, "git", "-C", dir, "rev-parse", "HEAD"); err == nil {
+		metadata.GitCommit = commit
+		// A detached HEAD has no branch.
+		if branch, err := cmdexec.RunCLICommand(ctx, "git", "-C", dir, "rev-parse", "--abbrev-ref", "HEAD"); err == nil && branch != "HEAD" {
+			metadata.GitBranch = branch
+		}
+		if status, err := cmdexec.RunCLICommand(ctx, "git", "-C", dir, "status", "--porcelain"); err == nil {
+			metadata.GitDirty = status != ""
+		}
+	}
+
+	if err := metadata.Validate(); err != nil {
+		return config.DeployMetadata{}, err
+	}
+	return metadata, nil
+}
+
+// formatGitCommit shows a deployment's commit like "4f1c2ab (main, dirty)".
+func formatGitCommit(metadata config.DeployMetadata) string {
+	if metadata.GitCommit == "" {
+		return ""
+	}
+	commit := metadata.GitCommit
+	if len(commit) > 7 {
+		commit = commit[:7]
+	}
+
+	var details []string
+	if metadata.GitBranch != "" {
+		details = append(details, metadata.GitBranch)
+	}
+	if metadata.GitDirty {
+		details = append(details, "dirty")
+	}
+	if len(details) == 0 {
+		return commit
+	}
+	return fmt.Sprintf("%s (%s)", commit, strings.Join(details, ", "))
+}
+
+func formatDeployLabels(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for _, key := range slices.Sorted(maps.Keys(labels)) {
+		pairs = append(pairs, key+"="+labels[key])
+	}
+	return strings.Join(pairs, ", ")
+}
+
+// formatDeployMetadata returns the status lines for the metadata that is set.
+func formatDeployMetadata(metadata config.DeployMetadata) []string {
+	var lines []string
+	if commit := formatGitCommit(metadata); commit != "" {
+		lines = append(lines, fmt.Sprintf("Git commit: %s", commit))
+	}
+	if metadata.Message != "" {
+		lines = append(lines, fmt.Sprintf("Message: %s", metadata.Message))
+	}
+	if len(metadata.Labels) > 0 {
+		lines = append(lines, fmt.Sprintf("Labels: %s", formatDeployLabels(metadata.Labels)))
+	}
+	return lines
+}
@@ -0,0 +1,180 @@
+package haloy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/haloydev/haloy/internal/apitypes"
+	"github.com/haloydev/haloy/internal/config"
+	"github.com/haloydev/haloy/internal/deploytypes"
+	"github.com/haloydev/haloy/internal/helpers"
+	"github.com/haloydev/haloy/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+// targetHistory is the JSON output of haloy history for one target.
+type targetHistory struct {
+	Target      string                         `json:"target"`
+	App         string                         `json:"app"`
+	Deployments []deploytypes.DeploymentRecord `json:"deployments"`
+}
+
+func HistoryCmd(configPath *string, flags *appCmdFlags) *cobra.Command {
+	var (
+		limit  int
+		since  string
+		status string
+		output string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "history",
+		Short: "Show the deployment history of an app",
+		Long: `Show the deployments of an app, newest first, with their status, git commit, who
+deployed them and how long they took.
+
+--since accepts a duration (24h, 7d), a date (2006-01-02) or an RFC 3339 timestamp.`,
+		Example: `  # Show the last 20 deployments
+  haloy history
+
+  # Show failed deployments from the last week
+  haloy history --since 7d --status failed
+
+  # Print the history as JSON
+  haloy history --output json`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if output != "table" && output != "json" {
+				return fmt.Errorf("unsupported output format '%s', must be 'table' or 'json'", output)
+			}
+			if status != "" && !deploytypes.DeploymentStatus(status).Valid() {
+				return fmt.Errorf("unknown status '%s'", status)
+			}
+
+			query := url.Values{}
+			query.Set("limit", strconv.Itoa(limit))
+			if status != "" {
+				query.Set("status", status)
+			}
+			if since != "" {
+				sinceTime, err := helpers.ParseSince(since, time.Now())
+				if err != nil {
+					return err
+				}
+				query.Set("since", sinceTime.UTC().Format(time.RFC3339))
+			}
+
+			var (
+				mu      sync.Mutex
+				results []targetHistory
+			)
+			err := runForTargets(cmd.Context(), *configPath, flags, func(ctx context.Context, target config.TargetConfig, prefix string) error {
+				api, err := newTargetAPIClient(&target, prefix)
+				if err != nil {
+					return err
+				}
+
+				var response apitypes.AppDeploymentsResponse
+				path := fmt.Sprintf("apps/%s/deployments?%s", url.PathEscape(target.Name), query.Encode())
+				if err := api.Get(ctx, path, &response); err != nil {
+					return &PrefixedError{Err: fmt.Errorf("failed to get deployment history: %w", err), Prefix: prefix}
+				}
+
+				if output == "json" {
+					mu.Lock()
+					results = append(results, targetHistory{Target: target.TargetName, App: target.Name, Deployments: response.Deployments})
+					mu.Unlock()
+					return nil
+				}
+
+				if len(response.Deployments) == 0 {
+					pui := &ui.PrefixedUI{Prefix: prefix}
+					pui.Info("No deployments found for %s", target.Name)
+					return nil
+				}
+				displayHistory(target.Name, prefix, response.Deployments)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+
+			if output == "json" {
+				slices.SortFunc(results, func(a, b targetHistory) int { return strings.Compare(a.Target, b.Target) })
+				data, err := json.MarshalIndent(results, "", "  ")
+				if err != nil {
+					return fmt.Errorf("failed to encode history: %w", err)
+				}
+				fmt.Println(string(data))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&flags.configPath, "config", "c", "", "Path to config file or directory (default: .)")
+	cmd.Flags().StringSliceVarP(&flags.targets, "targets", "t", nil, "Show the history of specific targets (comma-separated)")
+	cmd.Flags().BoolVarP(&flags.all, "all", "a", false, "Show the history of all targets")
+	cmd.Flags().IntVarP(&limit, "limit", "n", 20, "Maximum number of deployments to show")
+	cmd.Flags().StringVar(&since, "since", "", "Only show deployments started after this time")
+	cmd.Flags().StringVar(&status, "status", "", "Only show deployments with this status (queued, deploying, succeeded, failed, cancelled, rolled_back)")
+	cmd.Flags().StringVarP(&output, "output", "o", "table", "Output format (table, json)")
+
+	return cmd
+}
+
+func displayHistory(appName, prefix string, deployments []deploytypes.DeploymentRecord) {
+	title := fmt.Sprintf("Deployment history for %s", appName)
+	if prefix != "" {
+		title = fmt.Sprintf("%s (%s)", title, prefix)
+	}
+	ui.Info("%s", title)
+
+	headers := []string{"DEPLOYMENT ID", "STARTED", "IMAGE", "COMMIT", "STATUS", "DEPLOYED BY", "MESSAGE", "DURATION"}
+	rows := make([][]string, 0, len(deployments))
+	for _, d := range deployments {
+		started := "N/A"
+		if d.StartedAt != nil {
+			started = helpers.FormatTime(*d.StartedAt)
+		} else if t, err := helpers.GetTimestampFromDeploymentID(d.DeploymentID); err == nil {
+			started = helpers.FormatTime(t)
+		}
+
+		image := d.ImageRef
+		if digest := shortDigest(d.ImageDigest); digest != "" {
+			image = fmt.Sprintf("%s (%s)", image, digest)
+		}
+
+		status := string(d.Status)
+		if d.FailureReason != "" {
+			status = fmt.Sprintf("%s: %s", status, d.FailureReason)
+		}
+
+		duration := ""
+		if elapsed := d.Duration(); elapsed > 0 {
+			duration = elapsed.Round(100 * time.Millisecond).String()
+		}
+
+		rows = append(rows, []string{d.DeploymentID, started, image, formatGitCommit(d.DeployMetadata), status, d.DeployedBy, d.Message, duration})
+	}
+
+	ui.Table(headers, rows)
+}
+
+// shortDigest shortens an image digest like sha256:4f1c... to its first 12 hex characters.
+func shortDigest(digest string) string {
+	_, hex, ok := strings.Cut(digest, ":")
+	if !ok {
+		hex = digest
+	}
+	if len(hex) > 12 {
+		hex = hex[:12]
+	}
+	return hex
+}
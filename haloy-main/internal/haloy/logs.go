@@ -3,9 +3,17 @@ package haloy
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/haloydev/haloy/internal/apiclient"
+	"github.com/haloydev/haloy/internal/apitypes"
 	"github.com/haloydev/haloy/internal/appconfigloader"
 	"github.com/haloydev/haloy/internal/config"
 	"github.com/haloydev/haloy/internal/logging"
@@ -62,9 +70,125 @@ The logs are streamed in real-time and will continue until interrupted (Ctrl+C).
 	cmd.Flags().StringSliceVarP(&flags.targets, "targets", "t", nil, "Show logs for specific targets (comma-separated)")
 	cmd.Flags().BoolVarP(&flags.all, "all", "a", false, "Show all target logs")
 
+	cmd.AddCommand(LogsAppCmd(configPath, flags))
+
+	return cmd
+}
+
+func LogsAppCmd(configPath *string, flags *appCmdFlags) *cobra.Command {
+	var (
+		followFlag     bool
+		sinceFlag      string
+		untilFlag      string
+		tailFlag       string
+		replicaFlag    int
+		stderrFlag     bool
+		grepFlag       string
+		timestampsFlag bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "app",
+		Short: "Show what the app's containers printed",
+		Long: `Show the output of the app's running containers, merged across replicas. Each line
+is prefixed with the replica that printed it.
+
+Examples:
+  haloy logs app --tail 50
+  haloy logs app -f --replica 2
+  haloy logs app --since 1h --grep 'ERROR|WARN'`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			var grep *regexp.Regexp
+			if grepFlag != "" {
+				var err error
+				if grep, err = regexp.Compile(grepFlag); err != nil {
+					return fmt.Errorf("invalid --grep pattern: %w", err)
+				}
+			}
+
+			query := url.Values{}
+			if followFlag {
+				query.Set("follow", "true")
+			}
+			if sinceFlag != "" {
+				query.Set("since", sinceFlag)
+			}
+			if untilFlag != "" {
+				query.Set("until", untilFlag)
+			}
+			query.Set("tail", tailFlag)
+			if replicaFlag > 0 {
+				query.Set("replica", strconv.Itoa(replicaFlag))
+			}
+			if !stderrFlag {
+				query.Set("stderr", "false")
+			}
+
+			return runForTargets(cmd.Context(), *configPath, flags, func(ctx context.Context, target config.TargetConfig, prefix string) error {
+				api, err := newTargetAPIClient(&target, prefix)
+				if err != nil {
+					return err
+				}
+
+				path := fmt.Sprintf("apps/%s/logs?%s", url.PathEscape(target.Name), query.Encode())
+				err = api.Stream(ctx, path, func(data string) bool {
+					var entry apitypes.AppLogEntry
+					if err := json.Unmarshal([]byte(data), &entry); err != nil {
+						ui.Error("failed to parse log entry: %v", err)
+						return false
+					}
+					if grep != nil && !grep.MatchString(entry.Line) {
+						return false
+					}
+					printAppLogEntry(entry, prefix, timestampsFlag)
+					return false
+				})
+				if err != nil {
+					if errors.Is(err, apiclient.ErrNotFound) {
+						return &PrefixedError{Err: fmt.Errorf("no running containers found for %s", target.Name), Prefix: prefix}
+					}
+					if errors.Is(err, context.Canceled) {
+						return nil
+					}
+					return &PrefixedError{Err: fmt.Errorf("failed to get app logs: %w", err), Prefix: prefix}
+				}
+				return nil
+			})
+		},
+	}
+
+	cmd.Flags().StringVarP(&flags.configPath, "config", "c", "", "Path to config file or directory (default: .)")
+	cmd.Flags().StringSliceVarP(&flags.targets, "targets", "t", nil, "Show logs for specific targets (comma-separated)")
+	cmd.Flags().BoolVarP(&flags.all, "all", "a", false, "Show logs for all targets")
+	cmd.Flags().BoolVarP(&followFlag, "follow", "f", false, "Keep printing new lines until interrupted")
+	cmd.Flags().StringVar(&sinceFlag, "since", "", "Only show lines printed since a time (e.g. 2025-01-02T15:04:05Z) or for a duration (e.g. 10m)")
+	cmd.Flags().StringVar(&untilFlag, "until", "", "Only show lines printed before a time or a duration ago")
+	cmd.Flags().StringVar(&tailFlag, "tail", "100", "Number of lines to show from the end of each replica's output, or all")
+	cmd.Flags().IntVar(&replicaFlag, "replica", 0, "Only show the output of this replica")
+	cmd.Flags().BoolVar(&stderrFlag, "stderr", true, "Include stderr")
+	cmd.Flags().StringVar(&grepFlag, "grep", "", "Only show lines matching this regular expression")
+	cmd.Flags().BoolVar(&timestampsFlag, "timestamps", false, "Show when each line was printed")
+
 	return cmd
 }
 
+func printAppLogEntry(entry apitypes.AppLogEntry, prefix string, timestamps bool) {
+	var b strings.Builder
+	if prefix != "" {
+		fmt.Fprintf(&b, "%s ", prefix)
+	}
+	if timestamps && !entry.Timestamp.IsZero() {
+		fmt.Fprintf(&b, "%s ", entry.Timestamp.Local().Format(time.RFC3339))
+	}
+	fmt.Fprintf(&b, "[%s] %s", entry.Replica, entry.Line)
+	if entry.Stream == "stderr" {
+		fmt.Fprintln(os.Stderr, b.String())
+		return
+	}
+	fmt.Fprintln(os.Stdout, b.String())
+}
+
 func streamLogs(ctx context.Context, targetConfig *config.TargetConfig, targetServer string) error {
 	token, err := getToken(targetConfig, targetServer)
 	if err != nil {
@@ -0,0 +1,162 @@
+package haloy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/haloydev/haloy/internal/apiclient"
+	"github.com/haloydev/haloy/internal/apitypes"
+	"github.com/haloydev/haloy/internal/config"
+	"github.com/haloydev/haloy/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+func MirrorCmd(configPath *string, flags *appCmdFlags) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "mirror",
+		Short: "Mirror production traffic to a deployment waiting for promotion",
+		Long: `Mirror production traffic to a deployment started with 'haloy deploy --no-promote'.
+
+While a mirror runs, every request to the app's domains is answered by the live deployment
+and a copy is sent to the candidate in the background. The candidate's responses are
+discarded, their status codes and latencies are compared with the live responses.`,
+	}
+
+	cmd.PersistentFlags().StringVarP(&flags.configPath, "config", "c", "", "Path to config file or directory (default: .)")
+	cmd.PersistentFlags().StringSliceVarP(&flags.targets, "targets", "t", nil, "Run on specific targets (comma-separated)")
+	cmd.PersistentFlags().BoolVarP(&flags.all, "all", "a", false, "Run on all targets")
+
+	cmd.AddCommand(MirrorStartCmd(configPath, flags))
+	cmd.AddCommand(MirrorStopCmd(configPath, flags))
+	cmd.AddCommand(MirrorReportCmd(configPath, flags))
+
+	return cmd
+}
+
+func MirrorStartCmd(configPath *string, flags *appCmdFlags) *cobra.Command {
+	var allMethods bool
+
+	cmd := &cobra.Command{
+		Use:   "start <deployment-id>",
+		Short: "Start copying requests to a deployment waiting for promotion",
+		Long: `Start copying requests to a deployment waiting for promotion.
+
+Only GET, HEAD and OPTIONS requests are copied by default. Use --all-methods to copy
+requests that may change state too, only if the candidate can't affect production data.
+Copies carry the X-Haloy-Mirrored header.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			deploymentID := args[0]
+
+			return runForTargets(cmd.Context(), *configPath, flags, func(ctx context.Context, target config.TargetConfig, prefix string) error {
+				api, err := newTargetAPIClient(&target, prefix)
+				if err != nil {
+					return err
+				}
+
+				request := apitypes.MirrorStartRequest{DeploymentID: deploymentID, AllMethods: allMethods}
+				var response apitypes.MirrorStatusResponse
+				if err := api.Post(ctx, fmt.Sprintf("mirror/%s", target.Name), request, &response); err != nil {
+					if errors.Is(err, apiclient.ErrNotFound) {
+						return &PrefixedError{Err: fmt.Errorf("no deployment waiting for promotion for '%s'", target.Name), Prefix: prefix}
+					}
+					return &PrefixedError{Err: fmt.Errorf("failed to start mirror: %w", err), Prefix: prefix}
+				}
+
+				pui := &ui.PrefixedUI{Prefix: prefix}
+				pui.Success("Mirroring requests for %s from %s to %s", target.Name, response.LiveDeploymentID, response.CandidateDeploymentID)
+				return nil
+			})
+		},
+	}
+
+	cmd.Flags().BoolVar(&allMethods, "all-methods", false, "Also copy requests that may change state, like POST and DELETE")
+
+	return cmd
+}
+
+func MirrorStopCmd(configPath *string, flags *appCmdFlags) *cobra.Command {
+	return &cobra.Command{
+		Use:   "stop",
+		Short: "Stop copying requests, the report stays available",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return runForTargets(cmd.Context(), *configPath, flags, func(ctx context.Context, target config.TargetConfig, prefix string) error {
+				api, err := newTargetAPIClient(&target, prefix)
+				if err != nil {
+					return err
+				}
+
+				var response apitypes.MirrorActionResponse
+				if err := api.Post(ctx, fmt.Sprintf("mirror/%s/stop", target.Name), nil, &response); err != nil {
+					if errors.Is(err, apiclient.ErrNotFound) {
+						return &PrefixedError{Err: fmt.Errorf("no traffic mirror in progress for '%s'", target.Name), Prefix: prefix}
+					}
+					return &PrefixedError{Err: fmt.Errorf("failed to stop mirror: %w", err), Prefix: prefix}
+				}
+
+				pui := &ui.PrefixedUI{Prefix: prefix}
+				pui.Success("%s", response.Message)
+				return nil
+			})
+		},
+	}
+}
+
+func MirrorReportCmd(configPath *string, flags *appCmdFlags) *cobra.Command {
+	return &cobra.Command{
+		Use:   "report",
+		Short: "Compare the candidate's responses with the live responses",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return runForTargets(cmd.Context(), *configPath, flags, func(ctx context.Context, target config.TargetConfig, prefix string) error {
+				api, err := newTargetAPIClient(&target, prefix)
+				if err != nil {
+					return err
+				}
+
+				var response apitypes.MirrorReportResponse
+				if err := api.Get(ctx, fmt.Sprintf("mirror/%s/report", target.Name), &response); err != nil {
+					if errors.Is(err, apiclient.ErrNotFound) {
+						return &PrefixedError{Err: fmt.Errorf("no mirrored requests for '%s'", target.Name), Prefix: prefix}
+					}
+					return &PrefixedError{Err: fmt.Errorf("failed to get mirror report: %w", err), Prefix: prefix}
+				}
+
+				ui.Section(fmt.Sprintf("Mirror report for %s", target.Name), mirrorReportLines(response))
+				return nil
+			})
+		},
+	}
+}
+
+func mirrorReportLines(report apitypes.MirrorReportResponse) []string {
+	state := "stopped"
+	if report.Active {
+		state = "mirroring"
+	}
+
+	lines := []string{
+		fmt.Sprintf("Candidate deployment: %s (%s)", report.CandidateDeploymentID, state),
+		fmt.Sprintf("Mirrored requests: %d", report.Requests),
+		fmt.Sprintf("Matching status codes: %d", report.StatusMatches),
+		fmt.Sprintf("Different status codes: %d", report.StatusMismatches),
+		fmt.Sprintf("Failed copies: %d", report.MirrorErrors),
+		fmt.Sprintf("Live latency: %s", formatMirrorLatency(report.LiveLatency)),
+		fmt.Sprintf("Candidate latency: %s", formatMirrorLatency(report.CandidateLatency)),
+	}
+
+	if len(report.Mismatches) > 0 {
+		lines = append(lines, "", "Most frequent differences (live → candidate):")
+		for _, mismatch := range report.Mismatches {
+			lines = append(lines, fmt.Sprintf("  %d → %d  %s %s (%d)",
+				mismatch.LiveStatus, mismatch.MirrorStatus, mismatch.Method, mismatch.Path, mismatch.Count))
+		}
+	}
+	return lines
+}
+
+func formatMirrorLatency(latency apitypes.MirrorLatency) string {
+	return fmt.Sprintf("p50 %dms, p95 %dms, p99 %dms, max %dms", latency.P50Ms, latency.P95Ms, latency.P99Ms, latency.MaxMs)
+}
@@ -0,0 +1,54 @@
+package haloy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/haloydev/haloy/internal/apiclient"
+	"github.com/haloydev/haloy/internal/apitypes"
+	"github.com/haloydev/haloy/internal/config"
+	"github.com/haloydev/haloy/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+func PromoteCmd(configPath *string, flags *appCmdFlags) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "promote <deployment-id>",
+		Short: "Switch traffic to a deployment started with --no-promote",
+		Long: `Switch traffic to a deployment started with 'haloy deploy --no-promote'.
+
+The app's domains move to the deployment in a single reload and the previous
+deployment is drained and stopped.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			deploymentID := args[0]
+
+			return runForTargets(cmd.Context(), *configPath, flags, func(ctx context.Context, target config.TargetConfig, prefix string) error {
+				api, err := newTargetAPIClient(&target, prefix)
+				if err != nil {
+					return err
+				}
+
+				request := apitypes.PromoteRequest{DeploymentID: deploymentID}
+				var response apitypes.PromoteResponse
+				if err := api.Post(ctx, fmt.Sprintf("promote/%s", target.Name), request, &response); err != nil {
+					if errors.Is(err, apiclient.ErrNotFound) {
+						return &PrefixedError{Err: fmt.Errorf("no deployment waiting for promotion for '%s'", target.Name), Prefix: prefix}
+					}
+					return &PrefixedError{Err: fmt.Errorf("failed to promote deployment: %w", err), Prefix: prefix}
+				}
+
+				pui := &ui.PrefixedUI{Prefix: prefix}
+				pui.Success("%s", response.Message)
+				return nil
+			})
+		},
+	}
+
+	cmd.Flags().StringVarP(&flags.configPath, "config", "c", "", "Path to config file or directory (default: .)")
+	cmd.Flags().StringSliceVarP(&flags.targets, "targets", "t", nil, "Promote on specific targets (comma-separated)")
+	cmd.Flags().BoolVarP(&flags.all, "all", "a", false, "Promote on all targets")
+
+	return cmd
+}
@@ -0,0 +1,61 @@
+package haloy
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"github.com/haloydev/haloy/internal/apitypes"
+	"github.com/haloydev/haloy/internal/config"
+	"github.com/haloydev/haloy/internal/helpers"
+	"github.com/haloydev/haloy/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+func QueueCmd(configPath *string, flags *appCmdFlags) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "queue",
+		Short: "Show running and pending deployments",
+		Long: `Show the running and pending deployments of an app.
+
+haloyd deploys an app one deployment at a time. Deployments and rollbacks that arrive
+while the app is being deployed wait in a queue, unless deployed with --no-queue.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return runForTargets(cmd.Context(), *configPath, flags, func(ctx context.Context, target config.TargetConfig, prefix string) error {
+				api, err := newTargetAPIClient(&target, prefix)
+				if err != nil {
+					return err
+				}
+
+				var response apitypes.DeployQueueResponse
+				if err := api.Get(ctx, "deployments/queue?app="+url.QueryEscape(target.Name), &response); err != nil {
+					return &PrefixedError{Err: fmt.Errorf("failed to get deploy queue: %w", err), Prefix: prefix}
+				}
+
+				if len(response.Deployments) == 0 {
+					pui := &ui.PrefixedUI{Prefix: prefix}
+					pui.Info("No deployments running or queued for %s", target.Name)
+					return nil
+				}
+
+				lines := make([]string, 0, len(response.Deployments))
+				for _, d := range response.Deployments {
+					if d.StartedAt != nil {
+						lines = append(lines, fmt.Sprintf("Running: %s (%s, started %s)", d.DeploymentID, d.Kind, helpers.FormatTime(*d.StartedAt)))
+					} else {
+						lines = append(lines, fmt.Sprintf("%d. %s (%s, queued %s)", d.Position, d.DeploymentID, d.Kind, helpers.FormatTime(d.QueuedAt)))
+					}
+				}
+				ui.Section(fmt.Sprintf("Deploy queue for %s", target.Name), lines)
+				return nil
+			})
+		},
+	}
+
+	cmd.Flags().StringVarP(&flags.configPath, "config", "c", "", "Path to config file or directory (default: .)")
+	cmd.Flags().StringSliceVarP(&flags.targets, "targets", "t", nil, "Show the queue on specific targets (comma-separated)")
+	cmd.Flags().BoolVarP(&flags.all, "all", "a", false, "Show the queue on all targets")
+
+	return cmd
+}
@@ -43,7 +43,7 @@ Use 'haloy rollback-targets' to list available deployment IDs.`,
 				return err
 			}
 
-			newDeploymentID := createDeploymentID()
+			newDeploymentID := helpers.NewDeploymentID()
 
 			servers := appconfigloader.TargetsByServer(targets)
 
@@ -102,6 +102,7 @@ Use 'haloy rollback-targets' to list available deployment IDs.`,
 							TargetDeploymentID: targetDeploymentID,
 							NewDeploymentID:    newDeploymentID,
 							NewTargetConfig:    newResolvedTargetConfig,
+							DeployedBy:         deployedBy(),
 						}
 
 						ui.Info("Starting rollback for application: %s using server %s", targetConfig.Name, server)
@@ -231,7 +232,7 @@ func displayRollbackTargets(appName string, rollbackTargets []deploytypes.Rollba
 	}
 	ui.Info("%s", header)
 
-	headers := []string{"DEPLOYMENT ID", "IMAGE REFERENCE", "DATE", "STATUS"}
+	headers := []string{"DEPLOYMENT ID", "IMAGE REFERENCE", "COMMIT", "MESSAGE", "DATE", "STATUS"}
 	rows := make([][]string, 0, len(rollbackTargets))
 
 	for _, rollbackTarget := range rollbackTargets {
@@ -244,11 +245,15 @@ func displayRollbackTargets(appName string, rollbackTargets []deploytypes.Rollba
 		status := ""
 		if rollbackTarget.IsRunning {
 			status = "🟢 CURRENT"
+		} else if rollbackTarget.AutoRolledBack {
+			status = "🔴 AUTO ROLLED BACK"
 		}
 
 		rows = append(rows, []string{
 			rollbackTarget.DeploymentID,
 			rollbackTarget.ImageRef,
+			formatGitCommit(rollbackTarget.Metadata),
+			rollbackTarget.Metadata.Message,
 			date,
 			status,
 		})
@@ -71,6 +71,11 @@ func NewRootCmd() *cobra.Command {
 		DeployAppCmd(&resolvedConfigPath, appFlags),
 		RollbackTargetsCmd(&resolvedConfigPath, appFlags),
 		RollbackAppCmd(&resolvedConfigPath, appFlags),
+		CanaryCmd(&resolvedConfigPath, appFlags),
+		PromoteCmd(&resolvedConfigPath, appFlags),
+		MirrorCmd(&resolvedConfigPath, appFlags),
+		QueueCmd(&resolvedConfigPath, appFlags),
+		HistoryCmd(&resolvedConfigPath, appFlags),
 		LogsCmd(&resolvedConfigPath, appFlags),
 		StatusAppCmd(&resolvedConfigPath, appFlags),
 		StopAppCmd(&resolvedConfigPath, appFlags),
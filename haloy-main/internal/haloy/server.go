@@ -2,6 +2,7 @@ package haloy
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"os"
@@ -38,12 +39,21 @@ func ServerCmd(configPath *string, flags *appCmdFlags) *cobra.Command {
 
 func ServerAddCmd() *cobra.Command {
 	var force bool
+	var connection config.ServerConfig
 
 	cmd := &cobra.Command{
-		Use:   "add <url> <token>",
+		Use:   "add <url> [token]",
 		Short: "Add a new Haloy server",
+		Long: `Add a new Haloy server.
+
+Servers are reached over HTTPS at their API domain. Servers that don't expose the API can be
+reached through an SSH tunnel instead, with a URL like ssh://user@host[:port]. The tunnel
+connects to haloyd's Unix socket, so these don't need a token: the SSH user needs access to
+the socket instead.`,
+		Example: `  haloy server add api.example.com <token>
+  haloy server add ssh://root@example.com --ssh-identity ~/.ssh/id_ed25519`,
 		Args: func(cmd *cobra.Command, args []string) error {
-			if len(args) < 2 {
+			if len(args) < 1 || (len(args) < 2 && !helpers.IsSSHServerURL(args[0])) {
 				ui.Error("Error: You must provide a <url> and a <token> to add a server.\n")
 				ui.Info("%s", cmd.UsageString())
 				return fmt.Errorf("requires at least 2 arg(s), only received %d", len(args))
@@ -53,31 +63,46 @@ func ServerAddCmd() *cobra.Command {
 		RunE: func(cmd *cobra.Command, args []string) error {
 			url := args[0]
 			token := strings.Join(args[1:], " ")
-			return addServerURL(url, token, force)
+			return addServerURL(url, token, connection, force)
 		},
 	}
 
 	cmd.Flags().BoolVarP(&force, "force", "f", false, "Force overwrite if server already exists")
+	cmd.Flags().StringVar(&connection.ClientCert, "client-cert", "", "Client certificate to present, for servers that require one (see 'haloyadm client-cert create')")
+	cmd.Flags().StringVar(&connection.ClientKey, "client-key", "", "Key of the client certificate")
+	cmd.Flags().StringVar(&connection.SSHIdentity, "ssh-identity", "", "Path to SSH private key for ssh:// servers (optional; uses ssh-agent and the default keys in ~/.ssh if not set)")
 
 	return cmd
 }
 
-func addServerURL(url, token string, force bool) error {
+// addServerURL stores the token of a server and how to connect to it: the client certificate
+// and SSH identity in connection. Overwriting a server without giving them keeps the ones it had.
+// The token is optional for ssh:// servers.
+func addServerURL(url, token string, connection config.ServerConfig, force bool) error {
 	if url == "" {
 		return errors.New("URL is required")
 	}
 
-	if token == "" {
-		return errors.New("token is required")
-	}
-
 	normalizedURL, err := helpers.NormalizeServerURL(url)
 	if err != nil {
 		return fmt.Errorf("invalid URL: %w", err)
 	}
 
-	if err := helpers.IsValidDomain(normalizedURL); err != nil {
-		return fmt.Errorf("invalid domain: %w", err)
+	if token == "" && !helpers.IsSSHServerURL(normalizedURL) {
+		return errors.New("token is required")
+	}
+
+	if helpers.IsSSHServerURL(normalizedURL) {
+		if connection.ClientCert != "" || connection.ClientKey != "" {
+			return errors.New("client certificates can't be used with ssh:// servers, the API is reached through the SSH tunnel")
+		}
+	} else {
+		if err := helpers.IsValidDomain(normalizedURL); err != nil {
+			return fmt.Errorf("invalid domain: %w", err)
+		}
+		if connection.SSHIdentity != "" {
+			return errors.New("--ssh-identity can only be used with ssh:// servers")
+		}
 	}
 
 	configDir, err := config.ConfigDir()
@@ -91,19 +116,22 @@ func addServerURL(url, token string, force bool) error {
 
 	envFile := filepath.Join(configDir, constants.ConfigEnvFileName)
 
-	tokenEnv := generateTokenEnvName(normalizedURL)
+	var tokenEnv string
+	if token != "" {
+		tokenEnv = generateTokenEnvName(normalizedURL)
 
-	env, err := godotenv.Read(envFile)
-	if err != nil {
-		if os.IsNotExist(err) {
-			env = make(map[string]string)
-		} else {
-			return fmt.Errorf("failed to read env file: %w", err)
+		env, err := godotenv.Read(envFile)
+		if err != nil {
+			if os.IsNotExist(err) {
+				env = make(map[string]string)
+			} else {
+				return fmt.Errorf("failed to read env file: %w", err)
+			}
+		}
+		env[tokenEnv] = token
+		if err := godotenv.Write(env, envFile); err != nil {
+			return fmt.Errorf("failed to write env file: %w", err)
 		}
-	}
-	env[tokenEnv] = token
-	if err := godotenv.Write(env, envFile); err != nil {
-		return fmt.Errorf("failed to write env file: %w", err)
 	}
 
 	clientConfigPath := filepath.Join(configDir, constants.ClientConfigFileName)
@@ -116,7 +144,34 @@ func addServerURL(url, token string, force bool) error {
 		clientConfig = &config.ClientConfig{}
 	}
 
-	if err := clientConfig.AddServer(normalizedURL, tokenEnv, force); err != nil {
+	existing, exists := clientConfig.Servers[normalizedURL]
+	serverConfig := config.ServerConfig{TokenEnv: tokenEnv}
+	if connection.ClientCert != "" || connection.ClientKey != "" {
+		if connection.ClientCert == "" || connection.ClientKey == "" {
+			return errors.New("--client-cert and --client-key must be used together")
+		}
+		if serverConfig.ClientCert, err = filepath.Abs(connection.ClientCert); err != nil {
+			return fmt.Errorf("invalid client certificate path: %w", err)
+		}
+		if serverConfig.ClientKey, err = filepath.Abs(connection.ClientKey); err != nil {
+			return fmt.Errorf("invalid client key path: %w", err)
+		}
+		if _, err := tls.LoadX509KeyPair(serverConfig.ClientCert, serverConfig.ClientKey); err != nil {
+			return fmt.Errorf("failed to load client certificate: %w", err)
+		}
+	} else if exists {
+		serverConfig.ClientCert = existing.ClientCert
+		serverConfig.ClientKey = existing.ClientKey
+	}
+	if connection.SSHIdentity != "" {
+		if serverConfig.SSHIdentity, err = filepath.Abs(connection.SSHIdentity); err != nil {
+			return fmt.Errorf("invalid SSH identity path: %w", err)
+		}
+	} else if exists {
+		serverConfig.SSHIdentity = existing.SSHIdentity
+	}
+
+	if err := clientConfig.AddServerConfig(normalizedURL, serverConfig, force); err != nil {
 		return fmt.Errorf("failed to add server: %w", err)
 	}
 
@@ -125,7 +180,9 @@ func addServerURL(url, token string, force bool) error {
 	}
 
 	ui.Success("Server %s added successfully", normalizedURL)
-	ui.Info("API token stored as: %s", tokenEnv)
+	if tokenEnv != "" {
+		ui.Info("API token stored as: %s", tokenEnv)
+	}
 
 	return nil
 }
@@ -177,7 +234,7 @@ func ServerDeleteCmd() *cobra.Command {
 
 			envFile := filepath.Join(configDir, constants.ConfigEnvFileName)
 			env, _ := godotenv.Read(envFile)
-			if _, exists := env[serverConfig.TokenEnv]; exists {
+			if _, exists := env[serverConfig.TokenEnv]; exists && serverConfig.TokenEnv != "" {
 				delete(env, serverConfig.TokenEnv)
 				if err := godotenv.Write(env, envFile); err != nil {
 					ui.Warn("Failed to write env file: %v", err)
@@ -227,15 +284,23 @@ func ServerListCmd() *cobra.Command {
 			}
 
 			ui.Info("List of servers:")
-			headers := []string{"URL", "ENV VAR", "ENV VAR EXISTS"}
+			headers := []string{"URL", "ENV VAR", "ENV VAR EXISTS", "CLIENT CERT"}
 			rows := make([][]string, 0, len(servers))
 			for url, config := range servers {
+				tokenEnv := config.TokenEnv
 				tokenExists := "⚠️ no"
-				token := os.Getenv(config.TokenEnv)
-				if token != "" {
+				if tokenEnv == "" {
+					// ssh:// servers added without a token
+					tokenEnv = "-"
+					tokenExists = "not needed"
+				} else if os.Getenv(config.TokenEnv) != "" {
 					tokenExists = "✅ yes"
 				}
-				rows = append(rows, []string{url, config.TokenEnv, tokenExists})
+				clientCert := "-"
+				if config.ClientCert != "" {
+					clientCert = config.ClientCert
+				}
+				rows = append(rows, []string{url, tokenEnv, tokenExists, clientCert})
 			}
 
 			ui.Table(headers, rows)
@@ -2,9 +2,12 @@ package haloy
 
 import (
 	"fmt"
+	"net"
 	"os"
+	"strconv"
 	"strings"
 
+	"github.com/haloydev/haloy/internal/config"
 	"github.com/haloydev/haloy/internal/helpers"
 	"github.com/haloydev/haloy/internal/sshrunner"
 	"github.com/haloydev/haloy/internal/ui"
@@ -38,8 +41,8 @@ This will:
   - SSH into the remote host
   - Install the haloyadm admin tool
   - Run 'haloyadm init' with your domain/email
-  - Read the API token from the server
-  - Add the server to your local haloy config
+  - Read the API token from the server, if an API domain is given
+  - Add the server to your local haloy config, reached over SSH if no API domain is given
 
 Examples:
   haloy server setup 192.168.1.100 --api-domain api.example.com --acme-email admin@example.com
@@ -75,16 +78,21 @@ Examples:
 			}
 
 			ui.Info("Connecting to %s@%s:%d over SSH...", user, host, port)
+			client, err := sshrunner.Connect(ctx, sshCfg)
+			if err != nil {
+				return err
+			}
+			defer client.Close()
 
 			ui.Info("Checking if Docker is installed...")
-			dockerCheck, err := sshrunner.Run(ctx, sshCfg, checkDockerCmd)
+			dockerCheck, err := client.Run(ctx, checkDockerCmd, nil, nil)
 			if err != nil {
 				return fmt.Errorf("failed to check Docker status: %w", err)
 			}
 
 			if strings.TrimSpace(dockerCheck.Stdout) != "installed" {
 				ui.Info("Docker not found, installing...")
-				if _, err := sshrunner.RunStreaming(ctx, sshCfg, installDockerScript, os.Stdout, os.Stderr); err != nil {
+				if _, err := client.Run(ctx, installDockerScript, os.Stdout, os.Stderr); err != nil {
 					return fmt.Errorf("failed to install Docker on remote server: %w", err)
 				}
 				ui.Success("Docker installed successfully")
@@ -93,42 +101,50 @@ Examples:
 			}
 
 			ui.Info("Installing haloyadm on remote server...")
-			if _, err := sshrunner.RunStreaming(ctx, sshCfg, installHaloyadmScript, os.Stdout, os.Stderr); err != nil {
+			if _, err := client.Run(ctx, installHaloyadmScript, os.Stdout, os.Stderr); err != nil {
 				return fmt.Errorf("failed to install haloyadm on remote server: %w", err)
 			}
 
 			initCmd := buildInitCommand(apiDomain, acmeEmail, override, noServices, noLogs)
 			ui.Info("Running remote: %s", initCmd)
 
-			if _, err := sshrunner.RunStreaming(ctx, sshCfg, initCmd, os.Stdout, os.Stderr); err != nil {
+			if _, err := client.Run(ctx, initCmd, os.Stdout, os.Stderr); err != nil {
 				return fmt.Errorf("remote haloyadm init failed: %w", err)
 			}
 
-			ui.Info("Reading API token from remote server...")
-			tokenRes, err := sshrunner.Run(ctx, sshCfg, "haloyadm api token --raw")
-			if err != nil {
-				serverURL := serverURLFromDomainOrHost(apiDomain, host)
-				ui.Warn("Could not retrieve API token from remote server.")
-				ui.Info("You can still add the server manually:")
-				ui.Info("  On the server, run: haloyadm api token")
-				ui.Info("  Then locally, run: haloy server add %s <token>", serverURL)
-				return fmt.Errorf("failed to get API token: %w", err)
-			}
+			serverURL := serverURLFromDomainOrHost(apiDomain, sshCfg)
+
+			// Servers without an API domain are reached over SSH through haloyd's Unix socket,
+			// which doesn't need the token.
+			var apiToken string
+			if apiDomain != "" {
+				ui.Info("Reading API token from remote server...")
+				tokenRes, err := client.Run(ctx, "haloyadm api token --raw", nil, nil)
+				if err != nil {
+					ui.Warn("Could not retrieve API token from remote server.")
+					ui.Info("You can still add the server manually:")
+					ui.Info("  On the server, run: haloyadm api token")
+					ui.Info("  Then locally, run: haloy server add %s <token>", serverURL)
+					return fmt.Errorf("failed to get API token: %w", err)
+				}
 
-			apiToken := strings.TrimSpace(tokenRes.Stdout)
-			if apiToken == "" {
-				serverURL := serverURLFromDomainOrHost(apiDomain, host)
-				ui.Warn("API token is empty.")
-				ui.Info("You can still add the server manually:")
-				ui.Info("  On the server, run: haloyadm api token")
-				ui.Info("  Then locally, run: haloy server add %s <token>", serverURL)
-				return fmt.Errorf("API token is empty")
+				apiToken = strings.TrimSpace(tokenRes.Stdout)
+				if apiToken == "" {
+					ui.Warn("API token is empty.")
+					ui.Info("You can still add the server manually:")
+					ui.Info("  On the server, run: haloyadm api token")
+					ui.Info("  Then locally, run: haloy server add %s <token>", serverURL)
+					return fmt.Errorf("API token is empty")
+				}
 			}
 
-			serverURL := serverURLFromDomainOrHost(apiDomain, host)
 			ui.Info("Adding server '%s' to local haloy config...", serverURL)
 
-			if err := addServerURL(serverURL, apiToken, true); err != nil {
+			var connection config.ServerConfig
+			if apiDomain == "" {
+				connection.SSHIdentity = identity
+			}
+			if err := addServerURL(serverURL, apiToken, connection, true); err != nil {
 				return fmt.Errorf("failed to add server locally: %w", err)
 			}
 
@@ -144,7 +160,7 @@ Examples:
 	cmd.Flags().BoolVar(&override, "override", false, "Override existing Haloy data/config on server")
 	cmd.Flags().BoolVar(&noServices, "no-services", false, "Don't start HAProxy and haloyd containers on server")
 	cmd.Flags().BoolVar(&noLogs, "no-logs", false, "Don't stream haloyd initialization logs on server")
-	cmd.Flags().StringVar(&identity, "ssh-identity", "", "Path to SSH private key (optional; uses default ssh behavior if not set)")
+	cmd.Flags().StringVar(&identity, "ssh-identity", "", "Path to SSH private key (optional; uses ssh-agent and the default keys in ~/.ssh if not set)")
 
 	return cmd
 }
@@ -171,9 +187,15 @@ func buildInitCommand(apiDomain, acmeEmail string, override, noServices, noLogs
 	return strings.Join(args, " ")
 }
 
-func serverURLFromDomainOrHost(apiDomain, host string) string {
+// serverURLFromDomainOrHost returns the API domain or, for servers without one, the URL that
+// tunnels to the API over the SSH connection used for setting up the server.
+func serverURLFromDomainOrHost(apiDomain string, sshCfg sshrunner.Config) string {
 	if apiDomain != "" {
 		return apiDomain
 	}
-	return host
+	host := sshCfg.Host
+	if sshCfg.Port != 0 && sshCfg.Port != 22 {
+		host = net.JoinHostPort(host, strconv.Itoa(sshCfg.Port))
+	}
+	return fmt.Sprintf("ssh://%s@%s", sshCfg.User, host)
 }
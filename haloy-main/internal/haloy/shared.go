@@ -1,25 +1,19 @@
 package haloy
 
 import (
+	"context"
 	"fmt"
-	"math/rand"
 	"os"
 	"path/filepath"
-	"strings"
-	"time"
 
+	"github.com/haloydev/haloy/internal/apiclient"
+	"github.com/haloydev/haloy/internal/appconfigloader"
 	"github.com/haloydev/haloy/internal/config"
 	"github.com/haloydev/haloy/internal/constants"
 	"github.com/haloydev/haloy/internal/helpers"
-	"github.com/oklog/ulid"
+	"golang.org/x/sync/errgroup"
 )
 
-func createDeploymentID() string {
-	entropy := ulid.Monotonic(rand.New(rand.NewSource(time.Now().UnixNano())), 0)
-	id := ulid.MustNew(ulid.Timestamp(time.Now()), entropy).String()
-	return strings.ToLower(id)
-}
-
 func getToken(targetConfig *config.TargetConfig, url string) (string, error) {
 	if targetConfig != nil && targetConfig.APIToken != nil && targetConfig.APIToken.Value != "" {
 		return targetConfig.APIToken.Value, nil
@@ -50,9 +44,53 @@ func getToken(targetConfig *config.TargetConfig, url string) (string, error) {
 	}
 
 	token := os.Getenv(serverConfig.TokenEnv)
+	if token == "" && helpers.IsSSHServerURL(normalizedURL) {
+		// The SSH tunnel reaches haloyd's Unix socket, which doesn't need a token.
+		return "", nil
+	}
 	if token == "" {
 		return "", fmt.Errorf("token not found for server %s. Please set environment variable: %s", normalizedURL, serverConfig.TokenEnv)
 	}
 
 	return token, nil
 }
+
+// runForTargets loads the app config and runs fn concurrently for each selected target.
+// The prefix is set when more than one target is selected and should be used for output and errors.
+func runForTargets(ctx context.Context, configPath string, flags *appCmdFlags, fn func(ctx context.Context, target config.TargetConfig, prefix string) error) error {
+	rawAppConfig, format, err := appconfigloader.Load(ctx, configPath, flags.targets, flags.all)
+	if err != nil {
+		return fmt.Errorf("unable to load config: %w", err)
+	}
+
+	targets, err := appconfigloader.ExtractTargets(rawAppConfig, format)
+	if err != nil {
+		return err
+	}
+
+	g, ctx := errgroup.WithContext(ctx)
+	for _, target := range targets {
+		g.Go(func() error {
+			prefix := ""
+			if len(targets) > 1 {
+				prefix = target.TargetName
+			}
+			return fn(ctx, target, prefix)
+		})
+	}
+
+	return g.Wait()
+}
+
+func newTargetAPIClient(targetConfig *config.TargetConfig, prefix string) (*apiclient.APIClient, error) {
+	token, err := getToken(targetConfig, targetConfig.Server)
+	if err != nil {
+		return nil, &PrefixedError{Err: fmt.Errorf("unable to get token: %w", err), Prefix: prefix}
+	}
+
+	api, err := apiclient.New(targetConfig.Server, token)
+	if err != nil {
+		return nil, &PrefixedError{Err: fmt.Errorf("unable to create API client: %w", err), Prefix: prefix}
+	}
+	return api, nil
+}
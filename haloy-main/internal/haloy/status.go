@@ -11,6 +11,7 @@ import (
 	"github.com/haloydev/haloy/internal/apitypes"
 	"github.com/haloydev/haloy/internal/appconfigloader"
 	"github.com/haloydev/haloy/internal/config"
+	"github.com/haloydev/haloy/internal/constants"
 	"github.com/haloydev/haloy/internal/helpers"
 	"github.com/haloydev/haloy/internal/ui"
 	"github.com/spf13/cobra"
@@ -102,6 +103,13 @@ func getAppStatus(ctx context.Context, targetConfig *config.TargetConfig, target
 		fmt.Sprintf("Running container(s): %s", strings.Join(containerIDs, ", ")),
 		fmt.Sprintf("Domain(s): %s", strings.Join(canonicalDomains, ", ")),
 	}
+	formattedOutput = append(formattedOutput, formatDeployMetadata(response.Metadata)...)
+
+	if len(response.ReachableDeploymentIDs) > 0 {
+		formattedOutput = append(formattedOutput,
+			fmt.Sprintf("Reachable deployment(s): %s", strings.Join(response.ReachableDeploymentIDs, ", ")),
+			fmt.Sprintf("Pick one with the %s and %s headers", constants.DeploymentRoutingHeader, constants.DeploymentRoutingSecretHeader))
+	}
 
 	ui.Section(fmt.Sprintf("Status for %s", appName), formattedOutput)
 
@@ -120,6 +128,8 @@ func displayState(state string) string {
 		return lipgloss.NewStyle().Foreground(ui.Red).Render("Exited")
 	case "stopped":
 		return lipgloss.NewStyle().Foreground(ui.Red).Render("Stopped")
+	case "sleeping":
+		return lipgloss.NewStyle().Foreground(ui.Blue).Render("Sleeping (wakes up on the next request)")
 	default:
 		return lipgloss.NewStyle().Foreground(ui.LightGray).Italic(true).Render(state)
 	}
@@ -4,11 +4,12 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
+	"net"
 	"os"
 	"path/filepath"
 	"time"
 
-	"github.com/haloydev/haloy/internal/apiclient"
 	"github.com/haloydev/haloy/internal/config"
 	"github.com/haloydev/haloy/internal/constants"
 	"github.com/haloydev/haloy/internal/helpers"
@@ -85,6 +86,11 @@ func APIDomainCmd() *cobra.Command {
 			// Set the API domain and email in the haloyd configuration
 			haloydConfig.API.Domain = normalizedURL
 			haloydConfig.Certificates.AcmeEmail = email
+			if haloydConfig.API.DisableTCP {
+				// HAProxy reaches the API over TCP.
+				haloydConfig.API.DisableTCP = false
+				ui.Info("Turning the API's TCP listener back on for the API domain")
+			}
 
 			// Save the updated haloyd configuration
 			if err := config.SaveHaloydConfig(haloydConfig, haloydConfigPath); err != nil {
@@ -116,14 +122,9 @@ func APIDomainCmd() *cobra.Command {
 				return err
 			}
 
-			apiToken := os.Getenv(constants.EnvVarAPIToken)
-			if apiToken == "" {
-				return errors.New("failed to get API token")
-			}
-			apiURL := fmt.Sprintf("http://localhost:%s", constants.APIServerPort)
-			api, err := apiclient.New(apiURL, apiToken)
+			api, err := localAPIClient()
 			if err != nil {
-				return fmt.Errorf("failed to create API client: %w", err)
+				return err
 			}
 			if err := streamHaloydInitLogs(ctx, api); err != nil {
 				ui.Warn("Failed to stream haloyd initialization logs: %v", err)
@@ -210,18 +211,40 @@ func APIURLCmd() *cobra.Command {
 
 const (
 	newTokenTimeout = 1 * time.Minute
+	// defaultTokenGracePeriod is how long the replaced token keeps working, so clients can be
+	// switched over to the new one.
+	defaultTokenGracePeriod = "1h"
 )
 
 func APINewTokenCmd() *cobra.Command {
+	var gracePeriodFlag string
+	var restart bool
 	var devMode bool
 	var debug bool
 	cmd := &cobra.Command{
 		Use:   "generate-token",
-		Short: "Generate a new API token and restart the haloyd",
+		Short: "Generate a new API token",
+		Long: `Generate a new API token and make haloyd use it right away, without restarting it.
+
+The previous token keeps working for the grace period, so clients can be switched over to the
+new one. Deployments in progress and open log streams are not interrupted.`,
+		Example: `  # Rotate the token, the old one works for another hour
+  haloyadm api generate-token
+
+  # Give clients a day to switch over
+  haloyadm api generate-token --grace 1d
+
+  # Stop accepting the old token immediately
+  haloyadm api generate-token --grace 0`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx, cancel := context.WithTimeout(cmd.Context(), newTokenTimeout)
 			defer cancel()
 
+			gracePeriod, err := helpers.ParseLongDuration(gracePeriodFlag)
+			if err != nil {
+				return fmt.Errorf("invalid --grace '%s', use a duration like 30m or 1d", gracePeriodFlag)
+			}
+
 			token, err := generateAPIToken()
 			if err != nil {
 				return fmt.Errorf("failed to generate API token: %w", err)
@@ -240,26 +263,85 @@ func APINewTokenCmd() *cobra.Command {
 			if err != nil {
 				return fmt.Errorf("failed to read environment variables from %s: %w", envFile, err)
 			}
+
+			previousToken := env[constants.EnvVarAPIToken]
+			previousExpiresAt := time.Now().Add(gracePeriod).UTC()
 			env[constants.EnvVarAPIToken] = token
+			if previousToken != "" && gracePeriod > 0 {
+				env[constants.EnvVarAPITokenPrevious] = previousToken
+				env[constants.EnvVarAPITokenPreviousExpires] = previousExpiresAt.Format(time.RFC3339)
+			} else {
+				delete(env, constants.EnvVarAPITokenPrevious)
+				delete(env, constants.EnvVarAPITokenPreviousExpires)
+			}
 			if err := godotenv.Write(env, envFile); err != nil {
 				return fmt.Errorf("failed to write environment variables to %s: %w", envFile, err)
 			}
 
-			// Restart haloyd
-			if err := stopContainer(ctx, config.HaloydLabelRole); err != nil {
-				return fmt.Errorf("failed to stop haloyd container: %w", err)
-			}
-			if err := startHaloyd(ctx, dataDir, configDir, devMode, debug); err != nil {
-				return fmt.Errorf("failed to restart haloyd: %w", err)
+			if restart {
+				if err := stopContainer(ctx, config.HaloydLabelRole); err != nil {
+					return fmt.Errorf("failed to stop haloyd container: %w", err)
+				}
+				if err := startHaloyd(ctx, dataDir, configDir, devMode, debug); err != nil {
+					return fmt.Errorf("failed to restart haloyd: %w", err)
+				}
+				ui.Success("Generated new API token and restarted haloyd")
+			} else {
+				running, err := signalContainer(ctx, config.HaloydLabelRole, "HUP")
+				if err != nil {
+					return fmt.Errorf("failed to reload haloyd: %w", err)
+				}
+				if running {
+					ui.Success("Generated new API token, haloyd is using it now")
+				} else {
+					ui.Warn("Generated new API token, haloyd isn't running and will use it when started")
+				}
 			}
 
-			ui.Success("Generated new API token and restarted haloyd")
 			ui.Info("New API token: %s\n", token)
+			if previousToken != "" && gracePeriod > 0 {
+				ui.Info("The previous token works until %s", previousExpiresAt.Local().Format(time.DateTime))
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&gracePeriodFlag, "grace", defaultTokenGracePeriod, "How long the previous token keeps working, like 30m or 1d (0 to revoke it immediately)")
+	cmd.Flags().BoolVar(&restart, "restart", false, "Restart haloyd instead of reloading the token")
+	cmd.Flags().BoolVar(&devMode, "dev", false, "Restart in development mode using the local haloyd image (with --restart)")
+	cmd.Flags().BoolVar(&debug, "debug", false, "Restart haloyd in debug mode (with --restart)")
+	return cmd
+}
+
+// APIConnectCmd relays stdin and stdout to the API socket. It is what the haloy CLI runs over
+// SSH to reach ssh:// servers, which works with the TCP listener turned off.
+func APIConnectCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "connect",
+		Short: "Connect stdin and stdout to the haloyd API socket",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			socketPath, err := config.APISocketPath()
+			if err != nil {
+				return fmt.Errorf("failed to determine API socket path: %w", err)
+			}
+
+			conn, err := net.Dial("unix", socketPath)
+			if err != nil {
+				return fmt.Errorf("failed to connect to haloyd at %s, is it running? %w", socketPath, err)
+			}
+			defer conn.Close()
+
+			go func() {
+				_, _ = io.Copy(conn, os.Stdin)
+				// Let haloyd finish the response it is sending once the client is done.
+				_ = conn.(*net.UnixConn).CloseWrite()
+			}()
+			if _, err := io.Copy(os.Stdout, conn); err != nil {
+				return fmt.Errorf("connection to haloyd failed: %w", err)
+			}
 			return nil
 		},
 	}
-	cmd.Flags().BoolVar(&devMode, "dev", false, "Restart in development mode using the local haloyd image")
-	cmd.Flags().BoolVar(&debug, "debug", false, "Restart haloyd in debug mode")
 	return cmd
 }
 
@@ -273,6 +355,7 @@ func APICmd() *cobra.Command {
 	cmd.AddCommand(APITokenCmd())
 	cmd.AddCommand(APINewTokenCmd())
 	cmd.AddCommand(APIURLCmd())
+	cmd.AddCommand(APIConnectCmd())
 
 	return cmd
 }
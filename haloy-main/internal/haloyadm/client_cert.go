@@ -0,0 +1,125 @@
+package haloyadm
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/haloydev/haloy/internal/apitoken"
+	"github.com/haloydev/haloy/internal/clientca"
+	"github.com/haloydev/haloy/internal/config"
+	"github.com/haloydev/haloy/internal/constants"
+	"github.com/haloydev/haloy/internal/helpers"
+	"github.com/haloydev/haloy/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+const defaultClientCertValidity = "365d"
+
+func ClientCertCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "client-cert",
+		Short: "Manage client certificates for the API",
+		Long: `Manage client certificates for the API.
+
+With 'require_client_cert: true' under 'api' in haloyd.yaml, HAProxy only passes requests to the
+API from clients presenting a certificate issued by haloyd's CA, in addition to the API token.`,
+	}
+
+	cmd.AddCommand(clientCertCreateCmd())
+
+	return cmd
+}
+
+func clientCertCreateCmd() *cobra.Command {
+	var outputDir string
+	var expiresFlag string
+
+	cmd := &cobra.Command{
+		Use:   "create <name>",
+		Short: "Issue a client certificate",
+		Long:  "Issue a client certificate and write it and its key to <name>.crt and <name>.key.",
+		Example: `  # Issue a certificate for a laptop and copy it there
+  haloyadm client-cert create alice-laptop
+
+  # Then, on the laptop
+  haloy server add api.example.com <token> --client-cert alice-laptop.crt --client-key alice-laptop.key`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name := args[0]
+			if err := apitoken.ValidateName(name); err != nil {
+				return fmt.Errorf("invalid certificate name: %w", err)
+			}
+			validity, err := helpers.ParseLongDuration(expiresFlag)
+			if err != nil || validity == 0 {
+				return fmt.Errorf("invalid --expires '%s', use a duration like 720h or 90d", expiresFlag)
+			}
+
+			if err := checkDirectoryAccess(RequiredAccess{Data: true}); err != nil {
+				return err
+			}
+
+			certPath := filepath.Join(outputDir, name+".crt")
+			keyPath := filepath.Join(outputDir, name+".key")
+			for _, path := range []string{certPath, keyPath} {
+				if _, err := os.Stat(path); err == nil {
+					return fmt.Errorf("%s already exists", path)
+				} else if !errors.Is(err, os.ErrNotExist) {
+					return err
+				}
+			}
+
+			caDir, err := clientca.Dir()
+			if err != nil {
+				return err
+			}
+			ca, created, err := clientca.LoadOrCreate(caDir)
+			if err != nil {
+				return err
+			}
+			if created {
+				ui.Info("Created CA for client certificates in %s", caDir)
+			}
+
+			certPEM, keyPEM, expiresAt, err := ca.Issue(name, validity)
+			if err != nil {
+				return err
+			}
+			if err := os.WriteFile(keyPath, keyPEM, constants.ModeFileSecret); err != nil {
+				return fmt.Errorf("failed to write key: %w", err)
+			}
+			if err := os.WriteFile(certPath, certPEM, constants.ModeFileDefault); err != nil {
+				return fmt.Errorf("failed to write certificate: %w", err)
+			}
+
+			ui.Success("Issued client certificate '%s', valid until %s", name, expiresAt.Local().Format(time.DateOnly))
+			ui.Info("Certificate: %s", certPath)
+			ui.Info("Key: %s", keyPath)
+
+			if !requireClientCertEnabled() {
+				ui.Warn("The API doesn't require client certificates yet. Set 'require_client_cert: true' under 'api' in %s and run 'haloyadm restart'",
+					constants.HaloydConfigFileName)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&outputDir, "output", "o", ".", "Directory to write the certificate and key to")
+	cmd.Flags().StringVar(&expiresFlag, "expires", defaultClientCertValidity, "How long the certificate is valid, like 90d")
+
+	return cmd
+}
+
+func requireClientCertEnabled() bool {
+	configDir, err := config.ConfigDir()
+	if err != nil {
+		return false
+	}
+	haloydConfig, err := config.LoadHaloydConfig(filepath.Join(configDir, constants.HaloydConfigFileName))
+	if err != nil || haloydConfig == nil {
+		return false
+	}
+	return haloydConfig.API.RequireClientCert
+}
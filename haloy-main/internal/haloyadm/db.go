@@ -0,0 +1,146 @@
+package haloyadm
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/haloydev/haloy/internal/config"
+	"github.com/haloydev/haloy/internal/constants"
+	"github.com/haloydev/haloy/internal/helpers"
+	"github.com/haloydev/haloy/internal/storage"
+	"github.com/haloydev/haloy/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+func DBCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "db",
+		Short: "Manage the haloyd database",
+		Long: `Manage the haloyd database.
+
+haloyd applies pending schema migrations when it starts, after copying the database to
+the backups directory next to it. These commands show and apply them by hand.`,
+	}
+
+	cmd.AddCommand(
+		dbStatusCmd(),
+		dbMigrateCmd(),
+	)
+
+	return cmd
+}
+
+func dbStatusCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "status",
+		Short: "Show the applied and pending schema migrations",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			db, err := openDB()
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			statuses, err := db.MigrationStatus()
+			if err != nil {
+				return err
+			}
+
+			headers := []string{"VERSION", "NAME", "STATUS", "APPLIED"}
+			rows := make([][]string, 0, len(statuses))
+			pending := 0
+			for _, status := range statuses {
+				state := "applied"
+				switch {
+				case status.Unknown:
+					state = "unknown, applied by a newer haloy"
+				case status.ChecksumMismatch:
+					state = "changed after it was applied"
+				case status.AppliedAt == nil:
+					state = "pending"
+					pending++
+				}
+
+				applied := ""
+				if status.AppliedAt != nil {
+					applied = helpers.FormatTime(*status.AppliedAt)
+				}
+				rows = append(rows, []string{strconv.Itoa(status.Version), status.Name, state, applied})
+			}
+			ui.Table(headers, rows)
+
+			if pending > 0 {
+				ui.Info("%d pending migration(s), run 'haloyadm db migrate' or restart haloyd to apply them", pending)
+			}
+			return nil
+		},
+	}
+}
+
+func dbMigrateCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "migrate",
+		Short: "Apply the pending schema migrations",
+		Long:  "Back up the database and apply the pending schema migrations.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			db, err := openDB()
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			report, err := db.Migrate()
+			if report.BackupPath != "" {
+				ui.Info("Backed up the database to %s", report.BackupPath)
+			}
+			for _, migration := range report.Applied {
+				ui.Info("Applied migration %d (%s)", migration.Version, migration.Name)
+			}
+			if err != nil {
+				return fmt.Errorf("failed to migrate database: %w", err)
+			}
+
+			if len(report.Applied) == 0 {
+				ui.Success("Database is up to date")
+				return nil
+			}
+			ui.Success("Applied %d migration(s)", len(report.Applied))
+			return nil
+		},
+	}
+}
+
+// openDB opens the haloyd database, which must exist already.
+func openDB() (*storage.DB, error) {
+	dataDir, err := config.DataDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to determine data directory: %w", err)
+	}
+	dbFile := filepath.Join(dataDir, constants.DBDir, constants.DBFileName)
+	if _, err := os.Stat(dbFile); err != nil {
+		return nil, fmt.Errorf("no database found at %s, has haloyd been started? %w", dbFile, err)
+	}
+	return storage.New()
+}
+
+// openMigratedDB opens the haloyd database and applies pending migrations, for commands that
+// need tables a haloyd that hasn't been restarted since upgrading may not have created yet.
+func openMigratedDB() (*storage.DB, error) {
+	db, err := openDB()
+	if err != nil {
+		return nil, err
+	}
+	report, err := db.Migrate()
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate database: %w", err)
+	}
+	if len(report.Applied) > 0 {
+		ui.Info("Applied %d database migration(s), backup at %s", len(report.Applied), report.BackupPath)
+	}
+	return db, nil
+}
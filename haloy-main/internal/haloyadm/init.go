@@ -12,7 +12,6 @@ import (
 	"text/template"
 	"time"
 
-	"github.com/haloydev/haloy/internal/apiclient"
 	"github.com/haloydev/haloy/internal/config"
 	"github.com/haloydev/haloy/internal/constants"
 	"github.com/haloydev/haloy/internal/embed"
@@ -114,6 +113,8 @@ The data directory can be customized by setting the %s environment variable.`,
 			emptyDirs := []string{
 				filepath.Base(constants.HAProxyConfigDir),
 				filepath.Base(constants.DBDir),
+				filepath.Base(constants.HAProxyRuntimeDir),
+				filepath.Base(constants.DeploymentLogsDir),
 			}
 			if err := copyDataFiles(dataDir, emptyDirs); err != nil {
 				return fmt.Errorf("failed to create configuration files: %w", err)
@@ -144,10 +145,9 @@ The data directory can be customized by setting the %s environment variable.`,
 				}
 
 				if !noLogs {
-					apiURL := fmt.Sprintf("http://localhost:%s", constants.APIServerPort)
-					api, err := apiclient.New(apiURL, apiToken)
+					api, err := localAPIClient()
 					if err != nil {
-						return fmt.Errorf("failed to create API client: %w", err)
+						return err
 					}
 					ui.Info("Waiting for haloyd API to become available...")
 					waitCtx, waitCancel := context.WithTimeout(ctx, 30*time.Second)
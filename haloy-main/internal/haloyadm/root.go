@@ -23,6 +23,9 @@ func NewRootCmd() *cobra.Command {
 		RestartCmd(),
 		StopCmd(),
 		APICmd(),
+		DBCmd(),
+		TokenCmd(),
+		ClientCertCmd(),
 	)
 
 	return cmd
@@ -111,6 +111,10 @@ func getDockerGroupID() string {
 
 // startHAProxy runs the docker command to start HAProxy.
 func startHAProxy(ctx context.Context, dataDir string) error {
+	if err := os.MkdirAll(filepath.Join(dataDir, constants.HAProxyRuntimeDir), constants.ModeDirPrivate); err != nil {
+		return fmt.Errorf("failed to create HAProxy runtime directory: %w", err)
+	}
+
 	cmd := exec.CommandContext(ctx, "docker", "run",
 		"--detach",
 		"--name", constants.HAProxyContainerName,
@@ -119,12 +123,17 @@ func startHAProxy(ctx context.Context, dataDir string) error {
 		"--volume", fmt.Sprintf("%s/%s:/usr/local/etc/haproxy:ro", dataDir, constants.HAProxyConfigDir),
 		"--volume", fmt.Sprintf("%s/%s:/usr/local/etc/haproxy-certs:rw", dataDir, constants.CertStorageDir),
 		"--volume", fmt.Sprintf("%s/error-pages:/usr/local/etc/haproxy-errors:ro", dataDir),
+		"--volume", fmt.Sprintf("%s/%s:/usr/local/etc/haproxy-runtime:rw", dataDir, constants.HAProxyRuntimeDir),
 		"--label", fmt.Sprintf("%s=%s", config.LabelRole, config.HAProxyLabelRole),
 		// Running as root is necessary for privileged ports 80 and 443.
 		"--user", "root",
 		"--restart", "unless-stopped",
 		"--network", constants.DockerNetwork,
 		fmt.Sprintf("haproxy:%s", constants.HAProxyVersion),
+		// Expose the master CLI so haloyd can watch sessions on old instances while draining.
+		"haproxy", "-W",
+		"-S", fmt.Sprintf("/usr/local/etc/haproxy-runtime/%s,mode,666", constants.HAProxyMasterSocket),
+		"-f", "/usr/local/etc/haproxy/haproxy.cfg",
 	)
 
 	var stderr bytes.Buffer
@@ -241,6 +250,40 @@ func stopContainer(ctx context.Context, role string) error {
 	return nil
 }
 
+// signalContainer sends a signal to the haloy container with the given role. It returns false
+// if no such container is running.
+func signalContainer(ctx context.Context, role, signal string) (bool, error) {
+	cmd := exec.CommandContext(ctx, "docker", "ps",
+		"--filter", fmt.Sprintf("label=%s=%s", config.LabelRole, role),
+		"--format", "{{.Names}}")
+
+	var out bytes.Buffer
+	cmd.Stdout = &out
+
+	if err := cmd.Run(); err != nil {
+		return false, fmt.Errorf("failed to list containers with role %s: %w", role, err)
+	}
+
+	output := strings.TrimSpace(out.String())
+	if output == "" {
+		return false, nil
+	}
+	containerName := strings.TrimSpace(strings.Split(output, "\n")[0])
+
+	cmd = exec.CommandContext(ctx, "docker", "kill", "--signal", signal, containerName)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if stderr.Len() > 0 {
+			return false, fmt.Errorf("failed to signal container %s: %s", containerName, stderr.String())
+		}
+		return false, fmt.Errorf("failed to signal container %s: %w", containerName, err)
+	}
+	return true, nil
+}
+
 // EnsureNetworkCmd checks for the existence of the specified Docker network and creates it if it doesn't exist.
 func ensureNetwork(ctx context.Context) error {
 	// List networks filtering by name
@@ -272,6 +315,16 @@ func ensureNetwork(ctx context.Context) error {
 	return nil
 }
 
+// localAPIClient returns a client for the API socket of haloyd on this machine, which doesn't
+// need the API token and works with the TCP listener turned off.
+func localAPIClient() (*apiclient.APIClient, error) {
+	socketPath, err := config.APISocketPath()
+	if err != nil {
+		return nil, fmt.Errorf("failed to determine API socket path: %w", err)
+	}
+	return apiclient.NewUnix(socketPath), nil
+}
+
 // streamHaloydInitLogs waits for the API to become available and streams initialization logs
 func streamHaloydInitLogs(ctx context.Context, api *apiclient.APIClient) error {
 	streamHandler := func(data string) bool {
@@ -3,10 +3,8 @@ package haloyadm
 import (
 	"context"
 	"fmt"
-	"os"
 	"time"
 
-	"github.com/haloydev/haloy/internal/apiclient"
 	"github.com/haloydev/haloy/internal/config"
 	"github.com/haloydev/haloy/internal/constants"
 	"github.com/haloydev/haloy/internal/ui"
@@ -55,15 +53,9 @@ func StartCmd() *cobra.Command {
 			}
 
 			if !noLogs {
-				apiToken := os.Getenv(constants.EnvVarAPIToken)
-				if apiToken == "" {
-					return fmt.Errorf("failed to get API token")
-				}
-
-				apiURL := fmt.Sprintf("http://localhost:%s", constants.APIServerPort)
-				api, err := apiclient.New(apiURL, apiToken)
+				api, err := localAPIClient()
 				if err != nil {
-					return fmt.Errorf("failed to create API client: %w", err)
+					return err
 				}
 				ui.Info("Waiting for haloyd API to become available...")
 				if err := waitForAPI(waitCtx, api); err != nil {
@@ -0,0 +1,204 @@
+package haloyadm
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/haloydev/haloy/internal/apitoken"
+	"github.com/haloydev/haloy/internal/helpers"
+	"github.com/haloydev/haloy/internal/storage"
+	"github.com/haloydev/haloy/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+func TokenCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "token",
+		Short: "Manage named API tokens",
+		Long: fmt.Sprintf(`Manage named API tokens for the haloyd API.
+
+Each token has scopes that limit what it can do (%s) and can be limited to apps
+whose names match glob patterns. Admin tokens can do everything on every app, like the
+token in HALOY_API_TOKEN. Changes made with a token are recorded in the audit log with its name.`, apitoken.JoinScopes(apitoken.Scopes)),
+	}
+
+	cmd.AddCommand(
+		tokenCreateCmd(),
+		tokenListCmd(),
+		tokenRevokeCmd(),
+	)
+
+	return cmd
+}
+
+func tokenCreateCmd() *cobra.Command {
+	var scopeFlags []string
+	var appFlags []string
+	var expiresFlag string
+
+	cmd := &cobra.Command{
+		Use:   "create <name>",
+		Short: "Create a token",
+		Long:  "Create a token and print it. The token is only shown once, haloyd only stores its hash.",
+		Example: `  # Token for a CI job that deploys the web apps
+  haloyadm token create ci-web --scope deploy,read --app 'web-*' --expires 90d
+
+  # Read only token for a teammate
+  haloyadm token create alice-readonly --scope read`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name := args[0]
+			if err := apitoken.ValidateName(name); err != nil {
+				return err
+			}
+			scopes, err := apitoken.ParseScopes(scopeFlags)
+			if err != nil {
+				return err
+			}
+			if err := apitoken.ValidateAppPatterns(appFlags); err != nil {
+				return err
+			}
+
+			var expiresAt *time.Time
+			if expiresFlag != "" {
+				d, err := helpers.ParseLongDuration(expiresFlag)
+				if err != nil || d == 0 {
+					return fmt.Errorf("invalid --expires '%s', use a duration like 24h or 90d", expiresFlag)
+				}
+				t := time.Now().UTC().Add(d)
+				expiresAt = &t
+			}
+
+			token, err := apitoken.Generate()
+			if err != nil {
+				return err
+			}
+
+			db, err := openMigratedDB()
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			err = db.CreateAPIToken(storage.APIToken{
+				Name:      name,
+				TokenHash: apitoken.Hash(token),
+				Scopes:    scopes,
+				Apps:      appFlags,
+				ExpiresAt: expiresAt,
+			})
+			if err != nil {
+				return err
+			}
+
+			ui.Success("Created token '%s'", name)
+			ui.Info("Save it now, it can't be shown again:")
+			ui.Basic("%s", token)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringSliceVar(&scopeFlags, "scope", nil, fmt.Sprintf("Scopes of the token, comma-separated (%s)", apitoken.JoinScopes(apitoken.Scopes)))
+	cmd.Flags().StringSliceVar(&appFlags, "app", nil, "Only allow apps whose names match these glob patterns (default: all apps)")
+	cmd.Flags().StringVar(&expiresFlag, "expires", "", "Expire the token after this long, like 24h or 90d (default: never)")
+	cmd.MarkFlagRequired("scope")
+
+	return cmd
+}
+
+func tokenListCmd() *cobra.Command {
+	var allFlag bool
+
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List tokens",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			db, err := openMigratedDB()
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			tokens, err := db.ListAPITokens(allFlag)
+			if err != nil {
+				return err
+			}
+			if len(tokens) == 0 {
+				ui.Info("No tokens found, create one with 'haloyadm token create'")
+				return nil
+			}
+
+			now := time.Now()
+			headers := []string{"NAME", "SCOPES", "APPS", "CREATED", "EXPIRES", "LAST USED", "STATUS"}
+			rows := make([][]string, 0, len(tokens))
+			for _, token := range tokens {
+				apps := "all"
+				if len(token.Apps) > 0 {
+					apps = strings.Join(token.Apps, ", ")
+				}
+				expires := "never"
+				if token.ExpiresAt != nil {
+					expires = helpers.FormatTime(*token.ExpiresAt)
+				}
+				lastUsed := "never"
+				if token.LastUsedAt != nil {
+					lastUsed = helpers.FormatTime(*token.LastUsedAt)
+				}
+				status := "active"
+				switch {
+				case token.RevokedAt != nil:
+					status = "revoked"
+				case token.Expired(now):
+					status = "expired"
+				}
+
+				rows = append(rows, []string{
+					token.Name,
+					apitoken.JoinScopes(token.Scopes),
+					apps,
+					helpers.FormatTime(token.CreatedAt),
+					expires,
+					lastUsed,
+					status,
+				})
+			}
+			ui.Table(headers, rows)
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&allFlag, "all", false, "Include revoked tokens")
+
+	return cmd
+}
+
+func tokenRevokeCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "revoke <name>",
+		Short: "Revoke a token",
+		Long:  "Revoke a token. Requests made with it are rejected right away.",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name := args[0]
+
+			db, err := openMigratedDB()
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			if err := db.RevokeAPIToken(name); err != nil {
+				if errors.Is(err, storage.ErrTokenNotFound) {
+					return fmt.Errorf("no active token named '%s'", name)
+				}
+				return err
+			}
+
+			ui.Success("Revoked token '%s'", name)
+			return nil
+		},
+	}
+}
@@ -0,0 +1,250 @@
+package haloyd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/haloydev/haloy/internal/config"
+	"github.com/haloydev/haloy/internal/constants"
+	"github.com/haloydev/haloy/internal/deploy"
+	"github.com/haloydev/haloy/internal/deploytypes"
+	"github.com/haloydev/haloy/internal/docker"
+	"github.com/haloydev/haloy/internal/helpers"
+)
+
+const (
+	autoRollbackProbeInterval = 10 * time.Second
+	autoRollbackQueueTimeout  = 15 * time.Minute
+)
+
+// observeDeployment watches a deployment that just took over an app's traffic for the app's
+// auto rollback window. If the deployment fails too many health checks in a row, or its containers
+// restart or exit too often, the app is rolled back to the previous deployment.
+// While a deployment is observed, later calls for it return right away.
+func (u *Updater) observeDeployment(ctx context.Context, logger *slog.Logger, appName, deploymentID string) {
+	deployment, ok := u.deploymentManager.Deployments()[appName]
+	if !ok || deployment.Labels.DeploymentID != deploymentID || deployment.Labels.AutoRollback == nil {
+		return
+	}
+	settings := deployment.Labels.AutoRollback
+
+	window, err := time.ParseDuration(settings.Window)
+	if err != nil || window <= 0 {
+		return
+	}
+
+	u.observersMutex.Lock()
+	if _, exists := u.observed[deploymentID]; exists {
+		u.observersMutex.Unlock()
+		return
+	}
+	u.observed[deploymentID] = struct{}{}
+	u.observersMutex.Unlock()
+	defer func() {
+		u.observersMutex.Lock()
+		delete(u.observed, deploymentID)
+		u.observersMutex.Unlock()
+	}()
+
+	maxFailedHealthChecks := constants.DefaultAutoRollbackMaxFailedHealthChecks
+	if settings.MaxFailedHealthChecks != nil {
+		maxFailedHealthChecks = *settings.MaxFailedHealthChecks
+	}
+	maxRestarts := constants.DefaultAutoRollbackMaxRestarts
+	if settings.MaxRestarts != nil {
+		maxRestarts = *settings.MaxRestarts
+	}
+
+	logger.Info(fmt.Sprintf("Watching %s for %s, rolling back if it becomes unhealthy", deploymentID, window),
+		"app", appName, "maxFailedHealthChecks", maxFailedHealthChecks, "maxRestarts", maxRestarts)
+
+	windowCtx, cancel := context.WithTimeout(ctx, window)
+	defer cancel()
+
+	observer := newDeploymentObserver()
+	ticker := time.NewTicker(autoRollbackProbeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-windowCtx.Done():
+			if ctx.Err() == nil {
+				logger.Info(fmt.Sprintf("Deployment %s stayed healthy during the observation window", deploymentID), "app", appName)
+			}
+			return
+		case <-ticker.C:
+		}
+
+		// A newer deployment or a promotion took over the app, so this one is no longer ours to judge.
+		if current, ok := u.deploymentManager.Deployments()[appName]; ok && current.Labels.DeploymentID != deploymentID {
+			logger.Debug("Deployment was replaced, stopping observation", "app", appName)
+			return
+		}
+
+		done, err := observer.probe(windowCtx, u, logger, appName, deploymentID)
+		if err != nil {
+			if windowCtx.Err() == nil {
+				logger.Warn("Failed to observe deployment", "app", appName, "error", err)
+			}
+			continue
+		}
+		if done {
+			logger.Info("Deployment was stopped, stopping observation", "app", appName)
+			return
+		}
+
+		reason := ""
+		switch {
+		case observer.restarts > maxRestarts:
+			reason = fmt.Sprintf("containers restarted or exited %d times (max %d)", observer.restarts, maxRestarts)
+		case observer.failedHealthChecks >= maxFailedHealthChecks:
+			reason = fmt.Sprintf("%d consecutive health checks failed (max %d): %v", observer.failedHealthChecks, maxFailedHealthChecks, observer.lastError)
+		}
+		if reason == "" {
+			continue
+		}
+
+		logger.Warn(fmt.Sprintf("Deployment %s became unhealthy: %s", deploymentID, reason), "app", appName)
+		rollbackDeploymentID := helpers.NewDeploymentID()
+		if err := u.autoRollback(ctx, logger, appName, deploymentID, rollbackDeploymentID, reason); err != nil {
+			logger.Error("Automatic rollback failed", "app", appName, "error", err)
+			return
+		}
+		logger.Info(fmt.Sprintf("Deployment %s was automatically rolled back, new deployment is %s", deploymentID, rollbackDeploymentID),
+			"app", appName, "rollbackDeploymentID", rollbackDeploymentID)
+		return
+	}
+}
+
+// autoRollback waits for deployments of the app that are already running or queued, like a
+// fix being deployed by hand, and then rolls the deployment back.
+func (u *Updater) autoRollback(ctx context.Context, logger *slog.Logger, appName, deploymentID, rollbackDeploymentID, reason string) (err error) {
+	if err := deploy.RecordQueued(rollbackDeploymentID, appName, "haloyd (automatic rollback)", config.DeployMetadata{}, nil, deploymentID); err != nil {
+		logger.Warn("Failed to record deployment", "error", err)
+	}
+
+	ctx, untrack := u.deployQueue.Track(ctx, rollbackDeploymentID)
+	defer untrack()
+	defer func() {
+		if err == nil {
+			return
+		}
+		if deploy.Cancelled(ctx) {
+			deploy.RecordStatus(rollbackDeploymentID, deploytypes.DeploymentStatusCancelled, deploy.ErrDeploymentCancelled.Error(), logger)
+			return
+		}
+		deploy.RecordStatus(rollbackDeploymentID, deploytypes.DeploymentStatusFailed, err.Error(), logger)
+	}()
+
+	ticket, err := u.deployQueue.Enqueue(appName, rollbackDeploymentID, deploytypes.DeploymentKindAutoRollback, true)
+	if err != nil {
+		return err
+	}
+	defer ticket.Done()
+
+	if position := ticket.Position(); position > 0 {
+		logger.Info(fmt.Sprintf("Waiting for %d earlier deployment(s) of the app to finish", position), "app", appName)
+	}
+	waitCtx, cancelWait := context.WithTimeout(ctx, autoRollbackQueueTimeout)
+	defer cancelWait()
+	if err := ticket.Wait(waitCtx); err != nil {
+		return fmt.Errorf("gave up waiting for earlier deployments of the app: %w", err)
+	}
+
+	// A deployment that ran while waiting replaced the unhealthy one, there is nothing left to roll back.
+	if current, ok := u.deploymentManager.Deployments()[appName]; ok && current.Labels.DeploymentID != deploymentID {
+		return fmt.Errorf("deployment %s was replaced while waiting, skipping the rollback", deploymentID)
+	}
+
+	rollbackCtx, cancelRollback := context.WithTimeout(ctx, 10*time.Minute)
+	defer cancelRollback()
+	return deploy.AutoRollback(rollbackCtx, u.cli, appName, deploymentID, rollbackDeploymentID, reason, u.logBroker, logger)
+}
+
+// deploymentObserver keeps the health of a deployment's containers across probes.
+type deploymentObserver struct {
+	restartCounts      map[string]int // Docker restart count per container when first seen
+	exited             map[string]bool
+	restarts           int
+	failedHealthChecks int
+	lastError          error
+}
+
+func newDeploymentObserver() *deploymentObserver {
+	return &deploymentObserver{
+		restartCounts: make(map[string]int),
+		exited:        make(map[string]bool),
+	}
+}
+
+// probe checks the containers of a deployment once. Containers run with the unless-stopped restart
+// policy, so crashes show up as restarts. When all containers are gone or stopped without being
+// restarted, the deployment was stopped on purpose and probe reports done.
+func (o *deploymentObserver) probe(ctx context.Context, u *Updater, logger *slog.Logger, appName, deploymentID string) (done bool, err error) {
+	containers, err := docker.GetAppContainers(ctx, u.cli, true, appName)
+	if err != nil {
+		return false, err
+	}
+
+	var running, stopped []string
+	total, restarts := 0, 0
+	for _, c := range containers {
+		if c.Labels[config.LabelDeploymentID] != deploymentID {
+			continue
+		}
+		total++
+
+		info, err := u.cli.ContainerInspect(ctx, c.ID)
+		if err != nil {
+			return false, fmt.Errorf("failed to inspect container %s: %w", helpers.SafeIDPrefix(c.ID), err)
+		}
+
+		if initial, seen := o.restartCounts[c.ID]; seen && info.RestartCount > initial {
+			restarts += info.RestartCount - initial
+			logger.Warn("Container restarted", "containerID", helpers.SafeIDPrefix(c.ID), "exitCode", info.State.ExitCode)
+		}
+		o.restartCounts[c.ID] = info.RestartCount
+
+		switch {
+		case info.State.Running:
+			running = append(running, c.ID)
+		case !info.State.Restarting:
+			stopped = append(stopped, c.ID)
+		}
+	}
+
+	if len(running) == 0 && len(stopped) == total {
+		return true, nil
+	}
+
+	// Some containers stopped while others keep running, which only happens when they crash
+	// for good. Each of them counts once.
+	for _, containerID := range stopped {
+		if !o.exited[containerID] {
+			o.exited[containerID] = true
+			restarts++
+			logger.Warn("Container exited", "containerID", helpers.SafeIDPrefix(containerID))
+		}
+	}
+	o.restarts += restarts
+
+	if len(running) == 0 {
+		o.failedHealthChecks++
+		o.lastError = fmt.Errorf("no running containers")
+		return false, nil
+	}
+
+	for _, containerID := range running {
+		if err := docker.HealthCheckContainer(ctx, u.cli, logger, containerID); err != nil {
+			o.failedHealthChecks++
+			o.lastError = err
+			logger.Warn("Health check failed", "containerID", helpers.SafeIDPrefix(containerID), "error", err)
+			return false, nil
+		}
+	}
+	o.failedHealthChecks = 0
+	o.lastError = nil
+	return false, nil
+}
@@ -0,0 +1,143 @@
+package haloyd
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"github.com/haloydev/haloy/internal/config"
+)
+
+// fakeContainer is a container as the fake Docker API reports it.
+type fakeContainer struct {
+	deploymentID string
+	running      bool
+	restarting   bool
+	restartCount int
+	health       string
+}
+
+// fakeDocker serves the parts of the Docker API the deployment observer uses. Containers can be
+// changed between calls while holding mutex.
+type fakeDocker struct {
+	mutex      sync.Mutex
+	containers map[string]*fakeContainer
+}
+
+func (d *fakeDocker) client(t *testing.T) *client.Client {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		d.mutex.Lock()
+		defer d.mutex.Unlock()
+
+		path := strings.TrimPrefix(r.URL.Path, "/v1.45")
+		switch {
+		case path == "/containers/json":
+			var list []container.Summary
+			for id, c := range d.containers {
+				list = append(list, container.Summary{ID: id, Labels: map[string]string{
+					config.LabelAppName:      "web",
+					config.LabelDeploymentID: c.deploymentID,
+				}})
+			}
+			json.NewEncoder(w).Encode(list)
+		case strings.HasPrefix(path, "/containers/") && strings.HasSuffix(path, "/json"):
+			id := strings.TrimSuffix(strings.TrimPrefix(path, "/containers/"), "/json")
+			c, ok := d.containers[id]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			state := &container.State{Running: c.running, Restarting: c.restarting}
+			if c.health != "" {
+				state.Health = &container.Health{Status: c.health}
+			}
+			json.NewEncoder(w).Encode(container.InspectResponse{
+				ContainerJSONBase: &container.ContainerJSONBase{ID: id, State: state, RestartCount: c.restartCount},
+				Config:            &container.Config{},
+			})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	cli, err := client.NewClientWithOpts(client.WithHost("tcp://"+strings.TrimPrefix(server.URL, "http://")), client.WithVersion("1.45"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cli.Close() })
+	return cli
+}
+
+func TestDeploymentObserverProbe(t *testing.T) {
+	docker := &fakeDocker{containers: map[string]*fakeContainer{
+		"a":     {deploymentID: "02", running: true, health: "healthy"},
+		"b":     {deploymentID: "02", running: true, health: "healthy"},
+		"older": {deploymentID: "01", running: false},
+	}}
+	u := &Updater{cli: docker.client(t)}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	observer := newDeploymentObserver()
+
+	steps := []struct {
+		name         string
+		change       func(containers map[string]*fakeContainer)
+		wantDone     bool
+		wantRestarts int
+		wantFailed   int
+	}{
+		{name: "healthy", change: func(map[string]*fakeContainer) {}},
+		{name: "restarted twice", change: func(c map[string]*fakeContainer) { c["a"].restartCount = 2 }, wantRestarts: 2},
+		{name: "exited while the other runs", change: func(c map[string]*fakeContainer) { c["b"].running = false }, wantRestarts: 3},
+		{name: "exit counts once", change: func(map[string]*fakeContainer) {}, wantRestarts: 3},
+		{name: "unhealthy", change: func(c map[string]*fakeContainer) { c["a"].health = "unhealthy" }, wantRestarts: 3, wantFailed: 1},
+		{name: "restarting", change: func(c map[string]*fakeContainer) {
+			c["a"].running, c["a"].restarting = false, true
+		}, wantRestarts: 3, wantFailed: 2},
+		{name: "healthy again", change: func(c map[string]*fakeContainer) {
+			c["a"].running, c["a"].restarting, c["a"].health = true, false, "healthy"
+		}, wantRestarts: 3},
+		{name: "stopped", change: func(c map[string]*fakeContainer) { c["a"].running = false }, wantDone: true, wantRestarts: 3},
+	}
+	for _, step := range steps {
+		docker.mutex.Lock()
+		step.change(docker.containers)
+		docker.mutex.Unlock()
+
+		done, err := observer.probe(context.Background(), u, logger, "web", "02")
+		if err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		if done != step.wantDone || observer.restarts != step.wantRestarts || observer.failedHealthChecks != step.wantFailed {
+			t.Errorf("%s: got done %v, %d restarts, %d failed health checks, want %v, %d, %d", step.name,
+				done, observer.restarts, observer.failedHealthChecks, step.wantDone, step.wantRestarts, step.wantFailed)
+		}
+		if (observer.lastError != nil) != (step.wantFailed > 0) {
+			t.Errorf("%s: last error %v with %d failed health checks", step.name, observer.lastError, step.wantFailed)
+		}
+	}
+}
+
+func TestObserveDeploymentForgetsDeployment(t *testing.T) {
+	u := &Updater{
+		deploymentManager: &DeploymentManager{deployments: map[string]Deployment{
+			"web": {Labels: &config.ContainerLabels{AppName: "web", DeploymentID: "02", AutoRollback: &config.AutoRollback{Window: "1ms"}}},
+		}},
+		observed: make(map[string]struct{}),
+	}
+
+	// The window ends before the first probe.
+	u.observeDeployment(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil)), "web", "02")
+	if len(u.observed) != 0 {
+		t.Errorf("observed holds %v after the window ended", u.observed)
+	}
+}
@@ -0,0 +1,188 @@
+package haloyd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/haloydev/haloy/internal/deploy"
+	"github.com/haloydev/haloy/internal/deploytypes"
+	"github.com/haloydev/haloy/internal/docker"
+	"github.com/haloydev/haloy/internal/storage"
+)
+
+// ApplyRouting rebuilds the deployment state and applies the HAProxy configuration.
+// It is used for routing changes that don't come from Docker events, like canary weights.
+func (u *Updater) ApplyRouting(ctx context.Context, logger *slog.Logger) error {
+	u.routingMutex.Lock()
+	defer u.routingMutex.Unlock()
+
+	_, excludedContainers, err := u.deploymentManager.BuildDeployments(ctx, logger)
+	if err != nil {
+		return fmt.Errorf("failed to build deployments: %w", err)
+	}
+	logExcludedContainerReasons(excludedContainers, logger)
+
+	if err := u.haproxyManager.ApplyConfig(ctx, logger, u.deploymentManager.Deployments()); err != nil {
+		return fmt.Errorf("failed to apply HAProxy config: %w", err)
+	}
+	return nil
+}
+
+// ReapplyConfig applies the HAProxy configuration for the current deployments without
+// rebuilding them, like when a certificate changed.
+func (u *Updater) ReapplyConfig(ctx context.Context, logger *slog.Logger) error {
+	u.routingMutex.Lock()
+	defer u.routingMutex.Unlock()
+
+	return u.haproxyManager.ApplyConfig(ctx, logger, u.deploymentManager.Deployments())
+}
+
+// isCanaryOrPreview reports whether deploymentID runs next to the app's live deployment, as its
+// canary or waiting for promotion.
+func (u *Updater) isCanaryOrPreview(appName, deploymentID string) bool {
+	deployment, ok := u.deploymentManager.Deployments()[appName]
+	if !ok {
+		return false
+	}
+	return (deployment.Canary != nil && deployment.Canary.DeploymentID == deploymentID) ||
+		(deployment.Preview != nil && deployment.Preview.DeploymentID == deploymentID)
+}
+
+// runningCanary returns the canary for an app and the deployment it runs next to.
+func (u *Updater) runningCanary(appName string) (storage.Canary, Deployment, error) {
+	canary, err := u.db.GetCanary(appName)
+	if err != nil {
+		return canary, Deployment{}, err
+	}
+
+	deployment, ok := u.deploymentManager.Deployments()[appName]
+	if !ok || deployment.Canary == nil || deployment.Canary.DeploymentID != canary.CanaryDeploymentID {
+		return canary, deployment, fmt.Errorf("canary deployment %s for %s is not running", canary.CanaryDeploymentID, appName)
+	}
+	return canary, deployment, nil
+}
+
+// SetCanaryWeight changes the percentage of traffic sent to the canary deployment of an app.
+func (u *Updater) SetCanaryWeight(ctx context.Context, logger *slog.Logger, appName string, weight int) (storage.Canary, error) {
+	if weight < 0 || weight > 100 {
+		return storage.Canary{}, fmt.Errorf("weight must be between 0 and 100, got %d", weight)
+	}
+
+	canary, _, err := u.runningCanary(appName)
+	if err != nil {
+		return canary, err
+	}
+
+	canary.Weight = weight
+	if err := u.db.SaveCanary(canary); err != nil {
+		return canary, err
+	}
+
+	if err := u.ApplyRouting(ctx, logger); err != nil {
+		return canary, err
+	}
+
+	logger.Info(fmt.Sprintf("Canary weight for %s set to %d%%", appName, weight),
+		"app", appName, "deploymentID", canary.CanaryDeploymentID, "weight", weight)
+	return canary, nil
+}
+
+// PromoteCanary sends all traffic to the canary deployment, then drains and stops the stable deployment.
+func (u *Updater) PromoteCanary(ctx context.Context, logger *slog.Logger, appName string) error {
+	canary, _, err := u.runningCanary(appName)
+	if err != nil {
+		return err
+	}
+
+	// Without the canary record the canary is the newest deployment, so it takes over
+	// the app and the stable instances are marked as draining.
+	if err := u.db.DeleteCanary(appName); err != nil {
+		return err
+	}
+	if err := u.switchTo(ctx, logger, appName, canary.CanaryDeploymentID); err != nil {
+		return err
+	}
+
+	logger.Info(fmt.Sprintf("Promoted canary %s for %s", canary.CanaryDeploymentID, appName),
+		"app", appName, "deploymentID", canary.CanaryDeploymentID)
+
+	// The promotion request ends here, the observer outlives it.
+	go u.observeDeployment(context.WithoutCancel(ctx), logger, appName, canary.CanaryDeploymentID)
+	return nil
+}
+
+// switchTo applies the routing that makes deploymentID serve the app, records it as live,
+// then drains and stops the app's other deployments. The caller removes the state that kept deploymentID aside first.
+func (u *Updater) switchTo(ctx context.Context, logger *slog.Logger, appName, deploymentID string) error {
+	routeSwitchStart := time.Now()
+	if err := u.ApplyRouting(ctx, logger); err != nil {
+		return err
+	}
+	deploy.RecordLive(deploymentID, time.Since(routeSwitchStart), logger)
+
+	deployment, ok := u.deploymentManager.Deployments()[appName]
+	if ok {
+		u.drainInstances(ctx, logger, appName, deployment.Labels.DrainTimeout, deployment.Draining)
+	}
+
+	stopCtx, cancelStop := context.WithTimeout(ctx, 10*time.Minute)
+	defer cancelStop()
+	if _, err := docker.StopContainers(stopCtx, u.cli, logger, appName, deploymentID); err != nil {
+		return fmt.Errorf("failed to stop old containers: %w", err)
+	}
+	if _, err := docker.RemoveContainers(stopCtx, u.cli, logger, appName, deploymentID); err != nil {
+		return fmt.Errorf("failed to remove old containers: %w", err)
+	}
+	return nil
+}
+
+// AbortCanary stops sending traffic to the canary deployment, then drains and stops it.
+func (u *Updater) AbortCanary(ctx context.Context, logger *slog.Logger, appName string) error {
+	canary, deployment, err := u.runningCanary(appName)
+	if err != nil {
+		if errors.Is(err, storage.ErrCanaryNotFound) {
+			return err
+		}
+		// The canary containers are already gone, only the record is left.
+		logger.Warn("Canary deployment is not running, removing canary state", "app", appName, "error", err)
+		if err := u.db.DeleteCanary(appName); err != nil {
+			return err
+		}
+		return u.ApplyRouting(ctx, logger)
+	}
+
+	canary.Weight = 0
+	if err := u.db.SaveCanary(canary); err != nil {
+		return err
+	}
+	if err := u.ApplyRouting(ctx, logger); err != nil {
+		return err
+	}
+
+	u.drainInstances(ctx, logger, appName, deployment.Canary.Labels.DrainTimeout, deployment.Canary.Instances)
+
+	stopCtx, cancelStop := context.WithTimeout(ctx, 10*time.Minute)
+	defer cancelStop()
+	if _, err := docker.StopDeploymentContainers(stopCtx, u.cli, logger, appName, canary.CanaryDeploymentID); err != nil {
+		return fmt.Errorf("failed to stop canary containers: %w", err)
+	}
+	if _, err := docker.RemoveDeploymentContainers(stopCtx, u.cli, logger, appName, canary.CanaryDeploymentID); err != nil {
+		return fmt.Errorf("failed to remove canary containers: %w", err)
+	}
+
+	if err := u.db.DeleteCanary(appName); err != nil {
+		return err
+	}
+	if err := u.ApplyRouting(ctx, logger); err != nil {
+		return err
+	}
+
+	deploy.RecordStatus(canary.CanaryDeploymentID, deploytypes.DeploymentStatusCancelled, "Canary aborted", logger)
+
+	logger.Info(fmt.Sprintf("Aborted canary %s for %s", canary.CanaryDeploymentID, appName),
+		"app", appName, "deploymentID", canary.CanaryDeploymentID)
+	return nil
+}
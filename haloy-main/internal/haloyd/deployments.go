@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log/slog"
 	"maps"
+	"slices"
 	"strings"
 	"sync"
 
@@ -14,6 +15,7 @@ import (
 	"github.com/haloydev/haloy/internal/constants"
 	"github.com/haloydev/haloy/internal/docker"
 	"github.com/haloydev/haloy/internal/helpers"
+	"github.com/haloydev/haloy/internal/storage"
 )
 
 type DeploymentInstance struct {
@@ -25,6 +27,75 @@ type DeploymentInstance struct {
 type Deployment struct {
 	Labels    *config.ContainerLabels
 	Instances []DeploymentInstance
+	// Draining holds instances from older deployments of the app that are still running.
+	// They stay in HAProxy without receiving new traffic until they are stopped.
+	Draining []DeploymentInstance
+	// Canary is set while a canary deployment runs next to this one.
+	Canary *CanaryDeployment
+	// Preview is set while a deployment started with --no-promote waits for promotion.
+	Preview *PreviewDeployment
+	// ByID holds the instances of every running deployment of the app, including the ones above.
+	// Requests with the deployment routing secret can be sent to any of them.
+	ByID map[string][]DeploymentInstance
+	// Mirror is set while requests to the app are copied to the deployment waiting for promotion.
+	Mirror *MirrorSettings
+	// Sleeping is set when the app's containers were stopped after being idle. It has no
+	// instances and HAProxy sends its requests to the waker, which starts the containers again.
+	Sleeping bool
+}
+
+type CanaryDeployment struct {
+	Labels       *config.ContainerLabels
+	DeploymentID string
+	Instances    []DeploymentInstance
+	Weight       int // Percentage of traffic sent to the canary instances
+}
+
+func (c *CanaryDeployment) instances() []DeploymentInstance {
+	if c == nil {
+		return nil
+	}
+	return c.Instances
+}
+
+func (c *CanaryDeployment) weight() int {
+	if c == nil {
+		return 0
+	}
+	return c.Weight
+}
+
+// PreviewDeployment is only reachable on its own hostname until it is promoted.
+type PreviewDeployment struct {
+	Labels       *config.ContainerLabels
+	DeploymentID string
+	Instances    []DeploymentInstance
+	Host         string
+}
+
+// MirrorSettings describe how requests are copied to the preview deployment.
+type MirrorSettings struct {
+	CandidateDeploymentID string
+	AllMethods            bool
+}
+
+func (p *PreviewDeployment) instances() []DeploymentInstance {
+	if p == nil {
+		return nil
+	}
+	return p.Instances
+}
+
+// previewHost returns the configured preview domain, or the deployment ID as a subdomain of the
+// app's first canonical domain.
+func previewHost(labels *config.ContainerLabels, deploymentID string) string {
+	if labels.PreviewDomain != "" {
+		return labels.PreviewDomain
+	}
+	if len(labels.Domains) == 0 {
+		return ""
+	}
+	return strings.ToLower(deploymentID) + "." + labels.Domains[0].Canonical
 }
 
 type ContainerExclusionReason int
@@ -66,6 +137,7 @@ type ExcludedContainerInfo struct {
 
 type DeploymentManager struct {
 	cli *client.Client
+	db  *storage.DB
 	// deployments is a map of appName to Deployment, key is the app name.
 	deployments      map[string]Deployment
 	compareResult    compareResult
@@ -73,9 +145,10 @@ type DeploymentManager struct {
 	haloydConfig     *config.HaloydConfig
 }
 
-func NewDeploymentManager(cli *client.Client, haloydConfig *config.HaloydConfig) *DeploymentManager {
+func NewDeploymentManager(cli *client.Client, db *storage.DB, haloydConfig *config.HaloydConfig) *DeploymentManager {
 	return &DeploymentManager{
 		cli:          cli,
+		db:           db,
 		deployments:  make(map[string]Deployment),
 		haloydConfig: haloydConfig,
 	}
@@ -86,6 +159,8 @@ func NewDeploymentManager(cli *client.Client, haloydConfig *config.HaloydConfig)
 // Returns true if the deployment state has changed, along with any error encountered.
 func (dm *DeploymentManager) BuildDeployments(ctx context.Context, logger *slog.Logger) (hasChanged bool, excludedContainers []ExcludedContainerInfo, err error) {
 	newDeployments := make(map[string]Deployment)
+	// appDeployments groups running deployments by app name and deployment ID.
+	appDeployments := make(map[string]map[string]*Deployment)
 	containers, err := docker.GetAppContainers(ctx, dm.cli, false, "")
 	if err != nil {
 		return hasChanged, excludedContainers, fmt.Errorf("failed to get containers: %w", err)
@@ -172,19 +247,81 @@ func (dm *DeploymentManager) BuildDeployments(ctx context.Context, logger *slog.
 
 		instance := DeploymentInstance{ContainerID: container.ID, IP: ip, Port: port}
 
-		if deployment, exists := newDeployments[labels.AppName]; exists {
-			// There is a appName match, check if the deployment ID matches.
-			if deployment.Labels.DeploymentID == labels.DeploymentID {
-				deployment.Instances = append(deployment.Instances, instance)
-				newDeployments[labels.AppName] = deployment
-			} else {
-				// Replace the deployment if the new one has a higher deployment ID
-				if deployment.Labels.DeploymentID < labels.DeploymentID {
-					newDeployments[labels.AppName] = Deployment{Labels: labels, Instances: []DeploymentInstance{instance}}
-				}
-			}
+		if _, exists := appDeployments[labels.AppName]; !exists {
+			appDeployments[labels.AppName] = make(map[string]*Deployment)
+		}
+		if deployment, exists := appDeployments[labels.AppName][labels.DeploymentID]; exists {
+			deployment.Instances = append(deployment.Instances, instance)
 		} else {
-			newDeployments[labels.AppName] = Deployment{Labels: labels, Instances: []DeploymentInstance{instance}}
+			appDeployments[labels.AppName][labels.DeploymentID] = &Deployment{Labels: labels, Instances: []DeploymentInstance{instance}}
+		}
+	}
+
+	canaries := make(map[string]storage.Canary)
+	if dm.db != nil {
+		canaries, err = dm.db.ListCanaries()
+		if err != nil {
+			return hasChanged, excludedContainers, fmt.Errorf("failed to get canaries: %w", err)
+		}
+	}
+
+	previews := make(map[string]storage.Preview)
+	if dm.db != nil {
+		previews, err = dm.db.ListPreviews()
+		if err != nil {
+			return hasChanged, excludedContainers, fmt.Errorf("failed to get previews: %w", err)
+		}
+	}
+
+	mirrors := make(map[string]storage.Mirror)
+	if dm.db != nil {
+		mirrors, err = dm.db.ListMirrors()
+		if err != nil {
+			return hasChanged, excludedContainers, fmt.Errorf("failed to get mirrors: %w", err)
+		}
+	}
+
+	sleepingApps := make(map[string]storage.SleepingApp)
+	if dm.db != nil {
+		sleepingApps, err = dm.db.ListSleepingApps()
+		if err != nil {
+			return hasChanged, excludedContainers, fmt.Errorf("failed to get sleeping apps: %w", err)
+		}
+	}
+
+	for appName, byID := range appDeployments {
+		var canary *storage.Canary
+		if c, ok := canaries[appName]; ok {
+			canary = &c
+		}
+		var preview *storage.Preview
+		if p, ok := previews[appName]; ok {
+			preview = &p
+		}
+		deployment := assembleDeployment(byID, canary, preview)
+		if m, ok := mirrors[appName]; ok && deployment.Preview != nil &&
+			deployment.Labels.DeploymentID == m.LiveDeploymentID && deployment.Preview.DeploymentID == m.CandidateDeploymentID {
+			deployment.Mirror = &MirrorSettings{CandidateDeploymentID: m.CandidateDeploymentID, AllMethods: m.AllMethods}
+		}
+
+		// An app is put to sleep before its containers are stopped, and woken up after they
+		// are healthy again, so requests never reach containers that are going away.
+		if sleeping, ok := sleepingApps[appName]; ok && len(byID) == 1 && deployment.Labels.DeploymentID == sleeping.DeploymentID {
+			deployment = Deployment{Labels: deployment.Labels, Sleeping: true}
+		}
+		newDeployments[appName] = deployment
+	}
+
+	for appName, sleeping := range sleepingApps {
+		if _, running := appDeployments[appName]; running {
+			continue
+		}
+		labels, err := dm.stoppedDeploymentLabels(ctx, appName, sleeping.DeploymentID)
+		if err != nil {
+			return hasChanged, excludedContainers, err
+		}
+		if labels != nil {
+			newDeployments[appName] = Deployment{Labels: labels, Sleeping: true}
 		}
 	}
 
@@ -197,12 +334,34 @@ func (dm *DeploymentManager) BuildDeployments(ctx context.Context, logger *slog.
 	compareResult := compareDeployments(oldDeployments, newDeployments)
 	hasChanged = len(compareResult.AddedDeployments) > 0 ||
 		len(compareResult.RemovedDeployments) > 0 ||
-		len(compareResult.UpdatedDeployments) > 0
+		len(compareResult.UpdatedDeployments) > 0 ||
+		len(compareResult.RoutingChanged) > 0
 
 	dm.compareResult = compareResult
 	return hasChanged, excludedContainers, nil
 }
 
+// stoppedDeploymentLabels returns the labels of a deployment's stopped containers, or nil if the
+// deployment has no containers left or they are not routable.
+func (dm *DeploymentManager) stoppedDeploymentLabels(ctx context.Context, appName, deploymentID string) (*config.ContainerLabels, error) {
+	containers, err := docker.GetAppContainers(ctx, dm.cli, true, appName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get containers for %s: %w", appName, err)
+	}
+
+	for _, c := range containers {
+		if c.Labels[config.LabelDeploymentID] != deploymentID {
+			continue
+		}
+		labels, err := config.ParseContainerLabels(c.Labels)
+		if err != nil || len(labels.Domains) == 0 {
+			return nil, nil
+		}
+		return labels, nil
+	}
+	return nil, nil
+}
+
 func (dm *DeploymentManager) HealthCheckNewContainers(ctx context.Context, logger *slog.Logger) (checked []Deployment, failedContainerIDs []string) {
 	for _, deployment := range dm.compareResult.AddedDeployments {
 		checked = append(checked, deployment)
@@ -213,7 +372,7 @@ func (dm *DeploymentManager) HealthCheckNewContainers(ctx context.Context, logge
 	}
 
 	for _, deployment := range checked {
-		for _, instance := range deployment.Instances {
+		for _, instance := range slices.Concat(deployment.Instances, deployment.Canary.instances(), deployment.Preview.instances()) {
 			if err := docker.HealthCheckContainer(ctx, dm.cli, logger, instance.ContainerID); err != nil {
 				failedContainerIDs = append(failedContainerIDs, instance.ContainerID)
 			}
@@ -245,11 +404,7 @@ func (dm *DeploymentManager) GetCertificateDomains() ([]CertificatesDomain, erro
 		}
 		for _, domain := range deployment.Labels.Domains {
 			if domain.Canonical != "" {
-				email := deployment.Labels.ACMEEmail
-				if dm.haloydConfig != nil && email == "" {
-					email = dm.haloydConfig.Certificates.AcmeEmail // Use default email if not set
-				}
-
+				email := dm.acmeEmail(deployment.Labels)
 				if email == "" {
 					return nil, fmt.Errorf("ACME email for domain %s not found in haloyd config or labels", domain.Canonical)
 				}
@@ -267,6 +422,30 @@ func (dm *DeploymentManager) GetCertificateDomains() ([]CertificatesDomain, erro
 				certDomains = append(certDomains, newDomain)
 			}
 		}
+
+		if deployment.Preview != nil && deployment.Preview.Host != "" {
+			// The preview host comes from the preview deployment's labels, so does its email.
+			email := ""
+			if deployment.Preview.Labels != nil {
+				email = dm.acmeEmail(deployment.Preview.Labels)
+			}
+			if email == "" {
+				email = dm.acmeEmail(deployment.Labels)
+			}
+			if email == "" {
+				return nil, fmt.Errorf("ACME email for preview domain %s not found in haloyd config or labels", deployment.Preview.Host)
+			}
+
+			previewDomain := CertificatesDomain{
+				Canonical: deployment.Preview.Host,
+				Aliases:   []string{},
+				Email:     email,
+			}
+			if err := previewDomain.Validate(); err != nil {
+				return nil, fmt.Errorf("preview domain not valid '%s': %w", deployment.Preview.Host, err)
+			}
+			certDomains = append(certDomains, previewDomain)
+		}
 	}
 
 	// We'll add the domain set in the haloyd config file if it exists.
@@ -281,10 +460,84 @@ func (dm *DeploymentManager) GetCertificateDomains() ([]CertificatesDomain, erro
 	return certDomains, nil
 }
 
+// acmeEmail returns the ACME email of a deployment, or the default one from the haloyd config
+// if its labels don't set one.
+func (dm *DeploymentManager) acmeEmail(labels *config.ContainerLabels) string {
+	if labels.ACMEEmail != "" {
+		return labels.ACMEEmail
+	}
+	if dm.haloydConfig != nil {
+		return dm.haloydConfig.Certificates.AcmeEmail
+	}
+	return ""
+}
+
+// assembleDeployment picks the deployment that serves an app from its running deployments.
+// Normally that is the one with the highest ID and the others are draining. While a canary is
+// in progress and both of its deployments are running, the stable one serves the app and the
+// canary gets its share of the traffic. Likewise, a deployment waiting for promotion is only
+// served on its preview hostname while the live deployment keeps serving the app.
+func assembleDeployment(byID map[string]*Deployment, canary *storage.Canary, preview *storage.Preview) Deployment {
+	ids := slices.Sorted(maps.Keys(byID))
+	slices.Reverse(ids)
+
+	primaryID := ids[0]
+	canaryID := ""
+	if canary != nil {
+		_, hasStable := byID[canary.StableDeploymentID]
+		_, hasCanary := byID[canary.CanaryDeploymentID]
+		if hasStable && hasCanary {
+			primaryID = canary.StableDeploymentID
+			canaryID = canary.CanaryDeploymentID
+		}
+	}
+	previewID := ""
+	if preview != nil && canaryID == "" {
+		_, hasLive := byID[preview.LiveDeploymentID]
+		_, hasPreview := byID[preview.PreviewDeploymentID]
+		if hasLive && hasPreview {
+			primaryID = preview.LiveDeploymentID
+			previewID = preview.PreviewDeploymentID
+		}
+	}
+
+	deployment := *byID[primaryID]
+	deployment.ByID = make(map[string][]DeploymentInstance, len(ids))
+	for _, id := range ids {
+		deployment.ByID[id] = byID[id].Instances
+	}
+	for _, id := range ids {
+		switch id {
+		case primaryID:
+			continue
+		case canaryID:
+			deployment.Canary = &CanaryDeployment{
+				Labels:       byID[id].Labels,
+				DeploymentID: id,
+				Instances:    byID[id].Instances,
+				Weight:       canary.Weight,
+			}
+		case previewID:
+			deployment.Preview = &PreviewDeployment{
+				Labels:       byID[id].Labels,
+				DeploymentID: id,
+				Instances:    byID[id].Instances,
+				Host:         previewHost(byID[id].Labels, id),
+			}
+		default:
+			deployment.Draining = append(deployment.Draining, byID[id].Instances...)
+		}
+	}
+	return deployment
+}
+
 type compareResult struct {
 	UpdatedDeployments map[string]Deployment
 	RemovedDeployments map[string]Deployment
 	AddedDeployments   map[string]Deployment
+	// RoutingChanged holds deployments where only the draining instances, the canary weight or mirroring changed.
+	// These need a new HAProxy config but no health checks.
+	RoutingChanged map[string]Deployment
 }
 
 // compareDeployments analyzes differences between the previous and current deployment states.
@@ -292,18 +545,26 @@ type compareResult struct {
 // 1. Updated deployments - same app name but different deployment ID or instance configuration
 // 2. Removed deployments - deployments that existed before but are no longer present
 // 3. Added deployments - new deployments that didn't exist in the previous state
+// Deployments where only the draining instances, canary weight or mirroring changed are tracked separately.
 func compareDeployments(oldDeployments, newDeployments map[string]Deployment) compareResult {
 	updatedDeployments := make(map[string]Deployment)
 	removedDeployments := make(map[string]Deployment)
 	addedDeployments := make(map[string]Deployment)
+	routingChanged := make(map[string]Deployment)
 
 	for appName, prevDeployment := range oldDeployments {
 		if currentDeployment, exists := newDeployments[appName]; exists {
 			if prevDeployment.Labels.DeploymentID != currentDeployment.Labels.DeploymentID {
 				updatedDeployments[appName] = currentDeployment
 			} else {
-				if !instancesEqual(prevDeployment.Instances, currentDeployment.Instances) {
+				if !instancesEqual(prevDeployment.Instances, currentDeployment.Instances) ||
+					!instancesEqual(prevDeployment.Canary.instances(), currentDeployment.Canary.instances()) ||
+					!instancesEqual(prevDeployment.Preview.instances(), currentDeployment.Preview.instances()) {
 					updatedDeployments[appName] = currentDeployment
+				} else if !instancesEqual(prevDeployment.Draining, currentDeployment.Draining) ||
+					prevDeployment.Canary.weight() != currentDeployment.Canary.weight() ||
+					(prevDeployment.Mirror == nil) != (currentDeployment.Mirror == nil) {
+					routingChanged[appName] = currentDeployment
 				}
 			}
 		} else {
@@ -321,6 +582,7 @@ func compareDeployments(oldDeployments, newDeployments map[string]Deployment) co
 		UpdatedDeployments: updatedDeployments,
 		RemovedDeployments: removedDeployments,
 		AddedDeployments:   addedDeployments,
+		RoutingChanged:     routingChanged,
 	}
 
 	return result
@@ -0,0 +1,238 @@
+package haloyd
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/haloydev/haloy/internal/config"
+	"github.com/haloydev/haloy/internal/storage"
+)
+
+func testDeployment(id string, containerIDs ...string) *Deployment {
+	deployment := &Deployment{
+		Labels: &config.ContainerLabels{
+			DeploymentID: id,
+			Domains:      []config.Domain{{Canonical: "example.com"}},
+		},
+	}
+	for _, containerID := range containerIDs {
+		deployment.Instances = append(deployment.Instances, DeploymentInstance{ContainerID: containerID})
+	}
+	return deployment
+}
+
+func containerIDs(instances []DeploymentInstance) []string {
+	ids := make([]string, 0, len(instances))
+	for _, instance := range instances {
+		ids = append(ids, instance.ContainerID)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+func TestAssembleDeployment(t *testing.T) {
+	tests := []struct {
+		name         string
+		byID         map[string]*Deployment
+		canary       *storage.Canary
+		preview      *storage.Preview
+		wantPrimary  string
+		wantDraining []string
+		wantCanary   string
+		wantWeight   int
+		wantPreview  string
+		wantHost     string
+	}{
+		{
+			name:        "single deployment",
+			byID:        map[string]*Deployment{"1": testDeployment("1", "a")},
+			wantPrimary: "1",
+		},
+		{
+			name:         "newest serves, older drain",
+			byID:         map[string]*Deployment{"1": testDeployment("1", "a"), "2": testDeployment("2", "b"), "3": testDeployment("3", "c1", "c2")},
+			wantPrimary:  "3",
+			wantDraining: []string{"a", "b"},
+		},
+		{
+			name:        "canary next to stable",
+			byID:        map[string]*Deployment{"1": testDeployment("1", "a"), "2": testDeployment("2", "b")},
+			canary:      &storage.Canary{StableDeploymentID: "1", CanaryDeploymentID: "2", Weight: 20},
+			wantPrimary: "1",
+			wantCanary:  "2",
+			wantWeight:  20,
+		},
+		{
+			name:         "canary whose stable is gone",
+			byID:         map[string]*Deployment{"1": testDeployment("1", "a"), "2": testDeployment("2", "b")},
+			canary:       &storage.Canary{StableDeploymentID: "0", CanaryDeploymentID: "2", Weight: 20},
+			wantPrimary:  "2",
+			wantDraining: []string{"a"},
+		},
+		{
+			name:        "preview next to live",
+			byID:        map[string]*Deployment{"1": testDeployment("1", "a"), "2A": testDeployment("2A", "b")},
+			preview:     &storage.Preview{LiveDeploymentID: "1", PreviewDeploymentID: "2A"},
+			wantPrimary: "1",
+			wantPreview: "2A",
+			wantHost:    "2a.example.com",
+		},
+		{
+			name:         "canary wins over preview",
+			byID:         map[string]*Deployment{"1": testDeployment("1", "a"), "2": testDeployment("2", "b"), "3": testDeployment("3", "c")},
+			canary:       &storage.Canary{StableDeploymentID: "1", CanaryDeploymentID: "3", Weight: 50},
+			preview:      &storage.Preview{LiveDeploymentID: "1", PreviewDeploymentID: "2"},
+			wantPrimary:  "1",
+			wantDraining: []string{"b"},
+			wantCanary:   "3",
+			wantWeight:   50,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := assembleDeployment(tt.byID, tt.canary, tt.preview)
+
+			if got.Labels.DeploymentID != tt.wantPrimary {
+				t.Errorf("primary is %s, want %s", got.Labels.DeploymentID, tt.wantPrimary)
+			}
+			if draining := containerIDs(got.Draining); !slices.Equal(draining, tt.wantDraining) {
+				t.Errorf("draining %v, want %v", draining, tt.wantDraining)
+			}
+			if len(got.ByID) != len(tt.byID) {
+				t.Errorf("ByID has %d deployments, want %d", len(got.ByID), len(tt.byID))
+			}
+
+			switch {
+			case tt.wantCanary == "" && got.Canary != nil:
+				t.Errorf("unexpected canary %s", got.Canary.DeploymentID)
+			case tt.wantCanary != "" && got.Canary == nil:
+				t.Errorf("no canary, want %s", tt.wantCanary)
+			case got.Canary != nil && (got.Canary.DeploymentID != tt.wantCanary || got.Canary.Weight != tt.wantWeight):
+				t.Errorf("canary %s at %d%%, want %s at %d%%", got.Canary.DeploymentID, got.Canary.Weight, tt.wantCanary, tt.wantWeight)
+			}
+
+			switch {
+			case tt.wantPreview == "" && got.Preview != nil:
+				t.Errorf("unexpected preview %s", got.Preview.DeploymentID)
+			case tt.wantPreview != "" && got.Preview == nil:
+				t.Errorf("no preview, want %s", tt.wantPreview)
+			case got.Preview != nil && (got.Preview.DeploymentID != tt.wantPreview || got.Preview.Host != tt.wantHost):
+				t.Errorf("preview %s on %s, want %s on %s", got.Preview.DeploymentID, got.Preview.Host, tt.wantPreview, tt.wantHost)
+			}
+		})
+	}
+}
+
+func TestCompareDeployments(t *testing.T) {
+	base := func() Deployment {
+		deployment := *testDeployment("2", "b")
+		deployment.Draining = []DeploymentInstance{{ContainerID: "a"}}
+		deployment.Canary = &CanaryDeployment{DeploymentID: "3", Instances: []DeploymentInstance{{ContainerID: "c"}}, Weight: 10}
+		return deployment
+	}
+
+	tests := []struct {
+		name        string
+		change      func(d *Deployment)
+		wantUpdated bool
+		wantRouting bool
+	}{
+		{name: "unchanged", change: func(d *Deployment) {}},
+		{name: "new deployment", change: func(d *Deployment) { d.Labels = &config.ContainerLabels{DeploymentID: "4"} }, wantUpdated: true},
+		{name: "instance replaced", change: func(d *Deployment) { d.Instances = []DeploymentInstance{{ContainerID: "b2"}} }, wantUpdated: true},
+		{name: "canary instance added", change: func(d *Deployment) {
+			d.Canary = &CanaryDeployment{DeploymentID: "3", Instances: []DeploymentInstance{{ContainerID: "c"}, {ContainerID: "c2"}}, Weight: 10}
+		}, wantUpdated: true},
+		{name: "draining stopped", change: func(d *Deployment) { d.Draining = nil }, wantRouting: true},
+		{name: "canary weight", change: func(d *Deployment) {
+			d.Canary = &CanaryDeployment{DeploymentID: "3", Instances: []DeploymentInstance{{ContainerID: "c"}}, Weight: 50}
+		}, wantRouting: true},
+		{name: "mirror started", change: func(d *Deployment) { d.Mirror = &MirrorSettings{CandidateDeploymentID: "3"} }, wantRouting: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			current := base()
+			tt.change(&current)
+
+			result := compareDeployments(map[string]Deployment{"app": base()}, map[string]Deployment{"app": current})
+			_, updated := result.UpdatedDeployments["app"]
+			_, routing := result.RoutingChanged["app"]
+			if updated != tt.wantUpdated || routing != tt.wantRouting {
+				t.Errorf("updated %v, routing changed %v, want %v, %v", updated, routing, tt.wantUpdated, tt.wantRouting)
+			}
+			if len(result.AddedDeployments) > 0 || len(result.RemovedDeployments) > 0 {
+				t.Errorf("got added %v, removed %v, want none", result.AddedDeployments, result.RemovedDeployments)
+			}
+		})
+	}
+}
+
+func TestCompareDeploymentsAddedAndRemoved(t *testing.T) {
+	result := compareDeployments(
+		map[string]Deployment{"old": *testDeployment("1", "a"), "kept": *testDeployment("2", "b")},
+		map[string]Deployment{"new": *testDeployment("3", "c"), "kept": *testDeployment("2", "b")},
+	)
+	if _, ok := result.AddedDeployments["new"]; !ok || len(result.AddedDeployments) != 1 {
+		t.Errorf("added %v, want new", result.AddedDeployments)
+	}
+	if _, ok := result.RemovedDeployments["old"]; !ok || len(result.RemovedDeployments) != 1 {
+		t.Errorf("removed %v, want old", result.RemovedDeployments)
+	}
+	if len(result.UpdatedDeployments) > 0 || len(result.RoutingChanged) > 0 {
+		t.Errorf("updated %v, routing changed %v, want none", result.UpdatedDeployments, result.RoutingChanged)
+	}
+}
+
+func TestGetCertificateDomainsPreviewEmail(t *testing.T) {
+	haloydConfig := &config.HaloydConfig{}
+	haloydConfig.Certificates.AcmeEmail = "default@example.com"
+
+	labels := func(appName, email string, domains ...string) *config.ContainerLabels {
+		l := &config.ContainerLabels{AppName: appName, ACMEEmail: email}
+		for _, domain := range domains {
+			l.Domains = append(l.Domains, config.Domain{Canonical: domain})
+		}
+		return l
+	}
+	dm := &DeploymentManager{
+		haloydConfig: haloydConfig,
+		deployments: map[string]Deployment{
+			"alpha": {Labels: labels("alpha", "alpha@example.com", "alpha.example.com")},
+			"beta": {
+				Labels:  labels("beta", "", "beta.example.com"),
+				Preview: &PreviewDeployment{Labels: labels("beta", "preview@example.com", "beta.example.com"), Host: "02.beta.example.com"},
+			},
+			"gamma": {
+				Labels:  labels("gamma", "gamma@example.com", "gamma.example.com"),
+				Preview: &PreviewDeployment{Labels: labels("gamma", "", "gamma.example.com"), Host: "02.gamma.example.com"},
+			},
+		},
+	}
+
+	// Map order varies, the emails must not depend on it.
+	for range 10 {
+		certDomains, err := dm.GetCertificateDomains()
+		if err != nil {
+			t.Fatal(err)
+		}
+		emails := make(map[string]string, len(certDomains))
+		for _, d := range certDomains {
+			emails[d.Canonical] = d.Email
+		}
+		want := map[string]string{
+			"alpha.example.com":    "alpha@example.com",
+			"beta.example.com":     "default@example.com",
+			"02.beta.example.com":  "preview@example.com",
+			"gamma.example.com":    "gamma@example.com",
+			"02.gamma.example.com": "default@example.com",
+		}
+		for domain, email := range want {
+			if emails[domain] != email {
+				t.Errorf("%s has email %q, want %q", domain, emails[domain], email)
+			}
+		}
+		if len(emails) != len(want) {
+			t.Errorf("got domains %v, want %v", emails, want)
+		}
+	}
+}
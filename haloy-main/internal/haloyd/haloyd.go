@@ -20,16 +20,20 @@ import (
 	"github.com/haloydev/haloy/internal/api"
 	"github.com/haloydev/haloy/internal/config"
 	"github.com/haloydev/haloy/internal/constants"
+	"github.com/haloydev/haloy/internal/deploy"
+	"github.com/haloydev/haloy/internal/deploytypes"
 	"github.com/haloydev/haloy/internal/docker"
 	"github.com/haloydev/haloy/internal/helpers"
 	"github.com/haloydev/haloy/internal/logging"
+	"github.com/haloydev/haloy/internal/logship"
 	"github.com/haloydev/haloy/internal/storage"
 )
 
 const (
-	maintenanceInterval = 12 * time.Hour   // Interval for periodic maintenance tasks
-	eventDebounceDelay  = 5 * time.Second  // Delay for debouncing container events
-	updateTimeout       = 15 * time.Minute // Max time for a single update operation
+	maintenanceInterval = 12 * time.Hour     // Interval for periodic maintenance tasks
+	eventDebounceDelay  = 5 * time.Second    // Delay for debouncing container events
+	updateTimeout       = 15 * time.Minute   // Max time for a single update operation
+	orphanedLogAge      = 7 * 24 * time.Hour // Age after which logs of deployments that aren't recorded are removed
 )
 
 type ContainerEvent struct {
@@ -47,8 +51,16 @@ func Run(debug bool) {
 		logLevel = slog.LevelDebug
 	}
 
+	// Keep deployment logs on disk so they can be replayed with 'haloy deploy attach'.
+	// Failures are logged once the logger exists.
+	var deploymentLogStore *logging.DeploymentLogStore
+	logsDataDir, deploymentLogsErr := config.DataDir()
+	if deploymentLogsErr == nil {
+		deploymentLogStore, deploymentLogsErr = logging.NewDeploymentLogStore(filepath.Join(logsDataDir, constants.DeploymentLogsDir))
+	}
+
 	// Allow streaming logs to the API server
-	logBroker := logging.NewLogBroker()
+	logBroker := logging.NewLogBroker(deploymentLogStore)
 	logger := logging.NewLogger(logLevel, logBroker)
 
 	logger.Info("haloyd started",
@@ -56,6 +68,10 @@ func Run(debug bool) {
 		"network", constants.DockerNetwork,
 		"debug", debug)
 
+	if deploymentLogsErr != nil {
+		logger.Warn("Deployment logs will not be stored", "error", deploymentLogsErr)
+	}
+
 	if debug {
 		logger.Info("Debug mode enabled: No changes will be applied to HAProxy. Staging certificates will be used for all domains.")
 	}
@@ -66,12 +82,23 @@ func Run(debug bool) {
 		return
 	}
 	defer db.Close()
-	if err := db.Migrate(); err != nil {
+	migrationReport, err := db.Migrate()
+	if err != nil {
 		logger.Error("Failed to run database migrations", "error", err)
 		return
 	}
+	for _, migration := range migrationReport.Applied {
+		logger.Info("Applied database migration", "version", migration.Version, "name", migration.Name)
+	}
+	if migrationReport.BackupPath != "" {
+		logger.Info("Database backed up before migrating", "path", migrationReport.BackupPath)
+	}
 	logger.Info("Database initialized successfully")
 
+	if deploymentLogStore != nil {
+		removeOrphanedDeploymentLogs(deploymentLogStore, db, logger)
+	}
+
 	dataDir, err := config.DataDir()
 	if err != nil {
 		logger.Error("Failed to get data directory", "error", err)
@@ -95,26 +122,32 @@ func Run(debug bool) {
 	}
 	defer cli.Close()
 
-	apiToken := os.Getenv(constants.EnvVarAPIToken)
-	if apiToken == "" {
-		logging.LogFatal(logger, "%s environment variable not set", constants.EnvVarAPIToken)
+	if haloydConfig != nil && len(haloydConfig.Logging.Sinks) > 0 {
+		shipper, err := logship.New(haloydConfig.Logging.Sinks, dataDir, logger)
+		if err != nil {
+			logging.LogFatal(logger, "Failed to configure log sinks", "error", err)
+		}
+		shipper.Start(ctx, logBroker, cli)
+		defer shipper.Stop()
+		logger.Info("Shipping logs", "sinks", len(haloydConfig.Logging.Sinks))
 	}
 
-	apiServer := api.NewServer(apiToken, logBroker, logLevel)
-	go func() {
-		logger.Info(fmt.Sprintf("Starting API server on :%s...", constants.APIServerPort))
-		if err := apiServer.ListenAndServe(fmt.Sprintf(":%s", constants.APIServerPort)); err != nil && err != http.ErrServerClosed {
-			logging.LogFatal(logger, "API server failed", "error", err)
-		}
-	}()
+	apiTokens, err := config.ReadAPITokens()
+	if err != nil {
+		logging.LogFatal(logger, "Failed to load API token", "error", err)
+	}
 
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 
+	// 'haloyadm api generate-token' sends SIGHUP after rotating the token in the .env file.
+	reloadChan := make(chan os.Signal, 1)
+	signal.Notify(reloadChan, syscall.SIGHUP)
+
 	// Channel for signaling cert updates needing HAProxy reload
 	certUpdateSignal := make(chan string, 5)
 
-	deploymentManager := NewDeploymentManager(cli, haloydConfig)
+	deploymentManager := NewDeploymentManager(cli, db, haloydConfig)
 	certManagerConfig := CertificatesManagerConfig{
 		CertDir:          filepath.Join(dataDir, constants.CertStorageDir),
 		HTTPProviderPort: constants.CertificatesHTTPProviderPort,
@@ -124,15 +157,71 @@ func Run(debug bool) {
 	if err != nil {
 		logging.LogFatal(logger, "Failed to create certificate manager", "error", err)
 	}
-	haproxyManager := NewHAProxyManager(cli, haloydConfig, filepath.Join(dataDir, constants.HAProxyConfigDir), debug)
+	if haloydConfig != nil && haloydConfig.API.RequireClientCert {
+		if err := installClientCA(filepath.Join(dataDir, constants.HAProxyConfigDir), logger); err != nil {
+			logging.LogFatal(logger, "Failed to set up API client certificates", "error", err)
+		}
+	}
+	haproxyManager := NewHAProxyManager(cli, haloydConfig, filepath.Join(dataDir, constants.HAProxyConfigDir), filepath.Join(dataDir, constants.CertStorageDir), debug)
+	haproxyRuntime := NewHAProxyRuntime(filepath.Join(dataDir, constants.HAProxyRuntimeDir, constants.HAProxyMasterSocket))
+	deployQueue := deploy.NewQueue()
 	updaterConfig := UpdaterConfig{
 		Cli:               cli,
 		DeploymentManager: deploymentManager,
 		CertManager:       certManager,
 		HAProxyManager:    haproxyManager,
+		HAProxyRuntime:    haproxyRuntime,
+		DeployQueue:       deployQueue,
+		DB:                db,
+		LogBroker:         logBroker,
 	}
 
 	updater := NewUpdater(updaterConfig)
+
+	apiServer := api.NewServer(apiTokens, logBroker, logLevel, deployQueue)
+	apiServer.SetRoutingController(updater)
+	if haloydConfig != nil && len(haloydConfig.API.JWTIssuers) > 0 {
+		jwtVerifier, err := api.NewJWTVerifier(haloydConfig.API.JWTIssuers)
+		if err != nil {
+			logging.LogFatal(logger, "Failed to configure JWT issuers", "error", err)
+		}
+		apiServer.SetJWTVerifier(jwtVerifier)
+		logger.Info("Accepting JWTs for the API", "issuers", len(haloydConfig.API.JWTIssuers))
+	}
+	if haloydConfig != nil && haloydConfig.API.DisableTCP {
+		logger.Info("API server TCP listener disabled, only serving the Unix socket")
+	} else {
+		go func() {
+			logger.Info(fmt.Sprintf("Starting API server on :%s...", constants.APIServerPort))
+			if err := apiServer.ListenAndServe(fmt.Sprintf(":%s", constants.APIServerPort)); err != nil && err != http.ErrServerClosed {
+				logging.LogFatal(logger, "API server failed", "error", err)
+			}
+		}()
+	}
+
+	go func() {
+		socketPath := filepath.Join(dataDir, constants.APISocketFileName)
+		logger.Info(fmt.Sprintf("Starting API server on %s...", socketPath))
+		if err := apiServer.ListenAndServeUnix(socketPath); err != nil && err != http.ErrServerClosed {
+			logging.LogFatal(logger, "API server failed on Unix socket", "error", err)
+		}
+	}()
+
+	go func() {
+		logger.Info(fmt.Sprintf("Starting waker on :%s...", constants.WakerPort))
+		if err := updater.ListenAndServeWaker(fmt.Sprintf(":%s", constants.WakerPort), logger); err != nil && err != http.ErrServerClosed {
+			logging.LogFatal(logger, "Waker failed", "error", err)
+		}
+	}()
+
+	go func() {
+		logger.Info(fmt.Sprintf("Starting mirror proxy on :%s...", constants.MirrorPort))
+		if err := updater.ListenAndServeMirror(fmt.Sprintf(":%s", constants.MirrorPort), logger); err != nil && err != http.ErrServerClosed {
+			logging.LogFatal(logger, "Mirror proxy failed", "error", err)
+		}
+	}()
+	go updater.recordMirrorResults(ctx, logger)
+
 	if err := updater.Update(ctx, logger, TriggerReasonInitial, nil); err != nil {
 		logger.Error("Initial update failed", "error", err)
 	}
@@ -146,6 +235,8 @@ func Run(debug bool) {
 	errorsChan := make(chan error)
 	go listenForDockerEvents(ctx, cli, eventsChan, errorsChan, logger)
 
+	go updater.watchIdleApps(ctx, logger)
+
 	debouncedEventsChan := make(chan debouncedAppEvent)
 	defer close(debouncedEventsChan)
 
@@ -183,20 +274,64 @@ func Run(debug bool) {
 					return
 				}
 
-				if err := updater.Update(updateCtx, deploymentLogger, TriggerReasonAppUpdated, app); err != nil {
+				// A new deployment can still be cancelled while it is health checked. Cancelling
+				// aborts the whole update, the next event brings the other apps up to date.
+				current, ok := updater.deploymentManager.Deployments()[de.AppName]
+				isNewDeployment := de.CapturedStartEvent && (!ok || current.Labels.DeploymentID != de.DeploymentID)
+				untrack := func() {}
+				if isNewDeployment {
+					updateCtx, untrack = deployQueue.Track(updateCtx, de.DeploymentID)
+				}
+
+				err := updater.Update(updateCtx, deploymentLogger, TriggerReasonAppUpdated, app)
+				untrack()
+				if err != nil {
+					if deploy.Cancelled(updateCtx) {
+						if cleanupErr := deploy.CleanupCancelledDeployment(cli, de.AppName, de.DeploymentID, deploymentLogger); cleanupErr != nil {
+							deploymentLogger.Warn("Failed to clean up cancelled deployment", "error", cleanupErr)
+						}
+						logging.LogDeploymentFailed(deploymentLogger, de.DeploymentID, de.AppName,
+							"Deployment cancelled", deploy.ErrDeploymentCancelled)
+						return
+					}
+					if isNewDeployment {
+						deploy.RecordStatus(de.DeploymentID, deploytypes.DeploymentStatusFailed, err.Error(), deploymentLogger)
+					}
 					logging.LogDeploymentFailed(deploymentLogger, de.DeploymentID, de.AppName,
 						"Deployment failed", err)
 					return
 				}
+				if isNewDeployment {
+					deploy.RecordPhase(de.DeploymentID, deploytypes.DeploymentPhaseHealth, app.healthCheckDuration, deploymentLogger)
+					// Canaries and deployments waiting for promotion go live when promoted.
+					if !updater.isCanaryOrPreview(de.AppName, de.DeploymentID) {
+						deploy.RecordLive(de.DeploymentID, app.routeSwitchDuration, deploymentLogger)
+					}
+				}
 
 				// Start event indicates that this is a new deployment and we'll signal the logger that the deployment is done.
 				if de.CapturedStartEvent {
+					// Waking up a sleeping app starts its containers again, that is not a new deployment.
+					if updater.consumeWake(de.DeploymentID) {
+						return
+					}
+					if preview := updater.deploymentManager.Deployments()[de.AppName].Preview; preview != nil && preview.DeploymentID == de.DeploymentID {
+						logging.LogDeploymentComplete(deploymentLogger, []string{preview.Host}, de.DeploymentID, de.AppName,
+							fmt.Sprintf("Deployed %s without promoting it, run 'haloy promote %s' to switch traffic", de.AppName, de.DeploymentID))
+						return
+					}
 					canonicalDomains := make([]string, len(de.Domains))
 					for i, domain := range de.Domains {
 						canonicalDomains[i] = domain.Canonical
 					}
 					logging.LogDeploymentComplete(deploymentLogger, canonicalDomains, de.DeploymentID, de.AppName,
 						fmt.Sprintf("Successfully deployed %s", de.AppName))
+
+					// Containers restarting later on start events too, their deployment's
+					// observation window is over by then.
+					if isNewDeployment {
+						updater.observeDeployment(ctx, deploymentLogger, de.AppName, de.DeploymentID)
+					}
 				}
 			}()
 
@@ -210,8 +345,7 @@ func Run(debug bool) {
 
 				// Update only needs to apply config, not full build/check
 				// We assume the deployment state triggering the cert update is still valid.
-				currentDeployments := updater.deploymentManager.Deployments()
-				if err := updater.haproxyManager.ApplyConfig(updateCtx, logger, currentDeployments); err != nil {
+				if err := updater.ReapplyConfig(updateCtx, logger); err != nil {
 					logger.Error("Background HAProxy update failed",
 						"reason", "cert update",
 						"domain", domainUpdated,
@@ -233,10 +367,26 @@ func Run(debug bool) {
 					logger.Error("Background update failed", "error", err)
 				}
 			}()
+			if deploymentLogStore != nil {
+				go removeOrphanedDeploymentLogs(deploymentLogStore, db, logger)
+			}
 
 		case err := <-errorsChan:
 			logger.Error("Error from docker events", "error", err)
 
+		case <-reloadChan:
+			apiTokens, err := config.ReadAPITokens()
+			if err != nil {
+				logger.Error("Failed to reload API token, keeping the current one", "error", err)
+				continue
+			}
+			apiServer.SetAPITokens(apiTokens)
+			if apiTokens.PreviousValid(time.Now()) {
+				logger.Info("Reloaded API token", "previousTokenValidUntil", apiTokens.PreviousExpiresAt.Format(time.RFC3339))
+			} else {
+				logger.Info("Reloaded API token")
+			}
+
 		case <-sigChan:
 			logger.Info("Received shutdown signal, stopping haloyd...")
 			if certManager != nil {
@@ -322,3 +472,18 @@ func listenForDockerEvents(ctx context.Context, cli *client.Client, eventsChan c
 		}
 	}
 }
+
+// removeOrphanedDeploymentLogs removes the logs of deployments that aren't recorded. Logs of
+// pruned deployments are removed along with them, this catches those of deployments that never
+// got recorded or whose removal failed.
+func removeOrphanedDeploymentLogs(store *logging.DeploymentLogStore, db *storage.DB, logger *slog.Logger) {
+	removed, err := store.RemoveOrphans(orphanedLogAge, func(deploymentID string) bool {
+		exists, err := db.DeploymentExists(deploymentID)
+		return exists || err != nil
+	})
+	if err != nil {
+		logger.Warn("Failed to remove orphaned deployment logs", "error", err)
+	} else if removed > 0 {
+		logger.Info("Removed orphaned deployment logs", "count", removed)
+	}
+}
@@ -3,10 +3,13 @@ package haloyd
 import (
 	"bytes"
 	"context"
+	"crypto/rand"
 	"fmt"
 	"log/slog"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
 	"text/template"
@@ -15,6 +18,7 @@ import (
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/client"
+	"github.com/haloydev/haloy/internal/clientca"
 	"github.com/haloydev/haloy/internal/config"
 	"github.com/haloydev/haloy/internal/constants"
 	"github.com/haloydev/haloy/internal/embed"
@@ -25,16 +29,24 @@ type HAProxyManager struct {
 	cli          *client.Client
 	haloydConfig *config.HaloydConfig
 	configDir    string
+	certDir      string
 	debug        bool
 	updateMutex  sync.Mutex // Mutex protects config writing and reload signaling
+	// wakeSecret and mirrorSecret are set on the requests HAProxy sends to the waker and the
+	// mirror proxy. They are new on every start, the config is applied again on start anyway.
+	wakeSecret   string
+	mirrorSecret string
 }
 
-func NewHAProxyManager(cli *client.Client, haloydConfig *config.HaloydConfig, configDir string, debug bool) *HAProxyManager {
+func NewHAProxyManager(cli *client.Client, haloydConfig *config.HaloydConfig, configDir, certDir string, debug bool) *HAProxyManager {
 	return &HAProxyManager{
 		cli:          cli,
 		haloydConfig: haloydConfig,
 		configDir:    configDir,
+		certDir:      certDir,
 		debug:        debug,
+		wakeSecret:   rand.Text(),
+		mirrorSecret: rand.Text(),
 	}
 }
 
@@ -59,6 +71,13 @@ func (hpm *HAProxyManager) ApplyConfig(ctx context.Context, logger *slog.Logger,
 		return nil
 	}
 
+	if crtList, ok := hpm.apiCrtList(); ok {
+		crtListPath := filepath.Join(hpm.configDir, constants.HAProxyAPICrtListFileName)
+		if err := os.WriteFile(crtListPath, []byte(crtList), constants.ModeFileDefault); err != nil {
+			return fmt.Errorf("HAProxyManager: failed to write crt-list %s: %w", crtListPath, err)
+		}
+	}
+
 	configPath := filepath.Join(hpm.configDir, constants.HAProxyConfigFileName)
 	logger.Debug("HAProxyManager: Writing config")
 	if err := os.WriteFile(configPath, configBuf.Bytes(), constants.ModeFileDefault); err != nil {
@@ -92,6 +111,7 @@ func (hpm *HAProxyManager) generateConfig(deployments map[string]Deployment) (by
 	var httpsFrontend string
 	var httpsFrontendUseBackend string
 	var backends string
+	var httpsBindOptions string
 	const indent = "    "
 
 	// Add ACLs for api
@@ -109,6 +129,16 @@ func (hpm *HAProxyManager) generateConfig(deployments map[string]Deployment) (by
 		backends += "backend haloy_api\n"
 		backends += fmt.Sprintf("%smode http\n", indent)
 		backends += fmt.Sprintf("%s# Forward to the haloyd API server\n", indent)
+		if hpm.haloydConfig.API.RequireClientCert {
+			// Client certificates are only asked for when the client connects to the API
+			// domain, so the apps' handshakes are left alone. Until the API domain has a
+			// certificate there is no crt-list, and every request to the API is denied.
+			if _, ok := hpm.apiCrtList(); ok {
+				httpsBindOptions = fmt.Sprintf(" crt-list /usr/local/etc/haproxy/%s", constants.HAProxyAPICrtListFileName)
+			}
+			backends += fmt.Sprintf("%s# Only requests with a client certificate issued by haloyd reach the API\n", indent)
+			backends += fmt.Sprintf("%shttp-request deny deny_status 403 unless { ssl_c_used } { ssl_c_verify 0 }\n", indent)
+		}
 		backends += fmt.Sprintf("%shttp-request set-header X-Forwarded-For %%[src]\n", indent)
 		backends += fmt.Sprintf("%shttp-request set-header X-Forwarded-Proto https\n", indent)
 		backends += fmt.Sprintf("%shttp-request set-header X-Forwarded-Port %%[dst_port]\n", indent)
@@ -154,15 +184,73 @@ func (hpm *HAProxyManager) generateConfig(deployments map[string]Deployment) (by
 		}
 
 		if len(canonicalACLs) > 0 {
+			if d.Labels.RoutingSecretHash != "" {
+				frontend, useBackend := deploymentRoutingRules(appName, d, indent)
+				httpsFrontend += frontend
+				httpsFrontendUseBackend += useBackend
+			}
 			httpsFrontendUseBackend += fmt.Sprintf("%suse_backend %s if %s\n", indent, appName, strings.Join(canonicalACLs, " or "))
 		}
+
+		if d.Preview != nil && d.Preview.Host != "" {
+			previewACLName := generateACLName(appName, d.Preview.Host, "preview")
+
+			httpsFrontend += fmt.Sprintf("%sacl %s hdr(host) -i %s\n", indent, previewACLName, d.Preview.Host)
+			httpsFrontendUseBackend += fmt.Sprintf("%suse_backend %s if %s\n", indent, previewBackendName(appName), previewACLName)
+
+			httpFrontend += fmt.Sprintf("%sacl %s hdr(host) -i %s\n", indent, previewACLName, d.Preview.Host)
+			httpFrontend += fmt.Sprintf("%shttp-request redirect code 301 location https://%s%%[path] if %s !is_acme_challenge\n",
+				indent, d.Preview.Host, previewACLName)
+		}
 	}
 
 	for _, d := range deployments {
 		backendName := d.Labels.AppName
 		backends += fmt.Sprintf("backend %s\n", backendName)
-		for i, instance := range d.Instances {
-			backends += fmt.Sprintf("%sserver app%d %s:%s check\n", indent, i+1, instance.IP, instance.Port)
+		if d.Sleeping {
+			backends += fmt.Sprintf("%s# The app is asleep, haloyd starts it and answers the request once it is healthy\n", indent)
+			backends += fmt.Sprintf("%shttp-request set-header %s %s\n", indent, constants.WakeAppHeader, backendName)
+			backends += fmt.Sprintf("%shttp-request set-header %s %s\n", indent, constants.WakeSecretHeader, hpm.wakeSecret)
+			backends += fmt.Sprintf("%stimeout server %ds\n", indent, int((wakeTimeout + time.Minute).Seconds()))
+			backends += fmt.Sprintf("%sserver waker haloyd:%s\n", indent, constants.WakerPort)
+		} else if d.Mirror != nil {
+			backends += fmt.Sprintf("%s# haloyd answers from the live deployment and copies requests to %s\n", indent, d.Mirror.CandidateDeploymentID)
+			backends += fmt.Sprintf("%shttp-request set-header %s %s\n", indent, constants.MirrorAppHeader, backendName)
+			backends += fmt.Sprintf("%shttp-request set-header %s %s\n", indent, constants.MirrorSecretHeader, hpm.mirrorSecret)
+			backends += fmt.Sprintf("%sserver mirror haloyd:%s\n", indent, constants.MirrorPort)
+		} else if d.Canary == nil {
+			for i, instance := range d.Instances {
+				backends += fmt.Sprintf("%sserver app%d %s:%s check\n", indent, i+1, instance.IP, instance.Port)
+			}
+		} else {
+			stableWeight, canaryWeight := canaryServerWeights(len(d.Instances), len(d.Canary.Instances), d.Canary.Weight)
+			for i, instance := range d.Instances {
+				backends += fmt.Sprintf("%sserver app%d %s:%s check weight %d\n", indent, i+1, instance.IP, instance.Port, stableWeight)
+			}
+			for i, instance := range d.Canary.Instances {
+				backends += fmt.Sprintf("%sserver canary%d %s:%s check weight %d\n", indent, i+1, instance.IP, instance.Port, canaryWeight)
+			}
+		}
+		// Instances from older deployments get weight 0 so they finish open
+		// connections without being sent new ones.
+		for i, instance := range d.Draining {
+			backends += fmt.Sprintf("%sserver drain%d %s:%s check weight 0\n", indent, i+1, instance.IP, instance.Port)
+		}
+
+		if d.Labels.RoutingSecretHash != "" && len(d.Labels.Domains) > 0 {
+			for _, id := range slices.Sorted(maps.Keys(d.ByID)) {
+				backends += fmt.Sprintf("backend %s\n", deploymentBackendName(backendName, id))
+				for i, instance := range d.ByID[id] {
+					backends += fmt.Sprintf("%sserver app%d %s:%s check\n", indent, i+1, instance.IP, instance.Port)
+				}
+			}
+		}
+
+		if d.Preview != nil {
+			backends += fmt.Sprintf("backend %s\n", previewBackendName(backendName))
+			for i, instance := range d.Preview.Instances {
+				backends += fmt.Sprintf("%sserver preview%d %s:%s check\n", indent, i+1, instance.IP, instance.Port)
+			}
 		}
 	}
 
@@ -180,6 +268,7 @@ func (hpm *HAProxyManager) generateConfig(deployments map[string]Deployment) (by
 		HTTPFrontend:            httpFrontend,
 		HTTPSFrontend:           httpsFrontend,
 		HTTPSFrontendUseBackend: httpsFrontendUseBackend,
+		HTTPSBindOptions:        httpsBindOptions,
 		Backends:                backends,
 	}
 
@@ -190,6 +279,41 @@ func (hpm *HAProxyManager) generateConfig(deployments map[string]Deployment) (by
 	return buf, nil
 }
 
+// maxServerWeight is the highest server weight HAProxy accepts.
+const maxServerWeight = 256
+
+// canaryServerWeights returns per-server weights for the stable and canary instances so that
+// the canary instances together receive the given percentage of the backend's traffic.
+func canaryServerWeights(stableCount, canaryCount, percent int) (stableWeight, canaryWeight int) {
+	switch {
+	case percent <= 0 || canaryCount == 0:
+		return 1, 0
+	case percent >= 100 || stableCount == 0:
+		return 0, 1
+	}
+
+	// With these weights the canary share is canaryCount*canaryWeight / total = percent/100.
+	stableWeight = (100 - percent) * canaryCount
+	canaryWeight = percent * stableCount
+
+	divisor := gcd(stableWeight, canaryWeight)
+	stableWeight /= divisor
+	canaryWeight /= divisor
+
+	if highest := max(stableWeight, canaryWeight); highest > maxServerWeight {
+		stableWeight = max(1, stableWeight*maxServerWeight/highest)
+		canaryWeight = max(1, canaryWeight*maxServerWeight/highest)
+	}
+	return stableWeight, canaryWeight
+}
+
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
 func (hpm *HAProxyManager) getContainerID(ctx context.Context, logger *slog.Logger) (string, error) {
 	maxRetries := 30
 	retryInterval := time.Second
@@ -233,6 +357,43 @@ func (hpm *HAProxyManager) getContainerID(ctx context.Context, logger *slog.Logg
 		maxRetries)
 }
 
+// deploymentRoutingRules returns the ACLs and use_backend rules that send requests for an app's
+// domains to one of its deployments. HAProxy compares the SHA-256 of the presented secret, so the
+// secret itself never ends up in the config. The rules must come before the app's own use_backend.
+func deploymentRoutingRules(appName string, d Deployment, indent string) (frontend, useBackend string) {
+	hostsACL := fmt.Sprintf("%s_routing_hosts", appName)
+	secretACL := fmt.Sprintf("%s_routing_secret", appName)
+
+	hosts := make([]string, 0, len(d.Labels.Domains))
+	for _, domain := range d.Labels.Domains {
+		hosts = append(hosts, domain.Canonical)
+	}
+	frontend += fmt.Sprintf("%sacl %s hdr(host) -i %s\n", indent, hostsACL, strings.Join(hosts, " "))
+	frontend += fmt.Sprintf("%sacl %s req.hdr(%s),digest(sha256),hex,lower -m str %s\n",
+		indent, secretACL, constants.DeploymentRoutingSecretHeader, d.Labels.RoutingSecretHash)
+	frontend += fmt.Sprintf("%sacl %s req.cook(%s),digest(sha256),hex,lower -m str %s\n",
+		indent, secretACL, constants.DeploymentRoutingSecretCookie, d.Labels.RoutingSecretHash)
+
+	for _, id := range slices.Sorted(maps.Keys(d.ByID)) {
+		requestedACL := fmt.Sprintf("%s_routing_%s", appName, id)
+		frontend += fmt.Sprintf("%sacl %s req.hdr(%s) -i %s\n", indent, requestedACL, constants.DeploymentRoutingHeader, id)
+		frontend += fmt.Sprintf("%sacl %s req.cook(%s) -i %s\n", indent, requestedACL, constants.DeploymentRoutingCookie, id)
+		useBackend += fmt.Sprintf("%suse_backend %s if %s %s %s\n",
+			indent, deploymentBackendName(appName, id), hostsACL, secretACL, requestedACL)
+	}
+	return frontend, useBackend
+}
+
+// deploymentBackendName returns the backend serving a single deployment of an app.
+func deploymentBackendName(appName, deploymentID string) string {
+	return fmt.Sprintf("%s_deployment_%s", appName, deploymentID)
+}
+
+// previewBackendName returns the backend serving an app's deployment that waits for promotion.
+func previewBackendName(appName string) string {
+	return appName + "_preview"
+}
+
 // sanitizeForACL converts a domain name to a safe ACL identifier
 func sanitizeForACL(domain string) string {
 	return strings.ReplaceAll(domain, ".", "_")
@@ -242,3 +403,36 @@ func sanitizeForACL(domain string) string {
 func generateACLName(appName, domain, suffix string) string {
 	return fmt.Sprintf("%s_%s_%s", appName, sanitizeForACL(domain), suffix)
 }
+
+// apiCrtList returns the crt-list that makes HAProxy ask for client certificates on
+// connections to the API domain, and false if the API doesn't require them or the API domain
+// has no certificate yet.
+func (hpm *HAProxyManager) apiCrtList() (string, bool) {
+	if hpm.haloydConfig == nil || !hpm.haloydConfig.API.RequireClientCert || hpm.haloydConfig.API.Domain == "" {
+		return "", false
+	}
+	apiDomain := hpm.haloydConfig.API.Domain
+	certFileName := apiDomain + combinedCertExt
+	if _, err := os.Stat(filepath.Join(hpm.certDir, certFileName)); err != nil {
+		return "", false
+	}
+	return fmt.Sprintf("/usr/local/etc/haproxy-certs/%s [ca-file /usr/local/etc/haproxy/%s verify optional] %s\n",
+		certFileName, constants.HAProxyClientCAFileName, apiDomain), true
+}
+
+// installClientCA gives HAProxy the certificate of the CA API client certificates are issued
+// from, creating the CA if 'haloyadm client-cert create' hasn't yet.
+func installClientCA(haproxyConfigDir string, logger *slog.Logger) error {
+	dir, err := clientca.Dir()
+	if err != nil {
+		return err
+	}
+	ca, created, err := clientca.LoadOrCreate(dir)
+	if err != nil {
+		return err
+	}
+	if created {
+		logger.Info("Created CA for API client certificates", "dir", dir)
+	}
+	return ca.InstallForHAProxy(haproxyConfigDir)
+}
@@ -0,0 +1,225 @@
+package haloyd
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HAProxyRuntime talks to the HAProxy master CLI over its unix socket.
+// The master CLI can route commands to individual worker processes, which lets us
+// observe sessions on old workers that are still finishing requests after a reload.
+type HAProxyRuntime struct {
+	socketPath string
+	timeout    time.Duration
+}
+
+func NewHAProxyRuntime(socketPath string) *HAProxyRuntime {
+	return &HAProxyRuntime{
+		socketPath: socketPath,
+		timeout:    5 * time.Second,
+	}
+}
+
+// Available reports whether the master socket exists. HAProxy containers started
+// by older versions of haloyadm don't expose it.
+func (r *HAProxyRuntime) Available() bool {
+	_, err := os.Stat(r.socketPath)
+	return err == nil
+}
+
+// execute sends a single command and returns the full response.
+// The master CLI closes the connection after answering in non-interactive mode.
+func (r *HAProxyRuntime) execute(ctx context.Context, command string) (string, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "unix", r.socketPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to connect to HAProxy runtime socket: %w", err)
+	}
+	defer conn.Close()
+
+	deadline := time.Now().Add(r.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		return "", fmt.Errorf("failed to set deadline on HAProxy runtime socket: %w", err)
+	}
+
+	if _, err := fmt.Fprintf(conn, "%s\n", command); err != nil {
+		return "", fmt.Errorf("failed to send command '%s': %w", command, err)
+	}
+
+	response, err := io.ReadAll(conn)
+	if err != nil {
+		return "", fmt.Errorf("failed to read response for '%s': %w", command, err)
+	}
+	return string(response), nil
+}
+
+// workerPIDs returns the PIDs of current and old worker processes.
+func (r *HAProxyRuntime) workerPIDs(ctx context.Context) ([]string, error) {
+	output, err := r.execute(ctx, "show proc")
+	if err != nil {
+		return nil, err
+	}
+	return parseWorkerPIDs(output), nil
+}
+
+// ServerStat holds the fields we use from a 'show stat' server row.
+type ServerStat struct {
+	Backend         string
+	Server          string
+	Addr            string
+	CurrentSessions int
+	TotalSessions   int64 // Sessions since the worker started, reset on every reload
+}
+
+// ServerStats returns server stats from all worker processes, including old workers
+// that are still serving connections accepted before the last reload.
+func (r *HAProxyRuntime) ServerStats(ctx context.Context) ([]ServerStat, error) {
+	pids, err := r.workerPIDs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var stats []ServerStat
+	for _, pid := range pids {
+		output, err := r.execute(ctx, fmt.Sprintf("@!%s show stat", pid))
+		if err != nil {
+			return nil, err
+		}
+		workerStats, err := parseServerStats(output)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse stats for worker %s: %w", pid, err)
+		}
+		stats = append(stats, workerStats...)
+	}
+	return stats, nil
+}
+
+// ActiveSessions returns the total number of current sessions to the given
+// addresses (ip:port) in a backend across all workers.
+func (r *HAProxyRuntime) ActiveSessions(ctx context.Context, backend string, addrs []string) (int, error) {
+	stats, err := r.ServerStats(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	wanted := make(map[string]struct{}, len(addrs))
+	for _, addr := range addrs {
+		wanted[addr] = struct{}{}
+	}
+
+	total := 0
+	for _, stat := range stats {
+		if stat.Backend != backend {
+			continue
+		}
+		if _, ok := wanted[stat.Addr]; ok {
+			total += stat.CurrentSessions
+		}
+	}
+	return total, nil
+}
+
+// BackendSessions returns the current and total number of sessions to all servers of a backend,
+// summed over all workers. The total only grows while the same workers run, so any change
+// between two calls means the backend received requests.
+func (r *HAProxyRuntime) BackendSessions(ctx context.Context, backend string) (current int, total int64, err error) {
+	stats, err := r.ServerStats(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	for _, stat := range stats {
+		if stat.Backend == backend {
+			current += stat.CurrentSessions
+			total += stat.TotalSessions
+		}
+	}
+	return current, total, nil
+}
+
+// parseWorkerPIDs extracts worker PIDs from 'show proc' output, e.g.:
+//
+//	#<PID>          <type>          <reloads>       <uptime>        <version>
+//	1               master          1 [failed: 0]   0d00h02m07s     3.2.0
+//	# workers
+//	23              worker          0               0d00h00m03s     3.2.0
+//	# old workers
+//	12              worker          1               0d00h02m07s     3.2.0
+func parseWorkerPIDs(output string) []string {
+	var pids []string
+	for line := range strings.SplitSeq(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if fields[1] == "worker" {
+			pids = append(pids, fields[0])
+		}
+	}
+	return pids
+}
+
+// parseServerStats parses the CSV output of 'show stat' and returns server rows.
+func parseServerStats(output string) ([]ServerStat, error) {
+	output = strings.TrimSpace(output)
+	if output == "" {
+		return nil, nil
+	}
+	output = strings.TrimPrefix(output, "# ")
+
+	reader := csv.NewReader(strings.NewReader(output))
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	columns := make(map[string]int, len(records[0]))
+	for i, name := range records[0] {
+		columns[name] = i
+	}
+	for _, name := range []string{"pxname", "svname", "scur"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("missing column '%s' in stats output", name)
+		}
+	}
+
+	field := func(record []string, name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return record[i]
+	}
+
+	var stats []ServerStat
+	for _, record := range records[1:] {
+		server := field(record, "svname")
+		if server == "" || server == "FRONTEND" || server == "BACKEND" {
+			continue
+		}
+		sessions, _ := strconv.Atoi(field(record, "scur"))
+		totalSessions, _ := strconv.ParseInt(field(record, "stot"), 10, 64)
+		stats = append(stats, ServerStat{
+			Backend:         field(record, "pxname"),
+			Server:          server,
+			Addr:            field(record, "addr"),
+			CurrentSessions: sessions,
+			TotalSessions:   totalSessions,
+		})
+	}
+	return stats, nil
+}
@@ -0,0 +1,94 @@
+package haloyd
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+// Captured from 'show proc' on the master socket after a reload, with an old worker still
+// serving connections.
+const showProcOutput = `#<PID>          <type>          <reloads>       <uptime>        <version>
+1               master          1 [failed: 0]   0d00h12m41s     3.0.5-8e879a5
+# workers
+38              worker          0               0d00h02m07s     3.0.5-8e879a5
+# old workers
+24              worker          1               0d00h12m41s     3.0.5-8e879a5
+# programs
+
+`
+
+// Captured from 'show stat' on a worker serving a single app with two instances.
+const showStatOutput = `# pxname,svname,qcur,qmax,scur,smax,slim,stot,bin,bout,dreq,dresp,ereq,econ,eresp,wretr,wredis,status,weight,act,bck,chkfail,chkdown,lastchg,downtime,qlimit,pid,iid,sid,throttle,lbtot,tracked,type,rate,rate_lim,rate_max,check_status,check_code,check_duration,hrsp_1xx,hrsp_2xx,hrsp_3xx,hrsp_4xx,hrsp_5xx,hrsp_other,hanafail,req_rate,req_rate_max,req_tot,cli_abrt,srv_abrt,comp_in,comp_out,comp_byp,comp_rsp,lastsess,last_chk,last_agt,qtime,ctime,rtime,ttime,agent_status,agent_code,agent_duration,check_desc,agent_desc,check_rise,check_fall,check_health,agent_rise,agent_fall,agent_health,addr,cookie,mode,algo,
+https,FRONTEND,,,3,12,262112,1543,912345,8123456,,,,,,,,OPEN,,,,,,,,,1,2,,,,,0,1,,9,,,,,,,,,,,,,,,,,,,,,,,,,,,,,,,,,,,,,,,,http,,
+web,app1,0,0,2,7,,845,401234,3912345,,,,,,,,UP,1,1,0,0,0,312,0,,1,3,1,,845,,2,0,,5,L4OK,,0,,,,,,,,,,,,,,,,,,,,,,,,,,,,,,,,,,,172.18.0.5:8080,,http,,
+web,app2,0,0,0,6,,698,385012,3801234,,,,,,,,UP,1,1,0,0,0,312,0,,1,3,2,,698,,2,0,,4,L4OK,,0,,,,,,,,,,,,,,,,,,,,,,,,,,,,,,,,,,,172.18.0.6:8080,,http,,
+web,BACKEND,,,2,9,,1543,786246,7713579,,,,,,,,UP,2,2,0,,,312,0,,1,3,0,,1543,,1,,,,,,,,,,,,,,,,,,,,,,,,,,,,,,,,,,,,,,,,,,,http,roundrobin,
+
+`
+
+func TestParseWorkerPIDs(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   []string
+	}{
+		{name: "current and old workers", output: showProcOutput, want: []string{"38", "24"}},
+		{name: "empty", output: "", want: nil},
+		{
+			name:   "only the master",
+			output: "#<PID>          <type>          <reloads>       <uptime>        <version>\n1               master          0 [failed: 0]   0d00h00m03s     3.0.5-8e879a5\n# workers\n",
+			want:   nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseWorkerPIDs(tt.output); !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseServerStats(t *testing.T) {
+	tests := []struct {
+		name    string
+		output  string
+		want    []ServerStat
+		wantErr bool
+	}{
+		{
+			name:   "frontend and backend rows are skipped",
+			output: showStatOutput,
+			want: []ServerStat{
+				{Backend: "web", Server: "app1", Addr: "172.18.0.5:8080", CurrentSessions: 2, TotalSessions: 845},
+				{Backend: "web", Server: "app2", Addr: "172.18.0.6:8080", CurrentSessions: 0, TotalSessions: 698},
+			},
+		},
+		{name: "empty", output: "\n", want: nil},
+		{name: "only the header", output: strings.SplitN(showStatOutput, "\n", 2)[0] + "\n", want: nil},
+		{
+			name:   "optional columns missing",
+			output: "# pxname,svname,scur\nweb,app1,4\n",
+			want:   []ServerStat{{Backend: "web", Server: "app1", CurrentSessions: 4}},
+		},
+		{
+			name:   "short row",
+			output: "# pxname,svname,scur,stot,addr\nweb,app1,1\n",
+			want:   []ServerStat{{Backend: "web", Server: "app1", CurrentSessions: 1}},
+		},
+		{name: "required column missing", output: "# pxname,svname,stot\nweb,app1,12\n", wantErr: true},
+		{name: "malformed CSV", output: "# pxname,svname,scur\nweb,\"app1,1\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseServerStats(tt.output)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
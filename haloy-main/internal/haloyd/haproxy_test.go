@@ -0,0 +1,169 @@
+package haloyd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/haloydev/haloy/internal/config"
+)
+
+func TestGenerateConfigClientCert(t *testing.T) {
+	certDir := t.TempDir()
+	haloydConfig := &config.HaloydConfig{}
+	haloydConfig.API.Domain = "api.example.com"
+	haloydConfig.API.RequireClientCert = true
+	hpm := NewHAProxyManager(nil, haloydConfig, t.TempDir(), certDir, false)
+
+	// Without a certificate for the API domain there is nothing to ask for client
+	// certificates on, and the API denies everything.
+	buf, err := hpm.generateConfig(map[string]Deployment{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := buf.String()
+	if !strings.Contains(cfg, "bind *:443 ssl crt /usr/local/etc/haproxy-certs/ alpn h2,http/1.1\n") {
+		t.Errorf("unexpected bind line without API certificate:\n%s", cfg)
+	}
+	if !strings.Contains(cfg, "http-request deny deny_status 403 unless { ssl_c_used } { ssl_c_verify 0 }") {
+		t.Error("API backend doesn't deny requests without a client certificate")
+	}
+	if _, ok := hpm.apiCrtList(); ok {
+		t.Error("expected no crt-list without API certificate")
+	}
+
+	if err := os.WriteFile(filepath.Join(certDir, "api.example.com.pem"), []byte("cert"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	buf, err = hpm.generateConfig(map[string]Deployment{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg = buf.String()
+	if !strings.Contains(cfg, "bind *:443 ssl crt-list /usr/local/etc/haproxy/api-crt-list.txt crt /usr/local/etc/haproxy-certs/ alpn h2,http/1.1\n") {
+		t.Errorf("unexpected bind line with API certificate:\n%s", cfg)
+	}
+	if strings.Contains(cfg, "ca-file") {
+		t.Error("client certificates are asked for outside the crt-list")
+	}
+	crtList, ok := hpm.apiCrtList()
+	want := "/usr/local/etc/haproxy-certs/api.example.com.pem [ca-file /usr/local/etc/haproxy/client-ca.crt verify optional] api.example.com\n"
+	if !ok || crtList != want {
+		t.Errorf("got crt-list %q, want %q", crtList, want)
+	}
+}
+
+func TestGenerateConfigWithoutClientCert(t *testing.T) {
+	certDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(certDir, "api.example.com.pem"), []byte("cert"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	haloydConfig := &config.HaloydConfig{}
+	haloydConfig.API.Domain = "api.example.com"
+	hpm := NewHAProxyManager(nil, haloydConfig, t.TempDir(), certDir, false)
+
+	buf, err := hpm.generateConfig(map[string]Deployment{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg := buf.String(); strings.Contains(cfg, "ssl crt-list") || strings.Contains(cfg, "ssl_c_used") {
+		t.Errorf("client certificates are asked for although the API doesn't require them:\n%s", cfg)
+	}
+}
+
+func TestGenerateConfigSleepingApp(t *testing.T) {
+	hpm := NewHAProxyManager(nil, &config.HaloydConfig{}, t.TempDir(), t.TempDir(), false)
+	other := NewHAProxyManager(nil, &config.HaloydConfig{}, t.TempDir(), t.TempDir(), false)
+	if hpm.wakeSecret == "" || hpm.wakeSecret == other.wakeSecret {
+		t.Fatalf("wake secrets %q and %q, want distinct secrets", hpm.wakeSecret, other.wakeSecret)
+	}
+
+	buf, err := hpm.generateConfig(map[string]Deployment{
+		"web": {Labels: &config.ContainerLabels{AppName: "web", DeploymentID: "01"}, Sleeping: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := buf.String()
+	for _, want := range []string{
+		"http-request set-header X-Haloy-Wake-App web\n",
+		"http-request set-header X-Haloy-Wake-Secret " + hpm.wakeSecret + "\n",
+		"server waker haloyd:9998\n",
+	} {
+		if !strings.Contains(cfg, want) {
+			t.Errorf("config doesn't contain %q:\n%s", want, cfg)
+		}
+	}
+}
+
+func TestCanaryServerWeights(t *testing.T) {
+	tests := []struct {
+		name                     string
+		stableCount, canaryCount int
+		percent                  int
+		wantStable, wantCanary   int
+	}{
+		{name: "no traffic to canary", stableCount: 2, canaryCount: 1, percent: 0, wantStable: 1, wantCanary: 0},
+		{name: "no canary instances", stableCount: 2, canaryCount: 0, percent: 50, wantStable: 1, wantCanary: 0},
+		{name: "all traffic to canary", stableCount: 2, canaryCount: 1, percent: 100, wantStable: 0, wantCanary: 1},
+		{name: "no stable instances", stableCount: 0, canaryCount: 1, percent: 50, wantStable: 0, wantCanary: 1},
+		{name: "reduced", stableCount: 1, canaryCount: 1, percent: 10, wantStable: 9, wantCanary: 1},
+		{name: "even per server", stableCount: 3, canaryCount: 1, percent: 25, wantStable: 1, wantCanary: 1},
+		{name: "many stable instances", stableCount: 200, canaryCount: 1, percent: 1, wantStable: 99, wantCanary: 200},
+		{name: "scaled to the maximum weight", stableCount: 11, canaryCount: 1, percent: 97, wantStable: 1, wantCanary: maxServerWeight},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stable, canary := canaryServerWeights(tt.stableCount, tt.canaryCount, tt.percent)
+			if stable != tt.wantStable || canary != tt.wantCanary {
+				t.Errorf("got %d, %d, want %d, %d", stable, canary, tt.wantStable, tt.wantCanary)
+			}
+		})
+	}
+}
+
+func TestGCD(t *testing.T) {
+	tests := []struct {
+		a, b, want int
+	}{
+		{12, 18, 6},
+		{18, 12, 6},
+		{7, 0, 7},
+		{0, 5, 5},
+		{13, 7, 1},
+	}
+	for _, tt := range tests {
+		if got := gcd(tt.a, tt.b); got != tt.want {
+			t.Errorf("gcd(%d, %d) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestGenerateConfigMirroredApp(t *testing.T) {
+	hpm := NewHAProxyManager(nil, &config.HaloydConfig{}, t.TempDir(), t.TempDir(), false)
+	if hpm.mirrorSecret == "" || hpm.mirrorSecret == hpm.wakeSecret {
+		t.Fatalf("mirror secret %q, want one distinct from the wake secret", hpm.mirrorSecret)
+	}
+
+	buf, err := hpm.generateConfig(map[string]Deployment{
+		"web": {
+			Labels:  &config.ContainerLabels{AppName: "web", DeploymentID: "01LIVE"},
+			Preview: &PreviewDeployment{DeploymentID: "01CANDIDATE"},
+			Mirror:  &MirrorSettings{CandidateDeploymentID: "01CANDIDATE"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := buf.String()
+	for _, want := range []string{
+		"http-request set-header X-Haloy-Mirror-App web\n",
+		"http-request set-header X-Haloy-Mirror-Secret " + hpm.mirrorSecret + "\n",
+		"server mirror haloyd:9997\n",
+	} {
+		if !strings.Contains(cfg, want) {
+			t.Errorf("config doesn't contain %q:\n%s", want, cfg)
+		}
+	}
+}
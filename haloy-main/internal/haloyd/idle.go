@@ -0,0 +1,122 @@
+package haloyd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/haloydev/haloy/internal/docker"
+	"github.com/haloydev/haloy/internal/storage"
+)
+
+const idleCheckInterval = 30 * time.Second
+
+// appActivity is the last known traffic of an app that has an idle timeout.
+type appActivity struct {
+	deploymentID  string
+	totalSessions int64
+	lastActive    time.Time
+}
+
+// watchIdleApps puts apps to sleep when HAProxy has not seen a request for them in their idle timeout.
+// It needs the HAProxy runtime socket to read session counters, without it apps are never put to sleep.
+func (u *Updater) watchIdleApps(ctx context.Context, logger *slog.Logger) {
+	ticker := time.NewTicker(idleCheckInterval)
+	defer ticker.Stop()
+
+	activity := make(map[string]appActivity)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if u.haproxyRuntime == nil || !u.haproxyRuntime.Available() {
+			continue
+		}
+		u.checkIdleApps(ctx, logger, activity)
+	}
+}
+
+func (u *Updater) checkIdleApps(ctx context.Context, logger *slog.Logger, activity map[string]appActivity) {
+	u.idleMutex.Lock()
+	defer u.idleMutex.Unlock()
+
+	deployments := u.deploymentManager.Deployments()
+
+	// A new deployment, a rollback or 'haloy stop' replaces a sleeping deployment.
+	sleepingApps, err := u.db.ListSleepingApps()
+	if err != nil {
+		logger.Warn("Failed to get sleeping apps", "error", err)
+		return
+	}
+	for appName := range sleepingApps {
+		if d, ok := deployments[appName]; !ok || !d.Sleeping {
+			if err := u.db.DeleteSleepingApp(appName); err != nil {
+				logger.Warn("Failed to delete sleeping app", "app", appName, "error", err)
+			}
+		}
+	}
+
+	now := time.Now()
+	for appName, d := range deployments {
+		idleTimeout, err := time.ParseDuration(d.Labels.IdleTimeout)
+		if err != nil || idleTimeout <= 0 || d.Sleeping || d.Canary != nil || d.Preview != nil || len(d.Draining) > 0 {
+			delete(activity, appName)
+			continue
+		}
+
+		current, total, err := u.haproxyRuntime.BackendSessions(ctx, appName)
+		if err != nil {
+			logger.Warn("Failed to read sessions from HAProxy", "app", appName, "error", err)
+			continue
+		}
+
+		last, seen := activity[appName]
+		if !seen || last.deploymentID != d.Labels.DeploymentID || current > 0 || total != last.totalSessions {
+			activity[appName] = appActivity{deploymentID: d.Labels.DeploymentID, totalSessions: total, lastActive: now}
+			continue
+		}
+		if now.Sub(last.lastActive) < idleTimeout {
+			continue
+		}
+
+		delete(activity, appName)
+		if err := u.sleep(ctx, logger, appName, d.Labels.DeploymentID); err != nil {
+			logger.Error("Failed to put idle app to sleep", "app", appName, "error", err)
+		}
+	}
+
+	for appName := range activity {
+		if _, ok := deployments[appName]; !ok {
+			delete(activity, appName)
+		}
+	}
+}
+
+// sleep points the app at the waker and then stops its containers. The containers are kept,
+// so waking up only has to start them again.
+func (u *Updater) sleep(ctx context.Context, logger *slog.Logger, appName, deploymentID string) error {
+	if err := u.db.SaveSleepingApp(storage.SleepingApp{AppName: appName, DeploymentID: deploymentID}); err != nil {
+		return err
+	}
+	if err := u.ApplyRouting(ctx, logger); err != nil {
+		if deleteErr := u.db.DeleteSleepingApp(appName); deleteErr != nil {
+			logger.Warn("Failed to delete sleeping app", "app", appName, "error", deleteErr)
+		}
+		return err
+	}
+
+	stopCtx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+	defer cancel()
+	stoppedIDs, err := docker.StopDeploymentContainers(stopCtx, u.cli, logger, appName, deploymentID)
+	if err != nil {
+		return fmt.Errorf("failed to stop containers: %w", err)
+	}
+
+	logger.Info(fmt.Sprintf("Put %s to sleep after it was idle, the next request wakes it up", appName),
+		"app", appName, "deploymentID", deploymentID, "stopped_count", len(stoppedIDs))
+	return nil
+}
@@ -0,0 +1,179 @@
+package haloyd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/haloydev/haloy/internal/config"
+	"github.com/haloydev/haloy/internal/constants"
+	"github.com/haloydev/haloy/internal/storage"
+)
+
+// fakeHAProxyRuntime answers the master CLI commands HAProxyRuntime sends with a single worker
+// whose 'show stat' output is stats.
+func fakeHAProxyRuntime(t *testing.T, stats string) *HAProxyRuntime {
+	t.Helper()
+	// Unix socket paths are limited in length, t.TempDir can be too long.
+	dir, err := os.MkdirTemp("", "haproxy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	socketPath := filepath.Join(dir, "master.sock")
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			command, _ := bufio.NewReader(conn).ReadString('\n')
+			switch strings.TrimSpace(command) {
+			case "show proc":
+				io.WriteString(conn, "#<PID>          <type>          <reloads>       <uptime>        <version>\n"+
+					"1               master          0 [failed: 0]   0d00h01m00s     3.2.0\n"+
+					"# workers\n"+
+					"8               worker          0               0d00h01m00s     3.2.0\n")
+			case "@!8 show stat":
+				io.WriteString(conn, stats)
+			}
+			conn.Close()
+		}
+	}()
+	return NewHAProxyRuntime(socketPath)
+}
+
+func openTestDB(t *testing.T) *storage.DB {
+	t.Helper()
+	dataDir := t.TempDir()
+	t.Setenv(constants.EnvVarDataDir, dataDir)
+	if err := os.MkdirAll(filepath.Join(dataDir, constants.DBDir), constants.ModeDirPrivate); err != nil {
+		t.Fatal(err)
+	}
+	db, err := storage.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if _, err := db.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func idleTestDeployment(appName, deploymentID, idleTimeout string) Deployment {
+	return Deployment{
+		Labels:    &config.ContainerLabels{AppName: appName, DeploymentID: deploymentID, IdleTimeout: idleTimeout},
+		Instances: []DeploymentInstance{{ContainerID: appName + "-1"}},
+	}
+}
+
+func TestCheckIdleApps(t *testing.T) {
+	db := openTestDB(t)
+	var stats strings.Builder
+	stats.WriteString("# pxname,svname,qcur,qmax,scur,smax,slim,stot\n")
+	for _, row := range []struct {
+		backend        string
+		current, total int
+	}{
+		{"new", 0, 5}, {"busy", 1, 5}, {"counted", 0, 5}, {"redeployed", 0, 5}, {"quiet", 0, 5},
+	} {
+		fmt.Fprintf(&stats, "%s,app1,0,0,%d,1,,%d\n", row.backend, row.current, row.total)
+		fmt.Fprintf(&stats, "%s,BACKEND,0,0,%d,1,,%d\n", row.backend, row.current, row.total)
+	}
+
+	canary := idleTestDeployment("canary", "02", "10m")
+	canary.Canary = &CanaryDeployment{DeploymentID: "03"}
+	asleep := idleTestDeployment("asleep", "01", "10m")
+	asleep.Sleeping = true
+	u := &Updater{
+		deploymentManager: &DeploymentManager{deployments: map[string]Deployment{
+			"new":        idleTestDeployment("new", "01", "10m"),
+			"busy":       idleTestDeployment("busy", "01", "10m"),
+			"counted":    idleTestDeployment("counted", "01", "10m"),
+			"redeployed": idleTestDeployment("redeployed", "02", "10m"),
+			"quiet":      idleTestDeployment("quiet", "01", "10m"),
+			"always-on":  idleTestDeployment("always-on", "01", ""),
+			"canary":     canary,
+			"asleep":     asleep,
+		}},
+		haproxyRuntime: fakeHAProxyRuntime(t, stats.String()),
+		db:             db,
+	}
+
+	for _, app := range []string{"gone", "always-on", "asleep"} {
+		if err := db.SaveSleepingApp(storage.SleepingApp{AppName: app, DeploymentID: "01"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	hourAgo := time.Now().Add(-time.Hour)
+	minuteAgo := time.Now().Add(-time.Minute)
+	activity := map[string]appActivity{
+		"busy":       {deploymentID: "01", totalSessions: 5, lastActive: hourAgo},
+		"counted":    {deploymentID: "01", totalSessions: 4, lastActive: hourAgo},
+		"redeployed": {deploymentID: "01", totalSessions: 5, lastActive: hourAgo},
+		"quiet":      {deploymentID: "01", totalSessions: 5, lastActive: minuteAgo},
+		"always-on":  {deploymentID: "01", totalSessions: 5, lastActive: hourAgo},
+		"canary":     {deploymentID: "02", totalSessions: 5, lastActive: hourAgo},
+		"removed":    {deploymentID: "01", totalSessions: 5, lastActive: hourAgo},
+	}
+
+	start := time.Now()
+	u.checkIdleApps(t.Context(), slog.New(slog.NewTextHandler(io.Discard, nil)), activity)
+
+	tests := []struct {
+		app          string
+		tracked      bool
+		wantRefresh  bool // lastActive moved to now
+		wantDeployID string
+	}{
+		{app: "new", tracked: true, wantRefresh: true, wantDeployID: "01"},
+		{app: "busy", tracked: true, wantRefresh: true, wantDeployID: "01"},
+		{app: "counted", tracked: true, wantRefresh: true, wantDeployID: "01"},
+		{app: "redeployed", tracked: true, wantRefresh: true, wantDeployID: "02"},
+		{app: "quiet", tracked: true, wantRefresh: false, wantDeployID: "01"},
+		{app: "always-on"},
+		{app: "canary"},
+		{app: "asleep"},
+		{app: "removed"},
+	}
+	for _, tt := range tests {
+		got, tracked := activity[tt.app]
+		if tracked != tt.tracked {
+			t.Errorf("%s tracked: %v, want %v", tt.app, tracked, tt.tracked)
+			continue
+		}
+		if !tracked {
+			continue
+		}
+		if refreshed := !got.lastActive.Before(start); refreshed != tt.wantRefresh {
+			t.Errorf("%s last active refreshed: %v, want %v", tt.app, refreshed, tt.wantRefresh)
+		}
+		if got.deploymentID != tt.wantDeployID || got.totalSessions != 5 {
+			t.Errorf("%s tracked as %s with %d sessions, want %s with 5", tt.app, got.deploymentID, got.totalSessions, tt.wantDeployID)
+		}
+	}
+
+	// Only apps that are still asleep keep their record.
+	sleeping, err := db.ListSleepingApps()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := sleeping["asleep"]; !ok || len(sleeping) != 1 {
+		t.Errorf("sleeping apps %v, want only asleep", sleeping)
+	}
+}
@@ -0,0 +1,289 @@
+package haloyd
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"time"
+
+	"github.com/haloydev/haloy/internal/constants"
+	"github.com/haloydev/haloy/internal/storage"
+)
+
+const (
+	// Requests with larger or unknown sized bodies are answered but not mirrored.
+	maxMirroredBodySize = 1 << 20
+	mirrorTimeout       = 30 * time.Second
+	// Requests are not mirrored while this many copies are in flight, so a slow candidate
+	// can't pile up work in haloyd.
+	maxConcurrentMirrors = 64
+
+	mirrorResultsBuffer        = 1000
+	mirrorResultsBatchSize     = 100
+	mirrorResultsFlushInterval = 5 * time.Second
+)
+
+// StartMirror copies requests for an app to its deployment waiting for promotion until the
+// mirror is stopped or the deployment is promoted. Unless allMethods is set, only GET, HEAD
+// and OPTIONS requests are copied so the candidate doesn't repeat writes.
+func (u *Updater) StartMirror(ctx context.Context, logger *slog.Logger, appName, deploymentID string, allMethods bool) (storage.Mirror, error) {
+	deployment, ok := u.deploymentManager.Deployments()[appName]
+	if !ok || deployment.Preview == nil || deployment.Preview.DeploymentID != deploymentID {
+		return storage.Mirror{}, fmt.Errorf("%w: %s is not running next to the live deployment of %s", ErrPreviewMismatch, deploymentID, appName)
+	}
+
+	mirror := storage.Mirror{
+		AppName:               appName,
+		LiveDeploymentID:      deployment.Labels.DeploymentID,
+		CandidateDeploymentID: deploymentID,
+		AllMethods:            allMethods,
+	}
+	if err := u.db.SaveMirror(mirror); err != nil {
+		return mirror, err
+	}
+	if err := u.ApplyRouting(ctx, logger); err != nil {
+		return mirror, err
+	}
+
+	logger.Info(fmt.Sprintf("Mirroring requests for %s to %s", appName, deploymentID),
+		"app", appName, "liveDeploymentID", mirror.LiveDeploymentID, "allMethods", allMethods)
+	return mirror, nil
+}
+
+// StopMirror stops copying requests for an app. The recorded comparisons are kept for the report.
+func (u *Updater) StopMirror(ctx context.Context, logger *slog.Logger, appName string) error {
+	mirror, err := u.db.GetMirror(appName)
+	if err != nil {
+		return err
+	}
+	if err := u.db.DeleteMirror(appName); err != nil {
+		return err
+	}
+	if err := u.ApplyRouting(ctx, logger); err != nil {
+		return err
+	}
+
+	logger.Info(fmt.Sprintf("Stopped mirroring requests for %s to %s", appName, mirror.CandidateDeploymentID), "app", appName)
+	return nil
+}
+
+// ListenAndServeMirror serves the requests HAProxy sends to apps with a traffic mirror. Each request
+// is answered by the live deployment and a copy is sent to the candidate in the background.
+// Requests without HAProxy's mirror secret are turned away.
+func (u *Updater) ListenAndServeMirror(addr string, logger *slog.Logger) error {
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           u.mirrorHandler(logger),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	return srv.ListenAndServe()
+}
+
+// liveResponse is what the client got for a mirrored request.
+type liveResponse struct {
+	status  int
+	latency time.Duration
+}
+
+func (u *Updater) mirrorHandler(logger *slog.Logger) http.Handler {
+	client := &http.Client{
+		Timeout: mirrorTimeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		appName := r.Header.Get(constants.MirrorAppHeader)
+		secret := r.Header.Get(constants.MirrorSecretHeader)
+		if appName == "" || subtle.ConstantTimeCompare([]byte(secret), []byte(u.haproxyManager.mirrorSecret)) != 1 {
+			http.Error(w, "Not found", http.StatusNotFound)
+			return
+		}
+		r.Header.Del(constants.MirrorAppHeader)
+		r.Header.Del(constants.MirrorSecretHeader)
+
+		deployment, ok := u.deploymentManager.Deployments()[appName]
+		if !ok || len(deployment.Instances) == 0 {
+			http.Error(w, "Service unavailable", http.StatusServiceUnavailable)
+			return
+		}
+
+		var live chan liveResponse
+		if deployment.Mirror != nil && len(deployment.Preview.instances()) > 0 && mirrorable(r, deployment.Mirror.AllMethods) {
+			body, ok := readMirroredBody(r)
+			if ok {
+				select {
+				case u.mirrorSlots <- struct{}{}:
+					live = make(chan liveResponse, 1)
+					candidate := deployment.Preview.Instances[rand.IntN(len(deployment.Preview.Instances))]
+					go u.mirrorRequest(client, logger, r, body, appName, deployment.Mirror.CandidateDeploymentID, candidate, live)
+				default:
+					logger.Debug("Too many mirrored requests in flight, not mirroring", "app", appName)
+				}
+			}
+		}
+
+		instance := deployment.Instances[rand.IntN(len(deployment.Instances))]
+		target := &url.URL{Scheme: "http", Host: net.JoinHostPort(instance.IP, instance.Port)}
+		proxy := &httputil.ReverseProxy{
+			Rewrite: func(pr *httputil.ProxyRequest) {
+				pr.SetURL(target)
+				pr.Out.Host = pr.In.Host
+			},
+		}
+
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		start := time.Now()
+		if live != nil {
+			// The proxy panics with http.ErrAbortHandler when the client goes away mid-response,
+			// and mirrorRequest holds on to its slot until it gets the live response.
+			defer func() {
+				live <- liveResponse{status: recorder.status, latency: time.Since(start)}
+			}()
+		}
+		proxy.ServeHTTP(recorder, r)
+	})
+}
+
+// mirrorRequest sends a copy of the request to a candidate instance, discards the response and
+// records it next to the live response once that is done.
+func (u *Updater) mirrorRequest(client *http.Client, logger *slog.Logger, r *http.Request, body []byte, appName, candidateDeploymentID string, candidate DeploymentInstance, live <-chan liveResponse) {
+	defer func() { <-u.mirrorSlots }()
+
+	result := storage.MirrorResult{
+		AppName:               appName,
+		CandidateDeploymentID: candidateDeploymentID,
+		Method:                r.Method,
+		Path:                  r.URL.Path,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), mirrorTimeout)
+	defer cancel()
+
+	target := "http://" + net.JoinHostPort(candidate.IP, candidate.Port) + r.URL.RequestURI()
+	copied, err := http.NewRequestWithContext(ctx, r.Method, target, bytes.NewReader(body))
+	if err != nil {
+		logger.Debug("Failed to copy request for mirroring", "app", appName, "error", err)
+		<-live
+		return
+	}
+	copied.Header = r.Header.Clone()
+	copied.Header.Set(constants.MirroredRequestHeader, "1")
+	copied.Host = r.Host
+
+	start := time.Now()
+	resp, err := client.Do(copied)
+	if err == nil {
+		_, err = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		result.MirrorStatus = resp.StatusCode
+	}
+	result.MirrorLatencyMs = time.Since(start).Milliseconds()
+	if err != nil {
+		result.Error = err.Error()
+	}
+
+	liveResult := <-live
+	result.LiveStatus = liveResult.status
+	result.LiveLatencyMs = liveResult.latency.Milliseconds()
+	result.CreatedAt = time.Now().UTC()
+
+	select {
+	case u.mirrorResults <- result:
+	default:
+		logger.Debug("Mirror results buffer is full, dropping result", "app", appName)
+	}
+}
+
+// recordMirrorResults writes mirror comparisons to the database in batches.
+func (u *Updater) recordMirrorResults(ctx context.Context, logger *slog.Logger) {
+	ticker := time.NewTicker(mirrorResultsFlushInterval)
+	defer ticker.Stop()
+
+	var batch []storage.MirrorResult
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := u.db.SaveMirrorResults(batch); err != nil {
+			logger.Warn("Failed to save mirror results", "count", len(batch), "error", err)
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			flush()
+			return
+		case result := <-u.mirrorResults:
+			batch = append(batch, result)
+			if len(batch) >= mirrorResultsBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// mirrorable reports whether a request may be copied to the candidate. Upgraded connections like
+// WebSockets are never copied.
+func mirrorable(r *http.Request, allMethods bool) bool {
+	if r.Header.Get("Upgrade") != "" {
+		return false
+	}
+	if allMethods {
+		return true
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	default:
+		return false
+	}
+}
+
+// readMirroredBody buffers the request body so it can be sent twice. It returns false, leaving
+// the body untouched, when the body is too large or its size is unknown.
+func readMirroredBody(r *http.Request) ([]byte, bool) {
+	if r.ContentLength == 0 || r.Body == nil || r.Body == http.NoBody {
+		return nil, true
+	}
+	if r.ContentLength < 0 || r.ContentLength > maxMirroredBodySize {
+		return nil, false
+	}
+
+	body, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return nil, false
+	}
+	return body, true
+}
+
+// statusRecorder remembers the status code written to the client. Unwrap lets the reverse proxy
+// flush streamed responses and hijack upgraded connections.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
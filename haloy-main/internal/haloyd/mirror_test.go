@@ -0,0 +1,222 @@
+package haloyd
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/haloydev/haloy/internal/config"
+	"github.com/haloydev/haloy/internal/constants"
+	"github.com/haloydev/haloy/internal/storage"
+)
+
+func TestMirrorable(t *testing.T) {
+	tests := []struct {
+		method     string
+		upgrade    string
+		allMethods bool
+		want       bool
+	}{
+		{method: http.MethodGet, want: true},
+		{method: http.MethodHead, want: true},
+		{method: http.MethodOptions, want: true},
+		{method: http.MethodPost, want: false},
+		{method: http.MethodDelete, want: false},
+		{method: http.MethodPost, allMethods: true, want: true},
+		{method: http.MethodGet, upgrade: "websocket", want: false},
+		{method: http.MethodGet, upgrade: "websocket", allMethods: true, want: false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, "/", nil)
+		if tt.upgrade != "" {
+			r.Header.Set("Upgrade", tt.upgrade)
+		}
+		if got := mirrorable(r, tt.allMethods); got != tt.want {
+			t.Errorf("mirrorable(%s, upgrade=%q, allMethods=%v) = %v, want %v", tt.method, tt.upgrade, tt.allMethods, got, tt.want)
+		}
+	}
+}
+
+func TestReadMirroredBody(t *testing.T) {
+	t.Run("no body", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		body, ok := readMirroredBody(r)
+		if !ok || body != nil {
+			t.Errorf("got %q, %v, want nil, true", body, ok)
+		}
+	})
+
+	t.Run("small body is readable twice", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("hello"))
+		body, ok := readMirroredBody(r)
+		if !ok || string(body) != "hello" {
+			t.Fatalf("got %q, %v, want hello, true", body, ok)
+		}
+		again, _ := io.ReadAll(r.Body)
+		if string(again) != "hello" {
+			t.Errorf("request body after buffering is %q, want hello", again)
+		}
+	})
+
+	t.Run("unknown size", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("hello"))
+		r.ContentLength = -1
+		if _, ok := readMirroredBody(r); ok {
+			t.Error("bodies of unknown size shouldn't be mirrored")
+		}
+		if rest, _ := io.ReadAll(r.Body); string(rest) != "hello" {
+			t.Errorf("body was consumed: %q left", rest)
+		}
+	})
+
+	t.Run("too large", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(strings.Repeat("x", maxMirroredBodySize+1)))
+		if _, ok := readMirroredBody(r); ok {
+			t.Error("bodies over the limit shouldn't be mirrored")
+		}
+		if rest, _ := io.ReadAll(r.Body); len(rest) != maxMirroredBodySize+1 {
+			t.Errorf("body was consumed: %d bytes left", len(rest))
+		}
+	})
+}
+
+func testInstance(t *testing.T, server *httptest.Server) DeploymentInstance {
+	t.Helper()
+	host, port, err := net.SplitHostPort(strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return DeploymentInstance{IP: host, Port: port}
+}
+
+func TestMirrorHandlerSecret(t *testing.T) {
+	var upstreamHeaders http.Header
+	live := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamHeaders = r.Header.Clone()
+	}))
+	defer live.Close()
+
+	u := &Updater{
+		deploymentManager: &DeploymentManager{deployments: map[string]Deployment{
+			"web": {
+				Labels:    &config.ContainerLabels{AppName: "web", DeploymentID: "01LIVE"},
+				Instances: []DeploymentInstance{testInstance(t, live)},
+			},
+		}},
+		haproxyManager: &HAProxyManager{mirrorSecret: "s3cret"},
+	}
+	mirror := httptest.NewServer(u.mirrorHandler(slog.New(slog.NewTextHandler(io.Discard, nil))))
+	defer mirror.Close()
+
+	tests := []struct {
+		name       string
+		secret     string
+		wantStatus int
+	}{
+		{name: "from HAProxy", secret: "s3cret", wantStatus: http.StatusOK},
+		{name: "without secret", wantStatus: http.StatusNotFound},
+		{name: "wrong secret", secret: "guess", wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstreamHeaders = nil
+			req, _ := http.NewRequest(http.MethodGet, mirror.URL+"/", nil)
+			req.Header.Set(constants.MirrorAppHeader, "web")
+			if tt.secret != "" {
+				req.Header.Set(constants.MirrorSecretHeader, tt.secret)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("got status %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				if upstreamHeaders != nil {
+					t.Error("request was proxied to the app")
+				}
+				return
+			}
+			if upstreamHeaders.Get(constants.MirrorAppHeader) != "" || upstreamHeaders.Get(constants.MirrorSecretHeader) != "" {
+				t.Error("mirror headers were passed on to the app")
+			}
+		})
+	}
+}
+
+// A client hanging up in the middle of the live response must still free the mirror slot.
+func TestMirrorClientDisconnect(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	live := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		io.WriteString(w, "partial")
+		w.(http.Flusher).Flush()
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer live.Close()
+	candidate := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(constants.MirroredRequestHeader) == "" {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer candidate.Close()
+
+	u := &Updater{
+		deploymentManager: &DeploymentManager{deployments: map[string]Deployment{
+			"web": {
+				Labels:    &config.ContainerLabels{AppName: "web", DeploymentID: "01LIVE"},
+				Instances: []DeploymentInstance{testInstance(t, live)},
+				Preview:   &PreviewDeployment{DeploymentID: "01CANDIDATE", Instances: []DeploymentInstance{testInstance(t, candidate)}},
+				Mirror:    &MirrorSettings{CandidateDeploymentID: "01CANDIDATE"},
+			},
+		}},
+		haproxyManager: &HAProxyManager{mirrorSecret: "s3cret"},
+		mirrorSlots:    make(chan struct{}, 1),
+		mirrorResults:  make(chan storage.MirrorResult, 1),
+	}
+	mirror := httptest.NewServer(u.mirrorHandler(slog.New(slog.NewTextHandler(io.Discard, nil))))
+	defer mirror.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, mirror.URL+"/page", nil)
+	req.Header.Set(constants.MirrorAppHeader, "web")
+	req.Header.Set(constants.MirrorSecretHeader, "s3cret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, len("partial"))
+	if _, err := io.ReadFull(resp.Body, buf); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	resp.Body.Close()
+
+	select {
+	case result := <-u.mirrorResults:
+		if result.Path != "/page" || result.MirrorStatus != http.StatusOK || result.LiveStatus != http.StatusOK {
+			t.Errorf("unexpected result %+v", result)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no mirror result recorded after the client disconnected")
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for len(u.mirrorSlots) > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("mirror slot wasn't freed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
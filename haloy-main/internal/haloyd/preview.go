@@ -0,0 +1,47 @@
+package haloyd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+)
+
+// ErrPreviewMismatch is returned when promoting a deployment that is not the one waiting for promotion.
+var ErrPreviewMismatch = errors.New("deployment is not waiting for promotion")
+
+// PromotePreview moves the app's domains to a deployment started with --no-promote in a single
+// HAProxy reload, then drains and stops the previously live deployment.
+func (u *Updater) PromotePreview(ctx context.Context, logger *slog.Logger, appName, deploymentID string) error {
+	preview, err := u.db.GetPreview(appName)
+	if err != nil {
+		return err
+	}
+	if preview.PreviewDeploymentID != deploymentID {
+		return fmt.Errorf("%w: %s is waiting for promotion for %s", ErrPreviewMismatch, preview.PreviewDeploymentID, appName)
+	}
+
+	deployment, ok := u.deploymentManager.Deployments()[appName]
+	if !ok || deployment.Preview == nil || deployment.Preview.DeploymentID != deploymentID {
+		return fmt.Errorf("deployment %s for %s is not running", deploymentID, appName)
+	}
+
+	// Without the preview record the preview is the newest deployment, so it takes over
+	// the app and the live instances are marked as draining.
+	if err := u.db.DeletePreview(appName); err != nil {
+		return err
+	}
+	if err := u.db.DeleteMirror(appName); err != nil {
+		return err
+	}
+	if err := u.switchTo(ctx, logger, appName, deploymentID); err != nil {
+		return err
+	}
+
+	logger.Info(fmt.Sprintf("Promoted deployment %s for %s", deploymentID, appName),
+		"app", appName, "deploymentID", deploymentID)
+
+	// The promotion request ends here, the observer outlives it.
+	go u.observeDeployment(context.WithoutCancel(ctx), logger, appName, deploymentID)
+	return nil
+}
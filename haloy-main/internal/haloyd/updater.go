@@ -6,14 +6,18 @@ import (
 	"log/slog"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/docker/docker/api/types/events"
 	"github.com/docker/docker/client"
 	"github.com/haloydev/haloy/internal/config"
 	"github.com/haloydev/haloy/internal/constants"
+	"github.com/haloydev/haloy/internal/deploy"
 	"github.com/haloydev/haloy/internal/docker"
 	"github.com/haloydev/haloy/internal/helpers"
+	"github.com/haloydev/haloy/internal/logging"
+	"github.com/haloydev/haloy/internal/storage"
 )
 
 type Updater struct {
@@ -21,6 +25,31 @@ type Updater struct {
 	deploymentManager *DeploymentManager
 	certManager       *CertificatesManager
 	haproxyManager    *HAProxyManager
+	haproxyRuntime    *HAProxyRuntime
+	deployQueue       *deploy.Queue
+	db                *storage.DB
+	logBroker         logging.StreamPublisher
+
+	// routingMutex serializes rebuilding the deployments and applying the HAProxy config, so
+	// a config built from an older state can't replace a newer one and new containers are
+	// health checked before anything routes to them.
+	routingMutex sync.Mutex
+
+	// observed holds the deployments being watched for an automatic rollback.
+	observersMutex sync.Mutex
+	observed       map[string]struct{}
+
+	// idleMutex keeps an app from being put to sleep and woken up at the same time.
+	idleMutex sync.Mutex
+	// waking holds the wake-ups in progress by app name, woken the deployments started by them.
+	wakeMutex sync.Mutex
+	waking    map[string]*wakeCall
+	woken     map[string]struct{}
+
+	// mirrorSlots limits the requests being copied to mirror candidates, mirrorResults queues
+	// their comparisons for the database.
+	mirrorSlots   chan struct{}
+	mirrorResults chan storage.MirrorResult
 }
 
 type UpdaterConfig struct {
@@ -28,6 +57,10 @@ type UpdaterConfig struct {
 	DeploymentManager *DeploymentManager
 	CertManager       *CertificatesManager
 	HAProxyManager    *HAProxyManager
+	HAProxyRuntime    *HAProxyRuntime
+	DeployQueue       *deploy.Queue
+	DB                *storage.DB
+	LogBroker         logging.StreamPublisher
 }
 
 func NewUpdater(config UpdaterConfig) *Updater {
@@ -36,6 +69,15 @@ func NewUpdater(config UpdaterConfig) *Updater {
 		deploymentManager: config.DeploymentManager,
 		certManager:       config.CertManager,
 		haproxyManager:    config.HAProxyManager,
+		haproxyRuntime:    config.HAProxyRuntime,
+		deployQueue:       config.DeployQueue,
+		db:                config.DB,
+		logBroker:         config.LogBroker,
+		observed:          make(map[string]struct{}),
+		waking:            make(map[string]*wakeCall),
+		woken:             make(map[string]struct{}),
+		mirrorSlots:       make(chan struct{}, maxConcurrentMirrors),
+		mirrorResults:     make(chan storage.MirrorResult, mirrorResultsBuffer),
 	}
 }
 
@@ -44,6 +86,10 @@ type TriggeredByApp struct {
 	domains           []config.Domain
 	deploymentID      string
 	dockerEventAction events.Action // Action that triggered the update (e.g., "start", "stop", etc.)
+
+	// Set by Update, recorded with new deployments.
+	healthCheckDuration time.Duration
+	routeSwitchDuration time.Duration
 }
 
 func (tba *TriggeredByApp) Validate() error {
@@ -90,10 +136,52 @@ func (r TriggerReason) String() string {
 }
 
 func (u *Updater) Update(ctx context.Context, logger *slog.Logger, reason TriggerReason, app *TriggeredByApp) error {
+	deployments, changed, err := u.updateRouting(ctx, logger, reason, app)
+	if err != nil || !changed {
+		return err
+	}
+
+	// If an app is provided:
+	// - wait for old instances to finish open connections.
+	// - stop old containers, remove and log the result.
+	// - log successful deployment for app.
+	if app != nil {
+		// Events from older deployments being stopped also end up here. Only the deployment
+		// currently serving the app may retire the others.
+		deployment, ok := deployments[app.appName]
+		if ok && deployment.Labels.DeploymentID != app.deploymentID {
+			return nil
+		}
+		if ok {
+			u.drainInstances(ctx, logger, app.appName, deployment.Labels.DrainTimeout, deployment.Draining)
+		}
+
+		stopCtx, cancelStop := context.WithTimeout(ctx, 10*time.Minute)
+		defer cancelStop()
+		_, err := docker.StopContainers(stopCtx, u.cli, logger, app.appName, app.deploymentID)
+		if err != nil {
+			return fmt.Errorf("failed to stop old containers: %w", err)
+		}
+		_, err = docker.RemoveContainers(stopCtx, u.cli, logger, app.appName, app.deploymentID)
+		if err != nil {
+			return fmt.Errorf("failed to remove old containers: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// updateRouting rebuilds the deployments and, if they changed, health checks the new
+// containers, refreshes certificates and applies the HAProxy config. It returns the
+// deployments the config was built from, and false if nothing changed.
+func (u *Updater) updateRouting(ctx context.Context, logger *slog.Logger, reason TriggerReason, app *TriggeredByApp) (map[string]Deployment, bool, error) {
+	u.routingMutex.Lock()
+	defer u.routingMutex.Unlock()
+
 	// Build Deployments and check if anything has changed (Thread-safe)
 	deploymentsHasChanged, excludedContainers, err := u.deploymentManager.BuildDeployments(ctx, logger)
 	if err != nil {
-		return fmt.Errorf("failed to build deployments: %w", err)
+		return nil, false, fmt.Errorf("failed to build deployments: %w", err)
 	}
 
 	logExcludedContainerReasons(excludedContainers, logger)
@@ -102,12 +190,16 @@ func (u *Updater) Update(ctx context.Context, logger *slog.Logger, reason Trigge
 	// We'll still want to continue on the initial update to ensure the API domain is set up correctly.
 	if !deploymentsHasChanged && reason != TriggerReasonInitial {
 		logger.Debug("Updater: No changes detected in deployments, skipping further processing")
-		return nil
+		return nil, false, nil
 	}
 
+	healthCheckStart := time.Now()
 	checkedDeployments, failedContainerIDs := u.deploymentManager.HealthCheckNewContainers(ctx, logger)
+	if app != nil {
+		app.healthCheckDuration = time.Since(healthCheckStart)
+	}
 	if len(failedContainerIDs) > 0 {
-		return fmt.Errorf("deployment aborted: failed to perform health check on containers (%s)", strings.Join(failedContainerIDs, ", "))
+		return nil, false, fmt.Errorf("deployment aborted: failed to perform health check on containers (%s)", strings.Join(failedContainerIDs, ", "))
 	} else {
 		apps := make([]string, 0, len(checkedDeployments))
 		for _, dep := range checkedDeployments {
@@ -130,7 +222,7 @@ func (u *Updater) Update(ctx context.Context, logger *slog.Logger, reason Trigge
 	// Certificates refresh logic based on trigger reason.
 	certDomains, err := u.deploymentManager.GetCertificateDomains()
 	if err != nil {
-		return fmt.Errorf("failed to get certificate domains: %w", err)
+		return nil, false, fmt.Errorf("failed to get certificate domains: %w", err)
 	}
 
 	// If an app is provided we refresh the certs synchronously so we can log the result.
@@ -149,12 +241,12 @@ func (u *Updater) Update(ctx context.Context, logger *slog.Logger, reason Trigge
 			}
 		}
 		if err := u.certManager.RefreshSync(logger, appCertDomains); err != nil {
-			return fmt.Errorf("failed to refresh certificates for app %s: %w", app.appName, err)
+			return nil, false, fmt.Errorf("failed to refresh certificates for app %s: %w", app.appName, err)
 		}
 	} else if reason == TriggerReasonInitial {
 		// Refresh synchronously on initial update so we can log api domain setup.
 		if err := u.certManager.RefreshSync(logger, certDomains); err != nil {
-			return err
+			return nil, false, err
 		}
 	} else {
 		u.certManager.Refresh(logger, certDomains)
@@ -165,28 +257,74 @@ func (u *Updater) Update(ctx context.Context, logger *slog.Logger, reason Trigge
 	}
 
 	// Apply the HAProxy configuration
+	routeSwitchStart := time.Now()
 	if err := u.haproxyManager.ApplyConfig(ctx, logger, deployments); err != nil {
-		return fmt.Errorf("failed to apply HAProxy config for app: %w", err)
+		return nil, false, fmt.Errorf("failed to apply HAProxy config for app: %w", err)
+	}
+	if app != nil {
+		app.routeSwitchDuration = time.Since(routeSwitchStart)
 	}
 	logger.Info("HAProxy configuration applied successfully")
 
-	// If an app is provided:
-	// - stop old containers, remove and log the result.
-	// - log successful deployment for app.
-	if app != nil {
-		stopCtx, cancelStop := context.WithTimeout(ctx, 10*time.Minute)
-		defer cancelStop()
-		_, err := docker.StopContainers(stopCtx, u.cli, logger, app.appName, app.deploymentID)
-		if err != nil {
-			return fmt.Errorf("failed to stop old containers: %w", err)
+	return deployments, true, nil
+}
+
+// drainInstances waits until HAProxy reports no open sessions to the given instances of an app,
+// or until the drain timeout expires. HAProxy no longer sends new requests to these instances,
+// so this only gives in-flight requests and long-lived connections a chance to finish.
+func (u *Updater) drainInstances(ctx context.Context, logger *slog.Logger, appName, drainTimeoutValue string, instances []DeploymentInstance) {
+	if len(instances) == 0 {
+		return
+	}
+
+	if u.haproxyRuntime == nil || !u.haproxyRuntime.Available() {
+		logger.Debug("HAProxy runtime socket not available, skipping connection draining")
+		return
+	}
+
+	drainTimeout, err := time.ParseDuration(drainTimeoutValue)
+	if err != nil {
+		logger.Warn("Invalid drain timeout, skipping connection draining", "drain_timeout", drainTimeoutValue, "error", err)
+		return
+	}
+	if drainTimeout == 0 {
+		return
+	}
+
+	addrs := make([]string, 0, len(instances))
+	for _, instance := range instances {
+		addrs = append(addrs, fmt.Sprintf("%s:%s", instance.IP, instance.Port))
+	}
+
+	drainCtx, cancel := context.WithTimeout(ctx, drainTimeout)
+	defer cancel()
+
+	logger.Info("Draining connections to old instances", "instances", len(addrs), "timeout", drainTimeout.String())
+
+	const pollInterval = time.Second
+	sessions := 0
+	for {
+		select {
+		case <-drainCtx.Done():
+			logger.Warn("Drain timeout reached, stopping old instances with open connections", "sessions", sessions)
+			return
+		case <-time.After(pollInterval):
 		}
-		_, err = docker.RemoveContainers(stopCtx, u.cli, logger, app.appName, app.deploymentID)
+
+		sessions, err = u.haproxyRuntime.ActiveSessions(drainCtx, appName, addrs)
 		if err != nil {
-			return fmt.Errorf("failed to remove old containers: %w", err)
+			if drainCtx.Err() != nil {
+				continue
+			}
+			logger.Warn("Failed to read sessions from HAProxy, skipping connection draining", "error", err)
+			return
+		}
+		if sessions == 0 {
+			logger.Info("Old instances drained")
+			return
 		}
+		logger.Debug("Waiting for connections to drain", "sessions", sessions)
 	}
-
-	return nil
 }
 
 func logExcludedContainerReasons(containers []ExcludedContainerInfo, logger *slog.Logger) {
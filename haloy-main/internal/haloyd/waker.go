@@ -0,0 +1,175 @@
+package haloyd
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/haloydev/haloy/internal/config"
+	"github.com/haloydev/haloy/internal/constants"
+	"github.com/haloydev/haloy/internal/docker"
+	"github.com/haloydev/haloy/internal/helpers"
+)
+
+// wakeTimeout is the maximum time to start a sleeping app and wait for it to become healthy.
+const wakeTimeout = 2 * time.Minute
+
+// wakeCall is a wake-up in progress. Requests that arrive while an app is waking up wait for the same call.
+type wakeCall struct {
+	done chan struct{}
+	err  error
+}
+
+// ListenAndServeWaker serves the requests HAProxy sends to sleeping apps. Each request is held
+// until the app is awake and then proxied to one of its instances. Requests without HAProxy's
+// wake secret are turned away.
+func (u *Updater) ListenAndServeWaker(addr string, logger *slog.Logger) error {
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           u.wakerHandler(logger),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	return srv.ListenAndServe()
+}
+
+func (u *Updater) wakerHandler(logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		appName := r.Header.Get(constants.WakeAppHeader)
+		secret := r.Header.Get(constants.WakeSecretHeader)
+		if appName == "" || subtle.ConstantTimeCompare([]byte(secret), []byte(u.haproxyManager.wakeSecret)) != 1 {
+			http.Error(w, "Not found", http.StatusNotFound)
+			return
+		}
+		r.Header.Del(constants.WakeAppHeader)
+		r.Header.Del(constants.WakeSecretHeader)
+
+		if err := u.WakeApp(r.Context(), logger, appName); err != nil {
+			logger.Error("Failed to wake app", "app", appName, "error", err)
+			http.Error(w, "Service unavailable", http.StatusServiceUnavailable)
+			return
+		}
+
+		deployment, ok := u.deploymentManager.Deployments()[appName]
+		if !ok || len(deployment.Instances) == 0 {
+			http.Error(w, "Service unavailable", http.StatusServiceUnavailable)
+			return
+		}
+
+		// Later requests go straight to the app, this one is forwarded by the waker.
+		instance := deployment.Instances[rand.IntN(len(deployment.Instances))]
+		target := &url.URL{Scheme: "http", Host: net.JoinHostPort(instance.IP, instance.Port)}
+		httputil.NewSingleHostReverseProxy(target).ServeHTTP(w, r)
+	})
+}
+
+// WakeApp starts the containers of a sleeping app and routes its traffic back to them once they
+// are healthy. It returns right away if the app is awake. Concurrent calls for an app share one wake-up.
+func (u *Updater) WakeApp(ctx context.Context, logger *slog.Logger, appName string) error {
+	u.wakeMutex.Lock()
+	call, inProgress := u.waking[appName]
+	if !inProgress {
+		call = &wakeCall{done: make(chan struct{})}
+		u.waking[appName] = call
+
+		// The wake-up outlives the request that started it, so other requests can still use it.
+		go func() {
+			wakeCtx, cancel := context.WithTimeout(context.Background(), wakeTimeout)
+			defer cancel()
+			call.err = u.wake(wakeCtx, logger, appName)
+
+			u.wakeMutex.Lock()
+			delete(u.waking, appName)
+			u.wakeMutex.Unlock()
+			close(call.done)
+		}()
+	}
+	u.wakeMutex.Unlock()
+
+	select {
+	case <-call.done:
+		return call.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (u *Updater) wake(ctx context.Context, logger *slog.Logger, appName string) (err error) {
+	u.idleMutex.Lock()
+	defer u.idleMutex.Unlock()
+
+	deployment, ok := u.deploymentManager.Deployments()[appName]
+	if !ok {
+		return fmt.Errorf("app %s not found", appName)
+	}
+	if !deployment.Sleeping {
+		return nil
+	}
+	deploymentID := deployment.Labels.DeploymentID
+
+	containers, err := docker.GetAppContainers(ctx, u.cli, true, appName)
+	if err != nil {
+		return fmt.Errorf("failed to get containers: %w", err)
+	}
+	var containerIDs []string
+	for _, c := range containers {
+		if c.Labels[config.LabelDeploymentID] == deploymentID {
+			containerIDs = append(containerIDs, c.ID)
+		}
+	}
+	if len(containerIDs) == 0 {
+		return fmt.Errorf("no containers found for deployment %s", deploymentID)
+	}
+
+	logger.Info(fmt.Sprintf("Waking up %s", appName), "app", appName, "deploymentID", deploymentID)
+
+	u.wakeMutex.Lock()
+	u.woken[deploymentID] = struct{}{}
+	u.wakeMutex.Unlock()
+	defer func() {
+		if err != nil {
+			u.consumeWake(deploymentID)
+		}
+	}()
+
+	for _, containerID := range containerIDs {
+		if err := u.cli.ContainerStart(ctx, containerID, container.StartOptions{}); err != nil {
+			return fmt.Errorf("failed to start container %s: %w", helpers.SafeIDPrefix(containerID), err)
+		}
+	}
+	for _, containerID := range containerIDs {
+		if err := docker.HealthCheckContainer(ctx, u.cli, logger, containerID); err != nil {
+			return fmt.Errorf("container %s is not healthy: %w", helpers.SafeIDPrefix(containerID), err)
+		}
+	}
+
+	if err := u.db.DeleteSleepingApp(appName); err != nil {
+		return err
+	}
+	if err := u.ApplyRouting(ctx, logger); err != nil {
+		return err
+	}
+
+	logger.Info(fmt.Sprintf("%s is awake", appName), "app", appName, "deploymentID", deploymentID)
+	return nil
+}
+
+// consumeWake reports whether a deployment was started by waking up its app, so its start event
+// is not reported as a new deployment. Each wake-up is reported once.
+func (u *Updater) consumeWake(deploymentID string) bool {
+	u.wakeMutex.Lock()
+	defer u.wakeMutex.Unlock()
+
+	if _, ok := u.woken[deploymentID]; !ok {
+		return false
+	}
+	delete(u.woken, deploymentID)
+	return true
+}
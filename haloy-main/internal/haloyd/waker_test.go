@@ -0,0 +1,141 @@
+package haloyd
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/haloydev/haloy/internal/config"
+	"github.com/haloydev/haloy/internal/constants"
+)
+
+func newWakerTestUpdater(deployments map[string]Deployment) *Updater {
+	return &Updater{
+		deploymentManager: &DeploymentManager{deployments: deployments},
+		haproxyManager:    &HAProxyManager{wakeSecret: "s3cret"},
+		waking:            make(map[string]*wakeCall),
+		woken:             make(map[string]struct{}),
+	}
+}
+
+func TestWakerHandler(t *testing.T) {
+	var upstreamHeaders http.Header
+	app := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamHeaders = r.Header.Clone()
+		io.WriteString(w, "awake")
+	}))
+	defer app.Close()
+
+	u := newWakerTestUpdater(map[string]Deployment{
+		"web": {
+			Labels:    &config.ContainerLabels{AppName: "web", DeploymentID: "01LIVE"},
+			Instances: []DeploymentInstance{testInstance(t, app)},
+		},
+	})
+	waker := httptest.NewServer(u.wakerHandler(slog.New(slog.NewTextHandler(io.Discard, nil))))
+	defer waker.Close()
+
+	tests := []struct {
+		name       string
+		appName    string
+		secret     string
+		wantStatus int
+	}{
+		{name: "from HAProxy", appName: "web", secret: "s3cret", wantStatus: http.StatusOK},
+		{name: "without secret", appName: "web", wantStatus: http.StatusNotFound},
+		{name: "wrong secret", appName: "web", secret: "guess", wantStatus: http.StatusNotFound},
+		{name: "without app", secret: "s3cret", wantStatus: http.StatusNotFound},
+		{name: "unknown app", appName: "other", secret: "s3cret", wantStatus: http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstreamHeaders = nil
+			req, _ := http.NewRequest(http.MethodGet, waker.URL+"/", nil)
+			if tt.appName != "" {
+				req.Header.Set(constants.WakeAppHeader, tt.appName)
+			}
+			if tt.secret != "" {
+				req.Header.Set(constants.WakeSecretHeader, tt.secret)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("got status %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				if upstreamHeaders != nil {
+					t.Error("request was proxied to the app")
+				}
+				return
+			}
+			if upstreamHeaders.Get(constants.WakeAppHeader) != "" || upstreamHeaders.Get(constants.WakeSecretHeader) != "" {
+				t.Error("waker headers were passed on to the app")
+			}
+		})
+	}
+}
+
+func TestWake(t *testing.T) {
+	u := newWakerTestUpdater(map[string]Deployment{
+		"web": {Labels: &config.ContainerLabels{AppName: "web", DeploymentID: "01LIVE"}},
+	})
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	if err := u.wake(context.Background(), logger, "other"); err == nil {
+		t.Error("expected an error for an unknown app")
+	}
+	// Apps that are awake are left alone.
+	if err := u.wake(context.Background(), logger, "web"); err != nil {
+		t.Errorf("got %v for an app that is awake", err)
+	}
+	if len(u.woken) != 0 {
+		t.Errorf("woken holds %v, want nothing", u.woken)
+	}
+}
+
+func TestWakeAppSharesWakeUp(t *testing.T) {
+	u := newWakerTestUpdater(nil)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	wakeErr := errors.New("failed to start")
+	call := &wakeCall{done: make(chan struct{})}
+	u.waking["web"] = call
+
+	result := make(chan error)
+	go func() { result <- u.WakeApp(context.Background(), logger, "web") }()
+	call.err = wakeErr
+	close(call.done)
+	if err := <-result; !errors.Is(err, wakeErr) {
+		t.Errorf("got %v, want the error of the wake-up in progress", err)
+	}
+
+	// A request that gives up doesn't wait for the wake-up.
+	u.waking["web"] = &wakeCall{done: make(chan struct{})}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := u.WakeApp(ctx, logger, "web"); !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, want context.Canceled", err)
+	}
+}
+
+func TestConsumeWake(t *testing.T) {
+	u := newWakerTestUpdater(nil)
+	u.woken["01LIVE"] = struct{}{}
+
+	if !u.consumeWake("01LIVE") {
+		t.Error("wake-up not reported")
+	}
+	if u.consumeWake("01LIVE") {
+		t.Error("wake-up reported twice")
+	}
+	if u.consumeWake("01OTHER") {
+		t.Error("reported a deployment that wasn't woken")
+	}
+}
@@ -2,11 +2,61 @@ package helpers
 
 import (
 	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/oklog/ulid"
 )
 
+// NewDeploymentID returns a lowercase ULID, so deployment IDs sort by creation time.
+func NewDeploymentID() string {
+	entropy := ulid.Monotonic(rand.New(rand.NewSource(time.Now().UnixNano())), 0)
+	id := ulid.MustNew(ulid.Timestamp(time.Now()), entropy).String()
+	return strings.ToLower(id)
+}
+
+// DeploymentIDAt returns the lowest deployment ID created at t. Deployment IDs created at t
+// or later compare greater or equal.
+func DeploymentIDAt(t time.Time) string {
+	var id ulid.ULID
+	if err := id.SetTime(ulid.Timestamp(t)); err != nil {
+		return ""
+	}
+	return strings.ToLower(id.String())
+}
+
+// ParseLongDuration parses a non-negative duration like "90m" or "24h", or a number of days like "7d".
+func ParseLongDuration(value string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err == nil && n >= 0 {
+			return time.Duration(n) * 24 * time.Hour, nil
+		}
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid duration '%s', use a duration like 24h or a number of days like 7d", value)
+	}
+	return d, nil
+}
+
+// ParseSince parses a point in time given either relative to now, like "90m", "24h" or "7d",
+// or as a date ("2006-01-02") or RFC3339 timestamp.
+func ParseSince(value string, now time.Time) (time.Time, error) {
+	if d, err := ParseLongDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, now.Location()); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time '%s', use a duration like 24h or 7d, a date like 2006-01-02 or an RFC3339 timestamp", value)
+}
+
 // GetTimestampFromDeploymentID extracts time.Time from an ULID
 func GetTimestampFromDeploymentID(deploymentID string) (time.Time, error) {
 	parsedULID, err := ulid.Parse(deploymentID)
@@ -1,6 +1,8 @@
 package helpers
 
 import (
+	"math/rand"
+	"strings"
 	"testing"
 	"time"
 
@@ -186,3 +188,75 @@ func (e *simpleEntropy) Read(p []byte) (n int, err error) {
 	}
 	return len(p), nil
 }
+
+func TestDeploymentIDAt(t *testing.T) {
+	at := time.Date(2025, 6, 15, 21, 43, 4, 0, time.UTC)
+
+	before := strings.ToLower(ulid.MustNew(ulid.Timestamp(at.Add(-time.Millisecond)), ulid.Monotonic(rand.New(rand.NewSource(1)), 0)).String())
+	same := strings.ToLower(ulid.MustNew(ulid.Timestamp(at), ulid.Monotonic(rand.New(rand.NewSource(1)), 0)).String())
+	after := strings.ToLower(ulid.MustNew(ulid.Timestamp(at.Add(time.Second)), ulid.Monotonic(rand.New(rand.NewSource(1)), 0)).String())
+
+	bound := DeploymentIDAt(at)
+	assert.Less(t, before, bound)
+	assert.GreaterOrEqual(t, same, bound)
+	assert.Greater(t, after, bound)
+}
+
+func TestParseSince(t *testing.T) {
+	now := time.Date(2025, 6, 15, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		value   string
+		want    time.Time
+		wantErr bool
+	}{
+		{name: "duration", value: "90m", want: now.Add(-90 * time.Minute)},
+		{name: "days", value: "7d", want: now.Add(-7 * 24 * time.Hour)},
+		{name: "date", value: "2025-06-01", want: time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)},
+		{name: "rfc3339", value: "2025-06-01T08:30:00Z", want: time.Date(2025, 6, 1, 8, 30, 0, 0, time.UTC)},
+		{name: "negative_duration", value: "-1h", wantErr: true},
+		{name: "garbage", value: "yesterday", wantErr: true},
+		{name: "empty", value: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseSince(tt.value, now)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.True(t, tt.want.Equal(got), "got %s, want %s", got, tt.want)
+		})
+	}
+}
+
+func TestParseLongDuration(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{value: "45s", want: 45 * time.Second},
+		{value: "24h", want: 24 * time.Hour},
+		{value: "30d", want: 30 * 24 * time.Hour},
+		{value: "0d", want: 0},
+		{value: "-2d", wantErr: true},
+		{value: "d", wantErr: true},
+		{value: "1w", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseLongDuration(tt.value)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
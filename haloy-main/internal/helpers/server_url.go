@@ -2,12 +2,35 @@ package helpers
 
 import (
 	"fmt"
+	"net"
 	"net/url"
+	"strconv"
 	"strings"
+
+	"github.com/haloydev/haloy/internal/constants"
 )
 
-// NormalizeServerURL strips protocol and normalizes the server URL for storage
+// sshScheme marks servers the CLI reaches by tunneling to haloyd over SSH instead of HTTPS.
+const sshScheme = "ssh://"
+
+// NormalizeServerURL strips protocol and normalizes the server URL for storage.
+// SSH URLs keep their scheme and user, like ssh://deploy@example.com:2222.
 func NormalizeServerURL(rawURL string) (string, error) {
+	if IsSSHServerURL(rawURL) {
+		user, host, port, err := ParseSSHServerURL(rawURL)
+		if err != nil {
+			return "", err
+		}
+		normalized := sshScheme
+		if user != "" {
+			normalized += user + "@"
+		}
+		if port != 0 {
+			return normalized + net.JoinHostPort(host, strconv.Itoa(port)), nil
+		}
+		return normalized + host, nil
+	}
+
 	// If no protocol specified, assume https://
 	if !strings.Contains(rawURL, "://") {
 		rawURL = "https://" + rawURL
@@ -21,8 +44,43 @@ func NormalizeServerURL(rawURL string) (string, error) {
 	return parsed.Host, nil
 }
 
+// IsSSHServerURL reports whether the server is reached over SSH.
+func IsSSHServerURL(serverURL string) bool {
+	return strings.HasPrefix(serverURL, sshScheme)
+}
+
+// ParseSSHServerURL returns the parts of an ssh:// server URL. User and port are empty if
+// the URL doesn't set them.
+func ParseSSHServerURL(serverURL string) (user, host string, port int, err error) {
+	parsed, err := url.Parse(serverURL)
+	if err != nil {
+		return "", "", 0, fmt.Errorf("invalid SSH URL: %w", err)
+	}
+	if parsed.Scheme != "ssh" || parsed.Hostname() == "" {
+		return "", "", 0, fmt.Errorf("invalid SSH URL '%s', expected ssh://user@host[:port]", serverURL)
+	}
+	if (parsed.Path != "" && parsed.Path != "/") || parsed.RawQuery != "" {
+		return "", "", 0, fmt.Errorf("invalid SSH URL '%s', expected ssh://user@host[:port]", serverURL)
+	}
+	if _, hasPassword := parsed.User.Password(); hasPassword {
+		return "", "", 0, fmt.Errorf("SSH URL '%s' must not contain a password", serverURL)
+	}
+	if p := parsed.Port(); p != "" {
+		port, err = strconv.Atoi(p)
+		if err != nil || port < 1 || port > 65535 {
+			return "", "", 0, fmt.Errorf("invalid port in SSH URL '%s'", serverURL)
+		}
+	}
+	return parsed.User.Username(), parsed.Hostname(), port, nil
+}
+
 // BuildServerURL constructs the full URL for API calls
 func BuildServerURL(normalizedURL string) string {
+	// Requests to SSH servers are tunneled to the API on the server itself, the address only
+	// ends up in the Host header.
+	if IsSSHServerURL(normalizedURL) {
+		return "http://" + net.JoinHostPort("127.0.0.1", constants.APIServerPort)
+	}
 	// Default to HTTPS for API calls
 	if strings.Contains(normalizedURL, "localhost") || strings.Contains(normalizedURL, "127.0.0.1") {
 		return "http://" + normalizedURL
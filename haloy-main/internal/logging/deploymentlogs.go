@@ -0,0 +1,251 @@
+package logging
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	deploymentLogExt = ".jsonl"
+	// maxDeploymentLogSize is how large a deployment's log grows before it is rotated. One
+	// rotated file is kept, so a deployment takes at most twice this.
+	maxDeploymentLogSize = 10 * 1024 * 1024
+	// lastEntryChunkSize is how much of a log is read at a time when looking for its last entry.
+	lastEntryChunkSize = 64 * 1024
+)
+
+// DeploymentLogStore keeps the log of every deployment on disk as one JSON lines file per
+// deployment, so a deployment's log can be replayed after its stream is gone. Logs are removed
+// along with the deployment's history.
+type DeploymentLogStore struct {
+	dir   string
+	mutex sync.Mutex
+}
+
+func NewDeploymentLogStore(dir string) (*DeploymentLogStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create deployment log directory: %w", err)
+	}
+	return &DeploymentLogStore{dir: dir}, nil
+}
+
+// Append adds an entry to the log of its deployment.
+func (s *DeploymentLogStore) Append(entry LogEntry) error {
+	path, err := s.path(entry.DeploymentID)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal log entry: %w", err)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if info, err := os.Stat(path); err == nil && info.Size()+int64(len(data)) >= maxDeploymentLogSize {
+		// Replaces the file rotated before, a deployment logging this much is stuck in a loop
+		// and what it logged last tells most.
+		if err := os.Rename(path, path+".1"); err != nil {
+			return fmt.Errorf("failed to rotate deployment log: %w", err)
+		}
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_RDWR, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open deployment log: %w", err)
+	}
+	line := append(data, '\n')
+	// A line cut short by a crash gets its own line, so the entry written now stays readable.
+	if info, err := f.Stat(); err == nil && info.Size() > 0 {
+		last := make([]byte, 1)
+		if _, err := f.ReadAt(last, info.Size()-1); err == nil && last[0] != '\n' {
+			line = append([]byte{'\n'}, line...)
+		}
+	}
+	if _, err := f.Write(line); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write deployment log: %w", err)
+	}
+	return f.Close()
+}
+
+// Read returns the stored log of a deployment, oldest entry first. A deployment that hasn't
+// logged anything yet has an empty log.
+func (s *DeploymentLogStore) Read(deploymentID string) ([]LogEntry, error) {
+	path, err := s.path(deploymentID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var entries []LogEntry
+	for _, file := range []string{path + ".1", path} {
+		fileEntries, err := readDeploymentLog(file)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, fileEntries...)
+	}
+	return entries, nil
+}
+
+// LastSeq returns the Seq of the last stored entry of a deployment, 0 if it has none. Only
+// the end of the log is read.
+func (s *DeploymentLogStore) LastSeq(deploymentID string) (uint64, error) {
+	path, err := s.path(deploymentID)
+	if err != nil {
+		return 0, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, file := range []string{path, path + ".1"} {
+		entry, found, err := lastDeploymentLogEntry(file)
+		if err != nil || found {
+			return entry.Seq, err
+		}
+	}
+	return 0, nil
+}
+
+// Remove deletes the log of a deployment.
+func (s *DeploymentLogStore) Remove(deploymentID string) error {
+	path, err := s.path(deploymentID)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, file := range []string{path, path + ".1"} {
+		if err := os.Remove(file); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove deployment log: %w", err)
+		}
+	}
+	return nil
+}
+
+// RemoveOrphans deletes the logs that haven't been written to for olderThan and whose
+// deployment isn't kept, like those of deployments that failed before they were recorded.
+// It returns the number of deployments whose logs were removed.
+func (s *DeploymentLogStore) RemoveOrphans(olderThan time.Duration, keep func(deploymentID string) bool) (int, error) {
+	files, err := os.ReadDir(s.dir)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read deployment log directory: %w", err)
+	}
+
+	removed := 0
+	for _, file := range files {
+		deploymentID, ok := strings.CutSuffix(file.Name(), deploymentLogExt)
+		if !ok || file.IsDir() {
+			continue
+		}
+		info, err := file.Info()
+		if err != nil || time.Since(info.ModTime()) < olderThan || keep(deploymentID) {
+			continue
+		}
+		if err := s.Remove(deploymentID); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+func readDeploymentLog(path string) ([]LogEntry, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to open deployment log: %w", err)
+	}
+	defer f.Close()
+
+	var entries []LogEntry
+	// Lines aren't limited in length, the file's size is.
+	reader := bufio.NewReader(f)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			var entry LogEntry
+			// A line cut short by a crash is skipped, the rest of the log is still useful.
+			if json.Unmarshal(line, &entry) == nil {
+				entries = append(entries, entry)
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return entries, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to read deployment log: %w", err)
+		}
+	}
+}
+
+// lastDeploymentLogEntry returns the last complete entry of a log file. It reads backwards
+// from the end, a chunk at a time, until it has a whole line that parses.
+func lastDeploymentLogEntry(path string) (LogEntry, bool, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return LogEntry{}, false, nil
+	} else if err != nil {
+		return LogEntry{}, false, fmt.Errorf("failed to open deployment log: %w", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return LogEntry{}, false, fmt.Errorf("failed to read deployment log: %w", err)
+	}
+
+	end := info.Size()
+	var tail []byte
+	for end > 0 {
+		chunk := min(end, lastEntryChunkSize)
+		buf := make([]byte, chunk, chunk+int64(len(tail)))
+		if _, err := f.ReadAt(buf, end-chunk); err != nil {
+			return LogEntry{}, false, fmt.Errorf("failed to read deployment log: %w", err)
+		}
+		end -= chunk
+		tail = append(buf, tail...)
+
+		// The first line of the tail may be cut off unless the tail starts the file.
+		lines := bytes.Split(tail, []byte("\n"))
+		first := 1
+		if end == 0 {
+			first = 0
+		}
+		for i := len(lines) - 1; i >= first; i-- {
+			var entry LogEntry
+			// A line cut short by a crash is skipped, like when the log is read.
+			if len(lines[i]) > 0 && json.Unmarshal(lines[i], &entry) == nil {
+				return entry, true, nil
+			}
+		}
+		// Only the first line can still grow, the others need not be parsed again.
+		tail = lines[0]
+	}
+	return LogEntry{}, false, nil
+}
+
+// path returns the log file of a deployment. Deployment IDs come from clients, so anything
+// that could escape the log directory is rejected.
+func (s *DeploymentLogStore) path(deploymentID string) (string, error) {
+	if deploymentID == "" || filepath.Base(deploymentID) != deploymentID || deploymentID == "." || deploymentID == ".." {
+		return "", fmt.Errorf("invalid deployment ID '%s'", deploymentID)
+	}
+	return filepath.Join(s.dir, deploymentID+deploymentLogExt), nil
+}
@@ -0,0 +1,298 @@
+package logging
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestStore(t *testing.T) (*DeploymentLogStore, string) {
+	t.Helper()
+	dir := t.TempDir()
+	store, err := NewDeploymentLogStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store, dir
+}
+
+func TestDeploymentLogPath(t *testing.T) {
+	store, dir := newTestStore(t)
+
+	tests := []struct {
+		deploymentID string
+		wantErr      bool
+	}{
+		{deploymentID: "01JDEPLOY", wantErr: false},
+		{deploymentID: "", wantErr: true},
+		{deploymentID: ".", wantErr: true},
+		{deploymentID: "..", wantErr: true},
+		{deploymentID: "../escape", wantErr: true},
+		{deploymentID: "nested/id", wantErr: true},
+		{deploymentID: "/etc/passwd", wantErr: true},
+	}
+	for _, tt := range tests {
+		path, err := store.path(tt.deploymentID)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("path(%q) error = %v, want error %v", tt.deploymentID, err, tt.wantErr)
+			continue
+		}
+		if err == nil && filepath.Dir(path) != dir {
+			t.Errorf("path(%q) = %s, outside %s", tt.deploymentID, path, dir)
+		}
+	}
+
+	// Every operation rejects them.
+	if err := store.Append(LogEntry{DeploymentID: "../escape"}); err == nil {
+		t.Error("Append accepted an invalid deployment ID")
+	}
+	if _, err := store.Read("../escape"); err == nil {
+		t.Error("Read accepted an invalid deployment ID")
+	}
+	if err := store.Remove("../escape"); err == nil {
+		t.Error("Remove accepted an invalid deployment ID")
+	}
+}
+
+func TestAppendAndRead(t *testing.T) {
+	store, dir := newTestStore(t)
+
+	if entries, err := store.Read("d1"); err != nil || len(entries) != 0 {
+		t.Errorf("got %v, %v for a deployment without log, want nothing", entries, err)
+	}
+
+	timestamp := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	written := []LogEntry{
+		{Level: "INFO", Message: "Pulling image", Timestamp: timestamp, Seq: 1, DeploymentID: "d1", AppName: "web"},
+		{Level: "INFO", Message: "Deployed", Timestamp: timestamp, Seq: 2, DeploymentID: "d1", AppName: "web",
+			Domains: []string{"example.com"}, IsDeploymentComplete: true, IsDeploymentSuccess: true},
+		{Level: "INFO", Message: "Other deployment", Timestamp: timestamp, Seq: 1, DeploymentID: "d2"},
+	}
+	for _, entry := range written {
+		if err := store.Append(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err := store.Read("d1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(entries))
+	}
+	for i, entry := range entries {
+		want := written[i]
+		if entry.Message != want.Message || entry.Seq != want.Seq || !entry.Timestamp.Equal(want.Timestamp) ||
+			entry.IsDeploymentComplete != want.IsDeploymentComplete || len(entry.Domains) != len(want.Domains) {
+			t.Errorf("entry %d is %+v, want %+v", i, entry, want)
+		}
+	}
+
+	info, err := os.Stat(filepath.Join(dir, "d1"+deploymentLogExt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0o600 {
+		t.Errorf("log file mode is %o, want 600", mode)
+	}
+}
+
+func TestReadSkipsTruncatedLine(t *testing.T) {
+	store, dir := newTestStore(t)
+	path := filepath.Join(dir, "d1"+deploymentLogExt)
+
+	if err := store.Append(LogEntry{DeploymentID: "d1", Seq: 1, Message: "before"}); err != nil {
+		t.Fatal(err)
+	}
+	// Like haloyd crashing in the middle of a write, and appending again after it restarted.
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"level":"INFO","message":"cut`)
+	f.Close()
+	if err := store.Append(LogEntry{DeploymentID: "d1", Seq: 2, Message: "after"}); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := store.Read("d1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Message != "before" || entries[1].Message != "after" {
+		t.Errorf("got %+v, want the entries before and after the truncated line", entries)
+	}
+}
+
+func TestLastSeq(t *testing.T) {
+	store, dir := newTestStore(t)
+
+	if seq, err := store.LastSeq("d1"); err != nil || seq != 0 {
+		t.Errorf("got %d, %v for a deployment without log, want 0", seq, err)
+	}
+
+	// Lines longer than what is read at a time.
+	long := strings.Repeat("x", 3*lastEntryChunkSize)
+	for seq := uint64(1); seq <= 3; seq++ {
+		if err := store.Append(LogEntry{DeploymentID: "d1", Seq: seq, Message: long}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if seq, err := store.LastSeq("d1"); err != nil || seq != 3 {
+		t.Errorf("got %d, %v, want 3", seq, err)
+	}
+
+	// A line cut short by a crash is skipped.
+	f, err := os.OpenFile(filepath.Join(dir, "d1"+deploymentLogExt), os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"level":"INFO","message":"cut`)
+	f.Close()
+	if seq, err := store.LastSeq("d1"); err != nil || seq != 3 {
+		t.Errorf("got %d, %v with a truncated last line, want 3", seq, err)
+	}
+}
+
+func TestLastSeqInRotatedLog(t *testing.T) {
+	store, dir := newTestStore(t)
+	if err := store.Append(LogEntry{DeploymentID: "d1", Seq: 7}); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "d1"+deploymentLogExt)
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	if seq, err := store.LastSeq("d1"); err != nil || seq != 7 {
+		t.Errorf("got %d, %v, want 7 from the rotated log", seq, err)
+	}
+}
+
+func TestAppendRotatesLog(t *testing.T) {
+	store, dir := newTestStore(t)
+	path := filepath.Join(dir, "d1"+deploymentLogExt)
+
+	// Each entry takes a bit more than a tenth of the maximum size, so the log is rotated twice.
+	message := strings.Repeat("x", maxDeploymentLogSize/10)
+	for seq := uint64(1); seq <= 21; seq++ {
+		if err := store.Append(LogEntry{DeploymentID: "d1", Seq: seq, Message: message}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, file := range []string{path, path + ".1"} {
+		info, err := os.Stat(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size() >= maxDeploymentLogSize {
+			t.Errorf("%s is %d bytes, want less than %d", filepath.Base(file), info.Size(), maxDeploymentLogSize)
+		}
+	}
+
+	// The second rotation replaced the first rotated file, the oldest entries are gone.
+	entries, err := store.Read("d1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) == 0 || len(entries) >= 21 {
+		t.Fatalf("got %d entries, want some of the oldest dropped", len(entries))
+	}
+	for i, entry := range entries {
+		if want := uint64(21 - len(entries) + 1 + i); entry.Seq != want {
+			t.Errorf("entry %d has seq %d, want %d", i, entry.Seq, want)
+		}
+	}
+}
+
+func TestReadAcrossRotatedLog(t *testing.T) {
+	store, dir := newTestStore(t)
+	path := filepath.Join(dir, "d1"+deploymentLogExt)
+
+	for seq := uint64(1); seq <= 2; seq++ {
+		if err := store.Append(LogEntry{DeploymentID: "d1", Seq: seq}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Append(LogEntry{DeploymentID: "d1", Seq: 3}); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := store.Read("d1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("got %d entries, want 3", len(entries))
+	}
+	for i, entry := range entries {
+		if entry.Seq != uint64(i+1) {
+			t.Errorf("entry %d has seq %d, want %d", i, entry.Seq, i+1)
+		}
+	}
+
+	if err := store.Remove("d1"); err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range []string{path, path + ".1"} {
+		if _, err := os.Stat(file); !os.IsNotExist(err) {
+			t.Errorf("%s not removed", filepath.Base(file))
+		}
+	}
+}
+
+func TestRemoveOrphans(t *testing.T) {
+	store, dir := newTestStore(t)
+
+	old := time.Now().Add(-2 * time.Hour)
+	for _, id := range []string{"recorded", "orphaned", "recent"} {
+		if err := store.Append(LogEntry{DeploymentID: id, Seq: 1}); err != nil {
+			t.Fatal(err)
+		}
+		if id != "recent" {
+			if err := os.Chtimes(filepath.Join(dir, id+deploymentLogExt), old, old); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	// Rotated files go with the deployment's log, on their own they are left alone.
+	if err := os.WriteFile(filepath.Join(dir, "orphaned"+deploymentLogExt+".1"), nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "other.txt"), nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	removed, err := store.RemoveOrphans(time.Hour, func(deploymentID string) bool {
+		return deploymentID == "recorded"
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 1 {
+		t.Errorf("removed %d logs, want 1", removed)
+	}
+
+	tests := []struct {
+		file string
+		kept bool
+	}{
+		{"recorded" + deploymentLogExt, true},
+		{"recent" + deploymentLogExt, true},
+		{"orphaned" + deploymentLogExt, false},
+		{"orphaned" + deploymentLogExt + ".1", false},
+		{"other.txt", true},
+	}
+	for _, tt := range tests {
+		_, err := os.Stat(filepath.Join(dir, tt.file))
+		if kept := err == nil; kept != tt.kept {
+			t.Errorf("%s kept: %v, want %v", tt.file, kept, tt.kept)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"slices"
 	"sync"
 	"time"
 )
@@ -13,6 +14,7 @@ type LogEntry struct {
 	Level                string         `json:"level"`
 	Message              string         `json:"message"`
 	Timestamp            time.Time      `json:"timestamp"`
+	Seq                  uint64         `json:"seq,omitempty"` // Position in the deployment's log, starting at 1
 	DeploymentID         string         `json:"deploymentID,omitempty"`
 	AppName              string         `json:"appName,omitempty"`
 	Domains              []string       `json:"domains,omitempty"`
@@ -30,8 +32,13 @@ type StreamPublisher interface {
 	SubscribeGeneral() (<-chan LogEntry, string)
 	UnsubscribeGeneral(subscriberID string)
 
-	SubscribeDeployment(deploymentID string) <-chan LogEntry
-	UnsubscribeDeployment(deploymentID string)
+	SubscribeDeployment(deploymentID string) (<-chan LogEntry, string)
+	UnsubscribeDeployment(deploymentID, subscriberID string)
+
+	// ReplayDeployment returns the stored log of a deployment, oldest entry first.
+	ReplayDeployment(deploymentID string) ([]LogEntry, error)
+	// RemoveDeployment deletes the stored log of a deployment that is gone.
+	RemoveDeployment(deploymentID string) error
 
 	Close()
 }
@@ -41,8 +48,16 @@ type LogBroker struct {
 	streams map[string]chan LogEntry // subscriberID -> channel
 	buffer  []LogEntry               // Buffer for historical logs
 
-	deploymentStreams map[string]chan LogEntry // One channel per deployment ID
+	deploymentStreams map[string]map[string]chan LogEntry // deploymentID -> subscriberID -> channel
 	deploymentBuffer  map[string][]LogEntry
+	deploymentSeq     map[string]uint64 // Seq of the last entry of each running deployment
+
+	// deploymentStore keeps deployment logs beyond the buffer, it is optional. Entries are
+	// written by a single goroutine in the order they were numbered, so the broker doesn't
+	// wait for the disk.
+	deploymentStore *DeploymentLogStore
+	storeQueue      chan storeRequest
+	storeDone       chan struct{}
 
 	maxBuffer        int // Maximum buffered logs
 	subscriberIDSeed int
@@ -50,16 +65,65 @@ type LogBroker struct {
 	closed           bool
 }
 
-// NewLogBroker creates a new log broker
-func NewLogBroker() StreamPublisher {
-	return &LogBroker{
+// storeQueueSize is how many entries can wait to be written to the deployment log store
+// before publishing waits for the disk.
+const storeQueueSize = 1000
+
+// storeRequest is an entry to write to the deployment log store, or, with synced set, a
+// request to be told once everything queued before it is written.
+type storeRequest struct {
+	entry  LogEntry
+	synced chan struct{}
+}
+
+// NewLogBroker creates a new log broker. Entries with a deployment ID are also written to
+// deploymentStore, unless it is nil.
+func NewLogBroker(deploymentStore *DeploymentLogStore) StreamPublisher {
+	lb := &LogBroker{
 		streams:           make(map[string]chan LogEntry),
 		buffer:            make([]LogEntry, 0),
-		deploymentStreams: make(map[string]chan LogEntry),
+		deploymentStreams: make(map[string]map[string]chan LogEntry),
 		deploymentBuffer:  make(map[string][]LogEntry),
+		deploymentSeq:     make(map[string]uint64),
+		deploymentStore:   deploymentStore,
 		maxBuffer:         100,
 		subscriberIDSeed:  1,
 	}
+	if deploymentStore != nil {
+		lb.storeQueue = make(chan storeRequest, storeQueueSize)
+		lb.storeDone = make(chan struct{})
+		go lb.writeDeploymentLogs()
+	}
+	return lb
+}
+
+func (lb *LogBroker) writeDeploymentLogs() {
+	defer close(lb.storeDone)
+	for req := range lb.storeQueue {
+		if req.synced != nil {
+			close(req.synced)
+			continue
+		}
+		// Errors can't be logged here without publishing again, the console output still has the entry.
+		_ = lb.deploymentStore.Append(req.entry)
+	}
+}
+
+// syncStore waits until the entries published so far are in the deployment log store.
+func (lb *LogBroker) syncStore() {
+	if lb.deploymentStore == nil {
+		return
+	}
+	synced := make(chan struct{})
+	lb.mutex.RLock()
+	if lb.closed {
+		// Close waits for the queue to be written.
+		lb.mutex.RUnlock()
+		return
+	}
+	lb.storeQueue <- storeRequest{synced: synced}
+	lb.mutex.RUnlock()
+	<-synced
 }
 
 // Publish publishes a log entry to the general stream and deployment-specific streams
@@ -67,10 +131,27 @@ func (lb *LogBroker) Publish(entry LogEntry) {
 	lb.mutex.Lock()
 	defer lb.mutex.Unlock()
 
+	for entry.DeploymentID != "" && !lb.closed {
+		if _, known := lb.deploymentSeq[entry.DeploymentID]; known {
+			break
+		}
+		lb.mutex.Unlock()
+		lb.loadDeploymentSeq(entry.DeploymentID)
+		lb.mutex.Lock()
+	}
 	if lb.closed {
 		return
 	}
 
+	if entry.DeploymentID != "" {
+		// Numbered and queued under the lock, so the stored log is in the order of the numbers.
+		entry.Seq = lb.deploymentSeq[entry.DeploymentID] + 1
+		lb.deploymentSeq[entry.DeploymentID] = entry.Seq
+		if lb.storeQueue != nil {
+			lb.storeQueue <- storeRequest{entry: entry}
+		}
+	}
+
 	lb.buffer = append(lb.buffer, entry)
 	if len(lb.buffer) > lb.maxBuffer {
 		lb.buffer = lb.buffer[len(lb.buffer)-lb.maxBuffer:]
@@ -89,6 +170,19 @@ func (lb *LogBroker) Publish(entry LogEntry) {
 
 	if entry.DeploymentID != "" {
 		lb.publishToDeployment(entry.DeploymentID, entry)
+		if entry.IsDeploymentComplete || entry.IsDeploymentFailed {
+			lb.endDeploymentStream(entry.DeploymentID)
+		}
+	}
+}
+
+// endDeploymentStream forgets the numbering of a deployment that is done, and its buffer if
+// nobody follows it and the stored log has it. If the deployment logs again, like when it is
+// promoted later on, numbering picks up from the buffer or the stored log.
+func (lb *LogBroker) endDeploymentStream(deploymentID string) {
+	delete(lb.deploymentSeq, deploymentID)
+	if lb.deploymentStore != nil && len(lb.deploymentStreams[deploymentID]) == 0 {
+		delete(lb.deploymentBuffer, deploymentID)
 	}
 }
 
@@ -101,19 +195,44 @@ func (lb *LogBroker) publishToDeployment(deploymentID string, entry LogEntry) {
 	}
 	lb.deploymentBuffer[deploymentID] = buffer
 
-	// Send to deployment subscriber if exists
-	if ch, exists := lb.deploymentStreams[deploymentID]; exists {
+	for subscriberID, ch := range lb.deploymentStreams[deploymentID] {
 		select {
 		case ch <- entry:
 		default:
-			// Channel full, close slow subscriber
-			close(ch)
-			delete(lb.deploymentStreams, deploymentID)
-			delete(lb.deploymentBuffer, deploymentID)
+			// Channel full, close the slow subscriber. It can reconnect and resume from the
+			// stored log, the others go on.
+			lb.removeDeploymentSubscriber(deploymentID, subscriberID)
 		}
 	}
 }
 
+// loadDeploymentSeq makes sure the Seq of the last entry of a deployment is known. Numbering
+// continues from the buffer or the stored log, deployments log more when they are promoted or
+// rolled back to later on. The stored log is read without holding the lock.
+func (lb *LogBroker) loadDeploymentSeq(deploymentID string) {
+	lb.mutex.RLock()
+	_, known := lb.deploymentSeq[deploymentID]
+	buffer := lb.deploymentBuffer[deploymentID]
+	lb.mutex.RUnlock()
+	if known {
+		return
+	}
+
+	var seq uint64
+	if len(buffer) > 0 {
+		seq = buffer[len(buffer)-1].Seq
+	} else if lb.deploymentStore != nil {
+		lb.syncStore()
+		seq, _ = lb.deploymentStore.LastSeq(deploymentID)
+	}
+
+	lb.mutex.Lock()
+	defer lb.mutex.Unlock()
+	if _, known := lb.deploymentSeq[deploymentID]; !known && !lb.closed {
+		lb.deploymentSeq[deploymentID] = seq
+	}
+}
+
 // SubscribeGeneral creates a subscription for all logs and returns the channel and subscriber ID
 func (lb *LogBroker) SubscribeGeneral() (<-chan LogEntry, string) {
 	lb.mutex.Lock()
@@ -126,41 +245,15 @@ func (lb *LogBroker) SubscribeGeneral() (<-chan LogEntry, string) {
 	}
 
 	// Generate unique subscriber ID
-	subscriberID := lb.generateSubscriberID()
+	subscriberID := lb.generateSubscriberID("general")
 
-	// Create new general subscription
-	ch := make(chan LogEntry, 100)
-
-	// Copy buffered general logs
-	var bufferCopy []LogEntry
-	if len(lb.buffer) > 0 {
-		bufferCopy = make([]LogEntry, len(lb.buffer))
-		copy(bufferCopy, lb.buffer)
+	// The buffered general logs fit in the channel, so they are sent before anything newer
+	ch := make(chan LogEntry, lb.maxBuffer)
+	for _, entry := range lb.buffer {
+		ch <- entry
 	}
-
-	// Store the channel
 	lb.streams[subscriberID] = ch
 
-	// Send buffered logs in a separate goroutine
-	if len(bufferCopy) > 0 {
-		go func() {
-			for _, entry := range bufferCopy {
-				select {
-				case ch <- entry:
-				case <-time.After(2 * time.Second):
-					// Timeout, subscriber is too slow
-					lb.mutex.Lock()
-					if existingCh, exists := lb.streams[subscriberID]; exists && existingCh == ch {
-						close(ch)
-						delete(lb.streams, subscriberID)
-					}
-					lb.mutex.Unlock()
-					return
-				}
-			}
-		}()
-	}
-
 	return ch, subscriberID
 }
 
@@ -175,81 +268,111 @@ func (lb *LogBroker) UnsubscribeGeneral(subscriberID string) {
 	}
 }
 
-// SubscribeDeployment creates a new subscription for a deployment ID
-func (lb *LogBroker) SubscribeDeployment(deploymentID string) <-chan LogEntry {
+// SubscribeDeployment creates a subscription for the logs of a deployment and returns the
+// channel and subscriber ID. The channel starts with the buffered logs of the deployment.
+// Any number of clients can follow the same deployment.
+func (lb *LogBroker) SubscribeDeployment(deploymentID string) (<-chan LogEntry, string) {
 	lb.mutex.Lock()
 	defer lb.mutex.Unlock()
 
 	if lb.closed {
 		ch := make(chan LogEntry)
 		close(ch)
-		return ch
-	}
-
-	// Check if already subscribed
-	if existingCh, exists := lb.deploymentStreams[deploymentID]; exists {
-		return existingCh
-	}
-
-	// Create new subscription
-	ch := make(chan LogEntry, 100)
-
-	// Copy buffered logs
-	var bufferCopy []LogEntry
-	if buffer, exists := lb.deploymentBuffer[deploymentID]; exists && len(buffer) > 0 {
-		bufferCopy = make([]LogEntry, len(buffer))
-		copy(bufferCopy, buffer)
-	}
-
-	// Store the channel
-	lb.deploymentStreams[deploymentID] = ch
-
-	// Send buffered logs in a separate goroutine
-	if len(bufferCopy) > 0 {
-		go func() {
-			for _, entry := range bufferCopy {
-				select {
-				case ch <- entry:
-				case <-time.After(2 * time.Second):
-					// Timeout, close the channel
-					lb.mutex.Lock()
-					if existingCh, exists := lb.deploymentStreams[deploymentID]; exists && existingCh == ch {
-						close(ch)
-						delete(lb.deploymentStreams, deploymentID)
-						delete(lb.deploymentBuffer, deploymentID)
-					}
-					lb.mutex.Unlock()
-					return
-				}
-			}
-		}()
+		return ch, ""
 	}
 
-	return ch
+	subscriberID := lb.generateSubscriberID("deployment")
+
+	// The buffer never holds more than the channel does, so it is sent right away and new
+	// entries can't get ahead of it.
+	ch := make(chan LogEntry, lb.maxBuffer)
+	for _, entry := range lb.deploymentBuffer[deploymentID] {
+		ch <- entry
+	}
+
+	subscribers, exists := lb.deploymentStreams[deploymentID]
+	if !exists {
+		subscribers = make(map[string]chan LogEntry)
+		lb.deploymentStreams[deploymentID] = subscribers
+	}
+	subscribers[subscriberID] = ch
+
+	return ch, subscriberID
 }
 
-// UnsubscribeDeployment removes a deployment subscriber
-func (lb *LogBroker) UnsubscribeDeployment(deploymentID string) {
+// UnsubscribeDeployment removes a deployment subscriber. The deployment's buffer is dropped
+// with its last subscriber.
+func (lb *LogBroker) UnsubscribeDeployment(deploymentID, subscriberID string) {
 	lb.mutex.Lock()
 	defer lb.mutex.Unlock()
 
-	if ch, exists := lb.deploymentStreams[deploymentID]; exists {
+	lb.removeDeploymentSubscriber(deploymentID, subscriberID)
+	if len(lb.deploymentStreams[deploymentID]) == 0 {
+		delete(lb.deploymentBuffer, deploymentID)
+	}
+}
+
+func (lb *LogBroker) removeDeploymentSubscriber(deploymentID, subscriberID string) {
+	subscribers := lb.deploymentStreams[deploymentID]
+	if ch, exists := subscribers[subscriberID]; exists {
 		close(ch)
+		delete(subscribers, subscriberID)
+	}
+	if len(subscribers) == 0 {
 		delete(lb.deploymentStreams, deploymentID)
 	}
-	delete(lb.deploymentBuffer, deploymentID)
 }
 
-// Close shuts down the log broker and closes all channels
+// ReplayDeployment returns the stored log of a deployment, or what is left of it in the
+// buffer when deployment logs aren't stored.
+func (lb *LogBroker) ReplayDeployment(deploymentID string) ([]LogEntry, error) {
+	if lb.deploymentStore != nil {
+		lb.syncStore()
+		return lb.deploymentStore.Read(deploymentID)
+	}
+
+	lb.mutex.RLock()
+	defer lb.mutex.RUnlock()
+	return slices.Clone(lb.deploymentBuffer[deploymentID]), nil
+}
+
+// RemoveDeployment deletes the stored log of a deployment, after writing what is queued for
+// it. The buffer is kept while the deployment has subscribers.
+func (lb *LogBroker) RemoveDeployment(deploymentID string) error {
+	lb.syncStore()
+
+	lb.mutex.Lock()
+	if !lb.closed && len(lb.deploymentStreams[deploymentID]) == 0 {
+		delete(lb.deploymentBuffer, deploymentID)
+		delete(lb.deploymentSeq, deploymentID)
+	}
+	lb.mutex.Unlock()
+
+	if lb.deploymentStore == nil {
+		return nil
+	}
+	return lb.deploymentStore.Remove(deploymentID)
+}
+
+// Close shuts down the log broker and closes all channels, after writing the queued
+// deployment logs.
 func (lb *LogBroker) Close() {
 	lb.mutex.Lock()
-	defer lb.mutex.Unlock()
+	defer func() {
+		lb.mutex.Unlock()
+		if lb.storeDone != nil {
+			<-lb.storeDone
+		}
+	}()
 
 	if lb.closed {
 		return
 	}
 
 	lb.closed = true
+	if lb.storeQueue != nil {
+		close(lb.storeQueue)
+	}
 
 	// Close all general streams
 	for subscriberID, ch := range lb.streams {
@@ -258,21 +381,24 @@ func (lb *LogBroker) Close() {
 	}
 
 	// Close all deployment streams
-	for deploymentID, ch := range lb.deploymentStreams {
-		close(ch)
+	for deploymentID, subscribers := range lb.deploymentStreams {
+		for _, ch := range subscribers {
+			close(ch)
+		}
 		delete(lb.deploymentStreams, deploymentID)
 	}
 
 	// Clear buffers
 	lb.buffer = nil
 	lb.deploymentBuffer = nil
+	lb.deploymentSeq = nil
 }
 
 // generateSubscriberID creates a unique subscriber ID
-func (lb *LogBroker) generateSubscriberID() string {
+func (lb *LogBroker) generateSubscriberID(kind string) string {
 	id := lb.subscriberIDSeed
 	lb.subscriberIDSeed++
-	return fmt.Sprintf("general_%d", id)
+	return fmt.Sprintf("%s_%d", kind, id)
 }
 
 // StreamHandler wraps another slog.Handler and publishes logs to streams
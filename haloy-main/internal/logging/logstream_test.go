@@ -0,0 +1,175 @@
+package logging
+
+import (
+	"testing"
+)
+
+func receive(t *testing.T, ch <-chan LogEntry) LogEntry {
+	t.Helper()
+	select {
+	case entry, ok := <-ch:
+		if !ok {
+			t.Fatal("channel closed")
+		}
+		return entry
+	default:
+		t.Fatal("no entry")
+	}
+	return LogEntry{}
+}
+
+func TestDeploymentSubscribers(t *testing.T) {
+	broker := NewLogBroker(nil)
+	defer broker.Close()
+
+	broker.Publish(LogEntry{DeploymentID: "d1", Message: "first"})
+	first, firstID := broker.SubscribeDeployment("d1")
+	second, secondID := broker.SubscribeDeployment("d1")
+	if firstID == secondID {
+		t.Fatalf("subscribers share ID %s", firstID)
+	}
+
+	// Both start with the buffered entry.
+	for _, ch := range []<-chan LogEntry{first, second} {
+		if entry := receive(t, ch); entry.Message != "first" || entry.Seq != 1 {
+			t.Errorf("got %q seq %d, want first seq 1", entry.Message, entry.Seq)
+		}
+	}
+
+	broker.UnsubscribeDeployment("d1", firstID)
+	if _, ok := <-first; ok {
+		t.Error("unsubscribed channel still open")
+	}
+
+	broker.Publish(LogEntry{DeploymentID: "d1", Message: "second"})
+	if entry := receive(t, second); entry.Message != "second" || entry.Seq != 2 {
+		t.Errorf("got %q seq %d, want second seq 2", entry.Message, entry.Seq)
+	}
+}
+
+func TestSlowDeploymentSubscriber(t *testing.T) {
+	broker := NewLogBroker(nil)
+	defer broker.Close()
+
+	slow, _ := broker.SubscribeDeployment("d1")
+	fast, _ := broker.SubscribeDeployment("d1")
+
+	for range 101 {
+		broker.Publish(LogEntry{DeploymentID: "d1"})
+		receive(t, fast)
+	}
+
+	// The slow subscriber is dropped once its buffer is full, the fast one keeps going.
+	for range 100 {
+		receive(t, slow)
+	}
+	if _, ok := <-slow; ok {
+		t.Error("slow subscriber not closed")
+	}
+	broker.Publish(LogEntry{DeploymentID: "d1"})
+	if entry := receive(t, fast); entry.Seq != 102 {
+		t.Errorf("got seq %d, want 102", entry.Seq)
+	}
+}
+
+func TestDeploymentSeqContinuesStoredLog(t *testing.T) {
+	store, err := NewDeploymentLogStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	broker := NewLogBroker(store)
+	broker.Publish(LogEntry{DeploymentID: "d1"})
+	broker.Publish(LogEntry{DeploymentID: "d1"})
+	broker.Close()
+
+	// Like haloyd restarting before the deployment is promoted.
+	broker = NewLogBroker(store)
+	defer broker.Close()
+	broker.Publish(LogEntry{DeploymentID: "d1"})
+
+	entries, err := broker.ReplayDeployment("d1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, entry := range entries {
+		if entry.Seq != uint64(i+1) {
+			t.Errorf("entry %d has seq %d", i, entry.Seq)
+		}
+	}
+	if len(entries) != 3 {
+		t.Errorf("got %d entries, want 3", len(entries))
+	}
+}
+
+func TestDeploymentSeqForgottenWhenStreamEnds(t *testing.T) {
+	store, err := NewDeploymentLogStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	publisher := NewLogBroker(store)
+	defer publisher.Close()
+	broker := publisher.(*LogBroker)
+
+	broker.Publish(LogEntry{DeploymentID: "d1"})
+	broker.Publish(LogEntry{DeploymentID: "d1", IsDeploymentComplete: true})
+	broker.mutex.RLock()
+	_, seqKept := broker.deploymentSeq["d1"]
+	_, bufferKept := broker.deploymentBuffer["d1"]
+	broker.mutex.RUnlock()
+	if seqKept || bufferKept {
+		t.Errorf("deployment state kept after its stream ended: seq %v, buffer %v", seqKept, bufferKept)
+	}
+
+	// Like the deployment being promoted later on.
+	broker.Publish(LogEntry{DeploymentID: "d1"})
+	entries, err := broker.ReplayDeployment("d1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 || entries[2].Seq != 3 {
+		t.Errorf("got %d entries, want 3 ending with seq 3", len(entries))
+	}
+}
+
+func TestDeploymentSeqContinuesBufferWithoutStore(t *testing.T) {
+	broker := NewLogBroker(nil)
+	defer broker.Close()
+
+	broker.Publish(LogEntry{DeploymentID: "d1"})
+	broker.Publish(LogEntry{DeploymentID: "d1", IsDeploymentFailed: true})
+	broker.Publish(LogEntry{DeploymentID: "d1"})
+
+	entries, err := broker.ReplayDeployment("d1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 || entries[2].Seq != 3 {
+		t.Errorf("got %d entries, want 3 ending with seq 3", len(entries))
+	}
+}
+
+func TestRemoveDeployment(t *testing.T) {
+	store, err := NewDeploymentLogStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	broker := NewLogBroker(store)
+	defer broker.Close()
+
+	broker.Publish(LogEntry{DeploymentID: "d1"})
+	broker.Publish(LogEntry{DeploymentID: "d1", IsDeploymentComplete: true})
+	if err := broker.RemoveDeployment("d1"); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := broker.ReplayDeployment("d1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("got %d entries after removing the deployment, want none", len(entries))
+	}
+	if err := broker.RemoveDeployment("../d1"); err == nil {
+		t.Error("removed a deployment with an invalid ID")
+	}
+}
@@ -0,0 +1,121 @@
+package logship
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"github.com/haloydev/haloy/internal/config"
+	"github.com/haloydev/haloy/internal/docker"
+	"github.com/haloydev/haloy/internal/helpers"
+)
+
+// appLogsPollInterval is how often new app containers are looked for. Their output is read
+// from when they were created, so nothing is missed in between.
+const appLogsPollInterval = 5 * time.Second
+
+// shipAppLogs follows the output of the running app containers that a sink wants.
+func (s *Shipper) shipAppLogs(ctx context.Context, cli *client.Client) {
+	started := time.Now()
+
+	var mu sync.Mutex
+	following := make(map[string]bool)
+	// Where to pick up a container's output if its stream ends while it is still running.
+	resumeAt := make(map[string]time.Time)
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	ticker := time.NewTicker(appLogsPollInterval)
+	defer ticker.Stop()
+	for {
+		containerList, err := docker.GetAppContainers(ctx, cli, false, "")
+		if err != nil && ctx.Err() == nil {
+			s.logger.Debug("Failed to list app containers for log shipping", "error", err)
+		}
+
+		running := make(map[string]bool, len(containerList))
+		mu.Lock()
+		for _, c := range containerList {
+			running[c.ID] = true
+			if following[c.ID] || !s.wantsApp(c.Labels[config.LabelAppName]) {
+				continue
+			}
+			since, resuming := resumeAt[c.ID]
+			if !resuming {
+				// Containers that ran before haloyd started had their output shipped already,
+				// or not at all if log shipping was just set up.
+				since = time.Unix(c.Created, 0)
+				if since.Before(started) {
+					since = started
+				}
+			}
+			following[c.ID] = true
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				last := s.followContainer(ctx, cli, c, since)
+
+				mu.Lock()
+				defer mu.Unlock()
+				delete(following, c.ID)
+				if last.After(since) {
+					resumeAt[c.ID] = last.Add(time.Nanosecond)
+				} else {
+					resumeAt[c.ID] = since
+				}
+			}()
+		}
+		for id := range resumeAt {
+			if !running[id] && !following[id] {
+				delete(resumeAt, id)
+			}
+		}
+		mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// followContainer ships a container's output from since until it stops, and returns the time
+// of the last line shipped.
+func (s *Shipper) followContainer(ctx context.Context, cli *client.Client, c container.Summary, since time.Time) time.Time {
+	appName := c.Labels[config.LabelAppName]
+	deploymentID := c.Labels[config.LabelDeploymentID]
+	replica := strconv.Itoa(docker.ReplicaID(c))
+
+	last := since
+	options := container.LogsOptions{
+		ShowStderr: true,
+		Follow:     true,
+		Since:      fmt.Sprintf("%d.%09d", since.Unix(), since.Nanosecond()),
+	}
+	err := docker.StreamContainerLogs(ctx, cli, c.ID, options, func(line docker.ContainerLogLine) error {
+		if line.Timestamp.After(last) {
+			last = line.Timestamp
+		}
+		s.dispatch(Record{
+			Timestamp:    line.Timestamp,
+			Source:       SourceApp,
+			Message:      line.Line,
+			App:          appName,
+			DeploymentID: deploymentID,
+			Replica:      replica,
+			Stream:       line.Stream,
+		})
+		return nil
+	})
+	if err != nil && ctx.Err() == nil {
+		s.logger.Debug("Stopped shipping app container logs", "app", appName, "containerID", helpers.SafeIDPrefix(c.ID), "error", err)
+	}
+	return last
+}
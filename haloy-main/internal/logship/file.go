@@ -0,0 +1,59 @@
+package logship
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/haloydev/haloy/internal/config"
+)
+
+// fileSink appends records to a file as JSON lines. The file is opened for every batch, so
+// it can be rotated by moving it away.
+type fileSink struct {
+	path   string
+	labels map[string]string
+}
+
+type fileRecord struct {
+	Record
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+func newFileSink(cfg config.LogSinkConfig, dataDir string) (*fileSink, error) {
+	path := cfg.Path
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dataDir, path)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create log directory: %w", err)
+	}
+	return &fileSink{path: path, labels: cfg.Labels}, nil
+}
+
+func (s *fileSink) Send(_ context.Context, records []Record) error {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, record := range records {
+		if err := encoder.Encode(fileRecord{Record: record, Labels: s.labels}); err != nil {
+			return fmt.Errorf("failed to marshal log record: %w", err)
+		}
+	}
+
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write log file: %w", err)
+	}
+	return f.Close()
+}
+
+func (s *fileSink) Close() error {
+	return nil
+}
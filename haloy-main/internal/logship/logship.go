@@ -0,0 +1,401 @@
+// Package logship ships haloyd's logs, and optionally what app containers print, to external
+// systems like syslog servers, Loki and OpenTelemetry collectors.
+package logship
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/docker/docker/client"
+	"github.com/haloydev/haloy/internal/config"
+	"github.com/haloydev/haloy/internal/logging"
+)
+
+const (
+	SourceHaloyd = "haloyd"
+	SourceApp    = "app"
+)
+
+const (
+	queueSize     = 10000 // Records waiting per sink before new ones are dropped
+	maxBatchSize  = 500
+	flushInterval = time.Second
+	sendTimeout   = 10 * time.Second
+	sendAttempts  = 3
+	stopTimeout   = 10 * time.Second // How long Stop waits for queued records to be sent
+)
+
+// Record is a log line shipped to sinks: an entry haloyd logged, or a line an app printed.
+type Record struct {
+	Timestamp    time.Time      `json:"timestamp"`
+	Source       string         `json:"source"`
+	Level        string         `json:"level,omitempty"` // Only set for haloyd's entries
+	Message      string         `json:"message"`
+	App          string         `json:"app,omitempty"`
+	DeploymentID string         `json:"deploymentId,omitempty"`
+	Replica      string         `json:"replica,omitempty"`
+	Stream       string         `json:"stream,omitempty"` // stdout or stderr for app output
+	Fields       map[string]any `json:"fields,omitempty"`
+}
+
+// Severity returns the level of a record. App output has none, stderr counts as errors like
+// Docker's own log drivers do.
+func (r Record) Severity() string {
+	switch {
+	case r.Level != "":
+		return r.Level
+	case r.Stream == "stderr":
+		return slog.LevelError.String()
+	default:
+		return slog.LevelInfo.String()
+	}
+}
+
+// Text returns the message with the fields of haloyd's entries appended as key=value, for
+// sinks that take a line of text.
+func (r Record) Text() string {
+	if len(r.Fields) == 0 {
+		return r.Message
+	}
+	keys := make([]string, 0, len(r.Fields))
+	for key := range r.Fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString(r.Message)
+	for _, key := range keys {
+		value := fmt.Sprint(r.Fields[key])
+		if value == "" || strings.ContainsAny(value, " \t\"=") {
+			value = fmt.Sprintf("%q", value)
+		}
+		fmt.Fprintf(&b, " %s=%s", key, value)
+	}
+	return b.String()
+}
+
+func recordFromEntry(entry logging.LogEntry) Record {
+	return Record{
+		Timestamp:    entry.Timestamp,
+		Source:       SourceHaloyd,
+		Level:        entry.Level,
+		Message:      entry.Message,
+		App:          entry.AppName,
+		DeploymentID: entry.DeploymentID,
+		Fields:       entry.Fields,
+	}
+}
+
+// Sink sends records to an external system. Send is only called by one goroutine at a time.
+type Sink interface {
+	Send(ctx context.Context, records []Record) error
+	Close() error
+}
+
+// NewSink creates the sink a config describes. Relative file paths are in dataDir.
+func NewSink(cfg config.LogSinkConfig, dataDir string) (Sink, error) {
+	switch cfg.Type {
+	case config.LogSinkSyslog:
+		return newSyslogSink(cfg)
+	case config.LogSinkLoki:
+		return newLokiSink(cfg), nil
+	case config.LogSinkOTLP:
+		return newOTLPSink(cfg), nil
+	case config.LogSinkFile:
+		return newFileSink(cfg, dataDir)
+	default:
+		return nil, fmt.Errorf("unknown log sink type '%s'", cfg.Type)
+	}
+}
+
+// Shipper sends haloyd's log entries, and the output of app containers, to the configured sinks.
+// Each sink has its own queue, so one that is slow or down doesn't hold up the others.
+type Shipper struct {
+	workers []*sinkWorker
+	logger  *slog.Logger
+
+	cancel     context.CancelFunc
+	abortSends context.CancelFunc
+	producers  sync.WaitGroup
+	consumers  sync.WaitGroup
+}
+
+type sinkWorker struct {
+	name    string
+	sink    Sink
+	appLogs bool
+	apps    []string
+
+	queue   chan Record
+	dropped atomic.Int64
+	failing bool
+}
+
+func New(configs []config.LogSinkConfig, dataDir string, logger *slog.Logger) (*Shipper, error) {
+	for _, cfg := range configs {
+		if err := cfg.Validate(); err != nil {
+			return nil, fmt.Errorf("log sink '%s': %w", cfg.DisplayName(), err)
+		}
+	}
+
+	s := &Shipper{logger: logger}
+	for _, cfg := range configs {
+		sink, err := NewSink(cfg, dataDir)
+		if err != nil {
+			for _, w := range s.workers {
+				w.sink.Close()
+			}
+			return nil, fmt.Errorf("log sink '%s': %w", cfg.DisplayName(), err)
+		}
+		s.workers = append(s.workers, &sinkWorker{
+			name:    cfg.DisplayName(),
+			sink:    sink,
+			appLogs: cfg.AppLogs,
+			apps:    cfg.Apps,
+			queue:   make(chan Record, queueSize),
+		})
+	}
+	return s, nil
+}
+
+// Start ships what is published from now on until Stop is called. App output is read through
+// cli, and only if a sink wants it.
+func (s *Shipper) Start(ctx context.Context, publisher logging.StreamPublisher, cli *client.Client) {
+	ctx, s.cancel = context.WithCancel(ctx)
+	// Sends outlive ctx, so what is queued when haloyd shuts down still gets shipped.
+	sendCtx, abortSends := context.WithCancel(context.WithoutCancel(ctx))
+	s.abortSends = abortSends
+
+	for _, w := range s.workers {
+		s.consumers.Add(1)
+		go func() {
+			defer s.consumers.Done()
+			defer w.sink.Close()
+			w.run(sendCtx, s.logger)
+		}()
+	}
+
+	// Subscribing before returning ships everything published after Start, along with what
+	// the broker still has buffered from before.
+	ch, subscriberID := publisher.SubscribeGeneral()
+	s.producers.Add(1)
+	go func() {
+		defer s.producers.Done()
+		s.shipHaloydLogs(ctx, publisher, ch, subscriberID)
+	}()
+
+	if cli != nil && s.wantsAppLogs() {
+		s.producers.Add(1)
+		go func() {
+			defer s.producers.Done()
+			s.shipAppLogs(ctx, cli)
+		}()
+	}
+}
+
+// Stop stops collecting logs and waits a while for the sinks to send what is queued. Sends that
+// take longer are aborted, what is still queued is dropped and the sinks are closed.
+func (s *Shipper) Stop() {
+	s.stop(stopTimeout)
+}
+
+func (s *Shipper) stop(timeout time.Duration) {
+	defer s.abortSends()
+	s.cancel()
+	s.producers.Wait()
+	for _, w := range s.workers {
+		close(w.queue)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.consumers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		s.logger.Warn("Gave up sending queued logs to log sinks")
+		s.abortSends()
+		<-done
+	}
+}
+
+func (s *Shipper) shipHaloydLogs(ctx context.Context, publisher logging.StreamPublisher, ch <-chan logging.LogEntry, subscriberID string) {
+	// The broker drops subscribers that fall behind. That shouldn't happen since records are
+	// only queued here, but if it does the subscription is renewed, skipping the entries that
+	// were already shipped from its buffer.
+	var skipUntil time.Time
+	for subscriberID != "" { // An empty ID means the broker is closed
+		lastShipped, ok := s.shipEntries(ctx, ch, skipUntil)
+		if !ok {
+			publisher.UnsubscribeGeneral(subscriberID)
+			return
+		}
+		skipUntil = lastShipped
+		ch, subscriberID = publisher.SubscribeGeneral()
+	}
+}
+
+// shipEntries queues the entries from ch that are newer than skipUntil until ch is closed. It
+// returns the time of the newest entry, and false if ctx is done, after queueing the entries
+// that were already waiting in ch.
+func (s *Shipper) shipEntries(ctx context.Context, ch <-chan logging.LogEntry, skipUntil time.Time) (time.Time, bool) {
+	lastShipped := skipUntil
+	ship := func(entry logging.LogEntry) {
+		if !entry.Timestamp.After(skipUntil) {
+			return
+		}
+		if entry.Timestamp.After(lastShipped) {
+			lastShipped = entry.Timestamp
+		}
+		s.dispatch(recordFromEntry(entry))
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			for {
+				select {
+				case entry, ok := <-ch:
+					if !ok {
+						return lastShipped, false
+					}
+					ship(entry)
+				default:
+					return lastShipped, false
+				}
+			}
+		case entry, ok := <-ch:
+			if !ok {
+				return lastShipped, true
+			}
+			ship(entry)
+		}
+	}
+}
+
+func (s *Shipper) dispatch(record Record) {
+	for _, w := range s.workers {
+		if record.Source == SourceApp && !w.wantsApp(record.App) {
+			continue
+		}
+		select {
+		case w.queue <- record:
+		default:
+			w.dropped.Add(1)
+		}
+	}
+}
+
+func (s *Shipper) wantsAppLogs() bool {
+	for _, w := range s.workers {
+		if w.appLogs {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Shipper) wantsApp(appName string) bool {
+	for _, w := range s.workers {
+		if w.wantsApp(appName) {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *sinkWorker) wantsApp(appName string) bool {
+	if !w.appLogs {
+		return false
+	}
+	if len(w.apps) == 0 {
+		return true
+	}
+	for _, pattern := range w.apps {
+		if ok, err := path.Match(pattern, appName); err == nil && ok {
+			return true
+		}
+	}
+	return false
+}
+
+// run sends queued records in batches until the queue is closed.
+func (w *sinkWorker) run(ctx context.Context, logger *slog.Logger) {
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]Record, 0, maxBatchSize)
+	for {
+		select {
+		case record, ok := <-w.queue:
+			if !ok {
+				w.flush(ctx, batch, logger)
+				return
+			}
+			batch = append(batch, record)
+			if len(batch) < maxBatchSize {
+				continue
+			}
+		case <-ticker.C:
+			if len(batch) == 0 {
+				continue
+			}
+		}
+		w.flush(ctx, batch, logger)
+		batch = batch[:0]
+	}
+}
+
+// flush sends a batch, retrying a few times. Failures are logged when the sink starts and
+// stops failing, not for every batch, since the warnings are shipped too.
+func (w *sinkWorker) flush(ctx context.Context, batch []Record, logger *slog.Logger) {
+	if len(batch) == 0 {
+		return
+	}
+	// Stop gave up on the sink, the rest of the queue goes without trying.
+	if ctx.Err() != nil {
+		w.dropped.Add(int64(len(batch)))
+		return
+	}
+
+	var err error
+	for attempt := 1; attempt <= sendAttempts; attempt++ {
+		sendCtx, cancel := context.WithTimeout(ctx, sendTimeout)
+		err = w.sink.Send(sendCtx, batch)
+		cancel()
+		if err == nil || ctx.Err() != nil {
+			break
+		}
+		if attempt < sendAttempts {
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Duration(attempt) * time.Second):
+			}
+		}
+	}
+
+	if err != nil {
+		w.dropped.Add(int64(len(batch)))
+		if !w.failing {
+			w.failing = true
+			logger.Warn("Failed to ship logs, dropping them until the sink recovers", "sink", w.name, "error", err)
+		}
+		return
+	}
+	dropped := w.dropped.Swap(0)
+	if w.failing {
+		w.failing = false
+		logger.Info("Log sink recovered", "sink", w.name, "dropped", dropped)
+	} else if dropped > 0 {
+		logger.Warn("Log sink fell behind and dropped logs", "sink", w.name, "dropped", dropped)
+	}
+}
@@ -0,0 +1,388 @@
+package logship
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/haloydev/haloy/internal/config"
+	"github.com/haloydev/haloy/internal/logging"
+)
+
+var testTime = time.Date(2025, 3, 4, 5, 6, 7, 890000000, time.UTC)
+
+var testRecords = []Record{
+	{Timestamp: testTime, Source: SourceHaloyd, Level: "WARN", Message: "Health check failed", App: "web", DeploymentID: "01JDEPLOY", Fields: map[string]any{"attempt": "2"}},
+	{Timestamp: testTime.Add(time.Second), Source: SourceApp, Message: "listening on :8080", App: "web", DeploymentID: "01JDEPLOY", Replica: "2", Stream: "stdout"},
+}
+
+func discardLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+func TestSyslogUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	sink, err := newSyslogSink(config.LogSinkConfig{Type: config.LogSinkSyslog, URL: "udp://" + conn.LocalAddr().String(), Labels: map[string]string{"env": "prod"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink.hostname = "host1"
+	defer sink.Close()
+	if err := sink.Send(context.Background(), testRecords); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		`<28>1 2025-03-04T05:06:07.890000Z host1 haloyd - - [haloy@32473 app="web" deploymentId="01JDEPLOY" env="prod"] Health check failed attempt=2`,
+		`<30>1 2025-03-04T05:06:08.890000Z host1 web - - [haloy@32473 app="web" deploymentId="01JDEPLOY" env="prod" replica="2" stream="stdout"] listening on :8080`,
+	}
+	buf := make([]byte, 2048)
+	for _, w := range want {
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := string(buf[:n]); got != w {
+			t.Errorf("got  %s\nwant %s", got, w)
+		}
+	}
+}
+
+func TestSyslogTCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	received := make(chan string, 2)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		for {
+			// Octet counting: the length of the message, a space and the message.
+			length, err := reader.ReadString(' ')
+			if err != nil {
+				return
+			}
+			n, err := strconv.Atoi(strings.TrimSpace(length))
+			if err != nil {
+				return
+			}
+			message := make([]byte, n)
+			if _, err := io.ReadFull(reader, message); err != nil {
+				return
+			}
+			received <- string(message)
+		}
+	}()
+
+	sink, err := newSyslogSink(config.LogSinkConfig{Type: config.LogSinkSyslog, URL: "tcp://" + listener.Addr().String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+	if err := sink.Send(context.Background(), testRecords); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, prefix := range []string{"<28>1 ", "<30>1 "} {
+		select {
+		case message := <-received:
+			if !strings.HasPrefix(message, prefix) {
+				t.Errorf("message %q doesn't start with %q", message, prefix)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("no message received")
+		}
+	}
+}
+
+func TestLoki(t *testing.T) {
+	var push lokiPush
+	var tenant string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenant = r.Header.Get("X-Scope-OrgID")
+		if err := json.NewDecoder(r.Body).Decode(&push); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	sink := newLokiSink(config.LogSinkConfig{Type: config.LogSinkLoki, URL: server.URL, Headers: map[string]string{"X-Scope-OrgID": "acme"}, Labels: map[string]string{"host-name": "web1"}})
+	if err := sink.Send(context.Background(), testRecords); err != nil {
+		t.Fatal(err)
+	}
+
+	if tenant != "acme" {
+		t.Errorf("got tenant %q, want acme", tenant)
+	}
+	if len(push.Streams) != 2 {
+		t.Fatalf("got %d streams, want 2", len(push.Streams))
+	}
+	app := push.Streams[1]
+	wantLabels := map[string]string{"host_name": "web1", "source": "app", "level": "info", "app": "web", "deployment_id": "01JDEPLOY", "replica": "2", "stream": "stdout"}
+	if fmt.Sprint(app.Stream) != fmt.Sprint(wantLabels) {
+		t.Errorf("got labels %v, want %v", app.Stream, wantLabels)
+	}
+	wantValue := [2]string{strconv.FormatInt(testTime.Add(time.Second).UnixNano(), 10), "listening on :8080"}
+	if len(app.Values) != 1 || app.Values[0] != wantValue {
+		t.Errorf("got values %v, want %v", app.Values, wantValue)
+	}
+	if line := push.Streams[0].Values[0][1]; line != "Health check failed attempt=2" {
+		t.Errorf("got line %q", line)
+	}
+}
+
+func TestLokiError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "entry too far behind", http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	sink := newLokiSink(config.LogSinkConfig{Type: config.LogSinkLoki, URL: server.URL})
+	err := sink.Send(context.Background(), testRecords)
+	if err == nil || !strings.Contains(err.Error(), "status 400: entry too far behind") {
+		t.Errorf("got error %v", err)
+	}
+}
+
+func TestOTLP(t *testing.T) {
+	var request otlpLogsRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/logs" || r.Header.Get("Content-Type") != "application/json" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte("{}"))
+	}))
+	defer server.Close()
+
+	sink := newOTLPSink(config.LogSinkConfig{Type: config.LogSinkOTLP, URL: server.URL + "/v1/logs", Labels: map[string]string{"deployment.environment": "prod"}})
+	if err := sink.Send(context.Background(), testRecords); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(request.ResourceLogs) != 2 {
+		t.Fatalf("got %d resources, want 2", len(request.ResourceLogs))
+	}
+	for i, service := range []string{"haloyd", "web"} {
+		attributes := request.ResourceLogs[i].Resource.Attributes
+		if len(attributes) != 2 || attributes[0].Value.StringValue != service || attributes[1].Key != "deployment.environment" {
+			t.Errorf("resource %d has attributes %v", i, attributes)
+		}
+	}
+
+	warning := request.ResourceLogs[0].ScopeLogs[0].LogRecords[0]
+	if warning.SeverityNumber != 13 || warning.Body.StringValue != "Health check failed" || warning.TimeUnixNano != strconv.FormatInt(testTime.UnixNano(), 10) {
+		t.Errorf("got record %+v", warning)
+	}
+	appLine := request.ResourceLogs[1].ScopeLogs[0].LogRecords[0]
+	wantAttributes := "[{haloy.app {web}} {haloy.deployment_id {01JDEPLOY}} {haloy.replica {2}} {log.iostream {stdout}}]"
+	if got := fmt.Sprint(appLine.Attributes); got != wantAttributes {
+		t.Errorf("got attributes %s, want %s", got, wantAttributes)
+	}
+}
+
+func readFileRecords(t *testing.T, path string) []fileRecord {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var records []fileRecord
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var record fileRecord
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("invalid line %q: %v", line, err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestShipHaloydLogsToFile(t *testing.T) {
+	dataDir := t.TempDir()
+	shipper, err := New([]config.LogSinkConfig{{Type: config.LogSinkFile, Path: "logs/haloy.jsonl", Labels: map[string]string{"host": "web1"}}}, dataDir, discardLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	broker := logging.NewLogBroker(nil)
+	defer broker.Close()
+
+	shipper.Start(context.Background(), broker, nil)
+	logger := logging.NewDeploymentLogger("01JDEPLOY", slog.LevelInfo, broker)
+	logger.Info("Deployment started", "app", "web")
+	logger.Error("Deployment failed", "error", "image not found")
+	shipper.Stop()
+
+	records := readFileRecords(t, filepath.Join(dataDir, "logs", "haloy.jsonl"))
+	if len(records) != 2 {
+		t.Fatalf("got %d records, want 2", len(records))
+	}
+	first, second := records[0], records[1]
+	if first.Message != "Deployment started" || first.App != "web" || first.DeploymentID != "01JDEPLOY" || first.Source != SourceHaloyd || first.Labels["host"] != "web1" {
+		t.Errorf("got first record %+v", first)
+	}
+	if second.Level != "ERROR" || second.Fields["error"] != "image not found" {
+		t.Errorf("got second record %+v", second)
+	}
+}
+
+// stuckSink blocks every send until it is aborted, like a sink behind a network that swallows packets.
+type stuckSink struct {
+	sends  chan struct{}
+	closed atomic.Bool
+}
+
+func (s *stuckSink) Send(ctx context.Context, records []Record) error {
+	s.sends <- struct{}{}
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (s *stuckSink) Close() error {
+	s.closed.Store(true)
+	return nil
+}
+
+func TestStopClosesStuckSinks(t *testing.T) {
+	sink := &stuckSink{sends: make(chan struct{}, sendAttempts)}
+	shipper := &Shipper{
+		workers: []*sinkWorker{{name: "stuck", sink: sink, queue: make(chan Record, queueSize)}},
+		logger:  discardLogger(),
+	}
+	broker := logging.NewLogBroker(nil)
+	defer broker.Close()
+
+	shipper.Start(context.Background(), broker, nil)
+	logging.NewDeploymentLogger("01JDEPLOY", slog.LevelInfo, broker).Info("Deployment started")
+	<-sink.sends
+
+	start := time.Now()
+	shipper.stop(50 * time.Millisecond)
+	if elapsed := time.Since(start); elapsed > sendTimeout/2 {
+		t.Errorf("stop took %s, want the stuck send to be aborted", elapsed)
+	}
+	if !sink.closed.Load() {
+		t.Error("sink not closed after giving up on it")
+	}
+}
+
+// fakeDocker serves the parts of the Docker API used to follow app containers.
+func fakeDocker(t *testing.T, containers []container.Summary, output map[string][]string) *client.Client {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/_ping"):
+			w.Header().Set("API-Version", "1.45")
+		case strings.HasSuffix(r.URL.Path, "/containers/json"):
+			json.NewEncoder(w).Encode(containers)
+		case strings.HasSuffix(r.URL.Path, "/logs"):
+			id := strings.Split(strings.TrimPrefix(r.URL.Path, "/v1.45/containers/"), "/")[0]
+			stdout := stdcopy.NewStdWriter(w, stdcopy.Stdout)
+			stderr := stdcopy.NewStdWriter(w, stdcopy.Stderr)
+			for i, line := range output[id] {
+				out := stdout
+				if strings.HasPrefix(line, "ERR ") {
+					out = stderr
+				}
+				fmt.Fprintf(out, "%s %s\n", testTime.Add(time.Duration(i)*time.Second).Format(time.RFC3339Nano), line)
+			}
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	cli, err := client.NewClientWithOpts(client.WithHost("tcp://"+strings.TrimPrefix(server.URL, "http://")), client.WithVersion("1.45"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cli.Close() })
+	return cli
+}
+
+func TestShipAppLogs(t *testing.T) {
+	cli := fakeDocker(t, []container.Summary{
+		{ID: "web1", Names: []string{"/web-01JDEPLOY-replica-2"}, Labels: map[string]string{config.LabelAppName: "web", config.LabelDeploymentID: "01JDEPLOY"}},
+		{ID: "api1", Names: []string{"/api-01JOTHER"}, Labels: map[string]string{config.LabelAppName: "api", config.LabelDeploymentID: "01JOTHER"}},
+	}, map[string][]string{
+		"web1": {"listening on :8080", "ERR cache miss"},
+		"api1": {"not shipped"},
+	})
+
+	dataDir := t.TempDir()
+	shipper, err := New([]config.LogSinkConfig{
+		{Name: "web", Type: config.LogSinkFile, Path: "web.jsonl", AppLogs: true, Apps: []string{"web*"}},
+		{Name: "haloyd", Type: config.LogSinkFile, Path: "haloyd.jsonl"},
+	}, dataDir, discardLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	broker := logging.NewLogBroker(nil)
+	defer broker.Close()
+
+	shipper.Start(context.Background(), broker, cli)
+	path := filepath.Join(dataDir, "web.jsonl")
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if data, _ := os.ReadFile(path); strings.Count(string(data), "\n") >= 2 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	shipper.Stop()
+
+	records := readFileRecords(t, path)
+	if len(records) != 2 {
+		t.Fatalf("got %d records, want 2: %+v", len(records), records)
+	}
+	want := []Record{
+		{Timestamp: testTime, Source: SourceApp, Message: "listening on :8080", App: "web", DeploymentID: "01JDEPLOY", Replica: "2", Stream: "stdout"},
+		{Timestamp: testTime.Add(time.Second), Source: SourceApp, Message: "ERR cache miss", App: "web", DeploymentID: "01JDEPLOY", Replica: "2", Stream: "stderr"},
+	}
+	// stdout and stderr are read separately, so only the timestamps order them.
+	sort.Slice(records, func(i, j int) bool { return records[i].Timestamp.Before(records[j].Timestamp) })
+	for i, record := range records {
+		if fmt.Sprint(record.Record) != fmt.Sprint(want[i]) {
+			t.Errorf("got record %+v, want %+v", record.Record, want[i])
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dataDir, "haloyd.jsonl")); !os.IsNotExist(err) {
+		t.Errorf("app logs shipped to a sink without appLogs")
+	}
+}
@@ -0,0 +1,99 @@
+package logship
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/haloydev/haloy/internal/config"
+)
+
+var invalidLokiLabelChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// lokiSink pushes records to Loki's push API, with the app, deployment and replica as labels.
+type lokiSink struct {
+	httpSink
+	labels map[string]string
+}
+
+type lokiPush struct {
+	Streams []lokiStream `json:"streams"`
+}
+
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"` // Timestamp in nanoseconds and line
+}
+
+func newLokiSink(cfg config.LogSinkConfig) *lokiSink {
+	return &lokiSink{
+		httpSink: httpSink{url: cfg.URL, headers: cfg.Headers, client: &http.Client{}},
+		labels:   cfg.Labels,
+	}
+}
+
+func (s *lokiSink) Send(ctx context.Context, records []Record) error {
+	var push lokiPush
+	streams := make(map[string]int) // Label set -> index in push.Streams
+	for _, record := range records {
+		labels := s.recordLabels(record)
+		key := lokiStreamKey(labels)
+		i, exists := streams[key]
+		if !exists {
+			i = len(push.Streams)
+			streams[key] = i
+			push.Streams = append(push.Streams, lokiStream{Stream: labels})
+		}
+		push.Streams[i].Values = append(push.Streams[i].Values,
+			[2]string{strconv.FormatInt(record.Timestamp.UnixNano(), 10), record.Text()})
+	}
+	return s.post(ctx, push)
+}
+
+func (s *lokiSink) recordLabels(record Record) map[string]string {
+	labels := make(map[string]string, len(s.labels)+6)
+	for name, value := range s.labels {
+		labels[lokiLabelName(name)] = value
+	}
+	labels["source"] = record.Source
+	labels["level"] = strings.ToLower(record.Severity())
+	for name, value := range map[string]string{
+		"app":           record.App,
+		"deployment_id": record.DeploymentID,
+		"replica":       record.Replica,
+		"stream":        record.Stream,
+	} {
+		if value != "" {
+			labels[name] = value
+		}
+	}
+	return labels
+}
+
+// lokiLabelName makes a name fit Loki's label names, which are like Prometheus'.
+func lokiLabelName(name string) string {
+	name = invalidLokiLabelChars.ReplaceAllString(name, "_")
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		name = "_" + name
+	}
+	return name
+}
+
+func lokiStreamKey(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	for _, name := range names {
+		b.WriteString(name)
+		b.WriteByte(0)
+		b.WriteString(labels[name])
+		b.WriteByte(0)
+	}
+	return b.String()
+}
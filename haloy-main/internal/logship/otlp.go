@@ -0,0 +1,153 @@
+package logship
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/haloydev/haloy/internal/config"
+)
+
+// otlpSink sends records as OTLP logs over HTTP, in the JSON encoding. Each app is a service
+// of its own, haloyd's entries come from the haloyd service.
+type otlpSink struct {
+	httpSink
+	labels map[string]string
+}
+
+type otlpLogsRequest struct {
+	ResourceLogs []otlpResourceLogs `json:"resourceLogs"`
+}
+
+type otlpResourceLogs struct {
+	Resource  otlpResource    `json:"resource"`
+	ScopeLogs []otlpScopeLogs `json:"scopeLogs"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeLogs struct {
+	Scope      otlpScope       `json:"scope"`
+	LogRecords []otlpLogRecord `json:"logRecords"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpLogRecord struct {
+	TimeUnixNano         string         `json:"timeUnixNano"`
+	ObservedTimeUnixNano string         `json:"observedTimeUnixNano"`
+	SeverityNumber       int            `json:"severityNumber"`
+	SeverityText         string         `json:"severityText"`
+	Body                 otlpAnyValue   `json:"body"`
+	Attributes           []otlpKeyValue `json:"attributes,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+func newOTLPSink(cfg config.LogSinkConfig) *otlpSink {
+	return &otlpSink{
+		httpSink: httpSink{url: cfg.URL, headers: cfg.Headers, client: &http.Client{}},
+		labels:   cfg.Labels,
+	}
+}
+
+func (s *otlpSink) Send(ctx context.Context, records []Record) error {
+	observed := strconv.FormatInt(time.Now().UnixNano(), 10)
+
+	var request otlpLogsRequest
+	services := make(map[string]int) // Service name -> index in request.ResourceLogs
+	for _, record := range records {
+		service := SourceHaloyd
+		if record.Source == SourceApp {
+			service = record.App
+		}
+		i, exists := services[service]
+		if !exists {
+			i = len(request.ResourceLogs)
+			services[service] = i
+			request.ResourceLogs = append(request.ResourceLogs, otlpResourceLogs{
+				Resource:  otlpResource{Attributes: s.resourceAttributes(service)},
+				ScopeLogs: []otlpScopeLogs{{Scope: otlpScope{Name: "haloy"}}},
+			})
+		}
+
+		severity := record.Severity()
+		scopeLogs := &request.ResourceLogs[i].ScopeLogs[0]
+		scopeLogs.LogRecords = append(scopeLogs.LogRecords, otlpLogRecord{
+			TimeUnixNano:         strconv.FormatInt(record.Timestamp.UnixNano(), 10),
+			ObservedTimeUnixNano: observed,
+			SeverityNumber:       otlpSeverityNumber(severity),
+			SeverityText:         severity,
+			Body:                 otlpAnyValue{StringValue: record.Message},
+			Attributes:           recordAttributes(record),
+		})
+	}
+	return s.post(ctx, request)
+}
+
+func (s *otlpSink) resourceAttributes(service string) []otlpKeyValue {
+	attributes := []otlpKeyValue{{Key: "service.name", Value: otlpAnyValue{StringValue: service}}}
+	return append(attributes, sortedAttributes(s.labels)...)
+}
+
+// recordAttributes returns the attributes of a log record, using the semantic conventions'
+// names where there are any.
+func recordAttributes(record Record) []otlpKeyValue {
+	attributes := make(map[string]string, len(record.Fields)+3)
+	for key, value := range record.Fields {
+		attributes[key] = fmt.Sprint(value)
+	}
+	for key, value := range map[string]string{
+		"haloy.app":           record.App,
+		"haloy.deployment_id": record.DeploymentID,
+		"haloy.replica":       record.Replica,
+		"log.iostream":        record.Stream,
+	} {
+		if value != "" {
+			attributes[key] = value
+		}
+	}
+	return sortedAttributes(attributes)
+}
+
+func sortedAttributes(values map[string]string) []otlpKeyValue {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	attributes := make([]otlpKeyValue, 0, len(keys))
+	for _, key := range keys {
+		attributes = append(attributes, otlpKeyValue{Key: key, Value: otlpAnyValue{StringValue: values[key]}})
+	}
+	return attributes
+}
+
+// otlpSeverityNumber maps levels to the first number of the matching OTLP severity range.
+func otlpSeverityNumber(level string) int {
+	switch level {
+	case slog.LevelDebug.String():
+		return 5
+	case slog.LevelWarn.String():
+		return 13
+	case slog.LevelError.String():
+		return 17
+	default:
+		return 9
+	}
+}
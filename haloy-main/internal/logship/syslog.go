@@ -0,0 +1,172 @@
+package logship
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/haloydev/haloy/internal/config"
+)
+
+const (
+	syslogFacilityDaemon = 3
+	// syslogSDID names the structured data element holding the record's app, deployment,
+	// replica and labels. Haloy has no private enterprise number of its own, 32473 is the one
+	// RFC 5612 reserves for documentation, which collectors treat like any other.
+	syslogSDID = "haloy@32473"
+	// syslogMaxUDPSize keeps messages within a UDP datagram, longer ones are cut short.
+	syslogMaxUDPSize = 60000
+)
+
+// syslogSink sends records as RFC 5424 messages, one per datagram over UDP and with octet
+// counting framing (RFC 6587) over TCP.
+type syslogSink struct {
+	network  string
+	address  string
+	hostname string
+	labels   map[string]string
+
+	conn net.Conn
+}
+
+func newSyslogSink(cfg config.LogSinkConfig) (*syslogSink, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid url: %w", err)
+	}
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+	return &syslogSink{
+		network:  u.Scheme,
+		address:  u.Host,
+		hostname: hostname,
+		labels:   cfg.Labels,
+	}, nil
+}
+
+func (s *syslogSink) Send(ctx context.Context, records []Record) error {
+	if s.conn == nil {
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, s.network, s.address)
+		if err != nil {
+			return fmt.Errorf("failed to connect to syslog server: %w", err)
+		}
+		s.conn = conn
+	}
+	deadline, _ := ctx.Deadline()
+	_ = s.conn.SetWriteDeadline(deadline)
+
+	for _, record := range records {
+		message := s.format(record)
+		if s.network == "tcp" {
+			message = fmt.Appendf(nil, "%d %s", len(message), message)
+		} else if len(message) > syslogMaxUDPSize {
+			message = message[:syslogMaxUDPSize]
+		}
+		if _, err := s.conn.Write(message); err != nil {
+			// Connect again on the next attempt, the server may have restarted.
+			s.conn.Close()
+			s.conn = nil
+			return fmt.Errorf("failed to send to syslog server: %w", err)
+		}
+	}
+	return nil
+}
+
+// format returns the RFC 5424 message for a record:
+// <PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID [SD] MSG
+func (s *syslogSink) format(record Record) []byte {
+	appName := SourceHaloyd
+	if record.Source == SourceApp {
+		appName = record.App
+	}
+
+	params := make(map[string]string, len(s.labels)+4)
+	for key, value := range s.labels {
+		params[key] = value
+	}
+	for key, value := range map[string]string{
+		"app":          record.App,
+		"deploymentId": record.DeploymentID,
+		"replica":      record.Replica,
+		"stream":       record.Stream,
+	} {
+		if value != "" {
+			params[key] = value
+		}
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "<%d>1 %s %s %s - - ",
+		syslogFacilityDaemon*8+syslogSeverity(record.Severity()),
+		record.Timestamp.UTC().Format("2006-01-02T15:04:05.000000Z07:00"),
+		syslogHeaderField(s.hostname, 255),
+		syslogHeaderField(appName, 48))
+	writeSyslogSD(&b, params)
+	b.WriteByte(' ')
+	b.WriteString(record.Text())
+	return b.Bytes()
+}
+
+func (s *syslogSink) Close() error {
+	if s.conn == nil {
+		return nil
+	}
+	return s.conn.Close()
+}
+
+func syslogSeverity(level string) int {
+	switch level {
+	case slog.LevelDebug.String():
+		return 7
+	case slog.LevelWarn.String():
+		return 4
+	case slog.LevelError.String():
+		return 3
+	default:
+		return 6
+	}
+}
+
+// syslogHeaderField makes a value fit a header field, which is printable ASCII without spaces.
+func syslogHeaderField(value string, maxLen int) string {
+	value = strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' {
+			return '_'
+		}
+		return r
+	}, value)
+	if value == "" {
+		return "-"
+	}
+	return value[:min(len(value), maxLen)]
+}
+
+func writeSyslogSD(b *bytes.Buffer, params map[string]string) {
+	if len(params) == 0 {
+		b.WriteByte('-')
+		return
+	}
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	b.WriteString("[" + syslogSDID)
+	for _, name := range names {
+		// Names can't contain '=', ' ', ']' or '"', values escape '"', '\' and ']'.
+		sdName := syslogHeaderField(strings.NewReplacer("=", "_", "]", "_", `"`, "_").Replace(name), 32)
+		value := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "]", `\]`).Replace(params[name])
+		fmt.Fprintf(b, ` %s="%s"`, sdName, value)
+	}
+	b.WriteByte(']')
+}
@@ -0,0 +1,94 @@
+package sshrunner
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+
+	"github.com/charmbracelet/x/term"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// defaultIdentities are the keys in ~/.ssh tried when no identity is configured, like ssh does.
+var defaultIdentities = []string{"id_ed25519", "id_ecdsa", "id_rsa"}
+
+// authMethods authenticates with the configured identity, or the default keys in ~/.ssh, and
+// the keys in ssh-agent. The returned function closes the connection to the agent.
+func authMethods(cfg Config) ([]ssh.AuthMethod, func()) {
+	var agentClient agent.ExtendedAgent
+	closeAgent := func() {}
+	if socket := os.Getenv("SSH_AUTH_SOCK"); socket != "" {
+		if conn, err := net.Dial("unix", socket); err == nil {
+			agentClient = agent.NewClient(conn)
+			closeAgent = func() { conn.Close() }
+		}
+	}
+
+	// Only one public key method is tried, so all keys are offered by the same one.
+	signers := func() ([]ssh.Signer, error) {
+		var signers []ssh.Signer
+		if cfg.Identity != "" {
+			signer, err := loadIdentity(cfg.Identity, true)
+			if err != nil {
+				return nil, err
+			}
+			signers = append(signers, signer)
+		}
+
+		var agentSigners []ssh.Signer
+		if agentClient != nil {
+			agentSigners, _ = agentClient.Signers()
+		}
+
+		if cfg.Identity == "" {
+			home, err := os.UserHomeDir()
+			if err == nil {
+				for _, name := range defaultIdentities {
+					// Passphrases of default keys are only asked for when the agent has no keys.
+					signer, err := loadIdentity(filepath.Join(home, ".ssh", name), len(agentSigners) == 0)
+					if err == nil {
+						signers = append(signers, signer)
+					}
+				}
+			}
+		}
+		return append(signers, agentSigners...), nil
+	}
+
+	return []ssh.AuthMethod{ssh.PublicKeysCallback(signers)}, closeAgent
+}
+
+// loadIdentity reads a private key file, asking for its passphrase on the terminal if it is
+// encrypted and askPassphrase is set.
+func loadIdentity(path string, askPassphrase bool) (ssh.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read SSH key %s: %w", path, err)
+	}
+	signer, err := ssh.ParsePrivateKey(data)
+	var missing *ssh.PassphraseMissingError
+	if !errors.As(err, &missing) {
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse SSH key %s: %w", path, err)
+		}
+		return signer, nil
+	}
+
+	if !askPassphrase || !term.IsTerminal(os.Stdin.Fd()) {
+		return nil, fmt.Errorf("SSH key %s is encrypted, add it to ssh-agent or use it from a terminal", path)
+	}
+	fmt.Fprintf(os.Stderr, "Enter passphrase for key '%s': ", path)
+	passphrase, err := term.ReadPassword(os.Stdin.Fd())
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read passphrase: %w", err)
+	}
+	signer, err = ssh.ParsePrivateKeyWithPassphrase(data, passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt SSH key %s: %w", path, err)
+	}
+	return signer, nil
+}
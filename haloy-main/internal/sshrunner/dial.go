@@ -0,0 +1,133 @@
+package sshrunner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// DialCommand connects to the stdin and stdout of a command run on the SSH server, like one
+// relaying to a Unix socket on the server. Every connection has its own SSH connection,
+// which is closed with it.
+func DialCommand(ctx context.Context, cfg Config, command string) (net.Conn, error) {
+	client, err := Connect(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := client.DialCommand(command)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	conn.(*commandConn).client = client
+	return conn, nil
+}
+
+// DialCommand connects to the stdin and stdout of a command run on the server.
+func (c *Client) DialCommand(command string) (net.Conn, error) {
+	session, err := c.client.NewSession()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open ssh session: %w", err)
+	}
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		session.Close()
+		return nil, fmt.Errorf("failed to create ssh stdin: %w", err)
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		session.Close()
+		return nil, fmt.Errorf("failed to create ssh stdout: %w", err)
+	}
+	conn := &commandConn{session: session, stdin: stdin, stdout: stdout, command: command, host: c.host}
+	session.Stderr = &conn.stderr
+
+	if err := session.Start(command); err != nil {
+		session.Close()
+		return nil, fmt.Errorf("failed to run %s: %w", command, err)
+	}
+	return conn, nil
+}
+
+// commandConn is a net.Conn over the stdin and stdout of a command run over SSH.
+type commandConn struct {
+	session *ssh.Session
+	client  *Client // Closed with the connection if it was opened for it
+	stdin   io.WriteCloser
+	stdout  io.Reader
+	stderr  lockedBuffer
+	command string
+	host    string
+
+	readAny   bool
+	closeOnce sync.Once
+	waitOnce  sync.Once
+}
+
+func (c *commandConn) Read(b []byte) (int, error) {
+	n, err := c.stdout.Read(b)
+	if n > 0 {
+		c.readAny = true
+	}
+	if errors.Is(err, io.EOF) && !c.readAny {
+		// Commands that fail exit without output, their stderr says why.
+		c.waitOnce.Do(func() { _ = c.session.Wait() })
+		if msg := strings.TrimSpace(c.stderr.String()); msg != "" {
+			return n, fmt.Errorf("ssh tunnel to %s failed: %s", c.host, msg)
+		}
+	}
+	return n, err
+}
+
+func (c *commandConn) Write(b []byte) (int, error) {
+	return c.stdin.Write(b)
+}
+
+func (c *commandConn) Close() error {
+	c.closeOnce.Do(func() {
+		c.stdin.Close()
+		c.session.Close()
+		if c.client != nil {
+			c.client.Close()
+		}
+	})
+	return nil
+}
+
+func (c *commandConn) LocalAddr() net.Addr  { return commandAddr("ssh") }
+func (c *commandConn) RemoteAddr() net.Addr { return commandAddr(c.host + ": " + c.command) }
+
+// Deadlines aren't supported on SSH channels, requests are bounded by their contexts instead.
+func (c *commandConn) SetDeadline(t time.Time) error      { return nil }
+func (c *commandConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *commandConn) SetWriteDeadline(t time.Time) error { return nil }
+
+type commandAddr string
+
+func (a commandAddr) Network() string { return "ssh" }
+func (a commandAddr) String() string  { return string(a) }
+
+// lockedBuffer collects stderr, which the session writes to while the connection is used.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf strings.Builder
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
@@ -0,0 +1,162 @@
+package sshrunner
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/charmbracelet/x/term"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// hostKeyMu serializes checking and adding host keys, so that connecting to the same new
+// host from several goroutines asks about it once.
+var hostKeyMu sync.Mutex
+
+// hostKeyVerification returns the callback checking the server's key against the known hosts
+// file, and the key algorithms to ask the server for: those of the keys known for it, so that
+// it doesn't present another key than the one that can be checked.
+func hostKeyVerification(cfg Config, address string) (ssh.HostKeyCallback, []string, error) {
+	path := cfg.KnownHostsFile
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to determine home directory: %w", err)
+		}
+		path = filepath.Join(home, ".ssh", "known_hosts")
+	}
+	confirm := cfg.ConfirmHostKey
+	if confirm == nil {
+		confirm = promptHostKey
+	}
+
+	hostKeyMu.Lock()
+	check, err := readKnownHosts(path)
+	hostKeyMu.Unlock()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	callback := func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		hostKeyMu.Lock()
+		defer hostKeyMu.Unlock()
+
+		// Read again, the host may have been added since.
+		check, err := readKnownHosts(path)
+		if err != nil {
+			return err
+		}
+		err = check(hostname, remote, key)
+		var keyErr *knownhosts.KeyError
+		if !errors.As(err, &keyErr) {
+			return err
+		}
+		if len(keyErr.Want) > 0 {
+			return fmt.Errorf("host key of %s doesn't match the one in %s (line %d). Someone could be intercepting the connection, or the server's key changed; if that is expected, remove the old key with: ssh-keygen -R %s",
+				hostname, path, keyErr.Want[0].Line, knownhosts.Normalize(hostname))
+		}
+
+		trusted, err := confirm(hostname, key)
+		if err != nil {
+			return err
+		}
+		if !trusted {
+			return fmt.Errorf("host key of %s isn't trusted", hostname)
+		}
+		return addKnownHost(path, hostname, key)
+	}
+
+	return callback, knownKeyAlgorithms(check, address), nil
+}
+
+// readKnownHosts parses the known hosts file, creating it if it doesn't exist yet.
+func readKnownHosts(path string) (ssh.HostKeyCallback, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", filepath.Dir(path), err)
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open known hosts file: %w", err)
+	}
+	f.Close()
+
+	check, err := knownhosts.New(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read known hosts file: %w", err)
+	}
+	return check, nil
+}
+
+func addKnownHost(path, hostname string, key ssh.PublicKey) error {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open known hosts file: %w", err)
+	}
+	defer f.Close()
+	if _, err := fmt.Fprintln(f, knownhosts.Line([]string{knownhosts.Normalize(hostname)}, key)); err != nil {
+		return fmt.Errorf("failed to add host key to %s: %w", path, err)
+	}
+	return nil
+}
+
+// knownKeyAlgorithms returns the algorithms of the keys known for address, or nil to accept any.
+func knownKeyAlgorithms(check ssh.HostKeyCallback, address string) []string {
+	// Checking a key that can't be known for the host lists the ones that are.
+	probe, err := ssh.NewPublicKey(ed25519.PublicKey(make([]byte, ed25519.PublicKeySize)))
+	if err != nil {
+		return nil
+	}
+	var keyErr *knownhosts.KeyError
+	if !errors.As(check(address, &net.TCPAddr{IP: net.IPv4zero}, probe), &keyErr) {
+		return nil
+	}
+
+	var algorithms []string
+	for _, known := range keyErr.Want {
+		keyAlgorithms := []string{known.Key.Type()}
+		if known.Key.Type() == ssh.KeyAlgoRSA {
+			// RSA keys are signed with SHA-2 by current servers.
+			keyAlgorithms = []string{ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA}
+		}
+		for _, algorithm := range keyAlgorithms {
+			if !slices.Contains(algorithms, algorithm) {
+				algorithms = append(algorithms, algorithm)
+			}
+		}
+	}
+	return algorithms
+}
+
+// promptHostKey asks on the terminal whether to trust a host seen for the first time.
+func promptHostKey(host string, key ssh.PublicKey) (bool, error) {
+	if !term.IsTerminal(os.Stdin.Fd()) {
+		hostname, port, _ := net.SplitHostPort(host)
+		return false, fmt.Errorf("host key of %s is unknown and there is no terminal to confirm it, add it to known_hosts first: ssh-keyscan -p %s %s >> ~/.ssh/known_hosts",
+			host, port, hostname)
+	}
+
+	fmt.Fprintf(os.Stderr, "The authenticity of host '%s' can't be established.\n", host)
+	fmt.Fprintf(os.Stderr, "%s key fingerprint is %s.\n", key.Type(), ssh.FingerprintSHA256(key))
+	reader := bufio.NewReader(os.Stdin)
+	for {
+		fmt.Fprint(os.Stderr, "Are you sure you want to continue connecting (yes/no)? ")
+		answer, err := reader.ReadString('\n')
+		if err != nil {
+			return false, fmt.Errorf("failed to read answer: %w", err)
+		}
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "yes":
+			return true, nil
+		case "no":
+			return false, nil
+		}
+	}
+}
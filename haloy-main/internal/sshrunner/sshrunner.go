@@ -3,18 +3,37 @@ package sshrunner
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
-	"os"
-	"os/exec"
+	"net"
 	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	defaultKeepAlive = 30 * time.Second
+	handshakeTimeout = 30 * time.Second
+	dialAttempts     = 3
 )
 
+// Config is where and as whom to connect. Unlike the ssh command, ~/.ssh/config isn't read.
 type Config struct {
 	User     string
 	Host     string
 	Port     int
-	Identity string
+	Identity string // Private key file, tried before the keys in ssh-agent
+
+	// KnownHostsFile is where host keys are checked and remembered, ~/.ssh/known_hosts by default.
+	KnownHostsFile string
+	// ConfirmHostKey decides whether to trust a host that isn't in KnownHostsFile yet. By default
+	// the user is asked on the terminal, and unknown hosts are rejected without one.
+	ConfirmHostKey func(host string, key ssh.PublicKey) (bool, error)
+	// KeepAlive is how often the server is checked to still be there, 30 seconds by default.
+	KeepAlive time.Duration
 }
 
 type Result struct {
@@ -23,78 +42,209 @@ type Result struct {
 	ExitCode int
 }
 
-func RunStreaming(
-	ctx context.Context,
-	cfg Config,
-	remoteCommand string,
-	stdout, stderr io.Writer,
-) (Result, error) {
-	if _, err := exec.LookPath("ssh"); err != nil {
-		return Result{}, fmt.Errorf("ssh binary not found: please install OpenSSH client")
-	}
-
-	args := buildSSHArgs(cfg, remoteCommand)
-	cmd := exec.CommandContext(ctx, "ssh", args...)
+// Client is a connection to an SSH server that commands can be run on and files uploaded to.
+type Client struct {
+	client *ssh.Client
+	host   string
 
-	cmd.Stdin = os.Stdin
+	done      chan struct{}
+	closeOnce sync.Once
+}
 
-	var stdoutBuf, stderrBuf bytes.Buffer
+// Connect connects and authenticates to the server with the keys in ssh-agent and cfg.Identity
+// or the default keys in ~/.ssh. Failing to reach the server is retried a few times.
+func Connect(ctx context.Context, cfg Config) (*Client, error) {
+	user := cfg.User
+	if user == "" {
+		user = "root"
+	}
+	port := cfg.Port
+	if port == 0 {
+		port = 22
+	}
+	address := net.JoinHostPort(cfg.Host, strconv.Itoa(port))
 
-	if stdout != nil {
-		cmd.Stdout = io.MultiWriter(stdout, &stdoutBuf)
-	} else {
-		cmd.Stdout = &stdoutBuf
+	hostKeyCallback, hostKeyAlgorithms, err := hostKeyVerification(cfg, address)
+	if err != nil {
+		return nil, err
+	}
+	auth, closeAgent := authMethods(cfg)
+	defer closeAgent()
+
+	clientConfig := &ssh.ClientConfig{
+		User:              user,
+		Auth:              auth,
+		HostKeyCallback:   hostKeyCallback,
+		HostKeyAlgorithms: hostKeyAlgorithms,
 	}
 
-	if stderr != nil {
-		cmd.Stderr = io.MultiWriter(stderr, &stderrBuf)
-	} else {
-		cmd.Stderr = &stderrBuf
+	conn, err := dialWithRetry(ctx, address)
+	if err != nil {
+		return nil, err
 	}
 
-	err := cmd.Run()
+	// The handshake isn't bound to ctx by itself.
+	deadline := time.Now().Add(handshakeTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	_ = conn.SetDeadline(deadline)
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, address, clientConfig)
+	stop()
+	if err != nil {
+		conn.Close()
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, fmt.Errorf("failed to connect to %s: %w", cfg.Host, err)
+	}
+	_ = conn.SetDeadline(time.Time{})
 
-	result := Result{
-		Stdout:   stdoutBuf.String(),
-		Stderr:   stderrBuf.String(),
-		ExitCode: 0,
+	c := &Client{
+		client: ssh.NewClient(sshConn, chans, reqs),
+		host:   cfg.Host,
+		done:   make(chan struct{}),
+	}
+	keepAlive := cfg.KeepAlive
+	if keepAlive == 0 {
+		keepAlive = defaultKeepAlive
 	}
+	go c.keepAlive(keepAlive)
+	return c, nil
+}
 
-	if err != nil {
-		if exitErr, ok := err.(*exec.ExitError); ok {
-			result.ExitCode = exitErr.ExitCode()
-			return result, fmt.Errorf("ssh command failed (exit %d): %s", result.ExitCode, stderrBuf.String())
+// dialWithRetry connects to the server, retrying if it can't be reached. Handshake errors
+// aren't retried, they are mostly about keys that won't be different the next time.
+func dialWithRetry(ctx context.Context, address string) (net.Conn, error) {
+	var dialer net.Dialer
+	var err error
+	for attempt := 1; ; attempt++ {
+		var conn net.Conn
+		conn, err = dialer.DialContext(ctx, "tcp", address)
+		if err == nil {
+			return conn, nil
 		}
-		return result, fmt.Errorf("ssh command failed: %w", err)
+		if attempt == dialAttempts || ctx.Err() != nil {
+			break
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(time.Duration(attempt) * time.Second):
+		}
+	}
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return nil, ctxErr
 	}
+	return nil, fmt.Errorf("failed to reach %s: %w", address, err)
+}
 
-	return result, nil
+// keepAlive closes the connection when the server stops answering, so that commands and
+// tunnels fail instead of hanging.
+func (c *Client) keepAlive(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+		}
+
+		errc := make(chan error, 1)
+		go func() {
+			// Servers answer requests they don't know with a failure, which is fine.
+			_, _, err := c.client.SendRequest("keepalive@openssh.com", true, nil)
+			errc <- err
+		}()
+		select {
+		case <-c.done:
+			return
+		case err := <-errc:
+			if err != nil {
+				c.Close()
+				return
+			}
+		case <-time.After(interval):
+			c.Close()
+			return
+		}
+	}
 }
 
-func Run(ctx context.Context, cfg Config, remoteCommand string) (Result, error) {
-	return RunStreaming(ctx, cfg, remoteCommand, nil, nil)
+func (c *Client) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		close(c.done)
+		err = c.client.Close()
+	})
+	return err
 }
 
-func buildSSHArgs(cfg Config, remoteCommand string) []string {
-	args := []string{
-		"-o", "StrictHostKeyChecking=accept-new",
-		"-o", "BatchMode=no",
+// Run runs a command on the server and returns its output, which is also written to stdout
+// and stderr if they are set. Cancelling ctx kills the command.
+func (c *Client) Run(ctx context.Context, remoteCommand string, stdout, stderr io.Writer) (Result, error) {
+	session, err := c.client.NewSession()
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to open ssh session: %w", err)
 	}
+	defer session.Close()
 
-	if cfg.Port != 0 && cfg.Port != 22 {
-		args = append(args, "-p", strconv.Itoa(cfg.Port))
+	var stdoutBuf, stderrBuf bytes.Buffer
+	session.Stdout = &stdoutBuf
+	if stdout != nil {
+		session.Stdout = io.MultiWriter(stdout, &stdoutBuf)
+	}
+	session.Stderr = &stderrBuf
+	if stderr != nil {
+		session.Stderr = io.MultiWriter(stderr, &stderrBuf)
 	}
 
-	if cfg.Identity != "" {
-		args = append(args, "-i", cfg.Identity)
+	if err := session.Start(remoteCommand); err != nil {
+		return Result{}, fmt.Errorf("ssh command failed: %w", err)
+	}
+	errc := make(chan error, 1)
+	go func() { errc <- session.Wait() }()
+
+	select {
+	case err = <-errc:
+	case <-ctx.Done():
+		_ = session.Signal(ssh.SIGKILL)
+		session.Close()
+		<-errc
+		return Result{Stdout: stdoutBuf.String(), Stderr: stderrBuf.String()}, ctx.Err()
 	}
 
-	user := cfg.User
-	if user == "" {
-		user = "root"
+	result := Result{
+		Stdout: stdoutBuf.String(),
+		Stderr: stderrBuf.String(),
 	}
+	if err != nil {
+		var exitErr *ssh.ExitError
+		if errors.As(err, &exitErr) {
+			result.ExitCode = exitErr.ExitStatus()
+			return result, fmt.Errorf("ssh command failed (exit %d): %s", result.ExitCode, result.Stderr)
+		}
+		return result, fmt.Errorf("ssh command failed: %w", err)
+	}
+	return result, nil
+}
 
-	args = append(args, user+"@"+cfg.Host, remoteCommand)
+// RunStreaming connects to the server, runs a command and disconnects.
+func RunStreaming(
+	ctx context.Context,
+	cfg Config,
+	remoteCommand string,
+	stdout, stderr io.Writer,
+) (Result, error) {
+	client, err := Connect(ctx, cfg)
+	if err != nil {
+		return Result{}, err
+	}
+	defer client.Close()
+	return client.Run(ctx, remoteCommand, stdout, stderr)
+}
 
-	return args
+func Run(ctx context.Context, cfg Config, remoteCommand string) (Result, error) {
+	return RunStreaming(ctx, cfg, remoteCommand, nil, nil)
 }
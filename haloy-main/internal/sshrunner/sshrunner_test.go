@@ -0,0 +1,378 @@
+package sshrunner
+
+import (
+	"bufio"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// testServer is an in-process SSH server that understands a few commands: echo, fail, cat,
+// sleep and scp -t.
+type testServer struct {
+	port    int
+	hostKey ssh.Signer
+
+	mu       sync.Mutex
+	uploaded map[string]uploadedFile
+}
+
+type uploadedFile struct {
+	name    string
+	mode    string
+	content string
+}
+
+func newSigner(t *testing.T) (ssh.Signer, ed25519.PrivateKey) {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer, key
+}
+
+// startTestServer starts a server accepting the client key and returns it with a Config
+// connecting to it that trusts any new host.
+func startTestServer(t *testing.T) (*testServer, Config) {
+	t.Helper()
+	// Keep the developer's agent and keys out of the tests.
+	t.Setenv("SSH_AUTH_SOCK", "")
+	t.Setenv("HOME", t.TempDir())
+
+	clientSigner, clientKey := newSigner(t)
+	block, err := ssh.MarshalPrivateKey(clientKey, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	identity := filepath.Join(t.TempDir(), "id_ed25519")
+	if err := os.WriteFile(identity, pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	hostKey, _ := newSigner(t)
+	serverConfig := &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if string(key.Marshal()) == string(clientSigner.PublicKey().Marshal()) {
+				return nil, nil
+			}
+			return nil, errors.New("unknown key")
+		},
+	}
+	serverConfig.AddHostKey(hostKey)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	s := &testServer{
+		port:     listener.Addr().(*net.TCPAddr).Port,
+		hostKey:  hostKey,
+		uploaded: make(map[string]uploadedFile),
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serveConn(conn, serverConfig)
+		}
+	}()
+
+	cfg := Config{
+		User:           "deploy",
+		Host:           "127.0.0.1",
+		Port:           s.port,
+		Identity:       identity,
+		KnownHostsFile: filepath.Join(t.TempDir(), "known_hosts"),
+		ConfirmHostKey: func(host string, key ssh.PublicKey) (bool, error) { return true, nil },
+	}
+	return s, cfg
+}
+
+func (s *testServer) serveConn(conn net.Conn, config *ssh.ServerConfig) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "session" {
+			_ = newChannel.Reject(ssh.UnknownChannelType, "only sessions")
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+		go func() {
+			for req := range requests {
+				if req.Type != "exec" {
+					_ = req.Reply(false, nil)
+					continue
+				}
+				var payload struct{ Command string }
+				if err := ssh.Unmarshal(req.Payload, &payload); err != nil {
+					_ = req.Reply(false, nil)
+					continue
+				}
+				_ = req.Reply(true, nil)
+				go func() {
+					status := s.exec(channel, payload.Command)
+					_, _ = channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{status}))
+					channel.Close()
+				}()
+			}
+		}()
+	}
+}
+
+func (s *testServer) exec(channel ssh.Channel, command string) uint32 {
+	switch {
+	case strings.HasPrefix(command, "echo "):
+		fmt.Fprintln(channel, strings.TrimPrefix(command, "echo "))
+		return 0
+	case command == "fail":
+		fmt.Fprintln(channel.Stderr(), "boom")
+		return 3
+	case command == "cat":
+		_, _ = io.Copy(channel, channel)
+		return 0
+	case command == "sleep":
+		time.Sleep(2 * time.Second)
+		return 0
+	case strings.HasPrefix(command, "scp -t "):
+		return s.receiveSCP(channel, strings.TrimPrefix(command, "scp -t "))
+	}
+	fmt.Fprintf(channel.Stderr(), "unknown command: %s\n", command)
+	return 127
+}
+
+func (s *testServer) receiveSCP(channel ssh.Channel, quotedPath string) uint32 {
+	r := bufio.NewReader(channel)
+	_, _ = channel.Write([]byte{0})
+	header, err := r.ReadString('\n')
+	if err != nil {
+		return 1
+	}
+	var mode, name string
+	var size int
+	if _, err := fmt.Sscanf(header, "C%s %d %s\n", &mode, &size, &name); err != nil {
+		fmt.Fprintf(channel, "\x01bad header %q\n", header)
+		return 1
+	}
+	_, _ = channel.Write([]byte{0})
+	content := make([]byte, size+1)
+	if _, err := io.ReadFull(r, content); err != nil || content[size] != 0 {
+		return 1
+	}
+	s.mu.Lock()
+	s.uploaded[quotedPath] = uploadedFile{name: name, mode: mode, content: string(content[:size])}
+	s.mu.Unlock()
+	_, _ = channel.Write([]byte{0})
+	return 0
+}
+
+func TestRunTrustsNewHostOnce(t *testing.T) {
+	s, cfg := startTestServer(t)
+	prompts := 0
+	cfg.ConfirmHostKey = func(host string, key ssh.PublicKey) (bool, error) {
+		prompts++
+		if ssh.FingerprintSHA256(key) != ssh.FingerprintSHA256(s.hostKey.PublicKey()) {
+			t.Errorf("asked about key %s, want the server's", ssh.FingerprintSHA256(key))
+		}
+		return true, nil
+	}
+
+	for range 2 {
+		result, err := Run(context.Background(), cfg, "echo hello")
+		if err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+		if result.Stdout != "hello\n" {
+			t.Errorf("Stdout = %q, want %q", result.Stdout, "hello\n")
+		}
+	}
+	if prompts != 1 {
+		t.Errorf("asked to trust the host %d times, want 1", prompts)
+	}
+
+	knownHosts, err := os.ReadFile(cfg.KnownHostsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "[127.0.0.1]:" + strconv.Itoa(s.port) + " ssh-ed25519 "; !strings.HasPrefix(string(knownHosts), want) {
+		t.Errorf("known_hosts = %q, want it to start with %q", knownHosts, want)
+	}
+}
+
+func TestRunRejectsUntrustedHost(t *testing.T) {
+	_, cfg := startTestServer(t)
+	cfg.ConfirmHostKey = func(host string, key ssh.PublicKey) (bool, error) { return false, nil }
+
+	if _, err := Run(context.Background(), cfg, "echo hello"); err == nil || !strings.Contains(err.Error(), "isn't trusted") {
+		t.Fatalf("Run() error = %v, want host not trusted", err)
+	}
+	if knownHosts, _ := os.ReadFile(cfg.KnownHostsFile); len(knownHosts) != 0 {
+		t.Errorf("known_hosts = %q, want it empty", knownHosts)
+	}
+}
+
+func TestRunRejectsChangedHostKey(t *testing.T) {
+	s, cfg := startTestServer(t)
+	otherKey, _ := newSigner(t)
+	line := fmt.Sprintf("[127.0.0.1]:%d %s", s.port, ssh.MarshalAuthorizedKey(otherKey.PublicKey()))
+	if err := os.WriteFile(cfg.KnownHostsFile, []byte(line), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg.ConfirmHostKey = func(host string, key ssh.PublicKey) (bool, error) {
+		t.Error("asked to trust a host whose key changed")
+		return true, nil
+	}
+
+	if _, err := Run(context.Background(), cfg, "echo hello"); err == nil || !strings.Contains(err.Error(), "doesn't match") {
+		t.Fatalf("Run() error = %v, want host key mismatch", err)
+	}
+}
+
+func TestRunRejectsUnknownClientKey(t *testing.T) {
+	_, cfg := startTestServer(t)
+	_, otherKey := newSigner(t)
+	block, err := ssh.MarshalPrivateKey(otherKey, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Identity = filepath.Join(t.TempDir(), "other")
+	if err := os.WriteFile(cfg.Identity, pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Run(context.Background(), cfg, "echo hello"); err == nil || !strings.Contains(err.Error(), "unable to authenticate") {
+		t.Fatalf("Run() error = %v, want authentication failure", err)
+	}
+}
+
+func TestRunReportsExitCode(t *testing.T) {
+	_, cfg := startTestServer(t)
+
+	result, err := Run(context.Background(), cfg, "fail")
+	if err == nil {
+		t.Fatal("Run() error = nil, want the command's failure")
+	}
+	if result.ExitCode != 3 {
+		t.Errorf("ExitCode = %d, want 3", result.ExitCode)
+	}
+	if result.Stderr != "boom\n" {
+		t.Errorf("Stderr = %q, want %q", result.Stderr, "boom\n")
+	}
+}
+
+func TestRunStopsWhenCancelled(t *testing.T) {
+	_, cfg := startTestServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if _, err := Run(ctx, cfg, "sleep"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Run() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Run() returned after %s, want it to stop when cancelled", elapsed)
+	}
+}
+
+func TestUpload(t *testing.T) {
+	s, cfg := startTestServer(t)
+	client, err := Connect(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	defer client.Close()
+
+	content := "API_TOKEN=secret\n"
+	remotePath := "/etc/haloy/it's.env"
+	if err := client.Upload(context.Background(), strings.NewReader(content), int64(len(content)), 0o640, remotePath); err != nil {
+		t.Fatalf("Upload() error = %v", err)
+	}
+
+	s.mu.Lock()
+	got, ok := s.uploaded[shellQuote(remotePath)]
+	s.mu.Unlock()
+	if !ok {
+		t.Fatalf("nothing uploaded to %s: %v", remotePath, s.uploaded)
+	}
+	want := uploadedFile{name: "it's.env", mode: "0640", content: content}
+	if got != want {
+		t.Errorf("uploaded %+v, want %+v", got, want)
+	}
+}
+
+func TestDialCommand(t *testing.T) {
+	_, cfg := startTestServer(t)
+	conn, err := DialCommand(context.Background(), cfg, "cat")
+	if err != nil {
+		t.Fatalf("DialCommand() error = %v", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if string(buf) != "ping" {
+		t.Errorf("read %q, want %q", buf, "ping")
+	}
+}
+
+func TestDialCommandReportsFailure(t *testing.T) {
+	_, cfg := startTestServer(t)
+	conn, err := DialCommand(context.Background(), cfg, "fail")
+	if err != nil {
+		t.Fatalf("DialCommand() error = %v", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Read(make([]byte, 1)); err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Fatalf("Read() error = %v, want the command's stderr", err)
+	}
+}
+
+func TestKeepAliveKeepsAnsweringConnectionOpen(t *testing.T) {
+	_, cfg := startTestServer(t)
+	cfg.KeepAlive = 20 * time.Millisecond
+	client, err := Connect(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	defer client.Close()
+
+	time.Sleep(100 * time.Millisecond)
+	if _, err := client.Run(context.Background(), "echo still there", nil, nil); err != nil {
+		t.Fatalf("Run() after keepalives error = %v", err)
+	}
+}
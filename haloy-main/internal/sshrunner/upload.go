@@ -0,0 +1,111 @@
+package sshrunner
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// UploadFile copies a local file to remotePath on the server, keeping its permissions.
+func (c *Client) UploadFile(ctx context.Context, localPath, remotePath string) error {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", localPath, err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat %s: %w", localPath, err)
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("%s is not a regular file", localPath)
+	}
+	return c.Upload(ctx, f, info.Size(), info.Mode().Perm(), remotePath)
+}
+
+// Upload writes size bytes from r to remotePath on the server, with the scp protocol that
+// servers with OpenSSH support without extra setup.
+func (c *Client) Upload(ctx context.Context, r io.Reader, size int64, mode os.FileMode, remotePath string) error {
+	session, err := c.client.NewSession()
+	if err != nil {
+		return fmt.Errorf("failed to open ssh session: %w", err)
+	}
+	defer session.Close()
+	stop := context.AfterFunc(ctx, func() { session.Close() })
+	defer stop()
+
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		return fmt.Errorf("failed to create ssh stdin: %w", err)
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("failed to create ssh stdout: %w", err)
+	}
+	var stderr strings.Builder
+	session.Stderr = &stderr
+
+	if err := session.Start("scp -t " + shellQuote(remotePath)); err != nil {
+		return fmt.Errorf("failed to start scp: %w", err)
+	}
+
+	err = sendSCPFile(bufio.NewReader(stdout), stdin, r, size, mode, path.Base(remotePath))
+	stdin.Close()
+	if waitErr := session.Wait(); err == nil && waitErr != nil {
+		err = fmt.Errorf("scp failed: %w %s", waitErr, strings.TrimSpace(stderr.String()))
+	}
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		return fmt.Errorf("failed to upload to %s:%s: %w", c.host, remotePath, err)
+	}
+	return nil
+}
+
+// sendSCPFile speaks the source side of scp: announce the file, send its content and a zero
+// byte, and wait for the sink to acknowledge each step.
+func sendSCPFile(acks *bufio.Reader, w io.Writer, r io.Reader, size int64, mode os.FileMode, name string) error {
+	if err := readSCPAck(acks); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "C%04o %d %s\n", mode.Perm(), size, name); err != nil {
+		return err
+	}
+	if err := readSCPAck(acks); err != nil {
+		return err
+	}
+	if _, err := io.CopyN(w, r, size); err != nil {
+		return err
+	}
+	if _, err := w.Write([]byte{0}); err != nil {
+		return err
+	}
+	return readSCPAck(acks)
+}
+
+// readSCPAck reads the sink's answer: a zero byte, or a warning or error followed by a message.
+func readSCPAck(r *bufio.Reader) error {
+	code, err := r.ReadByte()
+	if err != nil {
+		return fmt.Errorf("scp didn't respond: %w", err)
+	}
+	if code == 0 {
+		return nil
+	}
+	message, _ := r.ReadString('\n')
+	if message = strings.TrimSpace(message); message == "" {
+		return errors.New("scp failed")
+	}
+	return errors.New(message)
+}
+
+// shellQuote quotes s for the POSIX shell the server runs commands with.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -1,9 +1,300 @@
 package storage
 
-func (db *DB) Migrate() error {
-	if err := createDeploymentsTable(db); err != nil {
+import (
+	"crypto/sha256"
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/haloydev/haloy/internal/constants"
+)
+
+// Migrations are numbered SQL files, named like 0002_add_deployment_status.sql. Each runs
+// once, in its own transaction, and is recorded in schema_migrations with a checksum of its
+// SQL. Add new migrations with the next number and never change or renumber applied ones.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// maxDatabaseBackups is how many of the backups taken before migrating are kept.
+const maxDatabaseBackups = 5
+
+type Migration struct {
+	Version  int
+	Name     string
+	Checksum string // Hex encoded SHA-256 of the migration's SQL
+	sql      string
+}
+
+// MigrationStatus tells whether a migration was applied to the database.
+type MigrationStatus struct {
+	Migration
+	AppliedAt *time.Time
+	// ChecksumMismatch is set when the migration changed after it was applied.
+	ChecksumMismatch bool
+	// Unknown is set for migrations applied by a newer version of haloy.
+	Unknown bool
+}
+
+// MigrationReport describes what Migrate did.
+type MigrationReport struct {
+	Applied []Migration
+	// BackupPath is the copy of the database taken before migrating. Empty when nothing was
+	// applied or the database was empty.
+	BackupPath string
+}
+
+// loadMigrations reads the migrations in the migrations directory of fsys, ordered by version.
+func loadMigrations(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, "migrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	migrations := make([]Migration, 0, len(entries))
+	for _, entry := range entries {
+		base, ok := strings.CutSuffix(entry.Name(), ".sql")
+		if !ok {
+			continue
+		}
+		number, name, ok := strings.Cut(base, "_")
+		if !ok {
+			return nil, fmt.Errorf("migration %s must be named <version>_<name>.sql", entry.Name())
+		}
+		version, err := strconv.Atoi(number)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s must start with its version: %w", entry.Name(), err)
+		}
+		data, err := fs.ReadFile(fsys, path.Join("migrations", entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", entry.Name(), err)
+		}
+		sum := sha256.Sum256(data)
+		migrations = append(migrations, Migration{
+			Version:  version,
+			Name:     strings.ReplaceAll(name, "_", " "),
+			Checksum: hex.EncodeToString(sum[:]),
+			sql:      string(data),
+		})
+	}
+
+	slices.SortFunc(migrations, func(a, b Migration) int { return a.Version - b.Version })
+	for i, migration := range migrations {
+		if migration.Version != i+1 {
+			return nil, fmt.Errorf("migrations must be numbered from 1 without gaps, found version %d at position %d", migration.Version, i+1)
+		}
+	}
+	return migrations, nil
+}
+
+// prepareMigrations creates the schema_migrations table.
+func (db *DB) prepareMigrations() error {
+	_, err := db.Exec(`
+CREATE TABLE IF NOT EXISTS schema_migrations (
+    version INTEGER PRIMARY KEY,
+    name TEXT NOT NULL,
+    checksum TEXT NOT NULL,     -- SHA-256 of the migration's SQL when it was applied
+    applied_at DATETIME NOT NULL
+);
+`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+	return nil
+}
+
+// appliedMigrations returns the migrations recorded in schema_migrations by version, none if
+// the table doesn't exist yet.
+func (db *DB) appliedMigrations() (map[int]MigrationStatus, error) {
+	var tables int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations'`).Scan(&tables); err != nil {
+		return nil, fmt.Errorf("failed to read applied migrations: %w", err)
+	}
+	applied := make(map[int]MigrationStatus)
+	if tables == 0 {
+		return applied, nil
+	}
+
+	rows, err := db.Query(`SELECT version, name, checksum, applied_at FROM schema_migrations ORDER BY version`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read applied migrations: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var status MigrationStatus
+		var appliedAt time.Time
+		if err := rows.Scan(&status.Version, &status.Name, &status.Checksum, &appliedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan applied migration: %w", err)
+		}
+		status.AppliedAt = &appliedAt
+		applied[status.Version] = status
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read applied migrations: %w", err)
+	}
+	return applied, nil
+}
+
+func recordMigration(tx *sql.Tx, migration Migration) error {
+	_, err := tx.Exec(`INSERT INTO schema_migrations (version, name, checksum, applied_at) VALUES (?, ?, ?, ?)`,
+		migration.Version, migration.Name, migration.Checksum, time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("failed to record migration %d (%s): %w", migration.Version, migration.Name, err)
+	}
+	return nil
+}
+
+// MigrationStatus lists the known migrations and whether they were applied, followed by
+// those applied by a newer version of haloy. It doesn't change the database.
+func (db *DB) MigrationStatus() ([]MigrationStatus, error) {
+	migrations, err := loadMigrations(migrationFiles)
+	if err != nil {
+		return nil, err
+	}
+	applied, err := db.appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	for _, migration := range migrations {
+		status := MigrationStatus{Migration: migration}
+		if a, ok := applied[migration.Version]; ok {
+			status.AppliedAt = a.AppliedAt
+			status.ChecksumMismatch = a.Checksum != migration.Checksum
+			delete(applied, migration.Version)
+		}
+		statuses = append(statuses, status)
+	}
+	for _, version := range slices.Sorted(maps.Keys(applied)) {
+		status := applied[version]
+		status.Unknown = true
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// Migrate applies the pending migrations after backing up the database. It refuses to run
+// when an applied migration was changed or the database was migrated by a newer haloy.
+func (db *DB) Migrate() (MigrationReport, error) {
+	var report MigrationReport
+
+	if err := db.prepareMigrations(); err != nil {
+		return report, err
+	}
+	statuses, err := db.MigrationStatus()
+	if err != nil {
+		return report, err
+	}
+
+	var pending []Migration
+	current := 0
+	for _, status := range statuses {
+		switch {
+		case status.Unknown:
+			return report, fmt.Errorf("database has migration %d (%s) applied, which this version of haloy doesn't know, upgrade haloy", status.Version, status.Name)
+		case status.ChecksumMismatch:
+			return report, fmt.Errorf("migration %d (%s) changed after it was applied", status.Version, status.Name)
+		case status.AppliedAt == nil:
+			pending = append(pending, status.Migration)
+		default:
+			current = status.Version
+		}
+	}
+	if len(pending) == 0 {
+		return report, nil
+	}
+
+	empty, err := db.isEmpty()
+	if err != nil {
+		return report, err
+	}
+	if !empty {
+		if report.BackupPath, err = db.backupBeforeMigrating(current); err != nil {
+			return report, err
+		}
+	}
+
+	for _, migration := range pending {
+		if err := db.applyMigration(migration); err != nil {
+			return report, err
+		}
+		report.Applied = append(report.Applied, migration)
+	}
+	return report, nil
+}
+
+func (db *DB) applyMigration(migration Migration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to start migration %d (%s): %w", migration.Version, migration.Name, err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(migration.sql); err != nil {
+		return fmt.Errorf("migration %d (%s) failed: %w", migration.Version, migration.Name, err)
+	}
+	if err := recordMigration(tx, migration); err != nil {
 		return err
 	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit migration %d (%s): %w", migration.Version, migration.Name, err)
+	}
+	return nil
+}
+
+// isEmpty reports whether the database has no tables besides schema_migrations.
+func (db *DB) isEmpty() (bool, error) {
+	var tables int
+	err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name NOT IN ('schema_migrations', 'sqlite_sequence')`).Scan(&tables)
+	if err != nil {
+		return false, fmt.Errorf("failed to list tables: %w", err)
+	}
+	return tables == 0, nil
+}
 
+// Backup writes a consistent copy of the database to path, which must not exist.
+func (db *DB) Backup(path string) error {
+	if _, err := db.Exec(`VACUUM INTO ?`, path); err != nil {
+		return fmt.Errorf("failed to back up database to %s: %w", path, err)
+	}
 	return nil
 }
+
+// backupBeforeMigrating backs up the database next to it, named after the time and the
+// version it is at, and removes all but the newest backups.
+func (db *DB) backupBeforeMigrating(version int) (string, error) {
+	if db.path == "" {
+		return "", nil
+	}
+	dir := filepath.Join(filepath.Dir(db.path), constants.DBBackupDir)
+	if err := os.MkdirAll(dir, constants.ModeDirPrivate); err != nil {
+		return "", fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	backupPath := filepath.Join(dir, fmt.Sprintf("haloy-%s-v%d.db", time.Now().UTC().Format("20060102T150405Z"), version))
+	if err := db.Backup(backupPath); err != nil {
+		return "", err
+	}
+
+	// Names start with the time, so they sort oldest first.
+	backups, err := filepath.Glob(filepath.Join(dir, "haloy-*.db"))
+	if err == nil && len(backups) > maxDatabaseBackups {
+		slices.Sort(backups)
+		for _, old := range backups[:len(backups)-maxDatabaseBackups] {
+			os.Remove(old)
+		}
+	}
+	return backupPath, nil
+}
@@ -0,0 +1,73 @@
+-- Tables from before versioned migrations. They are created if missing, servers set up
+-- before then already have them.
+
+CREATE TABLE IF NOT EXISTS deployments (
+    id TEXT PRIMARY KEY,                    -- Timestamp-based ID
+    app_name TEXT NOT NULL,                 -- App being deployed
+    raw_app_config JSON NOT NULL,           -- config.AppConfig as JSON
+    deployed_image json not null,           -- Resolved config.Image config that was actually deployed
+    rolled_back_from TEXT,                  -- ID of deployment this was rolled back from
+
+    -- Foreign key constraint (optional)
+    FOREIGN KEY (rolled_back_from) REFERENCES deployments(id)
+);
+
+-- Indexes for efficient queries
+CREATE INDEX IF NOT EXISTS idx_deployments_app_name ON deployments(app_name);
+
+CREATE TABLE IF NOT EXISTS canaries (
+    app_name TEXT PRIMARY KEY,              -- One canary per app
+    stable_deployment_id TEXT NOT NULL,     -- Deployment receiving the remaining traffic
+    canary_deployment_id TEXT NOT NULL,     -- Deployment being tested
+    weight INTEGER NOT NULL,                -- Percentage of traffic sent to the canary
+    created_at DATETIME NOT NULL,
+    updated_at DATETIME NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS previews (
+    app_name TEXT PRIMARY KEY,              -- One preview per app
+    live_deployment_id TEXT NOT NULL,       -- Deployment serving the app's domains
+    preview_deployment_id TEXT NOT NULL,    -- Deployment waiting for promotion
+    created_at DATETIME NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS auto_rollbacks (
+    deployment_id TEXT PRIMARY KEY,         -- Deployment that was rolled back
+    app_name TEXT NOT NULL,
+    rolled_back_to TEXT NOT NULL,           -- Deployment whose config was restored
+    rollback_deployment_id TEXT NOT NULL,   -- New deployment created by the rollback
+    reason TEXT NOT NULL,
+    created_at DATETIME NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_auto_rollbacks_app_name ON auto_rollbacks(app_name);
+
+CREATE TABLE IF NOT EXISTS sleeping_apps (
+    app_name TEXT PRIMARY KEY,      -- One sleeping deployment per app
+    deployment_id TEXT NOT NULL,    -- Deployment whose containers were stopped
+    slept_at DATETIME NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS mirrors (
+    app_name TEXT PRIMARY KEY,                 -- One mirror per app
+    live_deployment_id TEXT NOT NULL,          -- Deployment answering the requests
+    candidate_deployment_id TEXT NOT NULL,     -- Deployment receiving the copies
+    all_methods BOOLEAN NOT NULL DEFAULT 0,
+    created_at DATETIME NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS mirror_results (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    app_name TEXT NOT NULL,
+    candidate_deployment_id TEXT NOT NULL,
+    method TEXT NOT NULL,
+    path TEXT NOT NULL,
+    live_status INTEGER NOT NULL,
+    live_latency_ms INTEGER NOT NULL,
+    mirror_status INTEGER NOT NULL,
+    mirror_latency_ms INTEGER NOT NULL,
+    error TEXT NOT NULL DEFAULT '',
+    created_at DATETIME NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_mirror_results_app_candidate ON mirror_results(app_name, candidate_deployment_id);
@@ -0,0 +1,17 @@
+-- The status and timeline of deployments. Deployments stored before were only saved once
+-- they went live, so they are marked as succeeded.
+ALTER TABLE deployments ADD COLUMN status TEXT NOT NULL DEFAULT 'succeeded';
+ALTER TABLE deployments ADD COLUMN started_at DATETIME;
+ALTER TABLE deployments ADD COLUMN finished_at DATETIME;
+ALTER TABLE deployments ADD COLUMN failure_reason TEXT NOT NULL DEFAULT '';
+ALTER TABLE deployments ADD COLUMN deployed_by TEXT NOT NULL DEFAULT '';
+ALTER TABLE deployments ADD COLUMN message TEXT NOT NULL DEFAULT '';
+ALTER TABLE deployments ADD COLUMN pull_ms INTEGER;
+ALTER TABLE deployments ADD COLUMN start_ms INTEGER;
+ALTER TABLE deployments ADD COLUMN health_ms INTEGER;
+ALTER TABLE deployments ADD COLUMN route_switch_ms INTEGER;
+
+CREATE INDEX IF NOT EXISTS idx_deployments_app_name_status ON deployments(app_name, status);
+
+-- Cancelled deployments were kept in a table of their own before deployments had a status.
+DROP TABLE IF EXISTS cancelled_deployments;
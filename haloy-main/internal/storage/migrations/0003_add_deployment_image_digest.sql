@@ -0,0 +1,2 @@
+-- The digest of the image a deployment ran, which tells deployments of a reused tag apart.
+ALTER TABLE deployments ADD COLUMN image_digest TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,5 @@
+-- The git commit, branch and labels a deployment was started with.
+ALTER TABLE deployments ADD COLUMN git_commit TEXT NOT NULL DEFAULT '';
+ALTER TABLE deployments ADD COLUMN git_branch TEXT NOT NULL DEFAULT '';
+ALTER TABLE deployments ADD COLUMN git_dirty INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE deployments ADD COLUMN labels TEXT NOT NULL DEFAULT ''; -- JSON object, empty without labels
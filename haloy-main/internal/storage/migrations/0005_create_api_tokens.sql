@@ -0,0 +1,27 @@
+-- Named API tokens and the log of the actions taken with them.
+CREATE TABLE api_tokens (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,        -- SHA-256 of the token, the token itself is only shown once
+    scopes TEXT NOT NULL,                   -- Comma separated apitoken.Scope values
+    apps TEXT NOT NULL DEFAULT '',          -- Comma separated app name globs, empty for all apps
+    created_at DATETIME NOT NULL,
+    expires_at DATETIME,
+    last_used_at DATETIME,
+    revoked_at DATETIME
+);
+
+-- Revoked tokens are kept for the audit log, names are only unique among active tokens.
+CREATE UNIQUE INDEX idx_api_tokens_active_name ON api_tokens(name) WHERE revoked_at IS NULL;
+
+CREATE TABLE audit_log (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at DATETIME NOT NULL,
+    token_name TEXT NOT NULL,
+    action TEXT NOT NULL,                   -- Method and route, like "POST /v1/deploy"
+    app_name TEXT NOT NULL DEFAULT '',
+    status_code INTEGER NOT NULL,
+    remote_addr TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX idx_audit_log_created_at ON audit_log(created_at);
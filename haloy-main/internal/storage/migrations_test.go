@@ -0,0 +1,279 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/haloydev/haloy/internal/constants"
+)
+
+// openTestDB opens a database in a temporary data dir.
+func openTestDB(t *testing.T) *DB {
+	t.Helper()
+	dataDir := t.TempDir()
+	t.Setenv(constants.EnvVarDataDir, dataDir)
+	if err := os.MkdirAll(filepath.Join(dataDir, constants.DBDir), constants.ModeDirPrivate); err != nil {
+		t.Fatal(err)
+	}
+	db, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestLoadMigrations(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/0002_add_column.sql":   {Data: []byte("ALTER TABLE t ADD COLUMN b TEXT;")},
+		"migrations/0001_create_table.sql": {Data: []byte("CREATE TABLE t (a TEXT);")},
+		"migrations/README.md":             {Data: []byte("Not a migration")},
+	}
+	migrations, err := loadMigrations(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) != 2 {
+		t.Fatalf("got %d migrations, want 2", len(migrations))
+	}
+	if migrations[0].Version != 1 || migrations[0].Name != "create table" || migrations[1].Version != 2 {
+		t.Errorf("got migrations %+v", migrations)
+	}
+	if migrations[0].Checksum == migrations[1].Checksum || len(migrations[0].Checksum) != 64 {
+		t.Errorf("unexpected checksums %q and %q", migrations[0].Checksum, migrations[1].Checksum)
+	}
+}
+
+func TestLoadMigrationsErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		files []string
+		want  string
+	}{
+		{name: "gap", files: []string{"0001_a.sql", "0003_c.sql"}, want: "without gaps, found version 3 at position 2"},
+		{name: "not starting at 1", files: []string{"0002_b.sql"}, want: "found version 2 at position 1"},
+		{name: "duplicate", files: []string{"0001_a.sql", "0001_b.sql"}, want: "found version 1 at position 2"},
+		{name: "no name", files: []string{"0001.sql"}, want: "must be named <version>_<name>.sql"},
+		{name: "no version", files: []string{"first_a.sql"}, want: "must start with its version"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fsys := fstest.MapFS{}
+			for _, file := range tt.files {
+				fsys["migrations/"+file] = &fstest.MapFile{Data: []byte("SELECT 1;")}
+			}
+			_, err := loadMigrations(fsys)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got error %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestEmbeddedMigrations(t *testing.T) {
+	migrations, err := loadMigrations(migrationFiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Servers refuse to start when a migration they applied changed, so released migrations
+	// must stay as they are. New ones are added below.
+	released := []string{
+		"78d3da7554ecf9651cfd3ef347bcf5f588a176e0bb7ccf401e9ee1d242c96c33",
+		"42db526deb32c041988bfdc4ab1bde7d99f23f365f61803dd96958fdfd0449c2",
+		"c7f87d786d0ad646212b3cff5e8b65b5ab92a20497a59e8064a5eff00bcddce5",
+		"ed5db04edc3d5b11902bfcdb370b2686d10e98bd74196642ae03c9930f5e7499",
+		"dcf69abccb1ae881cbab36d74d12825f6554bffbe563625b0174cba4d6db0ccd",
+	}
+	if len(migrations) < len(released) {
+		t.Fatalf("got %d migrations, want at least the %d released ones", len(migrations), len(released))
+	}
+	for i, checksum := range released {
+		if migrations[i].Checksum != checksum {
+			t.Errorf("released migration %s changed", migrations[i].Name)
+		}
+	}
+}
+
+func TestMigrateEmptyDatabase(t *testing.T) {
+	db := openTestDB(t)
+
+	report, err := db.Migrate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	migrations, _ := loadMigrations(migrationFiles)
+	if len(report.Applied) != len(migrations) {
+		t.Errorf("applied %d migrations, want %d", len(report.Applied), len(migrations))
+	}
+	if report.BackupPath != "" {
+		t.Errorf("empty database was backed up to %s", report.BackupPath)
+	}
+
+	report, err = db.Migrate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Applied) != 0 {
+		t.Errorf("second run applied %d migrations", len(report.Applied))
+	}
+}
+
+// Databases from before versioned migrations only have the deployments table.
+func TestMigrateDatabaseFromBeforeVersionedMigrations(t *testing.T) {
+	db := openTestDB(t)
+	_, err := db.Exec(`
+CREATE TABLE deployments (
+    id TEXT PRIMARY KEY,
+    app_name TEXT NOT NULL,
+    raw_app_config JSON NOT NULL,
+    deployed_image json not null,
+    rolled_back_from TEXT,
+    FOREIGN KEY (rolled_back_from) REFERENCES deployments(id)
+);
+CREATE INDEX idx_deployments_app_name ON deployments(app_name);
+INSERT INTO deployments (id, app_name, raw_app_config, deployed_image) VALUES ('01JOLD', 'web', X'7B7D', X'7B7D');
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := db.Migrate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.BackupPath == "" {
+		t.Fatal("database wasn't backed up before migrating")
+	}
+	if !strings.HasSuffix(report.BackupPath, "-v0.db") {
+		t.Errorf("backup %s isn't named after version 0", report.BackupPath)
+	}
+	if _, err := os.Stat(report.BackupPath); err != nil {
+		t.Error(err)
+	}
+
+	deployment, err := db.GetDeployment("01JOLD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deployment.Status != "succeeded" {
+		t.Errorf("existing deployment has status %q, want succeeded", deployment.Status)
+	}
+}
+
+func TestMigrationStatusIsReadOnly(t *testing.T) {
+	db := openTestDB(t)
+
+	statuses, err := db.MigrationStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, status := range statuses {
+		if status.AppliedAt != nil {
+			t.Errorf("migration %d is applied in an empty database", status.Version)
+		}
+	}
+	var tables int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table'`).Scan(&tables); err != nil {
+		t.Fatal(err)
+	}
+	if tables != 0 {
+		t.Errorf("MigrationStatus created %d tables", tables)
+	}
+}
+
+func TestMigrateRefusesChangedMigration(t *testing.T) {
+	db := openTestDB(t)
+	if _, err := db.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`UPDATE schema_migrations SET checksum = 'changed' WHERE version = 2`); err != nil {
+		t.Fatal(err)
+	}
+
+	statuses, err := db.MigrationStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !statuses[1].ChecksumMismatch || statuses[0].ChecksumMismatch {
+		t.Errorf("expected only migration 2 to be reported as changed")
+	}
+	if _, err := db.Migrate(); err == nil || !strings.Contains(err.Error(), "changed after it was applied") {
+		t.Errorf("got error %v, want a changed migration error", err)
+	}
+}
+
+func TestMigrateRefusesUnknownMigration(t *testing.T) {
+	db := openTestDB(t)
+	if _, err := db.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO schema_migrations (version, name, checksum, applied_at) VALUES (999, 'from the future', 'x', CURRENT_TIMESTAMP)`); err != nil {
+		t.Fatal(err)
+	}
+
+	statuses, err := db.MigrationStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := statuses[len(statuses)-1]
+	if last.Version != 999 || !last.Unknown {
+		t.Errorf("got last status %+v, want unknown migration 999", last)
+	}
+	if _, err := db.Migrate(); err == nil || !strings.Contains(err.Error(), "upgrade haloy") {
+		t.Errorf("got error %v, want an unknown migration error", err)
+	}
+}
+
+func TestBackupBeforeMigratingPrunesOldBackups(t *testing.T) {
+	db := openTestDB(t)
+	if _, err := db.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := filepath.Join(filepath.Dir(db.path), constants.DBBackupDir)
+	if err := os.MkdirAll(dir, constants.ModeDirPrivate); err != nil {
+		t.Fatal(err)
+	}
+	old := []string{
+		"haloy-20240101T000000Z-v1.db",
+		"haloy-20240102T000000Z-v2.db",
+		"haloy-20240103T000000Z-v3.db",
+		"haloy-20240104T000000Z-v4.db",
+		"haloy-20240105T000000Z-v5.db",
+		"haloy-20240106T000000Z-v6.db",
+	}
+	for _, name := range old {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, constants.ModeFileSecret); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	backupPath, err := db.backupBeforeMigrating(7)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backups, err := filepath.Glob(filepath.Join(dir, "haloy-*.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != maxDatabaseBackups {
+		t.Fatalf("got %d backups, want %d: %v", len(backups), maxDatabaseBackups, backups)
+	}
+	kept := make(map[string]bool)
+	for _, backup := range backups {
+		kept[filepath.Base(backup)] = true
+	}
+	if !kept[filepath.Base(backupPath)] {
+		t.Error("the new backup was removed")
+	}
+	for _, name := range old[:2] {
+		if kept[name] {
+			t.Errorf("old backup %s was kept", name)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/haloydev/haloy/internal/apitoken"
+)
+
+// ErrTokenNotFound is returned when no active token has the given name or hash.
+var ErrTokenNotFound = errors.New("token not found")
+
+// APIToken is a named token for the haloyd API. Only the hash of the token is stored.
+type APIToken struct {
+	ID         int64            `db:"id" json:"id"`
+	Name       string           `db:"name" json:"name"`
+	TokenHash  string           `db:"token_hash" json:"-"`
+	Scopes     []apitoken.Scope `db:"scopes" json:"scopes"`
+	Apps       []string         `db:"apps" json:"apps,omitempty"` // App name globs, empty for all apps
+	CreatedAt  time.Time        `db:"created_at" json:"createdAt"`
+	ExpiresAt  *time.Time       `db:"expires_at" json:"expiresAt,omitempty"`
+	LastUsedAt *time.Time       `db:"last_used_at" json:"lastUsedAt,omitempty"`
+	RevokedAt  *time.Time       `db:"revoked_at" json:"revokedAt,omitempty"`
+}
+
+// Expired reports whether the token expired at now.
+func (t APIToken) Expired(now time.Time) bool {
+	return t.ExpiresAt != nil && !now.Before(*t.ExpiresAt)
+}
+
+// Principal returns what requests made with the token may do.
+func (t APIToken) Principal() apitoken.Principal {
+	return apitoken.Principal{Name: t.Name, Scopes: t.Scopes, Apps: t.Apps}
+}
+
+const apiTokenColumns = `id, name, token_hash, scopes, apps, created_at, expires_at, last_used_at, revoked_at`
+
+func scanAPIToken(row interface{ Scan(dest ...any) error }) (APIToken, error) {
+	var token APIToken
+	var scopes, apps string
+	var expiresAt, lastUsedAt, revokedAt sql.NullTime
+	err := row.Scan(&token.ID, &token.Name, &token.TokenHash, &scopes, &apps, &token.CreatedAt, &expiresAt, &lastUsedAt, &revokedAt)
+	if err != nil {
+		return token, err
+	}
+
+	for scope := range strings.SplitSeq(scopes, ",") {
+		if scope != "" {
+			token.Scopes = append(token.Scopes, apitoken.Scope(scope))
+		}
+	}
+	if apps != "" {
+		token.Apps = strings.Split(apps, ",")
+	}
+	if expiresAt.Valid {
+		token.ExpiresAt = &expiresAt.Time
+	}
+	if lastUsedAt.Valid {
+		token.LastUsedAt = &lastUsedAt.Time
+	}
+	if revokedAt.Valid {
+		token.RevokedAt = &revokedAt.Time
+	}
+	return token, nil
+}
+
+// CreateAPIToken stores a new token. Names must be unique among tokens that aren't revoked.
+func (db *DB) CreateAPIToken(token APIToken) error {
+	if token.CreatedAt.IsZero() {
+		token.CreatedAt = time.Now().UTC()
+	}
+	scopes := make([]string, 0, len(token.Scopes))
+	for _, scope := range token.Scopes {
+		scopes = append(scopes, string(scope))
+	}
+
+	query := `INSERT INTO api_tokens (name, token_hash, scopes, apps, created_at, expires_at)
+              VALUES (?, ?, ?, ?, ?, ?)`
+	_, err := db.Exec(query, token.Name, token.TokenHash, strings.Join(scopes, ","), strings.Join(token.Apps, ","),
+		token.CreatedAt, token.ExpiresAt)
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+			return fmt.Errorf("a token named '%s' already exists", token.Name)
+		}
+		return fmt.Errorf("failed to create token: %w", err)
+	}
+	return nil
+}
+
+// GetAPITokenByHash returns the active token with the hash, expired or not.
+func (db *DB) GetAPITokenByHash(tokenHash string) (APIToken, error) {
+	query := `SELECT ` + apiTokenColumns + ` FROM api_tokens WHERE token_hash = ? AND revoked_at IS NULL`
+	token, err := scanAPIToken(db.QueryRow(query, tokenHash))
+	if errors.Is(err, sql.ErrNoRows) {
+		return token, ErrTokenNotFound
+	}
+	if err != nil {
+		return token, fmt.Errorf("failed to get token: %w", err)
+	}
+	return token, nil
+}
+
+// ListAPITokens returns the tokens ordered by name, with revoked ones only if includeRevoked is set.
+func (db *DB) ListAPITokens(includeRevoked bool) ([]APIToken, error) {
+	query := `SELECT ` + apiTokenColumns + ` FROM api_tokens`
+	if !includeRevoked {
+		query += ` WHERE revoked_at IS NULL`
+	}
+	query += ` ORDER BY name, id`
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query tokens: %w", err)
+	}
+	defer rows.Close()
+
+	var tokens []APIToken
+	for rows.Next() {
+		token, err := scanAPIToken(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan token: %w", err)
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, rows.Err()
+}
+
+// RevokeAPIToken revokes the active token with the name.
+func (db *DB) RevokeAPIToken(name string) error {
+	result, err := db.Exec(`UPDATE api_tokens SET revoked_at = ? WHERE name = ? AND revoked_at IS NULL`, time.Now().UTC(), name)
+	if err != nil {
+		return fmt.Errorf("failed to revoke token: %w", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return ErrTokenNotFound
+	}
+	return nil
+}
+
+// TouchAPIToken records that the token was used.
+func (db *DB) TouchAPIToken(id int64) error {
+	_, err := db.Exec(`UPDATE api_tokens SET last_used_at = ? WHERE id = ?`, time.Now().UTC(), id)
+	if err != nil {
+		return fmt.Errorf("failed to update token: %w", err)
+	}
+	return nil
+}
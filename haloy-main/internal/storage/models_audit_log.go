@@ -0,0 +1,30 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+)
+
+// AuditEvent records a change made through the API and the token that made it.
+type AuditEvent struct {
+	ID         int64     `db:"id" json:"id"`
+	CreatedAt  time.Time `db:"created_at" json:"createdAt"`
+	TokenName  string    `db:"token_name" json:"tokenName"`
+	Action     string    `db:"action" json:"action"` // Method and route, like "POST /v1/deploy"
+	AppName    string    `db:"app_name" json:"appName,omitempty"`
+	StatusCode int       `db:"status_code" json:"statusCode"`
+	RemoteAddr string    `db:"remote_addr" json:"remoteAddr,omitempty"`
+}
+
+func (db *DB) SaveAuditEvent(event AuditEvent) error {
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now().UTC()
+	}
+	query := `INSERT INTO audit_log (created_at, token_name, action, app_name, status_code, remote_addr)
+              VALUES (?, ?, ?, ?, ?, ?)`
+	_, err := db.Exec(query, event.CreatedAt, event.TokenName, event.Action, event.AppName, event.StatusCode, event.RemoteAddr)
+	if err != nil {
+		return fmt.Errorf("failed to save audit event: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrAutoRollbackNotFound is returned when a deployment was not automatically rolled back.
+var ErrAutoRollbackNotFound = errors.New("deployment was not automatically rolled back")
+
+// AutoRollback records a deployment that haloyd rolled back because it became unhealthy
+// during its observation window.
+type AutoRollback struct {
+	DeploymentID         string    `db:"deployment_id" json:"deploymentId"`
+	AppName              string    `db:"app_name" json:"appName"`
+	RolledBackTo         string    `db:"rolled_back_to" json:"rolledBackTo"`
+	RollbackDeploymentID string    `db:"rollback_deployment_id" json:"rollbackDeploymentId"`
+	Reason               string    `db:"reason" json:"reason"`
+	CreatedAt            time.Time `db:"created_at" json:"createdAt"`
+}
+
+func (db *DB) SaveAutoRollback(rollback AutoRollback) error {
+	if rollback.CreatedAt.IsZero() {
+		rollback.CreatedAt = time.Now().UTC()
+	}
+	query := `INSERT INTO auto_rollbacks (deployment_id, app_name, rolled_back_to, rollback_deployment_id, reason, created_at)
+              VALUES (?, ?, ?, ?, ?, ?)`
+	_, err := db.Exec(query, rollback.DeploymentID, rollback.AppName, rollback.RolledBackTo,
+		rollback.RollbackDeploymentID, rollback.Reason, rollback.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save auto rollback: %w", err)
+	}
+	return nil
+}
+
+func (db *DB) GetAutoRollback(deploymentID string) (AutoRollback, error) {
+	var rollback AutoRollback
+	query := `SELECT deployment_id, app_name, rolled_back_to, rollback_deployment_id, reason, created_at
+              FROM auto_rollbacks WHERE deployment_id = ?`
+
+	row := db.QueryRow(query, deploymentID)
+	err := row.Scan(&rollback.DeploymentID, &rollback.AppName, &rollback.RolledBackTo,
+		&rollback.RollbackDeploymentID, &rollback.Reason, &rollback.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return rollback, ErrAutoRollbackNotFound
+		}
+		return rollback, fmt.Errorf("failed to get auto rollback: %w", err)
+	}
+
+	return rollback, nil
+}
+
+// ListAutoRollbacks returns the automatically rolled back deployments of an app, keyed by deployment ID.
+func (db *DB) ListAutoRollbacks(appName string) (map[string]AutoRollback, error) {
+	rollbacks := make(map[string]AutoRollback)
+	query := `SELECT deployment_id, app_name, rolled_back_to, rollback_deployment_id, reason, created_at
+              FROM auto_rollbacks WHERE app_name = ?`
+
+	rows, err := db.Query(query, appName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query auto rollbacks: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var rollback AutoRollback
+		if err := rows.Scan(&rollback.DeploymentID, &rollback.AppName, &rollback.RolledBackTo,
+			&rollback.RollbackDeploymentID, &rollback.Reason, &rollback.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan auto rollback: %w", err)
+		}
+		rollbacks[rollback.DeploymentID] = rollback
+	}
+
+	return rollbacks, rows.Err()
+}
@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrCanaryNotFound is returned when an app has no canary in progress.
+var ErrCanaryNotFound = errors.New("no canary in progress")
+
+// Canary tracks a canary deployment running next to the stable deployment of an app.
+// There is at most one canary per app.
+type Canary struct {
+	AppName            string    `db:"app_name" json:"appName"`
+	StableDeploymentID string    `db:"stable_deployment_id" json:"stableDeploymentId"`
+	CanaryDeploymentID string    `db:"canary_deployment_id" json:"canaryDeploymentId"`
+	Weight             int       `db:"weight" json:"weight"` // Percentage of traffic sent to the canary (0-100)
+	CreatedAt          time.Time `db:"created_at" json:"createdAt"`
+	UpdatedAt          time.Time `db:"updated_at" json:"updatedAt"`
+}
+
+// SaveCanary creates or replaces the canary for an app.
+func (db *DB) SaveCanary(canary Canary) error {
+	now := time.Now().UTC()
+	if canary.CreatedAt.IsZero() {
+		canary.CreatedAt = now
+	}
+	query := `INSERT INTO canaries (app_name, stable_deployment_id, canary_deployment_id, weight, created_at, updated_at)
+              VALUES (?, ?, ?, ?, ?, ?)
+              ON CONFLICT(app_name) DO UPDATE SET
+                  stable_deployment_id = excluded.stable_deployment_id,
+                  canary_deployment_id = excluded.canary_deployment_id,
+                  weight = excluded.weight,
+                  created_at = excluded.created_at,
+                  updated_at = excluded.updated_at`
+	_, err := db.Exec(query, canary.AppName, canary.StableDeploymentID, canary.CanaryDeploymentID,
+		canary.Weight, canary.CreatedAt, now)
+	if err != nil {
+		return fmt.Errorf("failed to save canary: %w", err)
+	}
+	return nil
+}
+
+func (db *DB) GetCanary(appName string) (Canary, error) {
+	var canary Canary
+	query := `SELECT app_name, stable_deployment_id, canary_deployment_id, weight, created_at, updated_at
+              FROM canaries WHERE app_name = ?`
+
+	row := db.QueryRow(query, appName)
+	err := row.Scan(&canary.AppName, &canary.StableDeploymentID, &canary.CanaryDeploymentID,
+		&canary.Weight, &canary.CreatedAt, &canary.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return canary, ErrCanaryNotFound
+		}
+		return canary, fmt.Errorf("failed to get canary: %w", err)
+	}
+
+	return canary, nil
+}
+
+// ListCanaries returns all canaries in progress, keyed by app name.
+func (db *DB) ListCanaries() (map[string]Canary, error) {
+	canaries := make(map[string]Canary)
+	query := `SELECT app_name, stable_deployment_id, canary_deployment_id, weight, created_at, updated_at
+              FROM canaries`
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query canaries: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var canary Canary
+		err := rows.Scan(&canary.AppName, &canary.StableDeploymentID, &canary.CanaryDeploymentID,
+			&canary.Weight, &canary.CreatedAt, &canary.UpdatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan canary: %w", err)
+		}
+		canaries[canary.AppName] = canary
+	}
+
+	return canaries, rows.Err()
+}
+
+func (db *DB) DeleteCanary(appName string) error {
+	_, err := db.Exec(`DELETE FROM canaries WHERE app_name = ?`, appName)
+	if err != nil {
+		return fmt.Errorf("failed to delete canary: %w", err)
+	}
+	return nil
+}
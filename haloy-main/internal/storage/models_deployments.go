@@ -4,57 +4,160 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"time"
 
 	"github.com/haloydev/haloy/internal/config"
+	"github.com/haloydev/haloy/internal/deploytypes"
+	"github.com/haloydev/haloy/internal/helpers"
 )
 
+// MaxDeploymentsPerApp caps the deployments kept per app, whatever their status. Deployments
+// that can be rolled back to are kept beyond it, up to the app's history count.
+const MaxDeploymentsPerApp = 100
+
 type Deployment struct {
-	ID             string          `db:"id" json:"id"`
-	AppName        string          `db:"app_name" json:"appName"`
-	RawAppConfig   json.RawMessage `db:"raw_app_config" json:"rawAppConfig"`
-	DeployedImage  json.RawMessage `db:"deployed_image" json:"deployedImage"`
-	RolledBackFrom *string         `db:"rolled_back_from" json:"rolledBackFrom,omitempty"`
-}
-
-func createDeploymentsTable(db *DB) error {
-	schema := `
-CREATE TABLE IF NOT EXISTS deployments (
-    id TEXT PRIMARY KEY,                    -- Timestamp-based ID
-    app_name TEXT NOT NULL,                 -- App being deployed
-    raw_app_config JSON NOT NULL,           -- config.AppConfig as JSON
-    deployed_image json not null,           -- Resolved config.Image config that was actually deployed
-    rolled_back_from TEXT,                  -- ID of deployment this was rolled back from
-
-    -- Foreign key constraint (optional)
-    FOREIGN KEY (rolled_back_from) REFERENCES deployments(id)
-);
-
--- Indexes for efficient queries
-CREATE INDEX IF NOT EXISTS idx_deployments_app_name ON deployments(app_name);
-`
-
-	_, err := db.Exec(schema)
+	ID             string                       `db:"id" json:"id"`
+	AppName        string                       `db:"app_name" json:"appName"`
+	RawAppConfig   json.RawMessage              `db:"raw_app_config" json:"rawAppConfig"`
+	DeployedImage  json.RawMessage              `db:"deployed_image" json:"deployedImage"`
+	ImageDigest    string                       `db:"image_digest" json:"imageDigest,omitempty"`
+	RolledBackFrom *string                      `db:"rolled_back_from" json:"rolledBackFrom,omitempty"`
+	Status         deploytypes.DeploymentStatus `db:"status" json:"status"`
+	StartedAt      *time.Time                   `db:"started_at" json:"startedAt,omitempty"`
+	FinishedAt     *time.Time                   `db:"finished_at" json:"finishedAt,omitempty"`
+	FailureReason  string                       `db:"failure_reason" json:"failureReason,omitempty"`
+	DeployedBy     string                       `db:"deployed_by" json:"deployedBy,omitempty"`
+	Message        string                       `db:"message" json:"message,omitempty"`
+	GitCommit      string                       `db:"git_commit" json:"gitCommit,omitempty"`
+	GitBranch      string                       `db:"git_branch" json:"gitBranch,omitempty"`
+	GitDirty       bool                         `db:"git_dirty" json:"gitDirty,omitempty"`
+	Labels         string                       `db:"labels" json:"labels,omitempty"` // JSON object
+	PullMs         *int64                       `db:"pull_ms" json:"pullMs,omitempty"`
+	StartMs        *int64                       `db:"start_ms" json:"startMs,omitempty"`
+	HealthMs       *int64                       `db:"health_ms" json:"healthMs,omitempty"`
+	RouteSwitchMs  *int64                       `db:"route_switch_ms" json:"routeSwitchMs,omitempty"`
+}
+
+// deploymentColumns are selected by the queries returning full deployments, in the order scanDeployment expects.
+const deploymentColumns = `id, app_name, raw_app_config, deployed_image, image_digest, rolled_back_from, status, started_at,
+              finished_at, failure_reason, deployed_by, message, git_commit, git_branch, git_dirty, labels,
+              pull_ms, start_ms, health_ms, route_switch_ms`
+
+// phaseColumns maps the recorded phases of a deployment to their columns.
+var phaseColumns = map[deploytypes.DeploymentPhase]string{
+	deploytypes.DeploymentPhasePull:        "pull_ms",
+	deploytypes.DeploymentPhaseStart:       "start_ms",
+	deploytypes.DeploymentPhaseHealth:      "health_ms",
+	deploytypes.DeploymentPhaseRouteSwitch: "route_switch_ms",
+}
+
+// CreateDeployment records a deployment that was accepted and waits for its turn.
+func (db *DB) CreateDeployment(deployment Deployment) error {
+	if deployment.Status == "" {
+		deployment.Status = deploytypes.DeploymentStatusQueued
+	}
+	if deployment.StartedAt == nil {
+		now := time.Now().UTC()
+		deployment.StartedAt = &now
+	}
+	query := `INSERT INTO deployments (id, app_name, raw_app_config, deployed_image, rolled_back_from, status, started_at,
+                  deployed_by, message, git_commit, git_branch, git_dirty, labels)
+              VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err := db.Exec(query, deployment.ID, deployment.AppName, deployment.RawAppConfig, deployment.DeployedImage,
+		deployment.RolledBackFrom, deployment.Status, deployment.StartedAt, deployment.DeployedBy, deployment.Message,
+		deployment.GitCommit, deployment.GitBranch, deployment.GitDirty, deployment.Labels)
 	if err != nil {
-		return fmt.Errorf("failed to create deployments table: %w", err)
+		return fmt.Errorf("failed to create deployment: %w", err)
 	}
 	return nil
 }
 
+// SaveDeployment stores the config and image a deployment went out with, which rollbacks
+// redeploy. The deployment's status and timeline are left as they are.
 func (db *DB) SaveDeployment(deployment Deployment) error {
 	query := `INSERT INTO deployments (id, app_name, raw_app_config,  deployed_image, rolled_back_from)
-              VALUES (?, ?, ?, ?, ?)`
+              VALUES (?, ?, ?, ?, ?)
+              ON CONFLICT(id) DO UPDATE SET
+                  raw_app_config = excluded.raw_app_config,
+                  deployed_image = excluded.deployed_image`
 	_, err := db.Exec(query, deployment.ID, deployment.AppName, deployment.RawAppConfig,
 		deployment.DeployedImage, deployment.RolledBackFrom)
 	return err
 }
 
+// SetDeploymentStatus moves a deployment to a new status and sets its finish time when the
+// status is final. failureReason is empty unless the deployment failed or was cancelled.
+func (db *DB) SetDeploymentStatus(deploymentID string, status deploytypes.DeploymentStatus, failureReason string) error {
+	var finishedAt *time.Time
+	switch status {
+	case deploytypes.DeploymentStatusSucceeded, deploytypes.DeploymentStatusFailed, deploytypes.DeploymentStatusCancelled:
+		now := time.Now().UTC()
+		finishedAt = &now
+	}
+
+	query := `UPDATE deployments
+              SET status = ?, finished_at = COALESCE(?, finished_at), failure_reason = ?
+              WHERE id = ?`
+	_, err := db.Exec(query, status, finishedAt, failureReason, deploymentID)
+	if err != nil {
+		return fmt.Errorf("failed to set deployment status: %w", err)
+	}
+	return nil
+}
+
+// SetDeploymentPhase records how long a phase of a deployment took.
+func (db *DB) SetDeploymentPhase(deploymentID string, phase deploytypes.DeploymentPhase, duration time.Duration) error {
+	column, ok := phaseColumns[phase]
+	if !ok {
+		return fmt.Errorf("unknown deployment phase '%s'", phase)
+	}
+	_, err := db.Exec(fmt.Sprintf(`UPDATE deployments SET %s = ? WHERE id = ?`, column), duration.Milliseconds(), deploymentID)
+	if err != nil {
+		return fmt.Errorf("failed to record %s phase: %w", phase, err)
+	}
+	return nil
+}
+
+// SetDeploymentMetadata replaces the metadata of a deployment, rollbacks take over that of the
+// deployment they redeploy.
+func (db *DB) SetDeploymentMetadata(deploymentID string, metadata config.DeployMetadata) error {
+	var d Deployment
+	if err := d.SetMetadata(metadata); err != nil {
+		return err
+	}
+	query := `UPDATE deployments
+              SET message = ?, git_commit = ?, git_branch = ?, git_dirty = ?, labels = ?
+              WHERE id = ?`
+	_, err := db.Exec(query, d.Message, d.GitCommit, d.GitBranch, d.GitDirty, d.Labels, deploymentID)
+	if err != nil {
+		return fmt.Errorf("failed to set deployment metadata: %w", err)
+	}
+	return nil
+}
+
+// SetDeploymentImageDigest records the digest of the image a deployment runs.
+func (db *DB) SetDeploymentImageDigest(deploymentID, digest string) error {
+	_, err := db.Exec(`UPDATE deployments SET image_digest = ? WHERE id = ?`, digest, deploymentID)
+	if err != nil {
+		return fmt.Errorf("failed to set image digest: %w", err)
+	}
+	return nil
+}
+
+// SetDeploymentRolledBackFrom records the live deployment a rollback replaces.
+func (db *DB) SetDeploymentRolledBackFrom(deploymentID, rolledBackFrom string) error {
+	_, err := db.Exec(`UPDATE deployments SET rolled_back_from = ? WHERE id = ?`, rolledBackFrom, deploymentID)
+	if err != nil {
+		return fmt.Errorf("failed to set rolled back deployment: %w", err)
+	}
+	return nil
+}
+
 func (db *DB) GetDeployment(deploymentID string) (Deployment, error) {
-	var deployment Deployment
-	query := `SELECT id, app_name, raw_app_config, deployed_image, rolled_back_from
+	query := `SELECT ` + deploymentColumns + `
               FROM deployments WHERE id = ?`
 
-	row := db.QueryRow(query, deploymentID)
-	err := row.Scan(&deployment.ID, &deployment.AppName, &deployment.RawAppConfig, &deployment.DeployedImage, &deployment.RolledBackFrom)
+	deployment, err := scanDeployment(db.QueryRow(query, deploymentID))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return deployment, fmt.Errorf("deployment '%s' not found", deploymentID)
@@ -65,39 +168,116 @@ func (db *DB) GetDeployment(deploymentID string) (Deployment, error) {
 	return deployment, nil
 }
 
-func (db *DB) GetDeploymentHistory(appName string, limit int) ([]Deployment, error) {
+// DeploymentExists reports whether a deployment is recorded, and hasn't been pruned.
+func (db *DB) DeploymentExists(deploymentID string) (bool, error) {
+	var exists bool
+	if err := db.QueryRow(`SELECT EXISTS(SELECT 1 FROM deployments WHERE id = ?)`, deploymentID).Scan(&exists); err != nil {
+		return false, fmt.Errorf("failed to check deployment: %w", err)
+	}
+	return exists, nil
+}
+
+// DeploymentHistoryQuery selects the deployments GetDeploymentHistory returns.
+type DeploymentHistoryQuery struct {
+	Limit  int
+	Since  time.Time                    // Zero for no lower bound
+	Status deploytypes.DeploymentStatus // Empty for any status
+	// WentLive only selects deployments that served traffic at some point, the ones rollbacks can go back to.
+	WentLive bool
+}
+
+// GetDeploymentHistory returns an app's deployments, newest first.
+func (db *DB) GetDeploymentHistory(appName string, q DeploymentHistoryQuery) ([]Deployment, error) {
 	var deployments []Deployment
-	query := `SELECT id, app_name, raw_app_config, deployed_image, rolled_back_from
+	query := `SELECT ` + deploymentColumns + `
               FROM deployments
-              WHERE app_name = ?
+              WHERE app_name = ?`
+	args := []any{appName}
+	if !q.Since.IsZero() {
+		// Deployments stored before their start time was recorded have ULIDs as IDs, which sort by time.
+		query += ` AND (started_at >= ? OR (started_at IS NULL AND id >= ?))`
+		args = append(args, q.Since.UTC(), helpers.DeploymentIDAt(q.Since))
+	}
+	if q.Status != "" {
+		query += ` AND status = ?`
+		args = append(args, q.Status)
+	}
+	if q.WentLive {
+		query += ` AND status IN (?, ?)`
+		args = append(args, deploytypes.DeploymentStatusSucceeded, deploytypes.DeploymentStatusRolledBack)
+	}
+	query += `
               ORDER BY id DESC
               LIMIT ?`
+	args = append(args, q.Limit)
 
-	rows, err := db.Query(query, appName, limit)
+	rows, err := db.Query(query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query deployment history: %w", err)
 	}
 	defer rows.Close()
 
 	for rows.Next() {
-		var deployment Deployment
-		err := rows.Scan(&deployment.ID, &deployment.AppName, &deployment.RawAppConfig,
-			&deployment.DeployedImage, &deployment.RolledBackFrom)
+		deployment, err := scanDeployment(rows)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan deployment: %w", err)
 		}
 		deployments = append(deployments, deployment)
 	}
 
-	return deployments, nil
+	return deployments, rows.Err()
 }
 
-func (db *DB) PruneOldDeployments(appName string, deploymentsToKeep int) error {
-	// Keep the N most recent deployments for this app, delete the rest
+// scanDeployment scans a row holding deploymentColumns.
+func scanDeployment(row interface{ Scan(dest ...any) error }) (Deployment, error) {
+	var deployment Deployment
+	var startedAt, finishedAt sql.NullTime
+	var pullMs, startMs, healthMs, routeSwitchMs sql.NullInt64
+	err := row.Scan(&deployment.ID, &deployment.AppName, &deployment.RawAppConfig, &deployment.DeployedImage,
+		&deployment.ImageDigest, &deployment.RolledBackFrom, &deployment.Status, &startedAt, &finishedAt, &deployment.FailureReason,
+		&deployment.DeployedBy, &deployment.Message, &deployment.GitCommit, &deployment.GitBranch, &deployment.GitDirty,
+		&deployment.Labels, &pullMs, &startMs, &healthMs, &routeSwitchMs)
+	if err != nil {
+		return deployment, err
+	}
+
+	if startedAt.Valid {
+		deployment.StartedAt = &startedAt.Time
+	}
+	if finishedAt.Valid {
+		deployment.FinishedAt = &finishedAt.Time
+	}
+	for _, phase := range []struct {
+		value sql.NullInt64
+		dest  **int64
+	}{
+		{pullMs, &deployment.PullMs},
+		{startMs, &deployment.StartMs},
+		{healthMs, &deployment.HealthMs},
+		{routeSwitchMs, &deployment.RouteSwitchMs},
+	} {
+		if phase.value.Valid {
+			ms := phase.value.Int64
+			*phase.dest = &ms
+		}
+	}
+	return deployment, nil
+}
+
+// PruneOldDeployments keeps the app's deploymentsToKeep newest deployments that went live,
+// which can be rolled back to, and its MaxDeploymentsPerApp newest deployments of any status.
+// It returns the IDs of the pruned deployments.
+func (db *DB) PruneOldDeployments(appName string, deploymentsToKeep int) ([]string, error) {
 	// Since ID is in YYYYMMDDHHMMSS format, we can sort by ID directly
-	query := `
-        DELETE FROM deployments
+	prunable := `
+        SELECT id FROM deployments
         WHERE app_name = ?
+        AND id NOT IN (
+            SELECT id FROM deployments
+            WHERE app_name = ? AND status IN (?, ?)
+            ORDER BY id DESC
+            LIMIT ?
+        )
         AND id NOT IN (
             SELECT id FROM deployments
             WHERE app_name = ?
@@ -105,10 +285,43 @@ func (db *DB) PruneOldDeployments(appName string, deploymentsToKeep int) error {
             LIMIT ?
         )
     `
+	args := []any{appName, appName, deploytypes.DeploymentStatusSucceeded, deploytypes.DeploymentStatusRolledBack,
+		deploymentsToKeep, appName, MaxDeploymentsPerApp}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to prune old deployments: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(prunable, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prune old deployments: %w", err)
+	}
+	var prunedIDs []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to prune old deployments: %w", err)
+		}
+		prunedIDs = append(prunedIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to prune old deployments: %w", err)
+	}
 
-	result, err := db.Exec(query, appName, appName, deploymentsToKeep)
+	// Rollbacks that are kept may point at deployments being pruned.
+	if _, err := tx.Exec(`UPDATE deployments SET rolled_back_from = NULL WHERE rolled_back_from IN (`+prunable+`)`, args...); err != nil {
+		return nil, fmt.Errorf("failed to prune old deployments: %w", err)
+	}
+	result, err := tx.Exec(`DELETE FROM deployments WHERE id IN (`+prunable+`)`, args...)
 	if err != nil {
-		return fmt.Errorf("failed to prune old deployments: %w", err)
+		return nil, fmt.Errorf("failed to prune old deployments: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to prune old deployments: %w", err)
 	}
 
 	rowsAffected, _ := result.RowsAffected()
@@ -116,7 +329,7 @@ func (db *DB) PruneOldDeployments(appName string, deploymentsToKeep int) error {
 		fmt.Printf("Pruned %d old deployment(s) for app '%s'\n", rowsAffected, appName)
 	}
 
-	return nil
+	return prunedIDs, nil
 }
 
 func (d *Deployment) GetImageRef() (string, error) {
@@ -135,3 +348,72 @@ func (d *Deployment) GetDeployedImage() (config.Image, error) {
 	}
 	return deployedImage, nil
 }
+
+// Record returns the deployment's timeline without its configs.
+func (d *Deployment) Record() deploytypes.DeploymentRecord {
+	record := deploytypes.DeploymentRecord{
+		DeploymentID:   d.ID,
+		AppName:        d.AppName,
+		Status:         d.Status,
+		StartedAt:      d.StartedAt,
+		FinishedAt:     d.FinishedAt,
+		FailureReason:  d.FailureReason,
+		DeployedBy:     d.DeployedBy,
+		DeployMetadata: d.Metadata(),
+		ImageDigest:    d.ImageDigest,
+		Phases: deploytypes.DeploymentPhases{
+			Pull:        msToDuration(d.PullMs),
+			Start:       msToDuration(d.StartMs),
+			Health:      msToDuration(d.HealthMs),
+			RouteSwitch: msToDuration(d.RouteSwitchMs),
+		},
+	}
+	if d.RolledBackFrom != nil {
+		record.RolledBackFrom = *d.RolledBackFrom
+	}
+	// Rollbacks that never started have no image yet.
+	if image, err := d.GetDeployedImage(); err == nil && image.Repository != "" {
+		record.ImageRef = image.ImageRef()
+	}
+	return record
+}
+
+// Metadata returns the git commit, message and labels the deployment was started with.
+func (d *Deployment) Metadata() config.DeployMetadata {
+	metadata := config.DeployMetadata{
+		GitCommit: d.GitCommit,
+		GitBranch: d.GitBranch,
+		GitDirty:  d.GitDirty,
+		Message:   d.Message,
+	}
+	if d.Labels != "" {
+		// Labels are validated before they are stored, a malformed value is left out.
+		_ = json.Unmarshal([]byte(d.Labels), &metadata.Labels)
+	}
+	return metadata
+}
+
+// SetMetadata sets the metadata fields of the deployment.
+func (d *Deployment) SetMetadata(metadata config.DeployMetadata) error {
+	d.GitCommit = metadata.GitCommit
+	d.GitBranch = metadata.GitBranch
+	d.GitDirty = metadata.GitDirty
+	d.Message = metadata.Message
+	d.Labels = ""
+	if len(metadata.Labels) > 0 {
+		labels, err := json.Marshal(metadata.Labels)
+		if err != nil {
+			return fmt.Errorf("failed to convert labels to JSON: %w", err)
+		}
+		d.Labels = string(labels)
+	}
+	return nil
+}
+
+func msToDuration(ms *int64) *time.Duration {
+	if ms == nil {
+		return nil
+	}
+	d := time.Duration(*ms) * time.Millisecond
+	return &d
+}
@@ -0,0 +1,51 @@
+package storage
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/haloydev/haloy/internal/deploytypes"
+)
+
+func TestGetDeploymentHistoryWentLive(t *testing.T) {
+	db := openTestDB(t)
+	if _, err := db.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Two deployments that went live, then more failed attempts than a rollback listing asks for.
+	statuses := []deploytypes.DeploymentStatus{deploytypes.DeploymentStatusRolledBack, deploytypes.DeploymentStatusSucceeded}
+	for range 60 {
+		statuses = append(statuses, deploytypes.DeploymentStatusFailed)
+	}
+	statuses = append(statuses, deploytypes.DeploymentStatusQueued, deploytypes.DeploymentStatusCancelled)
+	for i, status := range statuses {
+		deployment := Deployment{ID: fmt.Sprintf("20250101%06d", i), AppName: "web", RawAppConfig: []byte("{}"), DeployedImage: []byte("{}"), Status: status}
+		if err := db.CreateDeployment(deployment); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.CreateDeployment(Deployment{ID: "20250102000000", AppName: "other", RawAppConfig: []byte("{}"), DeployedImage: []byte("{}"), Status: deploytypes.DeploymentStatusSucceeded}); err != nil {
+		t.Fatal(err)
+	}
+
+	deployments, err := db.GetDeploymentHistory("web", DeploymentHistoryQuery{Limit: 50, WentLive: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, deployment := range deployments {
+		ids = append(ids, deployment.ID)
+	}
+	if len(ids) != 2 || ids[0] != "20250101000001" || ids[1] != "20250101000000" {
+		t.Errorf("got %v, want the two deployments that went live, newest first", ids)
+	}
+
+	deployments, err = db.GetDeploymentHistory("web", DeploymentHistoryQuery{Limit: 50})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deployments) != 50 || deployments[0].Status != deploytypes.DeploymentStatusCancelled {
+		t.Errorf("got %d deployments starting with %s, want 50 of any status", len(deployments), deployments[0].Status)
+	}
+}
@@ -0,0 +1,184 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrMirrorNotFound is returned when an app's traffic is not being mirrored.
+var ErrMirrorNotFound = errors.New("no traffic mirror in progress")
+
+// MaxMirrorResultsPerApp bounds the stored comparisons, older ones are removed first.
+const MaxMirrorResultsPerApp = 10000
+
+// Mirror copies requests for an app's live deployment to a candidate deployment that waits for
+// promotion. The candidate's responses are discarded. There is at most one mirror per app.
+type Mirror struct {
+	AppName               string    `db:"app_name" json:"appName"`
+	LiveDeploymentID      string    `db:"live_deployment_id" json:"liveDeploymentId"`
+	CandidateDeploymentID string    `db:"candidate_deployment_id" json:"candidateDeploymentId"`
+	AllMethods            bool      `db:"all_methods" json:"allMethods"` // Also mirror requests that may change state, like POST
+	CreatedAt             time.Time `db:"created_at" json:"createdAt"`
+}
+
+// MirrorResult compares the live response to a request with the candidate's response to its copy.
+type MirrorResult struct {
+	ID                    int64     `db:"id" json:"id"`
+	AppName               string    `db:"app_name" json:"appName"`
+	CandidateDeploymentID string    `db:"candidate_deployment_id" json:"candidateDeploymentId"`
+	Method                string    `db:"method" json:"method"`
+	Path                  string    `db:"path" json:"path"`
+	LiveStatus            int       `db:"live_status" json:"liveStatus"`
+	LiveLatencyMs         int64     `db:"live_latency_ms" json:"liveLatencyMs"`
+	MirrorStatus          int       `db:"mirror_status" json:"mirrorStatus"` // 0 when the copy failed
+	MirrorLatencyMs       int64     `db:"mirror_latency_ms" json:"mirrorLatencyMs"`
+	Error                 string    `db:"error" json:"error,omitempty"`
+	CreatedAt             time.Time `db:"created_at" json:"createdAt"`
+}
+
+// SaveMirror creates or replaces the mirror for an app.
+func (db *DB) SaveMirror(mirror Mirror) error {
+	if mirror.CreatedAt.IsZero() {
+		mirror.CreatedAt = time.Now().UTC()
+	}
+	query := `INSERT INTO mirrors (app_name, live_deployment_id, candidate_deployment_id, all_methods, created_at)
+              VALUES (?, ?, ?, ?, ?)
+              ON CONFLICT(app_name) DO UPDATE SET
+                  live_deployment_id = excluded.live_deployment_id,
+                  candidate_deployment_id = excluded.candidate_deployment_id,
+                  all_methods = excluded.all_methods,
+                  created_at = excluded.created_at`
+	_, err := db.Exec(query, mirror.AppName, mirror.LiveDeploymentID, mirror.CandidateDeploymentID, mirror.AllMethods, mirror.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save mirror: %w", err)
+	}
+	return nil
+}
+
+func (db *DB) GetMirror(appName string) (Mirror, error) {
+	var mirror Mirror
+	query := `SELECT app_name, live_deployment_id, candidate_deployment_id, all_methods, created_at
+              FROM mirrors WHERE app_name = ?`
+
+	row := db.QueryRow(query, appName)
+	err := row.Scan(&mirror.AppName, &mirror.LiveDeploymentID, &mirror.CandidateDeploymentID, &mirror.AllMethods, &mirror.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return mirror, ErrMirrorNotFound
+		}
+		return mirror, fmt.Errorf("failed to get mirror: %w", err)
+	}
+
+	return mirror, nil
+}
+
+// ListMirrors returns all mirrors in progress, keyed by app name.
+func (db *DB) ListMirrors() (map[string]Mirror, error) {
+	mirrors := make(map[string]Mirror)
+	query := `SELECT app_name, live_deployment_id, candidate_deployment_id, all_methods, created_at FROM mirrors`
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query mirrors: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var mirror Mirror
+		if err := rows.Scan(&mirror.AppName, &mirror.LiveDeploymentID, &mirror.CandidateDeploymentID, &mirror.AllMethods, &mirror.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan mirror: %w", err)
+		}
+		mirrors[mirror.AppName] = mirror
+	}
+
+	return mirrors, rows.Err()
+}
+
+func (db *DB) DeleteMirror(appName string) error {
+	_, err := db.Exec(`DELETE FROM mirrors WHERE app_name = ?`, appName)
+	if err != nil {
+		return fmt.Errorf("failed to delete mirror: %w", err)
+	}
+	return nil
+}
+
+// SaveMirrorResults stores a batch of comparisons and removes the oldest ones of each app
+// beyond MaxMirrorResultsPerApp.
+func (db *DB) SaveMirrorResults(results []MirrorResult) error {
+	if len(results) == 0 {
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `INSERT INTO mirror_results (app_name, candidate_deployment_id, method, path, live_status, live_latency_ms,
+                  mirror_status, mirror_latency_ms, error, created_at)
+              VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	apps := make(map[string]struct{})
+	for _, result := range results {
+		if result.CreatedAt.IsZero() {
+			result.CreatedAt = time.Now().UTC()
+		}
+		_, err := tx.Exec(query, result.AppName, result.CandidateDeploymentID, result.Method, result.Path,
+			result.LiveStatus, result.LiveLatencyMs, result.MirrorStatus, result.MirrorLatencyMs, result.Error, result.CreatedAt)
+		if err != nil {
+			return fmt.Errorf("failed to save mirror result: %w", err)
+		}
+		apps[result.AppName] = struct{}{}
+	}
+
+	for appName := range apps {
+		_, err := tx.Exec(`DELETE FROM mirror_results WHERE app_name = ? AND id NOT IN (
+                               SELECT id FROM mirror_results WHERE app_name = ? ORDER BY id DESC LIMIT ?)`,
+			appName, appName, MaxMirrorResultsPerApp)
+		if err != nil {
+			return fmt.Errorf("failed to prune mirror results: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// ListMirrorResults returns the comparisons recorded for a candidate deployment of an app, oldest first.
+func (db *DB) ListMirrorResults(appName, candidateDeploymentID string) ([]MirrorResult, error) {
+	query := `SELECT id, app_name, candidate_deployment_id, method, path, live_status, live_latency_ms,
+                  mirror_status, mirror_latency_ms, error, created_at
+              FROM mirror_results WHERE app_name = ? AND candidate_deployment_id = ? ORDER BY id`
+
+	rows, err := db.Query(query, appName, candidateDeploymentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query mirror results: %w", err)
+	}
+	defer rows.Close()
+
+	var results []MirrorResult
+	for rows.Next() {
+		var result MirrorResult
+		if err := rows.Scan(&result.ID, &result.AppName, &result.CandidateDeploymentID, &result.Method, &result.Path,
+			&result.LiveStatus, &result.LiveLatencyMs, &result.MirrorStatus, &result.MirrorLatencyMs, &result.Error, &result.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan mirror result: %w", err)
+		}
+		results = append(results, result)
+	}
+
+	return results, rows.Err()
+}
+
+// LatestMirrorCandidate returns the candidate deployment of an app's most recent comparison.
+func (db *DB) LatestMirrorCandidate(appName string) (string, error) {
+	var candidateDeploymentID string
+	row := db.QueryRow(`SELECT candidate_deployment_id FROM mirror_results WHERE app_name = ? ORDER BY id DESC LIMIT 1`, appName)
+	if err := row.Scan(&candidateDeploymentID); err != nil {
+		if err == sql.ErrNoRows {
+			return "", ErrMirrorNotFound
+		}
+		return "", fmt.Errorf("failed to get latest mirror candidate: %w", err)
+	}
+	return candidateDeploymentID, nil
+}
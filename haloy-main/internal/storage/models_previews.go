@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrPreviewNotFound is returned when an app has no deployment waiting for promotion.
+var ErrPreviewNotFound = errors.New("no deployment waiting for promotion")
+
+// Preview tracks a deployment started with --no-promote. It is served on a preview hostname
+// while the app's domains keep pointing at the live deployment. There is at most one preview per app.
+type Preview struct {
+	AppName             string    `db:"app_name" json:"appName"`
+	LiveDeploymentID    string    `db:"live_deployment_id" json:"liveDeploymentId"`
+	PreviewDeploymentID string    `db:"preview_deployment_id" json:"previewDeploymentId"`
+	CreatedAt           time.Time `db:"created_at" json:"createdAt"`
+}
+
+// SavePreview creates or replaces the preview for an app.
+func (db *DB) SavePreview(preview Preview) error {
+	if preview.CreatedAt.IsZero() {
+		preview.CreatedAt = time.Now().UTC()
+	}
+	query := `INSERT INTO previews (app_name, live_deployment_id, preview_deployment_id, created_at)
+              VALUES (?, ?, ?, ?)
+              ON CONFLICT(app_name) DO UPDATE SET
+                  live_deployment_id = excluded.live_deployment_id,
+                  preview_deployment_id = excluded.preview_deployment_id,
+                  created_at = excluded.created_at`
+	_, err := db.Exec(query, preview.AppName, preview.LiveDeploymentID, preview.PreviewDeploymentID, preview.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save preview: %w", err)
+	}
+	return nil
+}
+
+func (db *DB) GetPreview(appName string) (Preview, error) {
+	var preview Preview
+	query := `SELECT app_name, live_deployment_id, preview_deployment_id, created_at
+              FROM previews WHERE app_name = ?`
+
+	row := db.QueryRow(query, appName)
+	err := row.Scan(&preview.AppName, &preview.LiveDeploymentID, &preview.PreviewDeploymentID, &preview.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return preview, ErrPreviewNotFound
+		}
+		return preview, fmt.Errorf("failed to get preview: %w", err)
+	}
+
+	return preview, nil
+}
+
+// ListPreviews returns all deployments waiting for promotion, keyed by app name.
+func (db *DB) ListPreviews() (map[string]Preview, error) {
+	previews := make(map[string]Preview)
+	query := `SELECT app_name, live_deployment_id, preview_deployment_id, created_at FROM previews`
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query previews: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var preview Preview
+		if err := rows.Scan(&preview.AppName, &preview.LiveDeploymentID, &preview.PreviewDeploymentID, &preview.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan preview: %w", err)
+		}
+		previews[preview.AppName] = preview
+	}
+
+	return previews, rows.Err()
+}
+
+func (db *DB) DeletePreview(appName string) error {
+	_, err := db.Exec(`DELETE FROM previews WHERE app_name = ?`, appName)
+	if err != nil {
+		return fmt.Errorf("failed to delete preview: %w", err)
+	}
+	return nil
+}
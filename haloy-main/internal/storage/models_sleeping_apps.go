@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+)
+
+// SleepingApp is an app whose containers were stopped after being idle for longer than its
+// idle timeout. Its domains point at the waker until a request comes in and the containers
+// of the deployment are started again.
+type SleepingApp struct {
+	AppName      string    `db:"app_name" json:"appName"`
+	DeploymentID string    `db:"deployment_id" json:"deploymentId"`
+	SleptAt      time.Time `db:"slept_at" json:"sleptAt"`
+}
+
+// SaveSleepingApp creates or replaces the sleeping deployment for an app.
+func (db *DB) SaveSleepingApp(app SleepingApp) error {
+	if app.SleptAt.IsZero() {
+		app.SleptAt = time.Now().UTC()
+	}
+	query := `INSERT INTO sleeping_apps (app_name, deployment_id, slept_at)
+              VALUES (?, ?, ?)
+              ON CONFLICT(app_name) DO UPDATE SET
+                  deployment_id = excluded.deployment_id,
+                  slept_at = excluded.slept_at`
+	_, err := db.Exec(query, app.AppName, app.DeploymentID, app.SleptAt)
+	if err != nil {
+		return fmt.Errorf("failed to save sleeping app: %w", err)
+	}
+	return nil
+}
+
+// ListSleepingApps returns all sleeping apps, keyed by app name.
+func (db *DB) ListSleepingApps() (map[string]SleepingApp, error) {
+	apps := make(map[string]SleepingApp)
+	query := `SELECT app_name, deployment_id, slept_at FROM sleeping_apps`
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sleeping apps: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var app SleepingApp
+		if err := rows.Scan(&app.AppName, &app.DeploymentID, &app.SleptAt); err != nil {
+			return nil, fmt.Errorf("failed to scan sleeping app: %w", err)
+		}
+		apps[app.AppName] = app
+	}
+
+	return apps, rows.Err()
+}
+
+func (db *DB) DeleteSleepingApp(appName string) error {
+	_, err := db.Exec(`DELETE FROM sleeping_apps WHERE app_name = ?`, appName)
+	if err != nil {
+		return fmt.Errorf("failed to delete sleeping app: %w", err)
+	}
+	return nil
+}
@@ -14,6 +14,7 @@ const driverName = "sqlite"
 
 type DB struct {
 	*sql.DB
+	path string
 }
 
 func New() (*DB, error) {
@@ -44,5 +45,5 @@ func New() (*DB, error) {
 		return nil, fmt.Errorf("failed to set cache size: %w", err)
 	}
 
-	return &DB{database}, nil
+	return &DB{DB: database, path: dbFile}, nil
 }